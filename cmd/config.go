@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/plugfox/foxy-gram-server/internal/federation"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/scheduler"
+)
+
+// runConfig checks the configuration: `config validate`.
+// The configuration is loaded before every command, so only the values and the schedules of the jobs are checked here.
+func runConfig(args []string) error {
+	if len(args) != 1 || args[0] != "validate" {
+		return fmt.Errorf("%w: config expects validate", errorInvalidCommand)
+	}
+
+	problems := []error{global.Config.Validate()}
+
+	schedules := global.Config.Scheduler.Schedules
+	for _, name := range slices.Sorted(maps.Keys(schedules)) {
+		if _, err := scheduler.Parse(schedules[name]); err != nil {
+			problems = append(problems, fmt.Errorf("job %s: %w", name, err))
+		}
+	}
+
+	if err := errors.Join(problems...); err != nil {
+		return err
+	}
+
+	fmt.Println("config is valid") //nolint:forbidigo
+
+	return nil
+}
+
+// runCaptcha writes a sample captcha image with the configured size and length:
+// `captcha preview [--output file]`.
+func runCaptcha(args []string) error {
+	flags := flag.NewFlagSet("captcha preview", flag.ContinueOnError)
+	output := flags.String("output", "captcha.png", "output PNG file")
+
+	args, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) != 1 || args[0] != "preview" {
+		return fmt.Errorf("%w: captcha expects preview", errorInvalidCommand)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	captcha, err := model.GenerateCaptcha(file)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("captcha %s written to %s\n", captcha.Digits, *output) //nolint:forbidigo
+
+	return nil
+}
+
+// runFederation generates the key pair of the ban feed: `federation keygen`.
+// The private key is set as FEDERATION_PRIVATE_KEY, the public key is shared with the peers.
+func runFederation(args []string) error {
+	if len(args) != 1 || args[0] != "keygen" {
+		return fmt.Errorf("%w: federation expects keygen", errorInvalidCommand)
+	}
+
+	private, public, err := federation.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("private key: %s\npublic key:  %s\n", private, public) //nolint:forbidigo
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/importer"
+	storage "github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// runPurge applies the retention policies once: `purge`.
+func runPurge([]string) error {
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	result, err := storage.Purge(context.Background(), db, &global.Config.Retention)
+
+	fmt.Printf("purged %d messages, removed %d soft-deleted rows\n", result.Messages, result.Deleted) //nolint:forbidigo
+
+	return err
+}
+
+// runImportExport imports the chat history exported by Telegram Desktop:
+// `import-export <result.json> [--verify] [--batch size]`.
+// The import is resumed from the last checkpoint, if it was interrupted.
+func runImportExport(args []string) error {
+	var options importer.Options
+
+	flags := flag.NewFlagSet("import-export", flag.ContinueOnError)
+	flags.BoolVar(&options.Verify, "verify", false, "verify the authors of the messages")
+	flags.IntVar(&options.BatchSize, "batch", 1000, "messages between the checkpoints") //nolint:mnd
+
+	args, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) != 1 {
+		return fmt.Errorf("%w: import-export expects the path to result.json", errorInvalidCommand)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	// Interruption stores the checkpoint, so the import can be resumed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	options.Progress = func(progress importer.Progress) {
+		fmt.Printf("chat %d: %5.1f%% imported %d, skipped %d, verified %d, last message %d\n", //nolint:forbidigo
+			progress.ChatID, progress.Percent(), progress.Messages, progress.Skipped, progress.Verified, progress.Checkpoint)
+	}
+
+	_, err = importer.ImportFile(ctx, db, args[0], options)
+
+	return err
+}
+
+// runBackup writes the backup of the database: `backup [--output file]`.
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("output", "", "output file, foxy-gram-<time>.ndjson.gz by default")
+
+	if _, err := parseArgs(flags, args); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		*output = fmt.Sprintf("foxy-gram-%s.ndjson.gz", time.Now().UTC().Format("20060102-150405"))
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	stats, err := db.Backup(context.Background(), file)
+	if err != nil {
+		return err
+	}
+
+	printBackupStats("backup "+*output, stats)
+
+	return file.Sync()
+}
+
+// runRestore restores the backup into the configured database: `restore <file>`.
+// The migrations are applied first, so the backup of another driver or an older schema can be restored.
+func runRestore(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: restore expects the backup file", errorInvalidCommand)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	stats, err := db.Restore(context.Background(), file)
+	printBackupStats("restore "+args[0], stats)
+
+	return err
+}
+
+// printBackupStats prints the number of the rows per table.
+func printBackupStats(title string, stats storage.BackupStats) {
+	tables := make([]string, 0, len(stats))
+	for table, count := range stats {
+		tables = append(tables, fmt.Sprintf("%s=%d", table, count))
+	}
+
+	sort.Strings(tables)
+
+	fmt.Printf("%s: %s\n", title, strings.Join(tables, " ")) //nolint:forbidigo
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/federation"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/scheduler"
+	storage "github.com/plugfox/foxy-gram-server/internal/storage"
+	"github.com/plugfox/foxy-gram-server/internal/telegram"
+)
+
+// initScheduler registers the background jobs, the schedules from the config replace the default ones.
+// The disabled jobs, e.g. with the zero interval, are not registered.
+func initScheduler(db storage.Repository, tg *telegram.Telegram, httpClient *http.Client) (*scheduler.Scheduler, error) {
+	cfg := global.Config
+
+	instance := cfg.Scheduler.Instance
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+
+	jobs := scheduler.New(db, instance, cfg.Scheduler.Lease)
+	registered := make(map[string]bool)
+
+	register := func(job scheduler.Job) error {
+		if spec, ok := cfg.Scheduler.Schedules[job.Name]; ok {
+			schedule, err := scheduler.Parse(spec)
+			if err != nil {
+				return fmt.Errorf("job %s: %w", job.Name, err)
+			}
+
+			job.Schedule = schedule
+		}
+
+		registered[job.Name] = true
+
+		return jobs.Register(job)
+	}
+
+	if err := register(scheduler.Job{
+		Name:        "captcha_cleanup",
+		Description: "Delete the outdated captchas and decline their join requests",
+		Schedule:    scheduler.Every(cfg.Captcha.Expiration / 10), //nolint:mnd
+		Run: func(ctx context.Context) error {
+			return cleanupCaptchas(ctx, db, tg)
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := register(scheduler.Job{
+		Name:        "announcements",
+		Description: "Post the due announcements to the chats",
+		Schedule:    scheduler.Every(time.Minute),
+		Run: func(ctx context.Context) error {
+			sent, err := tg.SendAnnouncements(ctx)
+			if sent > 0 {
+				global.Logger.InfoContext(ctx, "announcements posted", slog.Int("sent", sent))
+			}
+
+			return err
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	if cfg.Telegram.BanSweepInterval > 0 {
+		if err := register(scheduler.Job{
+			Name:        "ban_sweep",
+			Description: "Unban the users in Telegram, whose bans are expired or lifted",
+			Schedule:    scheduler.Every(cfg.Telegram.BanSweepInterval),
+			Run: func(ctx context.Context) error {
+				return sweepBans(ctx, tg)
+			},
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := register(scheduler.Job{
+		Name:        "lockdown_end",
+		Description: "End the lockdowns of the chats, whose cooldown is over, and restore their permissions",
+		Schedule:    scheduler.Every(time.Minute),
+		Run: func(ctx context.Context) error {
+			ended, err := tg.EndLockdowns(ctx)
+			if ended > 0 {
+				global.Logger.InfoContext(ctx, "lockdowns ended", slog.Int("ended", ended))
+			}
+
+			return err
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	if cfg.Retention.Interval > 0 {
+		if err := register(scheduler.Job{
+			Name:        "retention_purge",
+			Description: "Apply the retention policies to the stored messages and remove the outdated soft-deleted rows",
+			Schedule:    scheduler.Every(cfg.Retention.Interval),
+			Run: func(ctx context.Context) error {
+				return purgeMessages(ctx, db)
+			},
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if peers := cfg.Federation.Peers; len(peers) > 0 {
+		subscriber, err := federation.NewSubscriber(db, httpClient, peers)
+		if err != nil {
+			return nil, fmt.Errorf("federation setup error: %w", err)
+		}
+
+		if err := register(scheduler.Job{
+			Name:        "federation_pull",
+			Description: "Pull the ban feeds of the peers and merge them into the banned list",
+			Schedule:    scheduler.Every(cfg.Federation.Interval),
+			Run: func(ctx context.Context) error {
+				subscriber.PullAll(ctx)
+
+				return nil
+			},
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for name := range cfg.Scheduler.Schedules {
+		if !registered[name] {
+			global.Logger.Warn("scheduler: schedule of the unknown or disabled job is ignored", slog.String("job", name))
+		}
+	}
+
+	return jobs, nil
+}
+
+// cleanupCaptchas deletes the outdated captchas, declines their join requests and records the expiry.
+func cleanupCaptchas(ctx context.Context, db storage.Repository, tg *telegram.Telegram) error {
+	var errs []error
+
+	for _, captcha := range db.GetOutdatedCaptchas() {
+		if err := db.DeleteCaptchaByID(captcha.ID); err != nil {
+			global.Logger.ErrorContext(ctx, "database: deleting outdated captcha error", slog.String("error", err.Error()), slog.Int64("id", captcha.ID))
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if err := db.RecordModerationEvent(model.NewModerationEvent(model.ModerationEventCaptchaExpired, captcha.ModeratedChatID(), captcha.UserID, "")); err != nil {
+			global.Logger.ErrorContext(ctx, "database: recording expired captcha error", slog.String("error", err.Error()), slog.Int64("id", captcha.ID))
+		}
+
+		if err := tg.DeclineJoinRequests(&captcha, "captcha_expired"); err != nil {
+			global.Logger.ErrorContext(ctx, "telegram: declining join request error", slog.String("error", err.Error()), slog.Int64("id", captcha.ID))
+		}
+
+		if err := tg.DeleteMessage(captcha.ChatID, captcha.MessageID); err != nil {
+			global.Logger.ErrorContext(ctx, "telegram: deleting outdated captcha error", slog.String("error", err.Error()), slog.Int64("id", captcha.ID))
+			errs = append(errs, err)
+
+			continue
+		}
+
+		global.Logger.InfoContext(ctx, "outdated captcha deleted", slog.Int64("id", captcha.ID))
+	}
+
+	return errors.Join(errs...)
+}
+
+// purgeMessages applies the retention policies to the stored messages
+// and removes the outdated soft-deleted rows.
+func purgeMessages(ctx context.Context, db storage.Repository) error {
+	result, err := storage.Purge(ctx, db, &global.Config.Retention)
+	if result.Messages > 0 || result.Deleted > 0 {
+		global.Logger.InfoContext(ctx, "stored messages purged",
+			slog.Int64("messages", result.Messages), slog.Int64("deleted", result.Deleted))
+
+		global.Metrics.LogEvent("messages_purged", nil, map[string]any{
+			"messages": result.Messages,
+			"deleted":  result.Deleted,
+		})
+	}
+
+	return err
+}
+
+// sweepBans unbans the users in Telegram, whose bans are expired or lifted, and removes the expired bans.
+func sweepBans(ctx context.Context, tg *telegram.Telegram) error {
+	result, err := tg.SweepBans(ctx)
+	if result.Expired > 0 || result.Unbanned > 0 || result.Failed > 0 {
+		global.Logger.InfoContext(ctx, "bans swept", slog.Int("expired", result.Expired),
+			slog.Int("unbanned", result.Unbanned), slog.Int("failed", result.Failed))
+	}
+
+	return err
+}
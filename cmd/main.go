@@ -3,36 +3,65 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	logByDefault "log"
 	"log/slog"
 	"net/http"
 	"os"
-	"os/signal"
-	"sync"
-	"syscall"
 	"time"
 
 	config "github.com/plugfox/foxy-gram-server/internal/config"
-	"github.com/plugfox/foxy-gram-server/internal/err"
 	"github.com/plugfox/foxy-gram-server/internal/global"
-	"github.com/plugfox/foxy-gram-server/internal/httpclient"
 	log "github.com/plugfox/foxy-gram-server/internal/log"
 	"github.com/plugfox/foxy-gram-server/internal/metrics"
-	"github.com/plugfox/foxy-gram-server/internal/model"
-	"github.com/plugfox/foxy-gram-server/internal/server"
-	storage "github.com/plugfox/foxy-gram-server/internal/storage"
-	"github.com/plugfox/foxy-gram-server/internal/telegram"
-
-	// This controls the maxprocs environment variable in container runtimes.
-	// see https://martin.baillie.id/wrote/gotchas-in-the-go-network-packages-defaults/#bonus-gomaxprocs-containers-and-the-cfs
-	"go.uber.org/automaxprocs/maxprocs"
 )
 
+var errorInvalidCommand = errors.New("invalid command")
+
+// command - the subcommand of the CLI, e.g. `service migrate up`.
+type command struct {
+	name  string
+	usage string // Arguments and flags
+	help  string
+	run   func(args []string) error
+}
+
+// commands - the subcommands in the order of the usage.
+func commands(metricsHandler http.Handler) []command {
+	return []command{
+		{"serve", "", "run the bot and the API server, the default", func([]string) error { return runServe(metricsHandler) }},
+		{"migrate", "up | down [steps] | status", "apply, revert or show the database migrations", runMigrate},
+		{"verify", "<id | file>... [--reason text]", "verify the users, the files list the IDs separated by spaces or lines", runVerify},
+		{"ban", "<id>... [--reason text] [--for duration]", "ban the users, forever unless the duration is set", runBan},
+		{"unban", "<id>...", "remove the users from the banned list", runUnban},
+		{"forget", "<id>...", "remove the messages and the profile data of the users", runForget},
+		{"export", "verified | banned [--output file]", "write the IDs of the verified or banned users, one per line", runExport},
+		{"import-export", "<result.json> [--verify] [--batch size]", "import the chat history exported by Telegram Desktop", runImportExport},
+		{"backup", "[--output file]", "write the portable gzip NDJSON backup of the database", runBackup},
+		{"restore", "<file>", "restore the backup, the existing rows are updated", runRestore},
+		{"purge", "", "apply the retention policies once", runPurge},
+		{"config", "validate", "check the configuration", runConfig},
+		{"captcha", "preview [--output file]", "write a sample captcha image", runCaptcha},
+		{"federation", "keygen", "generate the key pair signing the ban feed", runFederation},
+	}
+}
+
 func main() {
 	// Set the local timezone to UTC
 	time.Local = time.UTC
 
+	name, args := "serve", []string{}
+	if len(os.Args) > 1 {
+		name, args = os.Args[1], os.Args[2:]
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		usage(commands(nil))
+
+		return
+	}
+
 	// Initialize the configuration
 	config, err := config.MustLoadConfig()
 	if err != nil {
@@ -47,252 +76,181 @@ func main() {
 	)
 
 	// Metrics configuration
-	if config.Metrics.IsValid() {
-		global.Metrics = metrics.NewMetricsImpl(
-			config.Metrics.URL,
-			config.Metrics.Token,
-			config.Metrics.Org,
-			config.Metrics.Bucket,
-			map[string]string{},
-		)
-	} else {
-		global.Metrics = metrics.NewMetricsFake()
-	}
-
-	global.Config = config
-	global.Logger = logger
+	var (
+		influx            metrics.Metrics
+		prometheus        metrics.Metrics
+		prometheusHandler http.Handler
+	)
 
-	// Run the server
-	if err := run(); err != nil {
-		logger.ErrorContext(context.Background(), "an error occurred", slog.String("error", err.Error()))
-		os.Exit(1)
+	buffered := initMetrics(&config.Metrics, logger, name == "serve")
+	if buffered != nil {
+		influx = buffered
 	}
 
-	os.Exit(0)
-}
-
-// waitExitSignal waits for the SIGINT or SIGTERM signal to shutdown the centrifuge node.
-// It creates a channel to receive signals and a channel to indicate when the shutdown is complete.
-// Then it notifies the channel for SIGINT and SIGTERM signals and starts a goroutine to wait for the signal.
-// Once the signal is received, it shuts down the centrifuge node and indicates that the shutdown is complete.
-func waitExitSignal(sigCh chan os.Signal, t *telegram.Telegram, s *server.Server /* n *centrifuge.Node */) {
-	wg := sync.WaitGroup{}
-
-	// Notify the channel for SIGINT and SIGTERM signals.
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-
-	const timeout = 10 * time.Second
-
-	// Start a goroutine to wait for the signal and handle graceful shutdown.
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-
-		// Wait for the signal.
-		<-sigCh
-
-		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-
-		defer cancel()
-
-		// _ = n.Shutdown(ctx)
-
-		_ = s.Shutdown(ctx)
-	}()
-
-	// Handle Telegram bot shutdown.
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-
-		// Wait for the signal.
-		<-sigCh
+	if config.Metrics.Prometheus {
+		prometheus, prometheusHandler = metrics.NewMetricsPrometheus(map[string]string{})
+	}
 
-		// Create a channel to indicate when the shutdown is complete.
-		done := make(chan struct{})
+	if buffered != nil {
+		go reportMetricsStats(buffered, prometheus, logger)
+	}
 
-		// Stop the Telegram bot
-		go func() {
-			defer close(done)
-			t.Stop()
-		}()
+	global.Metrics = metrics.NewMetricsFanOut(influx, prometheus)
+	global.Config = config
+	global.Logger = logger
 
-		// Ensure the shutdown happens within 10 seconds.
-		select {
-		case <-done: // Done
-		case <-time.After(timeout): // Timeout
+	// Run the command, the server flushes the metrics itself on shutdown
+	for _, cmd := range commands(prometheusHandler) {
+		if cmd.name != name {
+			continue
 		}
-	}()
 
-	// Wait for both goroutines to complete before exiting.
-	wg.Wait()
+		if name != "serve" {
+			defer global.Metrics.Close()
+		}
 
-	// Flush and close the metrics logger.
-	global.Metrics.Close()
-}
+		if err := cmd.run(args); err != nil && !errors.Is(err, flag.ErrHelp) {
+			logger.ErrorContext(context.Background(), "command error", slog.String("command", name), slog.String("error", err.Error()))
+			global.Metrics.Close()
+			os.Exit(1)
+		}
 
-// Starts the server and waits for the SIGINT or SIGTERM signal to shutdown the server.
-func run() error {
-	if global.Config == nil || global.Logger == nil {
-		return err.ErrorGlobalVariablesNotInitialized
+		return
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	fmt.Fprintf(os.Stderr, "%v: %s\n\n", errorInvalidCommand, name)
+	usage(commands(nil))
+	os.Exit(2) //nolint:mnd
+}
 
-	defer cancel()
+// usage prints the subcommands.
+func usage(commands []command) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [arguments]\n\nCommands:\n", os.Args[0])
 
-	// Set the maxprocs environment variable in container runtimes.
-	_, err := maxprocs.Set(maxprocs.Logger(func(s string, i ...interface{}) {
-		global.Logger.DebugContext(ctx, fmt.Sprintf(s, i...))
-	}))
-	if err != nil {
-		return fmt.Errorf("setting max procs: %w", err)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %-45s %s\n", cmd.name, cmd.usage, cmd.help)
 	}
+}
 
-	// Setup hash function
-	model.InitHashFunction()
-
-	// Setup database connection
-	db := initStorage()
+// parseArgs parses the flags placed both before and after the positional arguments,
+// e.g. `ban 123 --for 24h`, and returns the positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
 
-	// Create a http client
-	httpClient := initHTTPClient()
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
 
-	// Setup Telegram bot
-	tg := initTelegram(db, httpClient)
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
 
-	// Update the bot user information
-	if err := db.UpsertUser(tg.Me().Seen()); err != nil {
-		return fmt.Errorf("upserting user error: %w", err)
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
 	}
+}
 
-	// Setup API srv
-	srv := initServer(db, tg)
-
-	// TODO: Setup Centrifuge server
-
-	// TODO: Setup InfluxDB metrics (if any)
+// initMetrics creates the buffered metrics pipeline writing to InfluxDB,
+// with the local JSONL fallback replayed to InfluxDB in the background.
+// The fallback is owned by the server only, the other commands would seal and replay the file
+// the running server is appending to. Returns nil when neither InfluxDB nor the fallback is used.
+func initMetrics(cfg *config.MetricsConfig, logger *slog.Logger, serve bool) *metrics.MetricsBuffered {
+	var primary, fallback metrics.Sink
 
-	// Create a channel to shutdown the server.
-	sigCh := make(chan os.Signal, 1)
+	if cfg.IsValid() {
+		primary = metrics.NewInfluxSink(cfg.URL, cfg.Token, cfg.Org, cfg.Bucket, map[string]string{})
+	}
 
-	// Create a function to stop the server.
-	// Call this function when the server needs to be closed.
-	/* stop := func(sigCh chan os.Signal) func() {
-		return func() {
-			sigCh <- syscall.SIGTERM // Close server.
+	if serve && cfg.FallbackPath != "" {
+		sink, err := metrics.NewFileSink(cfg.FallbackPath, cfg.FallbackMaxSize)
+		if err != nil {
+			logger.Error("metrics fallback is disabled", slog.String("error", err.Error()))
+		} else {
+			fallback = sink
 		}
-	} */
-
-	// Track outdated captchas
-	go func() {
-		for {
-			select {
-			case <-time.After(global.Config.Captcha.Expiration / 10): //nolint:mnd
-				captchas := db.GetOutdatedCaptchas()
-				for _, captcha := range captchas {
-					if err := db.DeleteCaptchaByID(captcha.ID); err != nil {
-						global.Logger.ErrorContext(ctx, "database: deleting outdated captcha error", slog.String("error", err.Error()), slog.Int64("id", captcha.ID))
-						continue
-					}
-					if err := tg.DeleteMessage(captcha.ChatID, captcha.MessageID); err != nil {
-						global.Logger.ErrorContext(ctx, "telegram: deleting outdated captcha error", slog.String("error", err.Error()), slog.Int64("id", captcha.ID))
-						continue
-					}
-
-					global.Logger.InfoContext(ctx, "outdated captcha deleted", slog.Int64("id", captcha.ID))
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
-	// Log the server start
-	global.Logger.InfoContext(
-		ctx,
-		"Server started",
-		slog.String("host", global.Config.API.Host),
-		slog.Int("port", global.Config.API.Port),
-	)
-
-	global.Metrics.LogEvent("server_started", nil, map[string]interface{}{
-		"host": global.Config.API.Host,
-		"port": global.Config.API.Port,
-	})
-
-	// Wait for the SIGINT or SIGTERM signal to shutdown the server.
-	waitExitSignal(sigCh, tg, srv)
-	close(sigCh)
-
-	return nil
-}
+	}
 
-// initStorage initializes the database connection.
-func initStorage() *storage.Storage {
-	db, err := storage.New()
-	if err != nil {
-		panic(fmt.Sprintf("database connection error: %v", err))
+	if primary == nil && fallback == nil {
+		return nil
 	}
 
-	return db
-}
+	buffered := metrics.NewMetricsBuffered(primary, fallback, metrics.BufferedOptions{
+		QueueSize:     cfg.QueueSize,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: cfg.FlushInterval,
+		RetryAttempts: cfg.RetryAttempts,
+		RetryDelay:    cfg.RetryDelay,
+		OnError: func(err error) {
+			logger.Warn("metrics batch is lost", slog.String("error", err.Error()))
+		},
+	})
 
-// Create a new HTTP client
-func initHTTPClient() *http.Client {
-	httpClient, err := httpclient.NewHTTPClient(&global.Config.Proxy)
-	if err != nil {
-		panic(fmt.Sprintf("http client error: %v", err))
+	if primary != nil && fallback != nil {
+		go replayMetrics(cfg, logger, fallback)
 	}
 
-	return httpClient
+	return buffered
 }
 
-// Initialize the Telegram bot
-func initTelegram(db *storage.Storage, httpClient *http.Client) *telegram.Telegram {
-	tg, err := telegram.New(db, httpClient)
-	if err != nil {
-		panic(fmt.Sprintf("telegram bot setup error: %v", err))
-	}
+// replayMetrics periodically writes the events stored in the fallback directory to InfluxDB,
+// the active fallback file is sealed first, so its events are not delayed until the rotation.
+func replayMetrics(cfg *config.MetricsConfig, logger *slog.Logger, fallback metrics.Sink) {
+	const interval = 5 * time.Minute
 
-	// Start the Telegram bot polling
-	go func() {
-		tg.Start()
-	}()
+	sink := metrics.NewInfluxSink(cfg.URL, cfg.Token, cfg.Org, cfg.Bucket, map[string]string{})
+	defer sink.Close()
 
-	return tg
-}
+	for {
+		if rotator, ok := fallback.(metrics.Rotator); ok {
+			if err := rotator.Rotate(); err != nil {
+				logger.Warn("metrics fallback rotation failed", slog.String("error", err.Error()))
+			}
+		}
 
-// Initialize the API server
-func initServer(db *storage.Storage, tg *telegram.Telegram) *server.Server {
-	srv := server.New()
+		count, err := metrics.Replay(context.Background(), cfg.FallbackPath, sink, cfg.BatchSize)
+		if count > 0 {
+			logger.Info("metrics replayed from fallback", slog.Int("count", count))
+		}
 
-	srv.AddHealthCheck(
-		func() (bool, map[string]string) {
-			dbStatus, dbErr := db.Status()
-			srvStatus, srvErr := srv.Status()
-			tgStatus, tgErr := tg.Status()
+		if err != nil {
+			logger.Warn("metrics replay failed", slog.String("error", err.Error()))
+		}
 
-			isHealthy := dbErr == nil && srvErr == nil && tgErr == nil
+		time.Sleep(interval)
+	}
+}
 
-			return isHealthy, map[string]string{
-				"database": dbStatus,
-				"server":   srvStatus,
-				"telegram": tgStatus,
+// reportMetricsStats periodically exposes the counters of the buffered metrics pipeline as the Prometheus gauges,
+// when Prometheus is enabled, and warns about the events dropped or lost since the previous report.
+func reportMetricsStats(buffered *metrics.MetricsBuffered, prometheus metrics.Metrics, logger *slog.Logger) {
+	const interval = time.Minute
+
+	var previous metrics.BufferedStats
+
+	for range time.Tick(interval) {
+		stats := buffered.Stats()
+
+		if prometheus != nil {
+			for counter, value := range map[string]int64{
+				"queued":   stats.Queued,
+				"dropped":  stats.Dropped,
+				"written":  stats.Written,
+				"fallback": stats.Fallback,
+				"lost":     stats.Lost,
+			} {
+				prometheus.SetGauge(metrics.GaugeBufferedStats, float64(value), map[string]string{"counter": counter})
 			}
-		},
-	) // Add health check endpoint
-	srv.AddVerifyUsers(db) // Add verify users endpoint [POST] /admin/verify
-
-	// Start the server
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			global.Logger.Error("Server error", slog.String("error", err.Error()))
-			os.Exit(1) // Exit the program if the server fails to start.
 		}
-	}()
 
-	return srv
+		if stats.Dropped > previous.Dropped || stats.Lost > previous.Lost {
+			logger.Warn("metrics events are dropped",
+				slog.Int64("dropped", stats.Dropped-previous.Dropped),
+				slog.Int64("lost", stats.Lost-previous.Lost),
+				slog.Int64("queued", stats.Queued),
+			)
+		}
+
+		previous = stats
+	}
 }
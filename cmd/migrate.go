@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	storage "github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// runMigrate applies, reverts or shows the database migrations:
+// `migrate up`, `migrate down [steps]` and `migrate status`.
+func runMigrate(args []string) error {
+	db, err := storage.Open()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %d %s\n", migration.Version, migration.Name) //nolint:forbidigo
+		}
+
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("%w: steps must be a positive integer", errorInvalidCommand)
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d %s\n", migration.Version, migration.Name) //nolint:forbidigo
+		}
+
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Printf("%4d  %-40s  %s\n", status.Version, status.Name, appliedAt) //nolint:forbidigo
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: migrate %s, expected up, down or status", errorInvalidCommand, command)
+	}
+}
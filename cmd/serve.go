@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/err"
+	"github.com/plugfox/foxy-gram-server/internal/federation"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/httpclient"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/scheduler"
+	"github.com/plugfox/foxy-gram-server/internal/server"
+	storage "github.com/plugfox/foxy-gram-server/internal/storage"
+	"github.com/plugfox/foxy-gram-server/internal/storage/memory"
+	"github.com/plugfox/foxy-gram-server/internal/telegram"
+	"github.com/plugfox/foxy-gram-server/internal/tracing"
+
+	// This controls the maxprocs environment variable in container runtimes.
+	// see https://martin.baillie.id/wrote/gotchas-in-the-go-network-packages-defaults/#bonus-gomaxprocs-containers-and-the-cfs
+	"go.uber.org/automaxprocs/maxprocs"
+)
+
+// runServe starts the bot and the API server and waits for the SIGINT or SIGTERM signal to shutdown them: `serve`.
+// The metrics handler is exposed at /metrics, if any.
+func runServe(metricsHandler http.Handler) error {
+	if global.Config == nil || global.Logger == nil {
+		return err.ErrorGlobalVariablesNotInitialized
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	// Set the maxprocs environment variable in container runtimes.
+	_, err := maxprocs.Set(maxprocs.Logger(func(s string, i ...interface{}) {
+		global.Logger.DebugContext(ctx, fmt.Sprintf(s, i...))
+	}))
+	if err != nil {
+		return fmt.Errorf("setting max procs: %w", err)
+	}
+
+	// Setup tracing
+	shutdownTracing := initTracing()
+
+	defer func() {
+		const timeout = 10 * time.Second
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			global.Logger.ErrorContext(ctx, "tracing shutdown error", slog.String("error", err.Error()))
+		}
+	}()
+
+	// Setup hash function
+	model.InitHashFunction()
+
+	// Setup database connection
+	db := initStorage()
+
+	// Create a http client
+	httpClient := initHTTPClient()
+
+	// Setup Telegram bot
+	tg := initTelegram(db, httpClient)
+
+	// Update the bot user information
+	if err := db.UpsertUser(tg.Me().Seen()); err != nil {
+		return fmt.Errorf("upserting user error: %w", err)
+	}
+
+	// Setup the background jobs
+	jobs, err := initScheduler(db, tg, httpClient)
+	if err != nil {
+		return fmt.Errorf("scheduler setup error: %w", err)
+	}
+
+	// Setup API srv
+	srv := initServer(db, tg, jobs, metricsHandler)
+
+	// TODO: Setup Centrifuge server
+
+	// Create a channel to shutdown the server.
+	sigCh := make(chan os.Signal, 1)
+
+	// Create a function to stop the server.
+	// Call this function when the server needs to be closed.
+	/* stop := func(sigCh chan os.Signal) func() {
+		return func() {
+			sigCh <- syscall.SIGTERM // Close server.
+		}
+	} */
+
+	// Run the background jobs
+	jobs.Start(ctx)
+
+	// Log the server start
+	global.Logger.InfoContext(
+		ctx,
+		"Server started",
+		slog.String("host", global.Config.API.Host),
+		slog.Int("port", global.Config.API.Port),
+	)
+
+	global.Metrics.LogEvent("server_started", nil, map[string]interface{}{
+		"host": global.Config.API.Host,
+		"port": global.Config.API.Port,
+	})
+
+	// Wait for the SIGINT or SIGTERM signal to shutdown the server.
+	waitExitSignal(sigCh, tg, srv)
+	close(sigCh)
+
+	return nil
+}
+
+// waitExitSignal waits for the SIGINT or SIGTERM signal to shutdown the centrifuge node.
+// It creates a channel to receive signals and a channel to indicate when the shutdown is complete.
+// Then it notifies the channel for SIGINT and SIGTERM signals and starts a goroutine to wait for the signal.
+// Once the signal is received, it shuts down the centrifuge node and indicates that the shutdown is complete.
+func waitExitSignal(sigCh chan os.Signal, t *telegram.Telegram, s *server.Server /* n *centrifuge.Node */) {
+	wg := sync.WaitGroup{}
+
+	// Notify the channel for SIGINT and SIGTERM signals.
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	const timeout = 10 * time.Second
+
+	// Start a goroutine to wait for the signal and handle graceful shutdown.
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		// Wait for the signal.
+		<-sigCh
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+		defer cancel()
+
+		// _ = n.Shutdown(ctx)
+
+		_ = s.Shutdown(ctx)
+	}()
+
+	// Handle Telegram bot shutdown.
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		// Wait for the signal.
+		<-sigCh
+
+		// Create a channel to indicate when the shutdown is complete.
+		done := make(chan struct{})
+
+		// Stop the Telegram bot
+		go func() {
+			defer close(done)
+			t.Stop()
+		}()
+
+		// Ensure the shutdown happens within 10 seconds.
+		select {
+		case <-done: // Done
+		case <-time.After(timeout): // Timeout
+		}
+	}()
+
+	// Wait for both goroutines to complete before exiting.
+	wg.Wait()
+
+	// Flush and close the metrics logger.
+	global.Metrics.Close()
+}
+
+// initTracing initializes the OpenTelemetry tracing.
+func initTracing() tracing.Shutdown {
+	shutdown, err := tracing.New(&global.Config.Tracing)
+	if err != nil {
+		panic(fmt.Sprintf("tracing setup error: %v", err))
+	}
+
+	return shutdown
+}
+
+// initStorage initializes the database connection,
+// or the in-memory storage for the ephemeral deployments.
+func initStorage() storage.Repository {
+	if strings.EqualFold(global.Config.Database.Driver, "memory") {
+		global.Logger.Warn("in-memory storage is used, the data is lost on restart")
+
+		return memory.New()
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		panic(fmt.Sprintf("database connection error: %v", err))
+	}
+
+	return db
+}
+
+// Create a new HTTP client
+func initHTTPClient() *http.Client {
+	httpClient, err := httpclient.NewHTTPClient(&global.Config.Proxy)
+	if err != nil {
+		panic(fmt.Sprintf("http client error: %v", err))
+	}
+
+	return httpClient
+}
+
+// Initialize the Telegram bot
+func initTelegram(db storage.Repository, httpClient *http.Client) *telegram.Telegram {
+	tg, err := telegram.New(db, httpClient)
+	if err != nil {
+		panic(fmt.Sprintf("telegram bot setup error: %v", err))
+	}
+
+	// Start the Telegram bot polling
+	go func() {
+		tg.Start()
+	}()
+
+	return tg
+}
+
+// Initialize the API server
+func initServer(db storage.Repository, tg *telegram.Telegram, jobs *scheduler.Scheduler, metricsHandler http.Handler) *server.Server {
+	srv := server.New()
+
+	srv.AddHealthCheck(
+		func() (bool, map[string]string) {
+			dbStatus, dbErr := db.Status()
+			srvStatus, srvErr := srv.Status()
+			tgStatus, tgErr := tg.Status()
+
+			isHealthy := dbErr == nil && srvErr == nil && tgErr == nil
+
+			return isHealthy, map[string]string{
+				"database": dbStatus,
+				"server":   srvStatus,
+				"telegram": tgStatus,
+			}
+		},
+	) // Add health check endpoint
+	srv.AddVerifyUsers(db)      // Add verify users endpoint [POST] /admin/verify
+	srv.AddStats(db)            // Add statistics endpoints [GET] /admin/stats/*
+	srv.AddForgetUser(db)       // Add forget user endpoint [DELETE] /admin/users/{id}
+	srv.AddMessageRevisions(db) // Add message revisions endpoint [GET] /admin/chats/{chat_id}/messages/{id}/revisions
+	srv.AddUserChats(db)        // Add user chats endpoint [GET] /admin/users/{id}/chats
+	srv.AddInviteLinks(db, tg)  // Add invite links endpoints /admin/chats/{chat_id}/invite-links
+	srv.AddBanExpiries(db)      // Add upcoming ban expiries endpoint [GET] /admin/bans/expiring
+	srv.AddJobs(jobs)           // Add background jobs endpoints /admin/jobs
+	srv.AddAnnouncements(db)    // Add announcements endpoints /admin/announcements
+
+	if backuper, ok := db.(server.Backuper); ok {
+		srv.AddBackup(backuper) // Add backup endpoint [GET] /admin/backup
+	}
+
+	if cfg := global.Config.Federation; cfg.PrivateKey != "" {
+		key, err := federation.ParsePrivateKey(cfg.PrivateKey)
+		if err != nil {
+			panic(fmt.Sprintf("federation key error: %v", err))
+		}
+
+		srv.AddBanFeed(db, cfg.Name, key) // Add ban feed endpoint [GET] /federation/bans
+	}
+
+	if peers := global.Config.Federation.Peers; len(peers) > 0 {
+		names := make([]string, 0, len(peers))
+		for _, peer := range peers {
+			names = append(names, peer.Name)
+		}
+
+		srv.AddBanSources(db, names) // Add ban sources endpoints /admin/federation/sources
+	}
+
+	srv.AddMetrics(metricsHandler) // Add metrics endpoint [GET] /metrics, the health check without the handler
+
+	// Start the server
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			global.Logger.Error("Server error", slog.String("error", err.Error()))
+			os.Exit(1) // Exit the program if the server fails to start.
+		}
+	}()
+
+	return srv
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	storage "github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// runVerify verifies the users: `verify <id | file>... [--reason text]`.
+// The arguments, which are not numbers, are the files with the IDs, e.g. the ids.txt.
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	reason := flags.String("reason", "Verified from the command line", "reason of the verification")
+
+	args, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	var userIDs []model.UserID
+
+	for _, arg := range args {
+		ids, err := parseUserIDs(arg)
+		if err != nil {
+			return err
+		}
+
+		userIDs = append(userIDs, ids...)
+	}
+
+	if len(userIDs) == 0 {
+		return fmt.Errorf("%w: verify expects at least one user ID or file", errorInvalidCommand)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	ids := make([]int, 0, len(userIDs))
+	for _, userID := range userIDs {
+		ids = append(ids, int(userID))
+	}
+
+	if err := db.VerifyUsers(*reason, ids); err != nil {
+		return err
+	}
+
+	fmt.Printf("verified %d users\n", len(ids)) //nolint:forbidigo
+
+	return nil
+}
+
+// runBan bans the users: `ban <id>... [--reason text] [--for duration]`.
+// The ban is checked by the running bot on the next message of the user.
+func runBan(args []string) error {
+	flags := flag.NewFlagSet("ban", flag.ContinueOnError)
+	reason := flags.String("reason", "Banned from the command line", "reason of the ban")
+	duration := flags.Duration("for", 0, "duration of the ban, e.g. 24h, forever if 0")
+
+	args, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	userIDs, err := userIDsFromArgs("ban", args)
+	if err != nil {
+		return err
+	}
+
+	if *duration < 0 {
+		return fmt.Errorf("%w: ban duration must not be negative", errorInvalidCommand)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	now := time.Now()
+
+	for _, userID := range userIDs {
+		ban := &model.BannedUser{ID: userID, BannedAt: now, Reason: *reason}
+		if *duration > 0 {
+			ban.ExpiresAt.Time, ban.ExpiresAt.Valid = now.Add(*duration), true
+		}
+
+		if err := db.BanUser(ban); err != nil {
+			return err
+		}
+
+		fmt.Printf("banned %d\n", userID) //nolint:forbidigo
+	}
+
+	return nil
+}
+
+// runUnban removes the users from the banned list: `unban <id>...`.
+func runUnban(args []string) error {
+	userIDs, err := userIDsFromArgs("unban", args)
+	if err != nil {
+		return err
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	for _, userID := range userIDs {
+		if err := db.UnbanUser(userID); err != nil {
+			return err
+		}
+
+		fmt.Printf("unbanned %d\n", userID) //nolint:forbidigo
+	}
+
+	return nil
+}
+
+// runForget removes the messages and the profile data of the users: `forget <user_id>...`.
+func runForget(args []string) error {
+	userIDs, err := userIDsFromArgs("forget", args)
+	if err != nil {
+		return err
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	for _, userID := range userIDs {
+		removed, err := db.ForgetUser(userID)
+		if err != nil {
+			return err
+		}
+
+		tables := make([]string, 0, len(removed))
+		for table, count := range removed {
+			tables = append(tables, fmt.Sprintf("%s=%d", table, count))
+		}
+
+		sort.Strings(tables)
+
+		fmt.Printf("forgot %d: %s\n", userID, strings.Join(tables, " ")) //nolint:forbidigo
+	}
+
+	return nil
+}
+
+// runExport writes the IDs of the verified or banned users, one per line,
+// so they can be verified in another deployment: `export verified | banned [--output file]`.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("output", "", "output file, the standard output by default")
+
+	args, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) != 1 || (args[0] != "verified" && args[0] != "banned") {
+		return fmt.Errorf("%w: export expects verified or banned", errorInvalidCommand)
+	}
+
+	db, err := storage.New()
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	var userIDs []model.UserID
+
+	if args[0] == "verified" {
+		users, err := db.VerifiedUsers()
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			userIDs = append(userIDs, user.ID)
+		}
+	} else {
+		users, err := db.BannedUsers()
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			userIDs = append(userIDs, user.ID)
+		}
+	}
+
+	var writer io.Writer = os.Stdout
+
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		writer = file
+	}
+
+	buffered := bufio.NewWriter(writer)
+	for _, userID := range userIDs {
+		fmt.Fprintln(buffered, userID.ToString())
+	}
+
+	return buffered.Flush()
+}
+
+// userIDsFromArgs parses the user IDs of the command, at least one is required.
+func userIDsFromArgs(command string, args []string) ([]model.UserID, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%w: %s expects at least one user ID", errorInvalidCommand, command)
+	}
+
+	userIDs := make([]model.UserID, 0, len(args))
+
+	for _, arg := range args {
+		userID, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || userID < 1 {
+			return nil, fmt.Errorf("%w: user ID %q must be a positive integer", errorInvalidCommand, arg)
+		}
+
+		userIDs = append(userIDs, model.UserID(userID))
+	}
+
+	return userIDs, nil
+}
+
+// parseUserIDs parses the user ID, or reads the IDs from the file,
+// separated by spaces, commas or lines.
+func parseUserIDs(arg string) ([]model.UserID, error) {
+	if _, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return userIDsFromArgs("verify", []string{arg})
+	}
+
+	raw, err := os.ReadFile(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.FieldsFunc(string(raw), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+
+	return userIDsFromArgs("verify", fields)
+}
@@ -1,14 +1,24 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"html/template"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
-var errorFailedToReadConfig = fmt.Errorf("failed to read config")
+var (
+	errorFailedToReadConfig = fmt.Errorf("failed to read config")
+	errorInvalidConfig      = errors.New("invalid config")
+)
 
 // Config is the main config struct.
 type Config struct {
@@ -16,12 +26,19 @@ type Config struct {
 	Secret      string `env:"SECRET"      env-default:""           env-description:"Secret key for JWT token signing and validation"      yaml:"secret"`
 	Verbose     string `env:"VERBOSE"     env-default:"warn"       env-description:"Verbose mode for output: debug | info | warn | error" yaml:"verbose"`
 
-	Proxy    ProxyConfig    `env-description:"Proxy SOCKS5 server config" yaml:"proxy"`
-	Metrics  MetricsConfig  `yaml:"metrics"`
-	Telegram TelegramConfig `yaml:"telegram"`
-	Captcha  CaptchaConfig  `yaml:"captcha"`
-	API      APIConfig      `yaml:"api"`
-	Database DatabaseConfig `yaml:"database"`
+	Proxy      ProxyConfig      `env-description:"Proxy SOCKS5 server config" yaml:"proxy"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Telegram   TelegramConfig   `yaml:"telegram"`
+	Captcha    CaptchaConfig    `yaml:"captcha"`
+	API        APIConfig        `yaml:"api"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Retention  RetentionConfig  `yaml:"retention"`
+	Welcome    WelcomeConfig    `yaml:"welcome"`
+	Federation FederationConfig `yaml:"federation"`
+	Scheduler  SchedulerConfig  `yaml:"scheduler"`
+	Raid       RaidConfig       `yaml:"raid"`
+	Profile    ProfileConfig    `yaml:"profile"`
 }
 
 // Proxy SOCKS5 server config.
@@ -34,10 +51,19 @@ type ProxyConfig struct {
 
 // Metrics config.
 type MetricsConfig struct {
-	URL    string `env:"METRICS_URL"    env-description:"Metrics URL"    yaml:"url"`
-	Token  string `env:"METRICS_TOKEN"  env-description:"Metrics token"  yaml:"token"`
-	Org    string `env:"METRICS_ORG"    env-description:"Metrics org"    yaml:"org"`
-	Bucket string `env:"METRICS_BUCKET" env-description:"Metrics bucket" yaml:"bucket"`
+	URL        string `env:"METRICS_URL"        env-description:"Metrics URL"    yaml:"url"`
+	Token      string `env:"METRICS_TOKEN"      env-description:"Metrics token"  yaml:"token"`
+	Org        string `env:"METRICS_ORG"        env-description:"Metrics org"    yaml:"org"`
+	Bucket     string `env:"METRICS_BUCKET"     env-description:"Metrics bucket" yaml:"bucket"`
+	Prometheus bool   `env:"METRICS_PROMETHEUS" env-default:"false"              env-description:"Expose Prometheus metrics at /metrics" yaml:"prometheus"`
+
+	QueueSize       int           `env:"METRICS_QUEUE_SIZE"        env-default:"10000"    env-description:"Maximum number of queued metrics events, new events are dropped when full" yaml:"queue_size"`
+	BatchSize       int           `env:"METRICS_BATCH_SIZE"        env-default:"500"      env-description:"Maximum number of metrics events written in one batch"                     yaml:"batch_size"`
+	FlushInterval   time.Duration `env:"METRICS_FLUSH_INTERVAL"    env-default:"1s"       env-description:"Maximum time a metrics event waits in the batch"                           yaml:"flush_interval"`
+	RetryAttempts   int           `env:"METRICS_RETRY_ATTEMPTS"    env-default:"3"        env-description:"Number of attempts to write a batch to InfluxDB"                           yaml:"retry_attempts"`
+	RetryDelay      time.Duration `env:"METRICS_RETRY_DELAY"       env-default:"1s"       env-description:"Delay before the first retry, doubled after every attempt"                 yaml:"retry_delay"`
+	FallbackPath    string        `env:"METRICS_FALLBACK_PATH"     env-default:""         env-description:"Directory of the local JSONL fallback, empty to disable"                   yaml:"fallback_path"`
+	FallbackMaxSize int64         `env:"METRICS_FALLBACK_MAX_SIZE" env-default:"10485760" env-description:"Size in bytes at which the fallback file is rotated"                       yaml:"fallback_max_size"`
 }
 
 // IsValid - check if the metrics config is valid.
@@ -45,6 +71,21 @@ func (config *MetricsConfig) IsValid() bool {
 	return config != nil && config.URL != "" && config.Token != "" && config.Org != "" && config.Bucket != ""
 }
 
+// Tracing config for OpenTelemetry.
+type TracingConfig struct {
+	Exporter    string  `env:"TRACING_EXPORTER"     env-default:"none"         env-description:"Trace exporter: none | otlp | stdout | file"            yaml:"exporter"`
+	Endpoint    string  `env:"TRACING_ENDPOINT"     env-default:""             env-description:"OTLP/HTTP endpoint, e.g. localhost:4318"                yaml:"endpoint"`
+	Insecure    bool    `env:"TRACING_INSECURE"     env-default:"false"        env-description:"Use plain HTTP for the OTLP exporter"                   yaml:"insecure"`
+	File        string  `env:"TRACING_FILE"         env-default:"traces.json"  env-description:"Output file for the file exporter"                      yaml:"file"`
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" env-default:"1"            env-description:"Fraction of traces to sample, from 0 to 1"              yaml:"sample_ratio"`
+	ServiceName string  `env:"TRACING_SERVICE_NAME" env-default:"foxy-gram"    env-description:"Service name reported with the spans"                   yaml:"service_name"`
+}
+
+// IsEnabled - check if the tracing is enabled.
+func (config *TracingConfig) IsEnabled() bool {
+	return config != nil && config.Exporter != "" && config.Exporter != "none"
+}
+
 // Telegram config.
 type TelegramConfig struct {
 	Token     string        `env:"TELEGRAM_TOKEN"      env-description:"Telegram bot token"          env-required:"true"                               yaml:"token"`
@@ -54,6 +95,16 @@ type TelegramConfig struct {
 	Whitelist []int64       `env:"TELEGRAM_WHITELIST"  env-description:"Telegram bot whitelist"      yaml:"whitelist"`
 	Blacklist []int64       `env:"TELEGRAM_BLACKLIST"  env-description:"Telegram bot blacklist"      yaml:"blacklist"`
 	IgnoreVia bool          `env:"TELEGRAM_IGNORE_VIA" env-default:"false"                           env-description:"Ignore messages from other bots" yaml:"ignore_via"`
+
+	RecheckEdits     bool          `env:"TELEGRAM_RECHECK_EDITS"      env-default:"false" env-description:"Verify the sender again, when an edit adds links to the message"      yaml:"recheck_edits"`
+	JoinLeaveWindow  time.Duration `env:"TELEGRAM_JOIN_LEAVE_WINDOW"  env-default:"5m"    env-description:"Report the users who leave the chat within this time after the join, 0 to disable" yaml:"join_leave_window"`
+	BanSweepInterval time.Duration `env:"TELEGRAM_BAN_SWEEP_INTERVAL" env-default:"1m"    env-description:"Interval between the unbans of the users, whose bans are expired or lifted, 0 to disable" yaml:"ban_sweep_interval"`
+
+	QueueGlobalRate float64       `env:"TELEGRAM_QUEUE_GLOBAL_RATE" env-default:"30" env-description:"Requests per second sent to the Telegram Bot API, 0 to disable the limit"          yaml:"queue_global_rate"`
+	QueueChatRate   float64       `env:"TELEGRAM_QUEUE_CHAT_RATE"   env-default:"20" env-description:"Messages per minute sent to a chat, 0 to disable the limit"                        yaml:"queue_chat_rate"`
+	QueueWorkers    int           `env:"TELEGRAM_QUEUE_WORKERS"     env-default:"8"  env-description:"Requests to the Telegram Bot API sent at the same time"                           yaml:"queue_workers"`
+	QueueRetries    int           `env:"TELEGRAM_QUEUE_RETRIES"     env-default:"3"  env-description:"Attempts after 429 Too Many Requests, before the request fails"                   yaml:"queue_retries"`
+	QueueMaxWait    time.Duration `env:"TELEGRAM_QUEUE_MAX_WAIT"    env-default:"2m" env-description:"Time a request may wait in the queue, before it fails"                            yaml:"queue_max_wait"`
 }
 
 // Captcha config.
@@ -62,6 +113,9 @@ type CaptchaConfig struct {
 	Width      int           `env:"CAPTCHA_WIDTH"      env-default:"480" env-description:"Captcha image width"     yaml:"width"`
 	Height     int           `env:"CAPTCHA_HEIGHT"     env-default:"180" env-description:"Captcha image height"    yaml:"height"`
 	Expiration time.Duration `env:"CAPTCHA_EXPIRATION" env-default:"10m" env-description:"Captcha expiration time" yaml:"expiration"`
+
+	JoinRequests bool `env:"CAPTCHA_JOIN_REQUESTS" env-default:"true" env-description:"Send the captcha in the private chat to the users requesting to join, then approve or decline the request" yaml:"join_requests"`
+	MaxAttempts  int  `env:"CAPTCHA_MAX_ATTEMPTS"  env-default:"3"    env-description:"Wrong inputs before the join request is declined"                                                  yaml:"max_attempts"`
 }
 
 // API config.
@@ -76,9 +130,79 @@ type APIConfig struct {
 
 // SQLite / PostgreSQL / MySQL config for GORM dialector.
 type DatabaseConfig struct {
-	Driver     string `env:"DATABASE_DRIVER"     env-default:"sqlite3"    env-description:"Database driver to use: sqlite3 | postgres | mysql" yaml:"driver"`
-	Connection string `env:"DATABASE_CONNECTION" env-default:"db.sqlite3" env-description:"Connection string or path for SQLite database"      yaml:"connection"`
-	Logging    bool   `env:"DATABASE_LOGGING"    env-default:"false"      env-description:"Enable database logging"                            yaml:"logging"`
+	Driver      string `env:"DATABASE_DRIVER"       env-default:"sqlite3"    env-description:"Database driver to use: sqlite3 | postgres | mysql | memory"      yaml:"driver"`
+	Connection  string `env:"DATABASE_CONNECTION"   env-default:"db.sqlite3" env-description:"Connection string or path for SQLite database"                    yaml:"connection"`
+	Logging     bool   `env:"DATABASE_LOGGING"      env-default:"false"      env-description:"Enable database logging"                                          yaml:"logging"`
+	QueryValues bool   `env:"DATABASE_QUERY_VALUES" env-default:"false"      env-description:"Log and trace queries with the bound values, exposes user data"   yaml:"query_values"`
+	AutoMigrate bool   `env:"DATABASE_AUTO_MIGRATE" env-default:"true"       env-description:"Apply the pending migrations on start, disable for multi-replica" yaml:"auto_migrate"`
+}
+
+// Retention config of the stored messages.
+type RetentionConfig struct {
+	Interval      time.Duration `env:"RETENTION_INTERVAL"        env-default:"1h"    env-description:"Interval between the purges of the stored messages"                yaml:"interval"`
+	BatchSize     int           `env:"RETENTION_BATCH_SIZE"      env-default:"1000"  env-description:"Maximum number of rows deleted or updated in one transaction"    yaml:"batch_size"`
+	BatchPause    time.Duration `env:"RETENTION_BATCH_PAUSE"     env-default:"100ms" env-description:"Pause between the batches, so the purge does not hold the database" yaml:"batch_pause"`
+	DeletedMaxAge time.Duration `env:"RETENTION_DELETED_MAX_AGE" env-default:"720h"  env-description:"Soft-deleted users, chats and messages are removed after, 0 to keep" yaml:"deleted_max_age"`
+
+	Default RetentionPolicy           `yaml:"default"`
+	Chats   map[int64]RetentionPolicy `env-description:"Per chat policies, replace the default policy" yaml:"chats"`
+}
+
+// Retention policy of the messages of a chat.
+type RetentionPolicy struct {
+	MaxAge       time.Duration `env:"RETENTION_MAX_AGE"       env-default:"0"     env-description:"Messages older than this are deleted, 0 to keep forever"  yaml:"max_age"`
+	MaxRows      int           `env:"RETENTION_MAX_ROWS"      env-default:"0"     env-description:"Maximum number of messages kept per chat, 0 for unlimited" yaml:"max_rows"`
+	MetadataOnly bool          `env:"RETENTION_METADATA_ONLY" env-default:"false" env-description:"Do not keep the text of the messages, only the metadata"   yaml:"metadata_only"`
+}
+
+// PolicyFor - the retention policy of the chat, the default one if the chat has none.
+func (config *RetentionConfig) PolicyFor(chatID int64) RetentionPolicy {
+	if policy, ok := config.Chats[chatID]; ok {
+		return policy
+	}
+
+	return config.Default
+}
+
+// IsEnabled - check if the policy removes or erases anything.
+func (policy RetentionPolicy) IsEnabled() bool {
+	return policy.MaxAge > 0 || policy.MaxRows > 0 || policy.MetadataOnly
+}
+
+// Welcome config of the messages posted after the user passes the captcha.
+type WelcomeConfig struct {
+	Default WelcomeMessage           `yaml:"default"`
+	Chats   map[int64]WelcomeMessage `env-description:"Per chat welcome messages, replace the default message" yaml:"chats"`
+}
+
+// Welcome message of a chat.
+// The text is a Go template with the variables: .Name, .Username, .Mention, .UserID, .ChatTitle and .RulesLink.
+type WelcomeMessage struct {
+	Text        string          `env:"WELCOME_TEXT"         env-default:""   env-description:"Template of the welcome message in HTML, empty to disable"      yaml:"text"`
+	Photo       string          `env:"WELCOME_PHOTO"        env-default:""   env-description:"Optional photo of the welcome message, a file ID or an URL"     yaml:"photo"`
+	RulesLink   string          `env:"WELCOME_RULES_LINK"   env-default:""   env-description:"Link to the rules of the chat, the .RulesLink variable"         yaml:"rules_link"`
+	DeleteAfter time.Duration   `env:"WELCOME_DELETE_AFTER" env-default:"5m" env-description:"The welcome message is deleted after, 0 to keep it until the next one" yaml:"delete_after"`
+	Buttons     []WelcomeButton `yaml:"buttons"`
+}
+
+// Welcome button with the link, one button per row.
+type WelcomeButton struct {
+	Text string `yaml:"text"`
+	URL  string `yaml:"url"`
+}
+
+// MessageFor - the welcome message of the chat, the default one if the chat has none.
+func (config *WelcomeConfig) MessageFor(chatID int64) WelcomeMessage {
+	if message, ok := config.Chats[chatID]; ok {
+		return message
+	}
+
+	return config.Default
+}
+
+// IsEnabled - check if the welcome message is posted.
+func (message WelcomeMessage) IsEnabled() bool {
+	return message.Text != ""
 }
 
 // MustLoadConfig - load config from file or environment variables.
@@ -103,8 +227,144 @@ func MustLoadConfig() (*Config, error) {
 
 	// Check if there was an error reading the config file
 	if err != nil {
-		return nil, errorFailedToReadConfig
+		return nil, fmt.Errorf("%w: %w", errorFailedToReadConfig, err)
 	}
 
 	return &config, nil
 }
+
+// Federation config of the ban lists shared between the instances.
+type FederationConfig struct {
+	Name       string           `env:"FEDERATION_NAME"        env-default:""    env-description:"Name of this instance in the published ban feed"                                yaml:"name"`
+	PrivateKey string           `env:"FEDERATION_PRIVATE_KEY" env-default:""    env-description:"Base64 ed25519 private key signing the published ban feed, empty to not publish" yaml:"private_key"`
+	Interval   time.Duration    `env:"FEDERATION_INTERVAL"    env-default:"15m" env-description:"Interval between the pulls of the ban feeds of the peers"                         yaml:"interval"`
+	Peers      []FederationPeer `env-description:"Peers whose ban feeds are merged into the banned list" yaml:"peers"`
+}
+
+// Scheduler config of the background jobs.
+type SchedulerConfig struct {
+	Instance  string            `env:"SCHEDULER_INSTANCE"  env-default:""    env-description:"Name of this replica in the locks of the jobs, the hostname by default"                      yaml:"instance"`
+	Lease     time.Duration     `env:"SCHEDULER_LEASE"     env-default:"10m" env-description:"Lock of a running job expires after, so the job is run again if the replica is gone" yaml:"lease"`
+	Schedules map[string]string `env:"SCHEDULER_SCHEDULES" env-separator:";" env-description:"Schedules replacing the defaults of the jobs, e.g. retention_purge:0 3 * * *;ban_sweep:@every 5m" yaml:"schedules"`
+}
+
+// Raid config, the lockdown of the chat when many users join within the window.
+type RaidConfig struct {
+	Joins    int           `env:"RAID_JOINS"    env-default:"10"  env-description:"Joins to a chat within the window, which start the lockdown, 0 to disable the detection" yaml:"joins"`
+	Window   time.Duration `env:"RAID_WINDOW"   env-default:"30s" env-description:"Sliding window of the joins"                                                             yaml:"window"`
+	Cooldown time.Duration `env:"RAID_COOLDOWN" env-default:"15m" env-description:"Lockdown ends after this time, unless the raid goes on"                                  yaml:"cooldown"`
+
+	CaptchaLength     int           `env:"RAID_CAPTCHA_LENGTH"     env-default:"8"  env-description:"Captcha length in the lockdown and for the suspicious profiles"          yaml:"captcha_length"`
+	CaptchaExpiration time.Duration `env:"RAID_CAPTCHA_EXPIRATION" env-default:"3m" env-description:"Captcha expiration time in the lockdown and for the suspicious profiles" yaml:"captcha_expiration"`
+}
+
+// Profile config, the score of the profile of the joining user decides the verification.
+type ProfileConfig struct {
+	Enabled    bool `env:"PROFILE_ENABLED"     env-default:"false" env-description:"Score the profiles of the joining users"                            yaml:"enabled"`
+	TrustBelow int  `env:"PROFILE_TRUST_BELOW" env-default:"10"    env-description:"Users scoring below are verified without the captcha, 0 to disable" yaml:"trust_below"`
+	StrictFrom int  `env:"PROFILE_STRICT_FROM" env-default:"40"    env-description:"Users scoring from get the stricter captcha, 0 to disable"          yaml:"strict_from"`
+	BanFrom    int  `env:"PROFILE_BAN_FROM"    env-default:"90"    env-description:"Users scoring from are banned without the captcha, 0 to disable"    yaml:"ban_from"`
+
+	Languages  []string `env:"PROFILE_LANGUAGES"   env-description:"Suspicious language codes of the users, e.g. zh,hi"                                      yaml:"languages"`
+	RecentID   int64    `env:"PROFILE_RECENT_ID"   env-default:"8000000000" env-description:"User IDs from are registered recently, 0 to disable" yaml:"recent_id"`
+	EmojiCount int      `env:"PROFILE_EMOJI_COUNT" env-default:"3"          env-description:"Emoji in the name, which make it suspicious"         yaml:"emoji_count"`
+
+	Weights ProfileWeights `yaml:"weights"`
+}
+
+// Weights of the traits of the suspicious profiles, summed up to the score.
+type ProfileWeights struct {
+	NoUsername int `env:"PROFILE_WEIGHT_NO_USERNAME"  env-default:"10" env-description:"Weight of the profile without the username"       yaml:"no_username"`
+	NoPhoto    int `env:"PROFILE_WEIGHT_NO_PHOTO"     env-default:"20" env-description:"Weight of the profile without the photos"         yaml:"no_photo"`
+	LinkInName int `env:"PROFILE_WEIGHT_LINK_IN_NAME" env-default:"40" env-description:"Weight of the link or the mention in the name"    yaml:"link_in_name"`
+	EmojiName  int `env:"PROFILE_WEIGHT_EMOJI_NAME"   env-default:"15" env-description:"Weight of the name with many emoji or only emoji" yaml:"emoji_name"`
+	Language   int `env:"PROFILE_WEIGHT_LANGUAGE"     env-default:"15" env-description:"Weight of the suspicious language code"           yaml:"language"`
+	RecentID   int `env:"PROFILE_WEIGHT_RECENT_ID"    env-default:"15" env-description:"Weight of the recently registered user"           yaml:"recent_id"`
+}
+
+// Peer publishing the ban feed.
+type FederationPeer struct {
+	Name      string `yaml:"name"`       // Source of the imported bans, unique
+	URL       string `yaml:"url"`        // URL of the feed, e.g. https://example.com/federation/bans
+	PublicKey string `yaml:"public_key"` // Base64 ed25519 public key of the peer
+	Trust     int    `yaml:"trust"`      // From 1 to 100, the bans of a more trusted peer replace the others
+}
+
+// Validate - check the values, which are read successfully but can not be used, e.g. an unknown driver.
+// Every problem is reported, not only the first one.
+func (config *Config) Validate() error {
+	var problems []error
+
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Errorf("%w: "+format, append([]any{errorInvalidConfig}, args...)...))
+		}
+	}
+
+	oneOf := func(value string, allowed ...string) bool {
+		return slices.Contains(allowed, strings.ToLower(value))
+	}
+
+	check(oneOf(config.Verbose, "debug", "info", "warn", "error"), "verbose %q, expected debug, info, warn or error", config.Verbose)
+	check(config.Telegram.Token != "", "telegram token is required")
+	check(config.Telegram.Timeout > 0, "telegram timeout must be positive")
+	check(config.Telegram.QueueGlobalRate >= 0 && config.Telegram.QueueChatRate >= 0, "telegram queue rates must not be negative")
+	check(config.Telegram.QueueWorkers > 0, "telegram queue workers must be positive")
+	check(config.Telegram.QueueRetries >= 0, "telegram queue retries must not be negative")
+	check(config.Telegram.QueueMaxWait > 0, "telegram queue max wait must be positive")
+	check(config.Captcha.Length > 0, "captcha length must be positive")
+	check(config.Captcha.Width > 0 && config.Captcha.Height > 0, "captcha image size must be positive")
+	check(config.Captcha.Expiration > 0, "captcha expiration must be positive")
+	check(config.Captcha.MaxAttempts >= 0, "captcha max attempts must not be negative")
+	check(config.API.Port > 0 && config.API.Port < 1<<16, "api port %d is out of range", config.API.Port)
+	check(oneOf(config.Database.Driver, "sqlite3", "sqlite", "postgres", "mysql", "mariadb", "tidb", "memory"),
+		"database driver %q is not supported", config.Database.Driver)
+	check(oneOf(config.Tracing.Exporter, "", "none", "otlp", "stdout", "file"), "tracing exporter %q is not supported", config.Tracing.Exporter)
+	check(config.Tracing.SampleRatio >= 0 && config.Tracing.SampleRatio <= 1, "tracing sample ratio must be from 0 to 1")
+	check(config.Retention.BatchSize > 0, "retention batch size must be positive")
+
+	checkWelcome := func(name string, message WelcomeMessage) {
+		if _, err := template.New("welcome").Parse(message.Text); err != nil {
+			check(false, "welcome message of the %s: %v", name, err)
+		}
+
+		for _, button := range message.Buttons {
+			check(button.Text != "" && button.URL != "", "welcome button of the %s must have the text and the url", name)
+		}
+	}
+
+	checkWelcome("default", config.Welcome.Default)
+
+	for _, chatID := range slices.Sorted(maps.Keys(config.Welcome.Chats)) {
+		checkWelcome(fmt.Sprintf("chat %d", chatID), config.Welcome.Chats[chatID])
+	}
+
+	if config.Federation.PrivateKey != "" {
+		key, err := base64.StdEncoding.DecodeString(config.Federation.PrivateKey)
+		check(err == nil && (len(key) == ed25519.SeedSize || len(key) == ed25519.PrivateKeySize), "federation private key must be a base64 ed25519 key")
+	}
+
+	peers := make(map[string]bool, len(config.Federation.Peers))
+
+	for _, peer := range config.Federation.Peers {
+		key, err := base64.StdEncoding.DecodeString(peer.PublicKey)
+		check(peer.Name != "" && !peers[peer.Name], "federation peer name %q must be unique and not empty", peer.Name)
+		check(strings.HasPrefix(peer.URL, "https://") || strings.HasPrefix(peer.URL, "http://"), "federation peer %q url must be http or https", peer.Name)
+		check(err == nil && len(key) == ed25519.PublicKeySize, "federation peer %q public key must be a base64 ed25519 key", peer.Name)
+		check(peer.Trust >= 1 && peer.Trust <= 100, "federation peer %q trust must be from 1 to 100", peer.Name)
+
+		peers[peer.Name] = true
+	}
+
+	check(len(config.Federation.Peers) == 0 || config.Federation.Interval > 0, "federation interval must be positive")
+	check(config.Scheduler.Lease > 0, "scheduler lease must be positive")
+	check(config.Raid.Joins >= 0, "raid joins must not be negative")
+	check(config.Raid.Joins == 0 || config.Raid.Window > 0, "raid window must be positive")
+	check(config.Raid.Cooldown > 0, "raid cooldown must be positive")
+	check(config.Raid.CaptchaLength > 0 && config.Raid.CaptchaExpiration > 0, "raid captcha length and expiration must be positive")
+	check(config.Profile.TrustBelow >= 0 && config.Profile.StrictFrom >= 0 && config.Profile.BanFrom >= 0, "profile thresholds must not be negative")
+	check(config.Profile.StrictFrom == 0 || config.Profile.StrictFrom >= config.Profile.TrustBelow, "profile strict threshold must not be below the trust one")
+	check(config.Profile.BanFrom == 0 || config.Profile.BanFrom >= max(config.Profile.StrictFrom, config.Profile.TrustBelow), "profile ban threshold must not be below the others")
+
+	return errors.Join(problems...)
+}
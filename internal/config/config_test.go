@@ -61,3 +61,21 @@ func TestConfigTelegramEnv(t *testing.T) {
 	require.Equal(t, expected.Telegram.Blacklist, actual.Telegram.Blacklist)
 	require.Equal(t, expected.Telegram.IgnoreVia, actual.Telegram.IgnoreVia)
 }
+
+func TestConfigValidate(t *testing.T) {
+	setEnvVars(t, map[string]string{"TELEGRAM_TOKEN": "123"})
+
+	valid, err := config.MustLoadConfig()
+	require.NoError(t, err)
+	require.NoError(t, valid.Validate(), "defaults must be valid")
+
+	invalid := *valid
+	invalid.Database.Driver = "oracle"
+	invalid.Captcha.Length = 0
+	invalid.Welcome.Default.Text = "Hello, {{ .Name"
+
+	err = invalid.Validate()
+	require.ErrorContains(t, err, `database driver "oracle" is not supported`)
+	require.ErrorContains(t, err, "captcha length must be positive")
+	require.ErrorContains(t, err, "welcome message of the default")
+}
@@ -2,6 +2,7 @@ package converters
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/plugfox/foxy-gram-server/internal/model"
@@ -34,11 +35,22 @@ func MessageFromTG(m *tele.Message) *model.Message {
 		LastEdit:    lastEdit,
 		Caption:     m.Caption,
 		AlbumID:     m.AlbumID,
-		IsForwarded: m.OriginalSender != nil,
+		IsForwarded: m.OriginalSender != nil || m.OriginalChat != nil || m.OriginalSenderName != "" || m.Origin != nil,
 		Sender:      UserFromTG(m.Sender),
 		Chat:        ChatFromTG(m.Chat),
+
+		Entities:        entitiesToJSON(m.Entities),
+		CaptionEntities: entitiesToJSON(m.CaptionEntities),
+	}
+
+	// If the message is sent via an inline bot
+	if m.Via != nil {
+		msg.ViaBotID = model.UserID(m.Via.ID)
 	}
 
+	// If the message has a media
+	msg.MediaType, msg.FileID, msg.FileUniqueID, msg.FileSize = mediaFromTG(m)
+
 	// If the message is a reply
 	if m.ReplyTo != nil {
 		msg.ReplyToID = model.MessageID(m.ReplyTo.ID)
@@ -48,31 +60,155 @@ func MessageFromTG(m *tele.Message) *model.Message {
 	return msg
 }
 
-// Convert telebot message to database message origin.
+// Convert telebot message to database message origin, nil if the message is not forwarded.
 func MessageOriginFromTG(m *tele.Message) *model.MessageOrigin {
-	if m.OriginalSender == nil && m.OriginalChat == nil {
-		// Если сообщение не переслано
+	if m == nil || (m.Origin == nil && m.OriginalSender == nil && m.OriginalChat == nil && m.OriginalSenderName == "") {
 		return nil
 	}
 
 	origin := &model.MessageOrigin{
-		OriginalText: m.Text,
-		MessageID:    model.MessageID(m.ID),
+		MessageID:         model.MessageID(m.ID),
+		OriginalText:      m.Text,
+		SenderName:        m.OriginalSenderName,
+		OriginalMessageID: int64(m.OriginalMessageID),
+		Signature:         m.OriginalSignature,
+		OriginalUnixtime:  int64(m.OriginalUnixtime),
 	}
 
-	// Если переслано от пользователя
+	if origin.OriginalText == "" {
+		origin.OriginalText = m.Caption
+	}
+
+	// Forwarded from a user
 	if m.OriginalSender != nil {
 		origin.OriginalSenderID = model.UserID(m.OriginalSender.ID)
 	}
 
-	// Если переслано из чата
+	// Forwarded from a chat
 	if m.OriginalChat != nil {
 		origin.OriginalChatID = model.ChatID(m.OriginalChat.ID)
 	}
 
+	// The forward origin of the newer Bot API versions takes precedence
+	if o := m.Origin; o != nil {
+		origin.Type = o.Type
+		origin.OriginalUnixtime = o.DateUnixtime
+
+		if o.Sender != nil {
+			origin.OriginalSenderID = model.UserID(o.Sender.ID)
+		}
+
+		if o.SenderUsername != "" {
+			origin.SenderName = o.SenderUsername
+		}
+
+		if o.SenderChat != nil {
+			origin.OriginalChatID = model.ChatID(o.SenderChat.ID)
+		}
+
+		if o.Chat != nil {
+			origin.OriginalChatID = model.ChatID(o.Chat.ID)
+		}
+
+		if o.MessageID != 0 {
+			origin.OriginalMessageID = int64(o.MessageID)
+		}
+
+		if o.Signature != "" {
+			origin.Signature = o.Signature
+		}
+	}
+
+	if origin.Type == "" {
+		switch {
+		case m.OriginalSender != nil:
+			origin.Type = "user"
+		case m.OriginalChat != nil && m.OriginalChat.Type == tele.ChatChannel:
+			origin.Type = "channel"
+		case m.OriginalChat != nil:
+			origin.Type = "chat"
+		default:
+			origin.Type = "hidden_user"
+		}
+	}
+
 	return origin
 }
 
+// Convert the inline keyboard of the telebot message to database reply markup, nil if there is none.
+func ReplyMarkupFromTG(m *tele.Message) *model.ReplyMarkup {
+	if m == nil || m.ReplyMarkup == nil || len(m.ReplyMarkup.InlineKeyboard) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(m.ReplyMarkup.InlineKeyboard)
+	if err != nil {
+		return nil
+	}
+
+	return &model.ReplyMarkup{
+		MessageID: model.MessageID(m.ID),
+		Data:      string(data),
+	}
+}
+
+// Encode the entities to JSON, empty string if there are none.
+func entitiesToJSON(entities tele.Entities) string {
+	if len(entities) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(entities)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
+
+// Get the type and the file of the media of the message, if any.
+func mediaFromTG(m *tele.Message) (mediaType string, fileID string, fileUniqueID string, fileSize int64) {
+	var media tele.Media
+
+	// The animation is also sent as a document, so it goes first
+	switch {
+	case m.Animation != nil:
+		media = m.Animation
+	case m.Photo != nil:
+		media = m.Photo
+	case m.Video != nil:
+		media = m.Video
+	case m.VideoNote != nil:
+		media = m.VideoNote
+	case m.Voice != nil:
+		media = m.Voice
+	case m.Audio != nil:
+		media = m.Audio
+	case m.Sticker != nil:
+		media = m.Sticker
+	case m.Document != nil:
+		media = m.Document
+	case m.Contact != nil:
+		return "contact", "", "", 0
+	case m.Venue != nil:
+		return "venue", "", "", 0
+	case m.Location != nil:
+		return "location", "", "", 0
+	case m.Poll != nil:
+		return "poll", "", "", 0
+	case m.Dice != nil:
+		return "dice", "", "", 0
+	case m.Story != nil:
+		return "story", "", "", 0
+	default:
+		return "", "", "", 0
+	}
+
+	file := media.MediaFile()
+
+	return media.MediaType(), file.FileID, file.UniqueID, file.FileSize
+}
+
 // Convert telebot chat to database chat.
 func ChatFromTG(c *tele.Chat) *model.Chat {
 	if c == nil {
@@ -104,3 +240,28 @@ func UserFromTG(u *tele.User) *model.User {
 		IsBot:        u.IsBot,
 	}
 }
+
+// Convert telebot invite link of the chat to database invite link.
+func InviteLinkFromTG(chatID int64, l *tele.ChatInviteLink) *model.InviteLink {
+	if l == nil {
+		return nil
+	}
+
+	link := &model.InviteLink{
+		Link:        l.InviteLink,
+		ChatID:      model.ChatID(chatID),
+		Name:        l.Name,
+		MemberLimit: l.MemberLimit,
+		IsRevoked:   l.IsRevoked,
+	}
+
+	if l.Creator != nil {
+		link.CreatorID = model.UserID(l.Creator.ID)
+	}
+
+	if l.ExpireUnixtime > 0 {
+		link.ExpireAt = sql.NullTime{Time: time.Unix(l.ExpireUnixtime, 0).UTC(), Valid: true}
+	}
+
+	return link
+}
@@ -0,0 +1,77 @@
+package converters
+
+import (
+	"testing"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestMessageFromTG(t *testing.T) {
+	sender := &tele.User{ID: 1}
+	chat := &tele.Chat{ID: -100}
+
+	testcases := []struct {
+		Name         string
+		Message      *tele.Message
+		MediaType    string
+		FileUniqueID string
+		Entities     string
+		Origin       *model.MessageOrigin
+		ReplyMarkup  bool
+	}{
+		{
+			Name:     "Text with a link",
+			Message:  &tele.Message{ID: 1, Sender: sender, Chat: chat, Text: "see t.me", Entities: tele.Entities{{Type: tele.EntityURL, Offset: 4, Length: 4}}},
+			Entities: `[{"type":"url","offset":4,"length":4,"custom_emoji_id":""}]`,
+		},
+		{
+			Name: "Animation is not a document",
+			Message: &tele.Message{
+				ID: 2, Sender: sender, Chat: chat,
+				Animation: &tele.Animation{File: tele.File{FileID: "a", UniqueID: "ua", FileSize: 10}},
+				Document:  &tele.Document{File: tele.File{FileID: "a", UniqueID: "ua", FileSize: 10}},
+			},
+			MediaType:    "animation",
+			FileUniqueID: "ua",
+		},
+		{
+			Name: "Forward from a channel with a keyboard",
+			Message: &tele.Message{
+				ID: 3, Sender: sender, Chat: chat, Caption: "promo",
+				Photo:  &tele.Photo{File: tele.File{FileID: "p", UniqueID: "up"}},
+				Origin: &tele.MessageOrigin{Type: "channel", DateUnixtime: 100, Chat: &tele.Chat{ID: -200}, MessageID: 7},
+				ReplyMarkup: &tele.ReplyMarkup{InlineKeyboard: [][]tele.InlineButton{
+					{{Text: "Buy", URL: "https://example.com"}},
+				}},
+			},
+			MediaType:    "photo",
+			FileUniqueID: "up",
+			Origin: &model.MessageOrigin{
+				MessageID: 3, Type: "channel", OriginalChatID: -200, OriginalMessageID: 7,
+				OriginalUnixtime: 100, OriginalText: "promo",
+			},
+			ReplyMarkup: true,
+		},
+		{
+			Name:    "Forward from a hidden user",
+			Message: &tele.Message{ID: 4, Sender: sender, Chat: chat, Text: "hi", OriginalSenderName: "Fox", OriginalUnixtime: 50},
+			Origin: &model.MessageOrigin{
+				MessageID: 4, Type: "hidden_user", SenderName: "Fox", OriginalUnixtime: 50, OriginalText: "hi",
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			message := MessageFromTG(testcase.Message)
+			require.Equal(t, testcase.MediaType, message.MediaType)
+			require.Equal(t, testcase.FileUniqueID, message.FileUniqueID)
+			require.Equal(t, testcase.Entities, message.Entities)
+			require.Equal(t, testcase.Origin != nil, message.IsForwarded)
+			require.Equal(t, testcase.Origin, MessageOriginFromTG(testcase.Message))
+			require.Equal(t, testcase.ReplyMarkup, ReplyMarkupFromTG(testcase.Message) != nil)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignature(t *testing.T) {
+	private, public, err := GenerateKey()
+	require.NoError(t, err)
+
+	privateKey, err := ParsePrivateKey(private)
+	require.NoError(t, err)
+
+	publicKey, err := ParsePublicKey(public)
+	require.NoError(t, err)
+
+	signed, err := Sign(&Feed{Source: "foxes", Bans: []FeedEntry{{UserID: 1, Reason: "spam"}}}, privateKey)
+	require.NoError(t, err)
+
+	feed, err := Verify(signed, publicKey)
+	require.NoError(t, err)
+	require.Equal(t, "foxes", feed.Source)
+
+	signed.Feed = json.RawMessage(`{"source":"foxes","bans":[{"user_id":2,"reason":"spam"}]}`)
+	_, err = Verify(signed, publicKey)
+	require.ErrorIs(t, err, errorInvalidSignature)
+}
+
+func TestSubscriber(t *testing.T) {
+	global.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	global.Metrics = metrics.NewMetricsFake()
+
+	private, public, err := GenerateKey()
+	require.NoError(t, err)
+
+	key, err := ParsePrivateKey(private)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	feed := &Feed{Source: "partner", GeneratedAt: now, Bans: []FeedEntry{
+		{UserID: 1, Reason: "spam", BannedAt: now},
+		{UserID: 2, Reason: "spam", BannedAt: now},
+		{UserID: 3, Reason: "scam", BannedAt: now},
+	}}
+
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		signed, err := Sign(feed, key)
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(w).Encode(signed))
+	}))
+	defer peer.Close()
+
+	db := memory.New()
+	peers := []config.FederationPeer{
+		{Name: "partner", URL: peer.URL, PublicKey: public, Trust: 50},
+		{Name: "trusted", URL: peer.URL, PublicKey: public, Trust: 90},
+	}
+
+	// The local ban and the ban of a more trusted peer are kept
+	require.NoError(t, db.BanUser(&model.BannedUser{ID: 1, BannedAt: now, Reason: "local"}))
+	_, err = db.MergeBans("trusted", 90, []model.BannedUser{{ID: 2, BannedAt: now, Reason: "trusted"}})
+	require.NoError(t, err)
+
+	subscriber, err := NewSubscriber(db, peer.Client(), peers)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	result, err := subscriber.Pull(ctx, peers[0])
+	require.NoError(t, err)
+	require.Equal(t, int64(1), result.Added)
+	require.Equal(t, int64(2), result.Skipped)
+
+	bans, err := db.BannedUsers()
+	require.NoError(t, err)
+	require.Len(t, bans, 3)
+	require.True(t, bans[0].IsLocal())
+	require.Equal(t, "trusted", bans[1].Source)
+	require.Equal(t, "partner", bans[2].Source)
+	require.Equal(t, 50, bans[2].Trust)
+
+	t.Run("Lifted bans are removed", func(t *testing.T) {
+		feed.GeneratedAt, feed.Bans = now.Add(time.Minute), feed.Bans[:2]
+
+		result, err := subscriber.Pull(ctx, peers[0])
+		require.NoError(t, err)
+		require.Equal(t, int64(1), result.Removed)
+
+		banned, err := db.IsBannedUser(3)
+		require.NoError(t, err)
+		require.False(t, banned)
+	})
+
+	t.Run("Replayed feed is rejected", func(t *testing.T) {
+		feed.GeneratedAt = now
+
+		_, err := subscriber.Pull(ctx, peers[0])
+		require.ErrorIs(t, err, errorFeedReplay)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		removed, err := Revoke(db, "trusted")
+		require.NoError(t, err)
+		require.Equal(t, int64(1), removed)
+
+		paused, err := IsPaused(db, "trusted")
+		require.NoError(t, err)
+		require.True(t, paused)
+
+		require.NoError(t, Resume(db, "trusted"))
+
+		paused, err = IsPaused(db, "trusted")
+		require.NoError(t, err)
+		require.False(t, paused)
+	})
+}
@@ -0,0 +1,149 @@
+// Package federation shares the banned lists between the instances of the bot.
+// Every instance may publish the signed feed of its local bans and merge the feeds of its peers.
+package federation
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+)
+
+var (
+	errorInvalidKey       = errors.New("invalid ed25519 key")
+	errorInvalidSignature = errors.New("invalid feed signature")
+)
+
+// FeedEntry - the ban of the feed.
+type FeedEntry struct {
+	UserID    int64      `json:"user_id"`
+	Reason    string     `json:"reason"`
+	BannedAt  time.Time  `json:"banned_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Feed - the local bans of the instance.
+type Feed struct {
+	Source      string      `json:"source"` // Name of the publisher
+	GeneratedAt time.Time   `json:"generated_at"`
+	Bans        []FeedEntry `json:"bans"`
+}
+
+// SignedFeed - the feed with the ed25519 signature of its exact bytes.
+type SignedFeed struct {
+	Feed      json.RawMessage `json:"feed"`
+	Signature string          `json:"signature"` // Base64
+}
+
+// NewFeed - the feed of the local bans, the imported and the expired bans are not published.
+func NewFeed(source string, bans []model.BannedUser) *Feed {
+	now := time.Now().UTC()
+	feed := &Feed{Source: source, GeneratedAt: now, Bans: make([]FeedEntry, 0, len(bans))}
+
+	for _, ban := range bans {
+		if !ban.IsLocal() || (ban.ExpiresAt.Valid && ban.ExpiresAt.Time.Before(now)) {
+			continue
+		}
+
+		entry := FeedEntry{UserID: int64(ban.ID), Reason: ban.Reason, BannedAt: ban.BannedAt.UTC()}
+		if ban.ExpiresAt.Valid {
+			expiresAt := ban.ExpiresAt.Time.UTC()
+			entry.ExpiresAt = &expiresAt
+		}
+
+		feed.Bans = append(feed.Bans, entry)
+	}
+
+	return feed
+}
+
+// BannedUsers - the entries of the feed as the bans, the source is set on merge.
+func (feed *Feed) BannedUsers() []model.BannedUser {
+	bans := make([]model.BannedUser, 0, len(feed.Bans))
+
+	for _, entry := range feed.Bans {
+		if entry.UserID < 1 {
+			continue
+		}
+
+		ban := model.BannedUser{ID: model.UserID(entry.UserID), Reason: entry.Reason, BannedAt: entry.BannedAt}
+		if entry.ExpiresAt != nil {
+			ban.ExpiresAt = sql.NullTime{Time: *entry.ExpiresAt, Valid: true}
+		}
+
+		bans = append(bans, ban)
+	}
+
+	return bans
+}
+
+// Sign - encode and sign the feed.
+func Sign(feed *Feed, key ed25519.PrivateKey) (*SignedFeed, error) {
+	raw, err := json.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedFeed{
+		Feed:      raw,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, raw)),
+	}, nil
+}
+
+// Verify - check the signature and decode the feed.
+func Verify(signed *SignedFeed, key ed25519.PublicKey) (*Feed, error) {
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(key, signed.Feed, signature) {
+		return nil, errorInvalidSignature
+	}
+
+	var feed Feed
+	if err := json.Unmarshal(signed.Feed, &feed); err != nil {
+		return nil, err
+	}
+
+	return &feed, nil
+}
+
+// ParsePrivateKey - decode the base64 ed25519 private key or its seed.
+func ParsePrivateKey(value string) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+
+	switch {
+	case err != nil:
+		return nil, errors.Join(errorInvalidKey, err)
+	case len(key) == ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case len(key) == ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	default:
+		return nil, errorInvalidKey
+	}
+}
+
+// ParsePublicKey - decode the base64 ed25519 public key.
+func ParsePublicKey(value string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Join(errorInvalidKey, err)
+	} else if len(key) != ed25519.PublicKeySize {
+		return nil, errorInvalidKey
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// GenerateKey - a new key pair, both base64 encoded.
+func GenerateKey() (string, string, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(private.Seed()), base64.StdEncoding.EncodeToString(public), nil
+}
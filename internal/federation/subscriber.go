@@ -0,0 +1,160 @@
+package federation
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+const (
+	kvLastFeedKey = "federation#%s"        // Time of the last merged feed of the peer, older feeds are rejected
+	kvPausedKey   = "federation#paused#%s" // The peer is revoked and not pulled until resumed
+	maxFeedSize   = 64 << 20
+)
+
+var (
+	errorFeedStatus = errors.New("unexpected status of the feed")
+	errorFeedReplay = errors.New("feed is older than the last merged one")
+)
+
+// Subscriber - pulls the ban feeds of the peers and merges them into the banned list.
+type Subscriber struct {
+	db     storage.Repository
+	client *http.Client
+	peers  []config.FederationPeer
+	keys   map[string]ed25519.PublicKey
+}
+
+// NewSubscriber - create the subscriber of the peers, the keys of the peers are checked.
+func NewSubscriber(db storage.Repository, client *http.Client, peers []config.FederationPeer) (*Subscriber, error) {
+	keys := make(map[string]ed25519.PublicKey, len(peers))
+
+	for _, peer := range peers {
+		key, err := ParsePublicKey(peer.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("peer %s: %w", peer.Name, err)
+		}
+
+		keys[peer.Name] = key
+	}
+
+	return &Subscriber{db: db, client: client, peers: peers, keys: keys}, nil
+}
+
+// PullAll - pull the feeds of every peer, which is not paused.
+func (s *Subscriber) PullAll(ctx context.Context) {
+	for _, peer := range s.peers {
+		if paused, err := IsPaused(s.db, peer.Name); err != nil || paused {
+			continue
+		}
+
+		result, err := s.Pull(ctx, peer)
+		if err != nil {
+			global.Logger.WarnContext(ctx, "federation: pulling ban feed error",
+				slog.String("peer", peer.Name), slog.String("error", err.Error()))
+
+			continue
+		}
+
+		if result.Added > 0 || result.Removed > 0 {
+			global.Logger.InfoContext(ctx, "federation: ban feed merged", slog.String("peer", peer.Name),
+				slog.Int64("added", result.Added), slog.Int64("updated", result.Updated), slog.Int64("removed", result.Removed))
+		}
+
+		global.Metrics.LogEvent("ban_feed_merged", map[string]string{"peer": peer.Name}, map[string]any{
+			"added":   result.Added,
+			"updated": result.Updated,
+			"removed": result.Removed,
+			"skipped": result.Skipped,
+		})
+	}
+}
+
+// Pull - download the feed of the peer, verify the signature and merge the bans.
+func (s *Subscriber) Pull(ctx context.Context, peer config.FederationPeer) (storage.BanMergeResult, error) {
+	var result storage.BanMergeResult
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, peer.URL, nil)
+	if err != nil {
+		return result, err
+	}
+
+	request.Header.Set("Accept", "application/json")
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return result, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("%w: %s", errorFeedStatus, response.Status)
+	}
+
+	var signed SignedFeed
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxFeedSize)).Decode(&signed); err != nil {
+		return result, err
+	}
+
+	feed, err := Verify(&signed, s.keys[peer.Name])
+	if err != nil {
+		return result, err
+	}
+
+	// A replayed older feed would restore the lifted bans
+	lastKey := fmt.Sprintf(kvLastFeedKey, peer.Name)
+
+	var last int64
+	if kv, err := s.db.KVGet(lastKey); err == nil {
+		_ = kv.GetValue(&last)
+	}
+
+	if feed.GeneratedAt.UnixNano() < last {
+		return result, errorFeedReplay
+	}
+
+	if result, err = s.db.MergeBans(peer.Name, peer.Trust, feed.BannedUsers()); err != nil {
+		return result, err
+	}
+
+	return result, s.db.KVSet(lastKey, feed.GeneratedAt.UnixNano())
+}
+
+// IsPaused - check if the bans of the source are revoked.
+func IsPaused(db storage.Repository, source string) (bool, error) {
+	_, err := db.KVGet(fmt.Sprintf(kvPausedKey, source))
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Revoke - remove the bans of the source and stop pulling its feed until resumed.
+func Revoke(db storage.Repository, source string) (int64, error) {
+	if err := db.KVSet(fmt.Sprintf(kvPausedKey, source), time.Now().Unix()); err != nil {
+		return 0, err
+	}
+
+	return db.RevokeBans(source)
+}
+
+// Resume - pull the feed of the revoked source again, the bans are merged on the next pull.
+func Resume(db storage.Repository, source string) error {
+	if err := db.KVDelete(fmt.Sprintf(kvPausedKey, source)); err != nil {
+		return err
+	}
+
+	return db.KVDelete(fmt.Sprintf(kvLastFeedKey, source))
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/tracing"
 	"golang.org/x/net/proxy"
 )
 
@@ -38,9 +39,37 @@ func NewHTTPClient(config *config.ProxyConfig) (*http.Client, error) {
 	}
 
 	httpClient := &http.Client{
-		Transport: transport,
+		Transport: tracing.Transport(transport),
 		Timeout:   httpClientTimeout, // Set a timeout to avoid hanging requests
 	}
 
 	return httpClient, nil
 }
+
+// roundTripperFunc is an adapter to allow the use of ordinary functions as HTTP round trippers.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithObserver returns a copy of the client that reports the duration of every request.
+func WithObserver(client *http.Client, observe func(req *http.Request, duration time.Duration)) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	observed := *client
+	observed.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		startedAt := time.Now()
+		resp, err := base.RoundTrip(req)
+
+		observe(req, time.Since(startedAt))
+
+		return resp, err
+	})
+
+	return &observed
+}
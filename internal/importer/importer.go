@@ -0,0 +1,521 @@
+// Package importer imports the chat history exported by Telegram Desktop (result.json)
+// into the database, in the same format as the messages received by the bot.
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/plugfox/foxy-gram-server/internal/converters"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	kvCheckpointKey  = "import#%d" // Key of the last imported message of the chat in the key-value store
+	defaultBatchSize = 1000
+	readBufferSize   = 1 << 20
+	supergroupPrefix = -1000000000000 // Bot API IDs of the supergroups and the channels
+)
+
+var (
+	errorNotObject   = errors.New("export must be a JSON object of a single chat")
+	errorChatUnknown = errors.New("chat id must precede the messages in the export")
+)
+
+// Options - options of the import.
+type Options struct {
+	Verify    bool           // Verify the authors of the imported messages
+	BatchSize int            // Number of messages between the checkpoints, 1000 by default
+	Progress  func(Progress) // Optional. Called after every batch and at the end
+}
+
+// Progress - progress of the import.
+type Progress struct {
+	ChatID     int64 `json:"chat_id"`
+	Read       int64 `json:"read"`       // Bytes of the export read
+	Total      int64 `json:"total"`      // Size of the export in bytes
+	Messages   int64 `json:"messages"`   // Imported messages
+	Skipped    int64 `json:"skipped"`    // Service messages and messages imported before the checkpoint
+	Verified   int64 `json:"verified"`   // Verified authors
+	Checkpoint int64 `json:"checkpoint"` // ID of the last imported message
+}
+
+// Percent - share of the export read, from 0 to 100.
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+
+	return float64(p.Read) * 100 / float64(p.Total) //nolint:mnd
+}
+
+// exportChat - chat of the export.
+type exportChat struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	ID   int64  `json:"id"`
+}
+
+// exportMessage - message of the export, only the fields stored in the database.
+type exportMessage struct {
+	ID               int64          `json:"id"`
+	Type             string         `json:"type"`
+	DateUnixtime     string         `json:"date_unixtime"`
+	EditedUnixtime   string         `json:"edited_unixtime"`
+	From             string         `json:"from"`
+	FromID           any            `json:"from_id"`
+	ViaBot           string         `json:"via_bot"`
+	ReplyToMessageID int64          `json:"reply_to_message_id"`
+	ForwardedFrom    string         `json:"forwarded_from"`
+	TextEntities     []exportEntity `json:"text_entities"`
+	MediaType        string         `json:"media_type"`
+	Photo            string         `json:"photo"`
+	File             string         `json:"file"`
+	MimeType         string         `json:"mime_type"`
+}
+
+// exportEntity - part of the text of the message with its formatting.
+type exportEntity struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Href     string `json:"href"`
+	UserID   int64  `json:"user_id"`
+	Language string `json:"language"`
+}
+
+// countingReader - reader counting the bytes read, for the progress.
+type countingReader struct {
+	reader io.Reader
+	read   int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	return n, err
+}
+
+// importer - state of the running import.
+type importer struct {
+	ctx      context.Context //nolint:containedctx
+	db       storage.Repository
+	options  Options
+	reader   *countingReader
+	progress Progress
+	chat     *tele.Chat
+	known    map[int64]struct{} // Users and chats upserted during the import
+	authors  []int              // Authors of the batch to verify
+	verified map[int64]struct{}
+	batch    int
+}
+
+// ImportFile - import the chat export file, resuming after the last checkpoint of the chat.
+func ImportFile(ctx context.Context, db storage.Repository, path string, options Options) (Progress, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Progress{}, err
+	}
+
+	return Import(ctx, db, file, info.Size(), options)
+}
+
+// Import - stream the chat export and store its messages, the total size is used for the progress.
+func Import(ctx context.Context, db storage.Repository, reader io.Reader, total int64, options Options) (Progress, error) {
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultBatchSize
+	}
+
+	imp := &importer{
+		ctx:      ctx,
+		db:       db,
+		options:  options,
+		reader:   &countingReader{reader: reader},
+		progress: Progress{Total: total},
+		known:    make(map[int64]struct{}),
+		verified: make(map[int64]struct{}),
+	}
+
+	err := imp.run()
+
+	imp.progress.Read = imp.reader.read
+	imp.report()
+
+	return imp.progress, err
+}
+
+// run - walk the top-level object of the export, the messages are decoded one by one.
+func (imp *importer) run() error {
+	decoder := json.NewDecoder(bufio.NewReaderSize(imp.reader, readBufferSize))
+
+	if token, err := decoder.Token(); err != nil {
+		return err
+	} else if token != json.Delim('{') {
+		return errorNotObject
+	}
+
+	var chat exportChat
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case "name":
+			err = decoder.Decode(&chat.Name)
+		case "type":
+			err = decoder.Decode(&chat.Type)
+		case "id":
+			err = decoder.Decode(&chat.ID)
+		case "messages":
+			if chat.ID == 0 {
+				return errorChatUnknown
+			}
+
+			err = imp.messages(decoder, chat)
+		default:
+			var skip json.RawMessage
+			err = decoder.Decode(&skip)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// messages - import the array of the messages.
+func (imp *importer) messages(decoder *json.Decoder, chat exportChat) error {
+	imp.chat = chatFromExport(chat)
+	imp.progress.ChatID = imp.chat.ID
+
+	if err := imp.loadCheckpoint(); err != nil {
+		return err
+	}
+
+	if token, err := decoder.Token(); err != nil {
+		return err
+	} else if token != json.Delim('[') {
+		return fmt.Errorf("messages: %w", errorNotObject)
+	}
+
+	for decoder.More() {
+		if err := imp.ctx.Err(); err != nil {
+			return errors.Join(err, imp.checkpoint())
+		}
+
+		var message exportMessage
+		if err := decoder.Decode(&message); err != nil {
+			return err
+		}
+
+		if message.Type != "message" || message.ID <= imp.progress.Checkpoint {
+			imp.progress.Skipped++
+
+			continue
+		}
+
+		if err := imp.store(&message); err != nil {
+			return errors.Join(fmt.Errorf("message %d: %w", message.ID, err), imp.checkpoint())
+		}
+
+		imp.progress.Messages++
+		imp.progress.Checkpoint = message.ID
+		imp.batch++
+
+		if imp.batch >= imp.options.BatchSize {
+			if err := imp.checkpoint(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	return imp.checkpoint()
+}
+
+// loadCheckpoint - the last imported message of the chat, to resume the import.
+func (imp *importer) loadCheckpoint() error {
+	kv, err := imp.db.KVGet(fmt.Sprintf(kvCheckpointKey, imp.chat.ID))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return kv.GetValue(&imp.progress.Checkpoint)
+}
+
+// checkpoint - verify the authors of the batch and store the last imported message.
+func (imp *importer) checkpoint() error {
+	if imp.batch == 0 {
+		return nil
+	}
+
+	if imp.options.Verify && len(imp.authors) > 0 {
+		if err := imp.db.VerifyUsers("Imported from the chat history", imp.authors); err != nil {
+			return err
+		}
+
+		imp.progress.Verified += int64(len(imp.authors))
+		imp.authors = imp.authors[:0]
+	}
+
+	if err := imp.db.KVSet(fmt.Sprintf(kvCheckpointKey, imp.chat.ID), imp.progress.Checkpoint); err != nil {
+		return err
+	}
+
+	imp.batch = 0
+	imp.progress.Read = imp.reader.read
+	imp.report()
+
+	return nil
+}
+
+// report - report the progress.
+func (imp *importer) report() {
+	if imp.options.Progress != nil {
+		imp.options.Progress(imp.progress)
+	}
+}
+
+// store - store the message with its new users and chats.
+func (imp *importer) store(message *exportMessage) error {
+	msg := imp.messageToTG(message)
+
+	stored := converters.MessageFromTG(msg)
+	stored.ReplyToID = model.MessageID(message.ReplyToMessageID)
+	origin := converters.MessageOriginFromTG(msg)
+
+	if msg.Sender.ID == 0 {
+		stored.Sender = nil // Sent on behalf of the chat
+	}
+
+	// The text is not stored at all, if the chat keeps only the metadata
+	if global.Config.Retention.PolicyFor(imp.chat.ID).MetadataOnly {
+		stored.Text, stored.Caption = "", ""
+		if origin != nil {
+			origin.OriginalText = ""
+		}
+	}
+
+	input := storage.UpsertMessageInput{Message: stored, Origin: origin}
+
+	// The users and the chats are stored once, the export has only their names
+	for _, chat := range []*tele.Chat{imp.chat, msg.SenderChat} {
+		if chat != nil && imp.isNew(chat.ID) {
+			input.Chats = append(input.Chats, converters.ChatFromTG(chat))
+		}
+	}
+
+	if sender := msg.Sender; sender.ID != 0 {
+		if imp.isNew(sender.ID) {
+			if _, err := imp.db.UserByID(model.UserID(sender.ID)); errors.Is(err, storage.ErrNotFound) {
+				input.Users = append(input.Users, converters.UserFromTG(sender))
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if _, ok := imp.verified[sender.ID]; !ok && imp.options.Verify {
+			imp.verified[sender.ID] = struct{}{}
+			imp.authors = append(imp.authors, int(sender.ID))
+		}
+	}
+
+	return imp.db.UpsertMessage(input)
+}
+
+// isNew - check if the user or the chat is seen for the first time during the import.
+func (imp *importer) isNew(id int64) bool {
+	if _, ok := imp.known[id]; ok {
+		return false
+	}
+
+	imp.known[id] = struct{}{}
+
+	return true
+}
+
+// messageToTG - the message of the export as it would be received by the bot.
+func (imp *importer) messageToTG(message *exportMessage) *tele.Message {
+	msg := &tele.Message{
+		ID:                 int(message.ID),
+		Chat:               imp.chat,
+		Sender:             &tele.User{},
+		OriginalSenderName: message.ForwardedFrom,
+	}
+
+	msg.Unixtime, _ = strconv.ParseInt(message.DateUnixtime, 10, 64)
+	msg.LastEdit, _ = strconv.ParseInt(message.EditedUnixtime, 10, 64)
+
+	kind, id := parsePeerID(message.FromID)
+
+	switch kind {
+	case "user":
+		msg.Sender = &tele.User{ID: id, FirstName: message.From}
+	case "channel", "chat":
+		msg.SenderChat = &tele.Chat{ID: supergroupPrefix - id, Type: tele.ChatChannel, Title: message.From}
+	}
+
+	if message.ViaBot != "" {
+		msg.Via = &tele.User{Username: strings.TrimPrefix(message.ViaBot, "@"), IsBot: true}
+	}
+
+	text, entities := textFromExport(message.TextEntities)
+
+	if mediaFromExport(msg, message) {
+		msg.Caption, msg.CaptionEntities = text, entities
+	} else {
+		msg.Text, msg.Entities = text, entities
+	}
+
+	return msg
+}
+
+// parsePeerID - kind and ID of the peer, e.g. "user123" or "channel123", older exports have the number only.
+func parsePeerID(value any) (string, int64) {
+	switch v := value.(type) {
+	case float64:
+		return "user", int64(v)
+	case string:
+		for _, kind := range []string{"user", "channel", "chat"} {
+			if strings.HasPrefix(v, kind) {
+				if id, err := strconv.ParseInt(v[len(kind):], 10, 64); err == nil {
+					return kind, id
+				}
+			}
+		}
+	}
+
+	return "", 0
+}
+
+// chatFromExport - the chat of the export with the Bot API ID and type.
+func chatFromExport(chat exportChat) *tele.Chat {
+	result := &tele.Chat{ID: chat.ID, Title: chat.Name, Type: tele.ChatPrivate}
+
+	switch chat.Type {
+	case "private_supergroup", "public_supergroup":
+		result.ID, result.Type = supergroupPrefix-chat.ID, tele.ChatSuperGroup
+	case "private_channel", "public_channel":
+		result.ID, result.Type = supergroupPrefix-chat.ID, tele.ChatChannel
+	case "private_group":
+		result.ID, result.Type = -chat.ID, tele.ChatGroup
+	default:
+		result.Private = true
+	}
+
+	return result
+}
+
+// textFromExport - the text and its entities with the offsets in UTF-16 code units, like the Bot API.
+func textFromExport(parts []exportEntity) (string, tele.Entities) {
+	var (
+		builder  strings.Builder
+		entities tele.Entities
+		offset   int
+	)
+
+	for _, part := range parts {
+		length := len(utf16.Encode([]rune(part.Text)))
+		builder.WriteString(part.Text)
+
+		if entity, ok := entityFromExport(part); ok && length > 0 {
+			entity.Offset, entity.Length = offset, length
+			entities = append(entities, entity)
+		}
+
+		offset += length
+	}
+
+	return builder.String(), entities
+}
+
+// entityFromExport - the Bot API entity of the part of the text, false for the plain text.
+func entityFromExport(part exportEntity) (tele.MessageEntity, bool) {
+	types := map[string]tele.EntityType{
+		"link":          tele.EntityURL,
+		"text_link":     tele.EntityTextLink,
+		"mention":       tele.EntityMention,
+		"mention_name":  tele.EntityTMention,
+		"hashtag":       tele.EntityHashtag,
+		"cashtag":       tele.EntityCashtag,
+		"bot_command":   tele.EntityCommand,
+		"email":         tele.EntityEmail,
+		"phone":         tele.EntityPhone,
+		"bold":          tele.EntityBold,
+		"italic":        tele.EntityItalic,
+		"underline":     tele.EntityUnderline,
+		"strikethrough": tele.EntityStrikethrough,
+		"spoiler":       tele.EntitySpoiler,
+		"code":          tele.EntityCode,
+		"pre":           tele.EntityCodeBlock,
+		"blockquote":    tele.EntityBlockquote,
+		"custom_emoji":  tele.EntityCustomEmoji,
+	}
+
+	entityType, ok := types[part.Type]
+	if !ok {
+		return tele.MessageEntity{}, false
+	}
+
+	entity := tele.MessageEntity{Type: entityType, URL: part.Href, Language: part.Language}
+	if part.UserID != 0 {
+		entity.User = &tele.User{ID: part.UserID}
+	}
+
+	return entity, true
+}
+
+// mediaFromExport - set the media of the message, the files are not imported, only the type.
+// Returns true if the message has a media, so the text is the caption.
+func mediaFromExport(msg *tele.Message, message *exportMessage) bool {
+	switch {
+	case message.Photo != "":
+		msg.Photo = &tele.Photo{}
+	case message.MediaType == "sticker":
+		msg.Sticker = &tele.Sticker{}
+	case message.MediaType == "animation":
+		msg.Animation = &tele.Animation{MIME: message.MimeType}
+	case message.MediaType == "video_file":
+		msg.Video = &tele.Video{MIME: message.MimeType}
+	case message.MediaType == "video_message":
+		msg.VideoNote = &tele.VideoNote{}
+	case message.MediaType == "voice_message":
+		msg.Voice = &tele.Voice{MIME: message.MimeType}
+	case message.MediaType == "audio_file":
+		msg.Audio = &tele.Audio{MIME: message.MimeType}
+	case message.File != "":
+		msg.Document = &tele.Document{MIME: message.MimeType}
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+)
+
+const export = `{
+ "name": "Foxy chat",
+ "type": "public_supergroup",
+ "id": 1234567890,
+ "messages": [
+  {"id": 1, "type": "service", "date_unixtime": "1700000000", "actor_id": "user1", "action": "invite_members"},
+  {"id": 2, "type": "message", "date_unixtime": "1700000010", "from": "Fox", "from_id": "user1",
+   "text": ["Привет ", {"type": "link", "text": "https://example.com"}],
+   "text_entities": [{"type": "plain", "text": "Привет "}, {"type": "link", "text": "https://example.com"}]},
+  {"id": 3, "type": "message", "date_unixtime": "1700000020", "edited_unixtime": "1700000030", "from": "Cat", "from_id": "user2",
+   "reply_to_message_id": 2, "photo": "photos/photo_1.jpg", "text": "Look", "text_entities": [{"type": "plain", "text": "Look"}]},
+  {"id": 4, "type": "message", "date_unixtime": "1700000040", "from": "Foxy news", "from_id": "channel42",
+   "forwarded_from": "Somebody", "text": "News", "text_entities": [{"type": "bold", "text": "News"}]}
+ ]
+}`
+
+func TestImport(t *testing.T) {
+	global.Config = &config.Config{Database: config.DatabaseConfig{Driver: "sqlite", Connection: ":memory:", AutoMigrate: true}}
+	global.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	global.Metrics = metrics.NewMetricsFake()
+
+	db, err := storage.New()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	chatID := model.ChatID(-1001234567890)
+
+	progress, err := Import(context.Background(), db, strings.NewReader(export), int64(len(export)), Options{Verify: true, BatchSize: 2})
+	require.NoError(t, err)
+	require.Equal(t, Progress{
+		ChatID:     int64(chatID),
+		Read:       int64(len(export)),
+		Total:      int64(len(export)),
+		Messages:   3,
+		Skipped:    1,
+		Verified:   2,
+		Checkpoint: 4,
+	}, progress)
+
+	t.Run("Text and entities", func(t *testing.T) {
+		message, err := db.MessageByID(chatID, 2)
+		require.NoError(t, err)
+		require.Equal(t, "Привет https://example.com", message.Text)
+		require.EqualValues(t, 1, message.SenderID)
+
+		var entities tele.Entities
+		require.NoError(t, json.Unmarshal([]byte(message.Entities), &entities))
+		require.Equal(t, tele.Entities{{Type: tele.EntityURL, Offset: 7, Length: 19}}, entities)
+	})
+
+	t.Run("Reply with a photo", func(t *testing.T) {
+		message, err := db.MessageByID(chatID, 3)
+		require.NoError(t, err)
+		require.Equal(t, "Look", message.Caption)
+		require.Empty(t, message.Text)
+		require.Equal(t, "photo", message.MediaType)
+		require.EqualValues(t, 2, message.ReplyToID)
+		require.Equal(t, int64(1700000030), message.LastEdit.Time.Unix())
+	})
+
+	t.Run("Verified authors", func(t *testing.T) {
+		for _, userID := range []int64{1, 2} {
+			verified, err := db.IsVerifiedUser(model.UserID(userID))
+			require.NoError(t, err)
+			require.True(t, verified)
+		}
+	})
+
+	t.Run("Resume from the checkpoint", func(t *testing.T) {
+		progress, err := Import(context.Background(), db, strings.NewReader(export), int64(len(export)), Options{})
+		require.NoError(t, err)
+		require.Zero(t, progress.Messages)
+		require.EqualValues(t, 4, progress.Skipped)
+		require.EqualValues(t, 4, progress.Checkpoint)
+	})
+}
@@ -0,0 +1,278 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BufferedOptions configures the buffered metrics pipeline.
+type BufferedOptions struct {
+	QueueSize     int           // Maximum number of queued events, new events are dropped when the queue is full
+	BatchSize     int           // Maximum number of events written in one batch
+	FlushInterval time.Duration // Maximum time an event waits in the batch
+	RetryAttempts int           // Number of attempts to write a batch to the primary sink
+	RetryDelay    time.Duration // Delay before the first retry, doubled after every attempt
+	WriteTimeout  time.Duration // Timeout of a single write to a sink
+	OnError       func(error)   // Called when a batch can not be written anywhere
+}
+
+// BufferedStats are the counters of the buffered metrics pipeline.
+type BufferedStats struct {
+	Queued   int64 `json:"queued"`   // Events currently waiting in the queue
+	Dropped  int64 `json:"dropped"`  // Events dropped because the queue was full
+	Written  int64 `json:"written"`  // Events written to the primary sink
+	Fallback int64 `json:"fallback"` // Events written to the fallback sink
+	Lost     int64 `json:"lost"`     // Events that could not be written anywhere
+}
+
+// MetricsBuffered queues the events and writes them in batches from a background worker,
+// so logging a metric never blocks the caller.
+// The batches that can not be written to the primary sink after the retries,
+// e.g. during an InfluxDB outage, are written to the fallback sink to be replayed later.
+type MetricsBuffered struct {
+	primary  Sink // May be nil, e.g. in offline deployments
+	fallback Sink // May be nil, then the failed batches are lost
+	options  BufferedOptions
+
+	queue chan Event
+	done  chan struct{}
+	once  sync.Once
+
+	dropped atomic.Int64
+	written atomic.Int64
+	fallen  atomic.Int64
+	lost    atomic.Int64
+
+	mu     sync.RWMutex // Guards the queue from being closed while sending
+	closed bool
+}
+
+// Ensure MetricsBuffered implements Metrics
+var _ Metrics = (*MetricsBuffered)(nil)
+
+// NewMetricsBuffered creates the buffered metrics pipeline writing to the primary sink,
+// and to the fallback sink when the primary one is not available.
+func NewMetricsBuffered(primary Sink, fallback Sink, options BufferedOptions) *MetricsBuffered {
+	const (
+		defaultQueueSize     = 10000
+		defaultBatchSize     = 500
+		defaultFlushInterval = time.Second
+		defaultRetryDelay    = time.Second
+		defaultWriteTimeout  = 10 * time.Second
+	)
+
+	if options.QueueSize <= 0 {
+		options.QueueSize = defaultQueueSize
+	}
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultBatchSize
+	}
+
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = defaultFlushInterval
+	}
+
+	if options.RetryAttempts <= 0 {
+		options.RetryAttempts = 1
+	}
+
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = defaultRetryDelay
+	}
+
+	if options.WriteTimeout <= 0 {
+		options.WriteTimeout = defaultWriteTimeout
+	}
+
+	metrics := &MetricsBuffered{
+		primary:  primary,
+		fallback: fallback,
+		options:  options,
+		queue:    make(chan Event, options.QueueSize),
+		done:     make(chan struct{}),
+	}
+
+	go metrics.worker()
+
+	return metrics
+}
+
+// LogEvent queues the event
+func (metrics *MetricsBuffered) LogEvent(eventName string, tags map[string]string, fields map[string]interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+
+	metrics.enqueue(Event{
+		Measurement: measurementEvent,
+		Name:        eventName,
+		Tags:        tags,
+		Fields:      fields,
+		Time:        time.Now(),
+	})
+}
+
+// LogChatEvent queues the chat event
+func (metrics *MetricsBuffered) LogChatEvent(eventName string, chatID int64, fields map[string]interface{}) {
+	if chatID == 0 {
+		return
+	}
+
+	metrics.LogEvent(eventName, map[string]string{"chat_id": strconv.FormatInt(chatID, 10)}, fields)
+}
+
+// ObserveDuration queues the observed duration
+func (metrics *MetricsBuffered) ObserveDuration(name string, duration time.Duration, tags map[string]string) {
+	metrics.enqueue(Event{
+		Measurement: measurementDuration,
+		Name:        name,
+		Tags:        tags,
+		Fields:      map[string]interface{}{"seconds": duration.Seconds()},
+		Time:        time.Now(),
+	})
+}
+
+// SetGauge queues the value of the gauge
+func (metrics *MetricsBuffered) SetGauge(name string, value float64, tags map[string]string) {
+	metrics.enqueue(Event{
+		Measurement: measurementGauge,
+		Name:        name,
+		Tags:        tags,
+		Fields:      map[string]interface{}{"value": value},
+		Time:        time.Now(),
+	})
+}
+
+// Stats returns the counters of the pipeline
+func (metrics *MetricsBuffered) Stats() BufferedStats {
+	return BufferedStats{
+		Queued:   int64(len(metrics.queue)),
+		Dropped:  metrics.dropped.Load(),
+		Written:  metrics.written.Load(),
+		Fallback: metrics.fallen.Load(),
+		Lost:     metrics.lost.Load(),
+	}
+}
+
+// Close stops accepting events, flushes the queue and closes the sinks
+func (metrics *MetricsBuffered) Close() {
+	metrics.once.Do(func() {
+		metrics.mu.Lock()
+		metrics.closed = true
+		close(metrics.queue)
+		metrics.mu.Unlock()
+
+		<-metrics.done
+
+		if metrics.primary != nil {
+			_ = metrics.primary.Close()
+		}
+
+		if metrics.fallback != nil {
+			_ = metrics.fallback.Close()
+		}
+	})
+}
+
+// enqueue adds the event to the queue without blocking, the event is dropped if the queue is full
+func (metrics *MetricsBuffered) enqueue(event Event) {
+	metrics.mu.RLock()
+	defer metrics.mu.RUnlock()
+
+	if metrics.closed {
+		metrics.dropped.Add(1)
+
+		return
+	}
+
+	select {
+	case metrics.queue <- event:
+	default:
+		metrics.dropped.Add(1)
+	}
+}
+
+// worker collects the events into batches and writes them
+func (metrics *MetricsBuffered) worker() {
+	defer close(metrics.done)
+
+	ticker := time.NewTicker(metrics.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, metrics.options.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		metrics.write(batch)
+		batch = make([]Event, 0, metrics.options.BatchSize)
+	}
+
+	for {
+		select {
+		case event, ok := <-metrics.queue:
+			if !ok {
+				flush()
+
+				return
+			}
+
+			batch = append(batch, event)
+			if len(batch) >= metrics.options.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// write writes the batch to the primary sink with retries, then to the fallback sink
+func (metrics *MetricsBuffered) write(batch []Event) {
+	var err error
+
+	if metrics.primary != nil {
+		delay := metrics.options.RetryDelay
+
+		for attempt := range metrics.options.RetryAttempts {
+			if attempt > 0 {
+				time.Sleep(delay)
+				delay *= 2
+			}
+
+			if err = metrics.writeTo(metrics.primary, batch); err == nil {
+				metrics.written.Add(int64(len(batch)))
+
+				return
+			}
+		}
+	}
+
+	if metrics.fallback != nil {
+		if err = metrics.writeTo(metrics.fallback, batch); err == nil {
+			metrics.fallen.Add(int64(len(batch)))
+
+			return
+		}
+	}
+
+	metrics.lost.Add(int64(len(batch)))
+
+	if err != nil && metrics.options.OnError != nil {
+		metrics.options.OnError(err)
+	}
+}
+
+// writeTo writes the batch to the sink with the write timeout
+func (metrics *MetricsBuffered) writeTo(sink Sink, batch []Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), metrics.options.WriteTimeout)
+	defer cancel()
+
+	return sink.Write(ctx, batch)
+}
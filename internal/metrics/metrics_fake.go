@@ -1,5 +1,7 @@
 package metrics
 
+import "time"
+
 // metricsFake is a no-op implementation of MetricsLogger
 type metricsFake struct{}
 
@@ -21,6 +23,16 @@ func (metrics *metricsFake) LogChatEvent(_ string, _ int64, _ map[string]interfa
 	// No operation, this is a fake logger
 }
 
+// ObserveDuration is a no-op method for FakeMetricsLogger
+func (metrics *metricsFake) ObserveDuration(_ string, _ time.Duration, _ map[string]string) {
+	// No operation, this is a fake logger
+}
+
+// SetGauge is a no-op method for FakeMetricsLogger
+func (metrics *metricsFake) SetGauge(_ string, _ float64, _ map[string]string) {
+	// No operation, this is a fake logger
+}
+
 // Close is a no-op method for FakeMetricsLogger
 func (metrics *metricsFake) Close() {
 	// No operation, this is a fake logger
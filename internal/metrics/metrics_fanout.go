@@ -0,0 +1,68 @@
+package metrics
+
+import "time"
+
+// metricsFanOut sends every metric to all the underlying implementations,
+// e.g. to InfluxDB and Prometheus at the same time.
+type metricsFanOut struct {
+	targets []Metrics
+}
+
+// Ensure metricsFanOut implements Metrics
+var _ Metrics = (*metricsFanOut)(nil)
+
+// NewMetricsFanOut combines several metrics implementations into one.
+// Nil targets are skipped, and a single target is returned as is.
+func NewMetricsFanOut(targets ...Metrics) Metrics {
+	filtered := make([]Metrics, 0, len(targets))
+
+	for _, target := range targets {
+		if target != nil {
+			filtered = append(filtered, target)
+		}
+	}
+
+	switch len(filtered) {
+	case 0:
+		return NewMetricsFake()
+	case 1:
+		return filtered[0]
+	default:
+		return &metricsFanOut{targets: filtered}
+	}
+}
+
+// LogEvent logs the event to every target
+func (metrics *metricsFanOut) LogEvent(eventName string, tags map[string]string, fields map[string]interface{}) {
+	for _, target := range metrics.targets {
+		target.LogEvent(eventName, tags, fields)
+	}
+}
+
+// LogChatEvent logs the chat event to every target
+func (metrics *metricsFanOut) LogChatEvent(eventName string, chatID int64, fields map[string]interface{}) {
+	for _, target := range metrics.targets {
+		target.LogChatEvent(eventName, chatID, fields)
+	}
+}
+
+// ObserveDuration observes the duration in every target
+func (metrics *metricsFanOut) ObserveDuration(name string, duration time.Duration, tags map[string]string) {
+	for _, target := range metrics.targets {
+		target.ObserveDuration(name, duration, tags)
+	}
+}
+
+// SetGauge sets the gauge in every target
+func (metrics *metricsFanOut) SetGauge(name string, value float64, tags map[string]string) {
+	for _, target := range metrics.targets {
+		target.SetGauge(name, value, tags)
+	}
+}
+
+// Close closes every target
+func (metrics *metricsFanOut) Close() {
+	for _, target := range metrics.targets {
+		target.Close()
+	}
+}
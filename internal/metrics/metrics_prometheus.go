@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace is the prefix of every Prometheus metric name.
+const namespace = "foxygram"
+
+// metricsPrometheus exposes the events as counters and the durations as histograms
+// in the Prometheus text format.
+type metricsPrometheus struct {
+	registry  *prometheus.Registry
+	events    *prometheus.CounterVec
+	durations map[string]*prometheus.HistogramVec
+	labels    map[string]string // Tag used as a label for each histogram and gauge
+	other     *prometheus.HistogramVec
+	gauges    map[string]*prometheus.GaugeVec
+	gauge     *prometheus.GaugeVec // Other gauges by name
+}
+
+// Ensure metricsPrometheus implements Metrics
+var _ Metrics = (*metricsPrometheus)(nil)
+
+// NewMetricsPrometheus creates the Prometheus implementation of Metrics
+// and the HTTP handler exposing the collected metrics.
+// Constant labels, like bot ID, are added to every metric.
+func NewMetricsPrometheus(defaultLabels map[string]string) (Metrics, http.Handler) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	constLabels := prometheus.Labels(defaultLabels)
+
+	histogram := func(name string, help string, label string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: constLabels,
+			Buckets:     prometheus.DefBuckets,
+		}, []string{label})
+	}
+
+	gauge := func(name string, help string, label string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: constLabels,
+		}, []string{label})
+	}
+
+	metrics := &metricsPrometheus{
+		registry: registry,
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "events_total",
+			Help:        "Number of bot events by event name and chat.",
+			ConstLabels: constLabels,
+		}, []string{"event", "chat_id"}),
+		durations: map[string]*prometheus.HistogramVec{
+			DurationUpdate:      histogram("update_handling_duration_seconds", "Time spent handling a Telegram update.", "type"),
+			DurationDBQuery:     histogram("db_query_duration_seconds", "Time spent executing a database query.", "operation"),
+			DurationTelegramAPI: histogram("telegram_api_duration_seconds", "Time spent calling the Telegram Bot API.", "method"),
+			DurationQueueWait:   histogram("queue_wait_duration_seconds", "Time spent waiting in the outgoing queue of the Telegram Bot API.", "priority"),
+		},
+		labels: map[string]string{
+			DurationUpdate:      "type",
+			DurationDBQuery:     "operation",
+			DurationTelegramAPI: "method",
+			DurationQueueWait:   "priority",
+			GaugeQueueDepth:     "priority",
+			GaugeBufferedStats:  "counter",
+		},
+		other: histogram("duration_seconds", "Time spent in other observed operations.", "name"),
+		gauges: map[string]*prometheus.GaugeVec{
+			GaugeQueueDepth:    gauge("queue_depth", "Requests waiting in the outgoing queue of the Telegram Bot API.", "priority"),
+			GaugeBufferedStats: gauge("buffered_events", "Events of the buffered metrics pipeline: queued, dropped, written, fallback and lost.", "counter"),
+		},
+		gauge: gauge("gauge", "Current values of other gauges.", "name"),
+	}
+
+	registry.MustRegister(metrics.events, metrics.other, metrics.gauge)
+
+	for _, collector := range metrics.gauges {
+		registry.MustRegister(collector)
+	}
+
+	for _, collector := range metrics.durations {
+		registry.MustRegister(collector)
+	}
+
+	return metrics, promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// LogEvent increments the counter of the event
+func (metrics *metricsPrometheus) LogEvent(eventName string, tags map[string]string, _ map[string]interface{}) {
+	metrics.events.WithLabelValues(eventName, tags["chat_id"]).Inc()
+}
+
+// LogChatEvent increments the counter of the event in the chat
+func (metrics *metricsPrometheus) LogChatEvent(eventName string, chatID int64, fields map[string]interface{}) {
+	if chatID == 0 {
+		return
+	}
+
+	metrics.LogEvent(eventName, map[string]string{"chat_id": strconv.FormatInt(chatID, 10)}, fields)
+}
+
+// ObserveDuration adds the duration to the histogram with the given name
+func (metrics *metricsPrometheus) ObserveDuration(name string, duration time.Duration, tags map[string]string) {
+	if histogram, ok := metrics.durations[name]; ok {
+		histogram.WithLabelValues(tags[metrics.labels[name]]).Observe(duration.Seconds())
+
+		return
+	}
+
+	metrics.other.WithLabelValues(name).Observe(duration.Seconds())
+}
+
+// SetGauge sets the value of the gauge with the given name
+func (metrics *metricsPrometheus) SetGauge(name string, value float64, tags map[string]string) {
+	if gauge, ok := metrics.gauges[name]; ok {
+		gauge.WithLabelValues(tags[metrics.labels[name]]).Set(value)
+
+		return
+	}
+
+	metrics.gauge.WithLabelValues(name).Set(value)
+}
+
+// Close is a no-op, the metrics are pulled by Prometheus
+func (metrics *metricsPrometheus) Close() {}
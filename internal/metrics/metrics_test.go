@@ -1,8 +1,17 @@
 package metrics
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestCanPassNilTags(t *testing.T) {
@@ -20,3 +29,160 @@ func TestCanPassNilTags(t *testing.T) {
 		logEvent("test", nil, nil)
 	})
 }
+
+func TestPrometheusExposesEventsAndDurations(t *testing.T) {
+	metrics, handler := NewMetricsPrometheus(map[string]string{"bot": "test"})
+	combined := NewMetricsFanOut(NewMetricsFake(), metrics, nil)
+
+	combined.LogChatEvent("captcha_sent", -100123, map[string]interface{}{"user_id": 1})
+	combined.LogChatEvent("captcha_sent", -100123, nil)
+	combined.LogEvent("server_started", nil, nil)
+	combined.ObserveDuration(DurationDBQuery, 15*time.Millisecond, map[string]string{"operation": "select"})
+	combined.ObserveDuration("custom", time.Second, nil)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	require.Contains(t, body, `foxygram_events_total{bot="test",chat_id="-100123",event="captcha_sent"} 2`)
+	require.Contains(t, body, `foxygram_events_total{bot="test",chat_id="",event="server_started"} 1`)
+	require.Contains(t, body, `foxygram_db_query_duration_seconds_count{bot="test",operation="select"} 1`)
+	require.Contains(t, body, `foxygram_duration_seconds_count{bot="test",name="custom"} 1`)
+}
+
+func TestFanOutSkipsNilTargets(t *testing.T) {
+	require.IsType(t, &metricsFake{}, NewMetricsFanOut())
+	require.IsType(t, &metricsFake{}, NewMetricsFanOut(nil, NewMetricsFake()))
+}
+
+type memorySink struct {
+	mu     sync.Mutex
+	events []Event
+	err    error
+}
+
+func (sink *memorySink) Write(_ context.Context, events []Event) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.err != nil {
+		return sink.err
+	}
+
+	sink.events = append(sink.events, events...)
+
+	return nil
+}
+
+func (sink *memorySink) Close() error { return nil }
+
+func TestBufferedFallsBackAndReplays(t *testing.T) {
+	dir := t.TempDir()
+
+	primary := &memorySink{err: errors.New("influx is down")}
+	fallback, err := NewFileSink(dir, 1)
+	require.NoError(t, err)
+
+	buffered := NewMetricsBuffered(primary, fallback, BufferedOptions{
+		RetryAttempts: 2,
+		RetryDelay:    time.Millisecond,
+	})
+
+	buffered.LogChatEvent("captcha_sent", -100123, map[string]interface{}{"user_id": 1})
+	buffered.ObserveDuration(DurationDBQuery, time.Second, map[string]string{"operation": "select"})
+	buffered.Close()
+
+	stats := buffered.Stats()
+	require.Equal(t, int64(2), stats.Fallback)
+	require.Equal(t, int64(0), stats.Written)
+	require.Equal(t, int64(0), stats.Lost)
+
+	replayed := &memorySink{}
+	count, err := Replay(context.Background(), dir, replayed, 10)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, "captcha_sent", replayed.events[0].Name)
+	require.Equal(t, "-100123", replayed.events[0].Tags["chat_id"])
+	require.Equal(t, DurationDBQuery, replayed.events[1].Name)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestReplayKeepsFieldTypes(t *testing.T) {
+	dir := t.TempDir()
+
+	fallback, err := NewFileSink(dir, 1)
+	require.NoError(t, err)
+
+	require.NoError(t, fallback.Write(context.Background(), []Event{{
+		Measurement: measurementEvent,
+		Name:        "captcha_sent",
+		Fields: map[string]interface{}{
+			"user_id":  1,
+			"seconds":  2.0,
+			"attempts": uint(3),
+			"ok":       true,
+			"elapsed":  time.Second,
+		},
+		Time: time.Now(),
+	}}))
+	require.NoError(t, fallback.Close())
+
+	replayed := &memorySink{}
+	count, err := Replay(context.Background(), dir, replayed, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.Equal(t, map[string]interface{}{
+		"user_id":  int64(1),
+		"seconds":  2.0,
+		"attempts": uint64(3),
+		"ok":       true,
+		"elapsed":  "1s",
+	}, replayed.events[0].Fields)
+}
+
+func TestFileSinkRotatesLargeBatch(t *testing.T) {
+	dir := t.TempDir()
+
+	const maxSize = 8 << 10
+
+	fallback, err := NewFileSink(dir, maxSize)
+	require.NoError(t, err)
+
+	// The batch is larger than the buffer of bufio, which writes the rest directly to the file
+	events := make([]Event, 200)
+	for i := range events {
+		events[i] = Event{Measurement: measurementEvent, Name: "captcha_sent", Fields: map[string]interface{}{"user_id": i}, Time: time.Now()}
+	}
+
+	require.NoError(t, fallback.Write(context.Background(), events))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NotEqual(t, fallbackFileName, entries[0].Name())
+
+	info, err := entries[0].Info()
+	require.NoError(t, err)
+	require.Greater(t, info.Size(), int64(maxSize))
+
+	// The active file is sealed before the replay
+	require.NoError(t, fallback.Write(context.Background(), events[:1]))
+	require.NoError(t, fallback.(Rotator).Rotate())
+	require.NoError(t, fallback.Close())
+
+	replayed := &memorySink{}
+	count, err := Replay(context.Background(), dir, replayed, 500)
+	require.NoError(t, err)
+	require.Equal(t, 201, count)
+}
+
+func TestBufferedDropsAfterClose(t *testing.T) {
+	buffered := NewMetricsBuffered(nil, nil, BufferedOptions{QueueSize: 1, FlushInterval: time.Hour})
+	buffered.Close()
+
+	buffered.LogEvent("late", nil, map[string]interface{}{"value": 1})
+	require.Equal(t, int64(1), buffered.Stats().Dropped)
+}
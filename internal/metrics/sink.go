@@ -0,0 +1,434 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	measurementEvent    = "bot_event"    // Measurement of the events
+	measurementDuration = "bot_duration" // Measurement of the observed durations
+	measurementGauge    = "bot_gauge"    // Measurement of the values of the gauges
+
+	fallbackFileName   = "metrics.jsonl" // Name of the active fallback file
+	fallbackFilePrefix = "metrics-"      // Prefix of the rotated fallback files
+	fallbackFileSuffix = ".jsonl"        // Suffix of the fallback files
+
+	fieldTypeFloat = "float" // Type of the float field in the fallback file
+	fieldTypeUint  = "uint"  // Type of the unsigned integer field in the fallback file
+)
+
+// Event is a single metrics point, which can be queued, batched and stored locally.
+type Event struct {
+	Measurement string                 `json:"measurement"`
+	Name        string                 `json:"name"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	Types       map[string]string      `json:"types,omitempty"` // Types of the float and uint fields in the fallback file
+	Time        time.Time              `json:"time"`
+}
+
+// Sink is a destination for the batches of events.
+type Sink interface {
+	Write(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// Rotator is a sink, which can seal its active file, so the events are replayed without waiting for the rotation.
+type Rotator interface {
+	Rotate() error
+}
+
+// influxSink writes the batches to InfluxDB with the blocking write API,
+// so the write errors can be retried and the events can fall back to the local sink.
+type influxSink struct {
+	client      influxdb2.Client
+	writeAPI    api.WriteAPIBlocking
+	defaultTags map[string]string
+}
+
+// Ensure influxSink implements Sink
+var _ Sink = (*influxSink)(nil)
+
+// NewInfluxSink creates a sink writing to the InfluxDB bucket.
+func NewInfluxSink(url string, token string, org string, bucket string, defaultTags map[string]string) Sink {
+	client := influxdb2.NewClient(url, token)
+
+	return &influxSink{
+		client:      client,
+		writeAPI:    client.WriteAPIBlocking(org, bucket),
+		defaultTags: defaultTags,
+	}
+}
+
+// Write converts the events to points and writes them in one request
+func (sink *influxSink) Write(ctx context.Context, events []Event) error {
+	points := make([]*write.Point, 0, len(events))
+
+	for _, event := range events {
+		tags := make(map[string]string, len(sink.defaultTags)+len(event.Tags)+1)
+		for key, value := range sink.defaultTags {
+			tags[key] = value
+		}
+
+		for key, value := range event.Tags {
+			tags[key] = value
+		}
+
+		if event.Measurement == measurementEvent {
+			tags["event"] = event.Name
+		} else {
+			tags["name"] = event.Name
+		}
+
+		points = append(points, influxdb2.NewPoint(event.Measurement, tags, event.Fields, event.Time))
+	}
+
+	return sink.writeAPI.WritePoint(ctx, points...)
+}
+
+// Close closes the client
+func (sink *influxSink) Close() error {
+	sink.client.Close()
+
+	return nil
+}
+
+// fileSink appends the events as JSON lines to a local file,
+// rotating it when the file exceeds the maximum size.
+type fileSink struct {
+	mu      sync.Mutex
+	dir     string
+	maxSize int64
+	file    *os.File
+	size    int64
+}
+
+// Ensure fileSink implements Sink and Rotator
+var (
+	_ Sink    = (*fileSink)(nil)
+	_ Rotator = (*fileSink)(nil)
+)
+
+// NewFileSink creates a sink writing JSON lines into the directory.
+// The active file is rotated when it grows over maxSize bytes, zero disables the rotation.
+func NewFileSink(dir string, maxSize int64) (Sink, error) {
+	const dirPermissions = 0o750
+
+	if err := os.MkdirAll(dir, dirPermissions); err != nil {
+		return nil, fmt.Errorf("create metrics fallback directory: %w", err)
+	}
+
+	sink := &fileSink{
+		dir:     dir,
+		maxSize: maxSize,
+	}
+
+	// Seal the active file left by the previous run, so it can be replayed
+	if _, err := os.Stat(filepath.Join(dir, fallbackFileName)); err == nil {
+		if err := sink.rename(); err != nil {
+			return nil, fmt.Errorf("rotate metrics fallback file: %w", err)
+		}
+	}
+
+	return sink, nil
+}
+
+// Write appends the events to the active file
+func (sink *fileSink) Write(_ context.Context, events []Event) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if err := sink.open(); err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+
+	encoder := json.NewEncoder(&buffer)
+
+	for i := range events {
+		record := fileRecord(events[i])
+		if err := encoder.Encode(&record); err != nil {
+			return err
+		}
+	}
+
+	written, err := sink.file.Write(buffer.Bytes())
+	sink.size += int64(written)
+
+	if err != nil {
+		return err
+	}
+
+	if sink.maxSize > 0 && sink.size >= sink.maxSize {
+		return sink.rotate()
+	}
+
+	return nil
+}
+
+// Close closes the active file
+func (sink *fileSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.file == nil {
+		return nil
+	}
+
+	err := sink.file.Close()
+	sink.file = nil
+
+	return err
+}
+
+// Rotate seals the active file, if anything is written to it
+func (sink *fileSink) Rotate() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if sink.file == nil || sink.size == 0 {
+		return nil
+	}
+
+	return sink.rotate()
+}
+
+// open opens the active file for appending, if it is not opened yet
+func (sink *fileSink) open() error {
+	if sink.file != nil {
+		return nil
+	}
+
+	const filePermissions = 0o600
+
+	file, err := os.OpenFile(filepath.Join(sink.dir, fallbackFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, filePermissions)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	sink.file = file
+	sink.size = info.Size()
+
+	return nil
+}
+
+// fileRecord converts the fields of the event to the InfluxDB field types
+// and keeps the types, which are lost in JSON, so the event is replayed with the same types.
+func fileRecord(event Event) Event {
+	if len(event.Fields) == 0 {
+		return event
+	}
+
+	point := write.NewPoint(event.Measurement, nil, event.Fields, event.Time)
+
+	event.Fields = make(map[string]interface{}, len(point.FieldList()))
+	event.Types = nil
+
+	for _, field := range point.FieldList() {
+		event.Fields[field.Key] = field.Value
+
+		switch field.Value.(type) {
+		case float64:
+			event.Types = setFieldType(event.Types, field.Key, fieldTypeFloat)
+		case uint64:
+			event.Types = setFieldType(event.Types, field.Key, fieldTypeUint)
+		}
+	}
+
+	return event
+}
+
+func setFieldType(types map[string]string, key string, fieldType string) map[string]string {
+	if types == nil {
+		types = make(map[string]string)
+	}
+
+	types[key] = fieldType
+
+	return types
+}
+
+// decodeRecord decodes the line of the fallback file, the numbers are restored with their types,
+// ints by default, as InfluxDB rejects the fields changing the type.
+func decodeRecord(line []byte) (Event, error) {
+	var event Event
+
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&event); err != nil {
+		return event, err
+	}
+
+	for key, value := range event.Fields {
+		number, ok := value.(json.Number)
+		if !ok {
+			continue
+		}
+
+		var err error
+
+		switch event.Types[key] {
+		case fieldTypeFloat:
+			event.Fields[key], err = number.Float64()
+		case fieldTypeUint:
+			event.Fields[key], err = strconv.ParseUint(number.String(), 10, 64)
+		default:
+			event.Fields[key], err = number.Int64()
+		}
+
+		if err != nil {
+			return event, fmt.Errorf("field %s: %w", key, err)
+		}
+	}
+
+	event.Types = nil
+
+	return event, nil
+}
+
+// rotate closes the active file and renames it with a timestamp
+func (sink *fileSink) rotate() error {
+	if err := sink.file.Close(); err != nil {
+		return err
+	}
+
+	sink.file = nil
+	sink.size = 0
+
+	return sink.rename()
+}
+
+// rename moves the active file aside with a timestamp in the name
+func (sink *fileSink) rename() error {
+	rotated := fmt.Sprintf("%s%s%s", fallbackFilePrefix, time.Now().UTC().Format("20060102T150405.000000000"), fallbackFileSuffix)
+
+	return os.Rename(filepath.Join(sink.dir, fallbackFileName), filepath.Join(sink.dir, rotated))
+}
+
+// Replay writes the rotated files of the file sink in the directory to the sink,
+// oldest files first, and removes every file once it is written completely.
+// The active file is skipped, so the replay is safe while the file sink is writing,
+// it is sealed with Rotate of the file sink first to be replayed as well.
+// A file that failed in the middle is replayed again from the start,
+// which is harmless for InfluxDB, as the points with the same time and tags are overwritten.
+func Replay(ctx context.Context, dir string, sink Sink, batchSize int) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	files := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, fallbackFileSuffix) {
+			continue
+		}
+
+		if strings.HasPrefix(name, fallbackFilePrefix) {
+			files = append(files, name)
+		}
+	}
+
+	// Rotated files are named by time
+	sort.Strings(files)
+
+	replayed := 0
+
+	for _, name := range files {
+		count, err := replayFile(ctx, filepath.Join(dir, name), sink, batchSize)
+		replayed += count
+
+		if err != nil {
+			return replayed, fmt.Errorf("replay %s: %w", name, err)
+		}
+	}
+
+	return replayed, nil
+}
+
+// replayFile writes the events from the file to the sink in batches and removes the file.
+func replayFile(ctx context.Context, path string, sink Sink, batchSize int) (int, error) {
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	scanner := bufio.NewScanner(file)
+	batch := make([]Event, 0, batchSize)
+	replayed := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := sink.Write(ctx, batch); err != nil {
+			return err
+		}
+
+		replayed += len(batch)
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for scanner.Scan() {
+		event, err := decodeRecord(scanner.Bytes())
+		if err != nil {
+			continue // Skip the corrupted line, e.g. a partially written one
+		}
+
+		batch = append(batch, event)
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return replayed, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return replayed, err
+	}
+
+	if err := flush(); err != nil {
+		return replayed, err
+	}
+
+	_ = file.Close()
+
+	return replayed, os.Remove(path)
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// Media types of the announcements.
+const (
+	AnnouncementMediaPhoto     = "photo"
+	AnnouncementMediaVideo     = "video"
+	AnnouncementMediaAnimation = "animation"
+	AnnouncementMediaDocument  = "document"
+)
+
+const (
+	maxAnnouncementText    = 4096 // Maximum length of the message
+	maxAnnouncementCaption = 1024 // Maximum length of the caption of the media
+)
+
+var (
+	errorAnnouncementEmpty   = errors.New("the announcement has neither the text nor the media")
+	errorAnnouncementMedia   = errors.New("the media type must be photo, video, animation or document with the media")
+	errorAnnouncementTooLong = errors.New("the announcement is too long")
+)
+
+// Announcement - the message posted to the chat once or by the schedule.
+type Announcement struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement" json:"id"`         // ID of the announcement.
+	ChatID    ChatID `gorm:"not null;index"           json:"chat_id"`    // ID of the chat.
+	Text      string `gorm:"not null;default:''"      json:"text"`       // Text of the message, or the caption of the media.
+	MediaType string `gorm:"not null;default:''"      json:"media_type"` // Type of the media: photo | video | animation | document, empty for the text.
+	Media     string `gorm:"not null;default:''"      json:"media"`      // Telegram file ID or URL of the media.
+	Pin       bool   `gorm:"not null;default:false"   json:"pin"`        // True, if the message is pinned and the previous one is unpinned.
+	Schedule  string `gorm:"not null;default:''"      json:"schedule"`   // Cron spec of the recurring announcement, empty for the one-off.
+
+	NextRunAt     sql.NullTime `gorm:"index"                json:"next_run_at"`     // Time of the next post, null when the one-off is posted.
+	LastSentAt    sql.NullTime `json:"last_sent_at"`                                // Time of the last post.
+	LastMessageID int64        `gorm:"not null;default:0"   json:"last_message_id"` // ID of the last posted message.
+	LastError     string       `gorm:"not null;default:''"  json:"last_error"`      // Error of the last post, empty if posted.
+	Sent          int64        `gorm:"not null;default:0"   json:"sent"`            // Number of the posts.
+	CreatedByID   UserID       `json:"created_by_id"`                               // ID of the admin who created the announcement, 0 if via the API.
+
+	// Meta fields
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"` // Time when the announcement was created.
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"` // Time when the announcement was last updated.
+}
+
+// TableName - set the table name.
+func (Announcement) TableName() string {
+	return "announcements"
+}
+
+// IsRecurring - whether the announcement is posted by the schedule.
+func (obj *Announcement) IsRecurring() bool {
+	return obj.Schedule != ""
+}
+
+// IsActive - whether the announcement is posted again.
+func (obj *Announcement) IsActive() bool {
+	return obj.NextRunAt.Valid
+}
+
+// Validate - check the media and the length of the text, which is the caption if the media is set.
+func (obj *Announcement) Validate() error {
+	mediaTypes := []string{AnnouncementMediaPhoto, AnnouncementMediaVideo, AnnouncementMediaAnimation, AnnouncementMediaDocument}
+
+	switch {
+	case obj.Text == "" && obj.Media == "":
+		return errorAnnouncementEmpty
+	case (obj.Media == "") != (obj.MediaType == ""), obj.MediaType != "" && !slices.Contains(mediaTypes, obj.MediaType):
+		return errorAnnouncementMedia
+	}
+
+	limit := maxAnnouncementText
+	if obj.Media != "" {
+		limit = maxAnnouncementCaption
+	}
+
+	if utf8.RuneCountInString(obj.Text) > limit {
+		return fmt.Errorf("%w: %d characters at most", errorAnnouncementTooLong, limit)
+	}
+
+	return nil
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+)
+
+// BanChat - the chat where the bot banned the user in Telegram, so the user is unbanned there when the ban is lifted.
+type BanChat struct {
+	UserID   UserID    `gorm:"primaryKey;autoIncrement:false" json:"user_id"`   // ID of the banned user.
+	ChatID   ChatID    `gorm:"primaryKey;autoIncrement:false" json:"chat_id"`   // ID of the chat.
+	BannedAt time.Time `gorm:"not null"                       json:"banned_at"` // Time when the user was banned in the chat.
+}
+
+// TableName - set the table name.
+func (BanChat) TableName() string {
+	return "ban_chats"
+}
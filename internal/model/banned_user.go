@@ -12,7 +12,11 @@ type BannedUser struct {
 	ID        UserID       `gorm:"primaryKey" hash:"x" json:"id"`
 	BannedAt  time.Time    `gorm:"not null"   hash:"x" json:"banned_at"`  // The time when the user was banned
 	Reason    string       `gorm:"not null"   hash:"x" json:"reason"`     // Reason for the ban
-	ExpiresAt sql.NullTime `gorm:"null"       hash:"x" json:"expires_at"` // Expiry time of the ban, null if indefinite
+	ExpiresAt sql.NullTime `gorm:"null;index" hash:"x" json:"expires_at"` // Expiry time of the ban, null if indefinite
+
+	// Federation fields
+	Source string `gorm:"index;not null;default:''" hash:"x" json:"source"` // Peer the ban is imported from, empty for the local bans
+	Trust  int    `gorm:"not null;default:0"        hash:"x" json:"trust"`  // Trust level of the peer from 1 to 100, 0 for the local bans
 
 	// Meta fields
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"` // Time when the user was last updated
@@ -29,6 +33,16 @@ func (obj *BannedUser) GetID() int64 {
 	return int64(obj.ID)
 }
 
+// IsExpired - check if the ban is over, the expired bans are not enforced and removed by the sweeper.
+func (obj *BannedUser) IsExpired(now time.Time) bool {
+	return obj.ExpiresAt.Valid && !obj.ExpiresAt.Time.After(now)
+}
+
+// IsLocal - check if the user is banned by this instance, not imported from a peer.
+func (obj *BannedUser) IsLocal() bool {
+	return obj.Source == ""
+}
+
 // Hash - calculate the hash of the object.
 func (obj *BannedUser) Hash() (string, error) {
 	return utility.Hash(obj)
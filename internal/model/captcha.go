@@ -3,11 +3,13 @@ package model
 import (
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dchest/captcha"
+	"github.com/plugfox/foxy-gram-server/internal/config"
 	"github.com/plugfox/foxy-gram-server/internal/global"
 	"github.com/plugfox/foxy-gram-server/internal/utility"
 )
@@ -25,6 +27,12 @@ type Captcha struct {
 
 	MessageID int64 `gorm:"index" hash:"x" json:"message_id"` // Identifier for the message.
 
+	JoinChatID int64 `gorm:"index" hash:"x" json:"join_chat_id"` // Optional. Chat the user requested to join, the captcha is sent in the private chat.
+
+	QueuedJoinChats string `hash:"x" json:"queued_join_chats"` // Optional. Other chats the user requested to join while the captcha was active, separated by commas.
+
+	Attempts int `hash:"x" json:"attempts"` // Number of the wrong inputs.
+
 	Digits string `hash:"x" json:"digits"` // Digits of the captcha.
 
 	Input string `hash:"x" json:"input"` // User input for the captcha.
@@ -40,6 +48,7 @@ type Captcha struct {
 	ExpiresAt time.Time `hash:"x" json:"expires_at"` // Time when the captcha expires.
 
 	// Meta fields
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"` // Time when the captcha was sent.
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"` // Time when the captcha was last updated.
 }
 
@@ -58,11 +67,68 @@ func (obj *Captcha) Hash() (string, error) {
 	return utility.Hash(obj)
 }
 
+// IsJoinRequest - checks if the captcha was sent for the join request.
+func (obj *Captcha) IsJoinRequest() bool {
+	return obj.JoinChatID != 0
+}
+
+// JoinChats - the chats the user requested to join, approved or declined together with the captcha.
+func (obj *Captcha) JoinChats() []int64 {
+	var chats []int64
+
+	if obj.JoinChatID != 0 {
+		chats = append(chats, obj.JoinChatID)
+	}
+
+	for _, value := range strings.Split(obj.QueuedJoinChats, ",") {
+		if chatID, err := strconv.ParseInt(value, 10, 64); err == nil && chatID != 0 {
+			chats = append(chats, chatID)
+		}
+	}
+
+	return chats
+}
+
+// QueueJoinChat - add the chat the user requested to join while the captcha is active,
+// false if the chat is already requested.
+func (obj *Captcha) QueueJoinChat(chatID int64) bool {
+	if slices.Contains(obj.JoinChats(), chatID) {
+		return false
+	}
+
+	if obj.QueuedJoinChats != "" {
+		obj.QueuedJoinChats += ","
+	}
+
+	obj.QueuedJoinChats += strconv.FormatInt(chatID, 10)
+
+	return true
+}
+
+// ModeratedChatID - the chat the captcha protects: the requested chat for the join requests,
+// otherwise the chat of the captcha message.
+func (obj *Captcha) ModeratedChatID() int64 {
+	if obj.IsJoinRequest() {
+		return obj.JoinChatID
+	}
+
+	return obj.ChatID
+}
+
 // Expired - checks if the captcha has expired.
 func (obj *Captcha) Expired() bool {
 	return obj.ExpiresAt.Before(time.Now())
 }
 
+// SolveDuration - time since the captcha was sent, zero if unknown.
+func (obj *Captcha) SolveDuration() time.Duration {
+	if obj.CreatedAt.IsZero() {
+		return 0
+	}
+
+	return time.Since(obj.CreatedAt)
+}
+
 // Validate - checks if the captcha input is correct.
 func (obj *Captcha) Validate() bool {
 	return obj.Digits == obj.Input && !obj.Expired()
@@ -107,9 +173,13 @@ func (obj *Captcha) Caption(username string, firstName string, lastName string)
 	return caption
 }
 
-// Generates a new captcha with the given configuration.
+// Generates a new captcha with the configuration.
 func GenerateCaptcha(writer io.Writer) (*Captcha, error) {
-	config := global.Config.Captcha
+	return GenerateCaptchaWithConfig(writer, global.Config.Captcha)
+}
+
+// Generates a new captcha with the given configuration, e.g. the stricter one in the lockdown.
+func GenerateCaptchaWithConfig(writer io.Writer, config config.CaptchaConfig) (*Captcha, error) {
 	randomDigits := captcha.RandomDigits(config.Length)
 
 	id := string(captcha.RandomDigits(idLength))
@@ -143,8 +213,18 @@ func GenerateCaptcha(writer io.Writer) (*Captcha, error) {
 	}, nil
 }
 
+// Refresh - generate new digits of the same length and expiration.
 func (obj *Captcha) Refresh(writer io.Writer) error {
-	newCaptcha, err := GenerateCaptcha(writer)
+	config := global.Config.Captcha
+	if obj.Length > 0 {
+		config.Length = obj.Length
+	}
+
+	if obj.Expiration > 0 {
+		config.Expiration = obj.Expiration
+	}
+
+	newCaptcha, err := GenerateCaptchaWithConfig(writer, config)
 	if err != nil {
 		return err
 	}
@@ -31,17 +31,19 @@ func TestCaptchaHash(t *testing.T) {
 				UserID:     1,
 				ChatID:     1,
 				MessageID:  1,
+				JoinChatID: 1,
+				Attempts:   1,
 				ExpiresAt:  time.Time{},
 				UpdatedAt:  time.Time{},
 			},
-			ExpectedHash: "66025f011be311b43ef54f423ccf39c1e96a1105004a382f394d6b79e95df4cc",
+			ExpectedHash: "5316ab91ef27d8283710c3f5b7e2dcdead10ceaf12eae4b08ac614d9ac4f49d8",
 		},
 		{
 			Name: "Captcha with missing fields",
 			Captcha: &Captcha{
 				ID: 1,
 			},
-			ExpectedHash: "7bd1ebf0a92a85b609177346c8a3e87104ebb62bab3ade021e3ee5456b5403e0",
+			ExpectedHash: "0981c33d690c0de3238767db08bcc9885e08d0a161ad50af1e678169cad88df1",
 		},
 	}
 
@@ -60,6 +62,19 @@ func TestCaptchaHash(t *testing.T) {
 	}
 }
 
+func TestCaptchaQueueJoinChat(t *testing.T) {
+	captcha := &Captcha{JoinChatID: -100}
+
+	require.True(t, captcha.QueueJoinChat(-200))
+	require.True(t, captcha.QueueJoinChat(-300))
+	require.False(t, captcha.QueueJoinChat(-100), "The chat of the captcha is not queued")
+	require.False(t, captcha.QueueJoinChat(-200), "The queued chat is not queued twice")
+	require.Equal(t, []int64{-100, -200, -300}, captcha.JoinChats())
+
+	require.Equal(t, []int64{-200}, (&Captcha{QueuedJoinChats: "-200"}).JoinChats())
+	require.Empty(t, (&Captcha{}).JoinChats())
+}
+
 func TestBytesToString(t *testing.T) {
 	bytes := []byte{1, 2, 3, 4, 5}
 
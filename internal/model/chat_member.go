@@ -0,0 +1,68 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ChatMember - membership of the user in the chat, kept up to date from the chat member updates.
+type ChatMember struct {
+	ChatID      ChatID       `gorm:"primaryKey;autoIncrement:false"       json:"chat_id"`     // ID of the chat.
+	UserID      UserID       `gorm:"primaryKey;autoIncrement:false;index" json:"user_id"`     // ID of the member.
+	Status      string       `json:"status"`                                                  // Status: creator, administrator, member, restricted, left or kicked.
+	IsMember    bool         `json:"is_member"`                                               // True, if the user is in the chat now.
+	JoinedAt    sql.NullTime `json:"joined_at"`                                               // Time of the last join.
+	LeftAt      sql.NullTime `json:"left_at"`                                                 // Time of the last leave, null if the user is in the chat.
+	InvitedByID UserID       `json:"invited_by_id"`                                           // Optional. ID of the user who added the member, zero if the user joined by themselves.
+	InviteLink  string       `gorm:"index"                                json:"invite_link"` // Optional. Invite link used to join the chat.
+
+	// Meta fields
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"` // Time when the membership was last updated.
+}
+
+// TableName - set the table name.
+func (ChatMember) TableName() string {
+	return "chat_members"
+}
+
+// NewChatMember - create the membership of the user, who has not joined the chat yet.
+func NewChatMember(chatID int64, userID int64) *ChatMember {
+	return &ChatMember{
+		ChatID: ChatID(chatID),
+		UserID: UserID(userID),
+		Status: "left",
+	}
+}
+
+// Apply - apply the new status of the member at the time.
+// Returns whether the user joined or left the chat with this change.
+func (obj *ChatMember) Apply(status string, isMember bool, at time.Time) (joined bool, left bool) {
+	obj.Status = status
+
+	switch {
+	case isMember && !obj.IsMember:
+		obj.IsMember = true
+		obj.JoinedAt = sql.NullTime{Time: at.UTC(), Valid: true}
+		obj.LeftAt = sql.NullTime{}
+		obj.InvitedByID = 0
+		obj.InviteLink = ""
+
+		return true, false
+	case !isMember && obj.IsMember:
+		obj.IsMember = false
+		obj.LeftAt = sql.NullTime{Time: at.UTC(), Valid: true}
+
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// Stayed - how long the user stayed in the chat before the last leave, zero if the user is in the chat.
+func (obj *ChatMember) Stayed() time.Duration {
+	if obj.IsMember || !obj.JoinedAt.Valid || !obj.LeftAt.Valid {
+		return 0
+	}
+
+	return obj.LeftAt.Time.Sub(obj.JoinedAt.Time)
+}
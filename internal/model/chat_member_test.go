@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatMemberApply(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	member := NewChatMember(-100, 1)
+
+	testcases := []struct {
+		Name     string
+		Status   string
+		IsMember bool
+		At       time.Time
+		Joined   bool
+		Left     bool
+		Stayed   time.Duration
+	}{
+		{Name: "Join", Status: "member", IsMember: true, At: at, Joined: true},
+		{Name: "Promoted", Status: "administrator", IsMember: true, At: at.Add(time.Second)},
+		{Name: "Leave", Status: "left", IsMember: false, At: at.Add(time.Minute), Left: true, Stayed: time.Minute},
+		{Name: "Kicked after leave", Status: "kicked", IsMember: false, At: at.Add(2 * time.Minute), Stayed: time.Minute},
+		{Name: "Join again", Status: "restricted", IsMember: true, At: at.Add(time.Hour), Joined: true},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			joined, left := member.Apply(testcase.Status, testcase.IsMember, testcase.At)
+			require.Equal(t, testcase.Joined, joined)
+			require.Equal(t, testcase.Left, left)
+			require.Equal(t, testcase.Status, member.Status)
+			require.Equal(t, testcase.Stayed, member.Stayed())
+		})
+	}
+
+	require.Equal(t, at.Add(time.Hour), member.JoinedAt.Time)
+	require.False(t, member.LeftAt.Valid)
+}
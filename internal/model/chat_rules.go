@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+// ChatRules - rules of the chat, shown with the /rules command.
+type ChatRules struct {
+	ChatID            ChatID `gorm:"primaryKey;autoIncrement:false" json:"chat_id"` // ID of the chat.
+	Text              string `json:"text"`                                          // Text of the rules.
+	RequireAcceptance bool   `json:"require_acceptance"`                            // True, if the users accept the rules after the captcha to be verified.
+	UpdatedByID       UserID `json:"updated_by_id"`                                 // ID of the admin who last updated the rules.
+
+	// Meta fields
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"` // Time when the rules were last updated.
+}
+
+// TableName - set the table name.
+func (ChatRules) TableName() string {
+	return "chat_rules"
+}
+
+// AcceptanceRequired - check if the users have to accept the rules to be verified.
+func (obj *ChatRules) AcceptanceRequired() bool {
+	return obj != nil && obj.RequireAcceptance && obj.Text != ""
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrInviteLinkOtherChat - the invite link belongs to another chat than requested.
+var ErrInviteLinkOtherChat = errors.New("invite link belongs to another chat")
+
+// InviteLink - invite link of the chat, created by the bot for a campaign.
+type InviteLink struct {
+	Link        string       `gorm:"primaryKey" json:"link"`    // The invite link.
+	ChatID      ChatID       `gorm:"index"      json:"chat_id"` // ID of the chat.
+	Name        string       `json:"name"`                      // Name of the link, e.g. the campaign.
+	CreatorID   UserID       `json:"creator_id"`                // ID of the creator of the link, the bot itself.
+	ExpireAt    sql.NullTime `json:"expire_at"`                 // Optional. Time when the link expires.
+	MemberLimit int          `json:"member_limit"`              // Optional. Maximum number of users joining by the link, zero if unlimited.
+	IsRevoked   bool         `json:"is_revoked"`                // True, if the link was revoked.
+
+	// Meta fields
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"` // Time when the link was created.
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"` // Time when the link was last updated.
+}
+
+// TableName - set the table name.
+func (InviteLink) TableName() string {
+	return "invite_links"
+}
+
+// Active - check if the link can still be used to join the chat.
+func (obj *InviteLink) Active(now time.Time) bool {
+	return !obj.IsRevoked && (!obj.ExpireAt.Valid || now.Before(obj.ExpireAt.Time))
+}
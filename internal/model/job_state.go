@@ -0,0 +1,36 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// JobState - the persisted state of the scheduled job, shared by the replicas,
+// so the job is run by a single replica at a time and is not run again before the next run time.
+type JobState struct {
+	Name         string        `gorm:"primaryKey"            json:"name"`          // Name of the job.
+	LastRunAt    sql.NullTime  `json:"last_run_at"`                                // Start time of the last run, null if never run.
+	LastDuration time.Duration `gorm:"not null;default:0"    json:"last_duration"` // Duration of the last run.
+	LastError    string        `gorm:"not null;default:''"   json:"last_error"`    // Error of the last run, empty if succeeded.
+	NextRunAt    sql.NullTime  `json:"next_run_at"`                                // Time of the next run, null to run on start.
+	Runs         int64         `gorm:"not null;default:0"    json:"runs"`          // Number of the runs.
+	Failures     int64         `gorm:"not null;default:0"    json:"failures"`      // Number of the failed runs.
+	LockedBy     string        `gorm:"not null;default:''"   json:"locked_by"`     // Replica running the job, empty if not running.
+	LockedUntil  sql.NullTime  `json:"locked_until"`                               // Lock expires, if the replica is gone while running.
+	UpdatedAt    time.Time     `gorm:"autoUpdateTime"        json:"updated_at"`    // Time when the state was last updated.
+}
+
+// TableName - set the table name.
+func (JobState) TableName() string {
+	return "job_states"
+}
+
+// IsLocked - whether the job is running on a replica at the time.
+func (obj *JobState) IsLocked(now time.Time) bool {
+	return obj.LockedBy != "" && obj.LockedUntil.Valid && obj.LockedUntil.Time.After(now)
+}
+
+// IsDue - whether the next run time of the job is reached.
+func (obj *JobState) IsDue(now time.Time) bool {
+	return !obj.NextRunAt.Valid || !obj.NextRunAt.Time.After(now)
+}
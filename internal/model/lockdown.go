@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+)
+
+// Reasons of the lockdowns.
+const (
+	LockdownReasonRaid   = "raid"   // Started by the raid detector
+	LockdownReasonManual = "manual" // Started by an admin
+)
+
+// Lockdown - the chat is locked down, e.g. after the raid: the default permissions are restricted
+// and the captchas are stricter until the lockdown ends.
+type Lockdown struct {
+	ChatID      ChatID    `gorm:"primaryKey;autoIncrement:false" json:"chat_id"`     // ID of the chat.
+	Reason      string    `gorm:"not null;default:''"            json:"reason"`      // Reason of the lockdown: raid | manual.
+	Joins       int       `gorm:"not null;default:0"             json:"joins"`       // Joins within the window, which started the lockdown.
+	Restricted  bool      `gorm:"not null;default:false"         json:"restricted"`  // True, if the default permissions of the chat are restricted.
+	Permissions string    `gorm:"not null;default:''"            json:"permissions"` // JSON of the default permissions before the lockdown, restored at the end.
+	StartedByID UserID    `json:"started_by_id"`                                     // ID of the admin who started the lockdown, 0 for the raid detector.
+	StartedAt   time.Time `json:"started_at"`                                        // Time when the lockdown started.
+	EndsAt      time.Time `gorm:"index"                          json:"ends_at"`     // Time when the lockdown ends, extended while the raid goes on.
+
+	// Meta fields
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"` // Time when the lockdown was last updated.
+}
+
+// TableName - set the table name.
+func (Lockdown) TableName() string {
+	return "lockdowns"
+}
+
+// IsActive - whether the lockdown is not over at the time.
+func (obj *Lockdown) IsActive(now time.Time) bool {
+	return obj != nil && obj.EndsAt.After(now)
+}
@@ -26,6 +26,15 @@ type Message struct {
 	IsForwarded bool         `hash:"x"          json:"is_forwarded"`                    // True if the message was forwarded.
 	ReplyToID   MessageID    `gorm:"index"      hash:"x"            json:"reply_to_id"` // Optional. ID of the original message for replies.
 
+	// Content fields
+	Entities        string `hash:"x"     json:"entities"`                // Optional. JSON-encoded entities of the text, e.g. links and mentions.
+	CaptionEntities string `hash:"x"     json:"caption_entities"`        // Optional. JSON-encoded entities of the caption.
+	MediaType       string `gorm:"index" hash:"x" json:"media_type"`     // Optional. Type of the media, e.g. "photo", "video", "sticker".
+	FileID          string `hash:"x"     json:"file_id"`                 // Optional. Identifier of the media file, to download or resend it.
+	FileUniqueID    string `gorm:"index" hash:"x" json:"file_unique_id"` // Optional. Identifier of the media file, the same across bots and time.
+	FileSize        int64  `hash:"x"     json:"file_size"`               // Optional. Size of the media file in bytes.
+	ViaBotID        UserID `gorm:"index" hash:"x" json:"via_bot_id"`     // Optional. ID of the inline bot the message was sent via.
+
 	// Relations
 	Sender  *User    `gorm:"foreignKey:SenderID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`  // Reference to the sender.
 	Chat    *Chat    `gorm:"foreignKey:ChatID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`    // Reference to the chat.
@@ -71,6 +80,12 @@ func (id MessageID) ToString() string {
 	return strconv.FormatInt(int64(id), 10)
 }
 
+// ContentChanged - check if the text, the caption or their entities differ between the messages.
+func (obj *Message) ContentChanged(other *Message) bool {
+	return obj.Text != other.Text || obj.Caption != other.Caption ||
+		obj.Entities != other.Entities || obj.CaptionEntities != other.CaptionEntities
+}
+
 // Hash - calculate the hash of the object.
 func (obj *Message) Hash() (string, error) {
 	return utility.Hash(obj)
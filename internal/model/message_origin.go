@@ -3,10 +3,18 @@ package model
 type MessageOrigin struct {
 	ID               int64     `gorm:"PrimaryKey"    json:"id"`                 // Unique identifier for the message origin.
 	OriginalChatID   ChatID    `gorm:"index"         json:"original_chat_id"`   // ID of the original chat.
+	ChatID           ChatID    `gorm:"index"         json:"chat_id"`            // ID of the chat of the forwarded message.
 	MessageID        MessageID `gorm:"index"         json:"message_id"`         // ID of the forwarded message.
 	OriginalSenderID UserID    `gorm:"index"         json:"original_sender_id"` // ID of the original sender.
 	OriginalText     string    `json:"original_text"`                           // Text of the original message.
 
+	// Origin fields
+	Type              string `json:"type"`                // Type of the origin: "user", "hidden_user", "chat" or "channel".
+	SenderName        string `json:"sender_name"`         // Optional. Name of the sender hidden by the privacy settings.
+	OriginalMessageID int64  `json:"original_message_id"` // Optional. ID of the original message in the channel.
+	Signature         string `json:"signature"`           // Optional. Signature of the original author.
+	OriginalUnixtime  int64  `json:"original_unixtime"`   // Unix time when the original message was sent.
+
 	// Relations
 	OriginalChat   *Chat    `gorm:"foreignKey:OriginalChatID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`   // Reference to the original chat.
 	OriginalSender *User    `gorm:"foreignKey:OriginalSenderID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"` // Reference to the original sender.
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+)
+
+// MessageRevision - a previous version of the edited message.
+type MessageRevision struct {
+	ID              int64     `gorm:"primaryKey;autoIncrement"     json:"id"`
+	MessageID       MessageID `gorm:"index:idx_revision_message"   json:"message_id"` // ID of the edited message.
+	ChatID          ChatID    `gorm:"index:idx_revision_message"   json:"chat_id"`    // ID of the chat the message belongs to.
+	SenderID        UserID    `gorm:"index"                        json:"sender_id"`  // ID of the sender.
+	Text            string    `json:"text"`                                           // Text of the version.
+	Caption         string    `json:"caption"`                                        // Optional. Media caption of the version.
+	Entities        string    `json:"entities"`                                       // Optional. JSON-encoded entities of the text.
+	CaptionEntities string    `json:"caption_entities"`                               // Optional. JSON-encoded entities of the caption.
+	Unixtime        int64     `json:"unixtime"`                                       // Unix timestamp when the version was sent or edited.
+	CreatedAt       time.Time `gorm:"autoCreateTime"               json:"created_at"` // Time when the version was replaced.
+}
+
+// TableName - set the table name.
+func (MessageRevision) TableName() string {
+	return "message_revisions"
+}
+
+// GetID - get the revision ID.
+func (obj *MessageRevision) GetID() int64 {
+	return obj.ID
+}
+
+// NewMessageRevision - create the revision from the current version of the message.
+func NewMessageRevision(message *Message) *MessageRevision {
+	unixtime := message.Unixtime
+	if message.LastEdit.Valid {
+		unixtime = message.LastEdit.Time.Unix()
+	}
+
+	return &MessageRevision{
+		MessageID:       message.ID,
+		ChatID:          message.ChatID,
+		SenderID:        message.SenderID,
+		Text:            message.Text,
+		Caption:         message.Caption,
+		Entities:        message.Entities,
+		CaptionEntities: message.CaptionEntities,
+		Unixtime:        unixtime,
+	}
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"time"
+)
+
+// ModerationEventType - type of the moderation event.
+type ModerationEventType string
+
+const (
+	ModerationEventJoin           ModerationEventType = "join"            // User joined the chat
+	ModerationEventVerification   ModerationEventType = "verification"    // User was verified
+	ModerationEventBan            ModerationEventType = "ban"             // User was banned
+	ModerationEventCaptchaSent    ModerationEventType = "captcha_sent"    // Captcha was sent to the user
+	ModerationEventCaptchaSolved  ModerationEventType = "captcha_solved"  // Captcha was solved by the user
+	ModerationEventCaptchaFailed  ModerationEventType = "captcha_failed"  // Captcha input was wrong
+	ModerationEventCaptchaExpired ModerationEventType = "captcha_expired" // Captcha was not solved in time
+	ModerationEventMessageDeleted ModerationEventType = "message_deleted" // Message was deleted as spam
+	ModerationEventJoinLeave      ModerationEventType = "join_leave"      // User left the chat shortly after the join
+	ModerationEventJoinApproved   ModerationEventType = "join_approved"   // Join request was approved after the captcha
+	ModerationEventJoinDeclined   ModerationEventType = "join_declined"   // Join request was declined, the captcha was failed or not solved in time
+	ModerationEventUnban          ModerationEventType = "unban"           // User was unbanned in the chat, the ban expired or was lifted
+)
+
+// ModerationEvent - an action of the bot in the chat, stored for the statistics.
+type ModerationEvent struct {
+	ID       int64               `gorm:"primaryKey;autoIncrement"      json:"id"`
+	Type     ModerationEventType `gorm:"index:idx_moderation_type_time" json:"type"`     // Type of the event
+	ChatID   ChatID              `gorm:"index"                          json:"chat_id"`  // Chat of the event, zero if not related to a chat
+	UserID   UserID              `gorm:"index"                          json:"user_id"`  // User of the event
+	Rule     string              `json:"rule"`                                           // Rule or reason which triggered the event, e.g. "unverified", "local_db"
+	Unixtime int64               `gorm:"index:idx_moderation_type_time" json:"unixtime"` // Unix timestamp of the event
+	Duration int64               `json:"duration"`                                       // Optional. Duration in milliseconds, e.g. captcha solve time
+}
+
+// TableName - set the table name.
+func (ModerationEvent) TableName() string {
+	return "moderation_events"
+}
+
+// GetID - get the event ID.
+func (obj *ModerationEvent) GetID() int64 {
+	return obj.ID
+}
+
+// NewModerationEvent - create a new moderation event happened now.
+func NewModerationEvent(eventType ModerationEventType, chatID int64, userID int64, rule string) *ModerationEvent {
+	return &ModerationEvent{
+		Type:     eventType,
+		ChatID:   ChatID(chatID),
+		UserID:   UserID(userID),
+		Rule:     rule,
+		Unixtime: time.Now().Unix(),
+	}
+}
+
+// WithDuration - set the duration of the event.
+func (obj *ModerationEvent) WithDuration(duration time.Duration) *ModerationEvent {
+	obj.Duration = duration.Milliseconds()
+
+	return obj
+}
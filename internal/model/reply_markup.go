@@ -2,6 +2,7 @@ package model
 
 type ReplyMarkup struct {
 	ID        int64     `gorm:"PrimaryKey" json:"id"`
+	ChatID    ChatID    `gorm:"index"      json:"chat_id"` // ID of the chat of the message.
 	MessageID MessageID `gorm:"index"      json:"message_id"`
 	Data      string    `json:"data"` // JSON-encoded reply markup.
 
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/plugfox/foxy-gram-server/internal/utility"
@@ -12,6 +13,7 @@ type VerifiedUser struct {
 	VerifiedAt time.Time `gorm:"not null"   hash:"x" json:"verified_at"` // The time when the user was verified
 	Reason     string    `gorm:"not null"   hash:"x" json:"reason"`      // Reason for the verification
 	// ExpiresAt  sql.NullTime `hash:"x" gorm:"null" json:"expires_at"`      // Expiry time of the verification, null if indefinite
+	RulesAcceptedAt sql.NullTime `gorm:"null" hash:"x" json:"rules_accepted_at"` // The time when the user accepted the rules of the chat, null if not required
 
 	// Meta fields
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"` // Time when the user was last updated.
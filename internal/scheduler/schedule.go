@@ -0,0 +1,208 @@
+// Package scheduler runs the background jobs by their schedules.
+// The states of the jobs are persisted, so the replicas share them and a job is run by a single replica at a time.
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errorInvalidSchedule  = errors.New("invalid schedule")
+	errorInvalidCronField = errors.New("invalid cron field")
+)
+
+// Schedule - when the job is run.
+type Schedule interface {
+	// Next - the first run time after the time, zero if there is none.
+	Next(after time.Time) time.Time
+	// String - the spec of the schedule.
+	String() string
+}
+
+// Every - the schedule running the job every interval.
+func Every(interval time.Duration) Schedule {
+	return every(interval)
+}
+
+type every time.Duration
+
+func (s every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(s))
+}
+
+func (s every) String() string {
+	return "@every " + time.Duration(s).String()
+}
+
+// Parse - parse the spec of the schedule:
+// "@every 10m", "@hourly", "@daily", "@weekly", "@monthly"
+// or the five cron fields "minute hour day-of-month month day-of-week", e.g. "*/15 3-5 * * 1,3".
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if value, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("%w %q: positive interval expected", errorInvalidSchedule, spec)
+		}
+
+		return Every(interval), nil
+	}
+
+	descriptors := map[string]string{
+		"@hourly":  "0 * * * *",
+		"@daily":   "0 0 * * *",
+		"@weekly":  "0 0 * * 0",
+		"@monthly": "0 0 1 * *",
+	}
+
+	fields := strings.Fields(spec)
+	if expanded, ok := descriptors[spec]; ok {
+		fields = strings.Fields(expanded)
+	}
+
+	if len(fields) != 5 { //nolint:mnd
+		return nil, fmt.Errorf("%w %q: five cron fields expected", errorInvalidSchedule, spec)
+	}
+
+	cron := cronSchedule{spec: spec}
+	ranges := []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&cron.minutes, 0, 59},
+		{&cron.hours, 0, 23},
+		{&cron.days, 1, 31},
+		{&cron.months, 1, 12},
+		{&cron.weekdays, 0, 7},
+	}
+
+	for i, field := range fields {
+		bits, err := parseField(field, ranges[i].min, ranges[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %w", errorInvalidSchedule, spec, err)
+		}
+
+		*ranges[i].bits = bits
+	}
+
+	// Sunday is either 0 or 7
+	if cron.weekdays&(1<<7) != 0 {
+		cron.weekdays |= 1
+	}
+
+	cron.anyDay = fields[2] == "*"
+	cron.anyWeekday = fields[4] == "*"
+
+	if cron.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%w %q: the date never occurs", errorInvalidSchedule, spec)
+	}
+
+	return &cron, nil
+}
+
+// parseField - the bits of the values of the cron field, e.g. "*", "5", "1-5", "*/10", "0-30/5", "1,15".
+func parseField(field string, minimum int, maximum int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		expr, stepValue, hasStep := strings.Cut(part, "/")
+
+		step := 1
+
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepValue); err != nil || step < 1 {
+				return 0, fmt.Errorf("%w: step %q is not positive", errorInvalidCronField, stepValue)
+			}
+		}
+
+		low, high := minimum, maximum
+
+		if expr != "*" {
+			first, last, isRange := strings.Cut(expr, "-")
+
+			var err error
+			if low, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("%w: value %q is not a number", errorInvalidCronField, first)
+			}
+
+			high = low
+
+			if isRange {
+				if high, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("%w: value %q is not a number", errorInvalidCronField, last)
+				}
+			} else if hasStep {
+				high = maximum
+			}
+		}
+
+		if low < minimum || high > maximum || low > high {
+			return 0, fmt.Errorf("%w: range %q is out of %d-%d", errorInvalidCronField, expr, minimum, maximum)
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << value
+		}
+	}
+
+	return bits, nil
+}
+
+// cronSchedule - the bits of the allowed minutes, hours, days, months and weekdays.
+type cronSchedule struct {
+	spec       string
+	minutes    uint64
+	hours      uint64
+	days       uint64
+	months     uint64
+	weekdays   uint64
+	anyDay     bool
+	anyWeekday bool
+}
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	const searchYears = 5
+
+	next := after.Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(searchYears, 0, 0)
+
+	for next.Before(limit) {
+		switch {
+		case s.months&(1<<int(next.Month())) == 0:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+		case !s.matchDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+		case s.hours&(1<<next.Hour()) == 0:
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+		case s.minutes&(1<<next.Minute()) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+
+	return time.Time{}
+}
+
+// matchDay - the day of the month and the day of the week are matched like in cron:
+// if both are restricted, either of them matches.
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	day := s.days&(1<<t.Day()) != 0
+	weekday := s.weekdays&(1<<int(t.Weekday())) != 0
+
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+
+	return day || weekday
+}
+
+func (s *cronSchedule) String() string {
+	return s.spec
+}
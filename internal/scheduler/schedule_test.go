@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	// Wednesday
+	after := time.Date(2024, time.January, 31, 10, 17, 30, 0, time.UTC)
+
+	testcases := []struct {
+		Name string
+		Spec string
+		Next time.Time
+	}{
+		{Name: "Every", Spec: "@every 90m", Next: after.Add(90 * time.Minute)},
+		{Name: "Hourly", Spec: "@hourly", Next: time.Date(2024, time.January, 31, 11, 0, 0, 0, time.UTC)},
+		{Name: "Daily", Spec: "@daily", Next: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "Step", Spec: "*/15 * * * *", Next: time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)},
+		{Name: "Range and list", Spec: "0 3-5 * * 1,5", Next: time.Date(2024, time.February, 2, 3, 0, 0, 0, time.UTC)},
+		{Name: "Sunday as 7", Spec: "0 0 * * 7", Next: time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+		{Name: "Day of month or weekday", Spec: "0 12 1 * 4", Next: time.Date(2024, time.February, 1, 12, 0, 0, 0, time.UTC)},
+		{Name: "Leap day", Spec: "30 6 29 2 *", Next: time.Date(2024, time.February, 29, 6, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			schedule, err := Parse(tc.Spec)
+			require.NoError(t, err)
+			require.Equal(t, tc.Next, schedule.Next(after))
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, spec := range []string{"", "@every -1m", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "0 0 30 2 *"} {
+			_, err := Parse(spec)
+			require.ErrorIs(t, err, errorInvalidSchedule, spec)
+		}
+	})
+}
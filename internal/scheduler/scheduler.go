@@ -0,0 +1,277 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// ErrUnknownJob - the job is not registered.
+var ErrUnknownJob = errors.New("unknown job")
+
+var (
+	errorDuplicateJob = errors.New("job is already registered")
+	errorJobPanicked  = errors.New("job panicked")
+)
+
+// retryDelay - delay before the next attempt, when the state of the job can not be read or locked.
+const retryDelay = time.Minute
+
+// Job - the background job run by the schedule.
+type Job struct {
+	Name        string                          // Unique name of the job, e.g. retention_purge
+	Description string                          // What the job does
+	Schedule    Schedule                        // When the job is run
+	Run         func(ctx context.Context) error // Run the job, the error is stored as the last error
+}
+
+// JobStatus - the registered job with its persisted state.
+type JobStatus struct {
+	Name         string        `json:"name"`
+	Description  string        `json:"description"`
+	Schedule     string        `json:"schedule"`
+	Running      bool          `json:"running"`
+	LockedBy     string        `json:"locked_by,omitempty"`
+	LastRunAt    *time.Time    `json:"last_run_at"`
+	LastDuration time.Duration `json:"last_duration_ns"`
+	LastError    string        `json:"last_error"`
+	NextRunAt    *time.Time    `json:"next_run_at"`
+	Runs         int64         `json:"runs"`
+	Failures     int64         `json:"failures"`
+}
+
+// Scheduler - runs the registered jobs by their schedules.
+// A job is locked in the database while running, so the replicas sharing the database do not run it twice.
+type Scheduler struct {
+	db       storage.Repository
+	instance string
+	lease    time.Duration
+
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	triggers map[string]chan struct{}
+}
+
+// New - create the scheduler of the replica, the lock of a running job expires after the lease,
+// if the replica is gone.
+func New(db storage.Repository, instance string, lease time.Duration) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		instance: instance,
+		lease:    lease,
+		jobs:     make(map[string]*Job),
+		triggers: make(map[string]chan struct{}),
+	}
+}
+
+// Register - add the job, before the scheduler is started.
+func (s *Scheduler) Register(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("%w: %s", errorDuplicateJob, job.Name)
+	}
+
+	s.jobs[job.Name] = &job
+	s.triggers[job.Name] = make(chan struct{}, 1)
+
+	return nil
+}
+
+// Start - run every registered job by its schedule until the context is done.
+// A job never run before is run on start.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, job := range s.jobs {
+		go s.loop(ctx, job, s.triggers[name])
+	}
+}
+
+// Trigger - run the job now, even if it is not due, unless it is running on a replica.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	trigger, ok := s.triggers[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+
+	select {
+	case trigger <- struct{}{}:
+	default: // Already triggered
+	}
+
+	return nil
+}
+
+// Jobs - the registered jobs with their persisted states, ordered by the name.
+func (s *Scheduler) Jobs(ctx context.Context) ([]JobStatus, error) {
+	states, err := s.db.WithContext(ctx).JobStates()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]model.JobState, len(states))
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	jobs := make([]JobStatus, 0, len(s.jobs))
+
+	for name, job := range s.jobs {
+		state := byName[name]
+		status := JobStatus{
+			Name:         name,
+			Description:  job.Description,
+			Schedule:     job.Schedule.String(),
+			Running:      state.IsLocked(now),
+			LastDuration: state.LastDuration,
+			LastError:    state.LastError,
+			Runs:         state.Runs,
+			Failures:     state.Failures,
+		}
+
+		if status.Running {
+			status.LockedBy = state.LockedBy
+		}
+
+		if state.LastRunAt.Valid {
+			status.LastRunAt = &state.LastRunAt.Time
+		}
+
+		if state.NextRunAt.Valid {
+			status.NextRunAt = &state.NextRunAt.Time
+		}
+
+		jobs = append(jobs, status)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+
+	return jobs, nil
+}
+
+// loop - wait for the next run time of the job or the trigger and run the job.
+func (s *Scheduler) loop(ctx context.Context, job *Job, trigger chan struct{}) {
+	var err error
+
+	for {
+		delay := s.delay(ctx, job)
+		if err != nil {
+			delay = retryDelay
+		}
+
+		select {
+		case <-time.After(delay):
+			err = s.execute(ctx, job, false)
+		case <-trigger:
+			err = s.execute(ctx, job, true)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// delay - the time until the next run of the job, which may be set by another replica.
+func (s *Scheduler) delay(ctx context.Context, job *Job) time.Duration {
+	states, err := s.db.WithContext(ctx).JobStates()
+	if err != nil {
+		global.Logger.ErrorContext(ctx, "scheduler: reading job states error",
+			slog.String("job", job.Name), slog.String("error", err.Error()))
+
+		return retryDelay
+	}
+
+	now := time.Now()
+
+	for _, state := range states {
+		switch {
+		case state.Name != job.Name:
+			continue
+		case state.IsLocked(now):
+			// Running on a replica, check again when the lock expires
+			return min(state.LockedUntil.Time.Sub(now), retryDelay)
+		case state.IsDue(now):
+			return 0
+		default:
+			return state.NextRunAt.Time.Sub(now)
+		}
+	}
+
+	return 0
+}
+
+// execute - lock the job, run it and store the run, the error is returned if the job can not be locked.
+// The job is skipped, if it is running on a replica or, unless forced, is not due.
+func (s *Scheduler) execute(ctx context.Context, job *Job, force bool) error {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+
+	acquired, err := db.AcquireJob(job.Name, s.instance, now, now.Add(s.lease), force)
+	if err != nil {
+		global.Logger.ErrorContext(ctx, "scheduler: locking job error",
+			slog.String("job", job.Name), slog.String("error", err.Error()))
+
+		return err
+	} else if !acquired {
+		return nil
+	}
+
+	run := storage.JobRun{StartedAt: now}
+
+	if err := s.run(ctx, job); err != nil {
+		run.Error = err.Error()
+
+		global.Logger.ErrorContext(ctx, "scheduler: job failed", slog.String("job", job.Name), slog.String("error", run.Error))
+	}
+
+	run.Duration = time.Since(now)
+	run.NextRunAt = job.Schedule.Next(time.Now())
+
+	status := "ok"
+	if run.Error != "" {
+		status = "failed"
+	}
+
+	global.Logger.DebugContext(ctx, "scheduler: job finished", slog.String("job", job.Name),
+		slog.String("status", status), slog.Duration("duration", run.Duration))
+
+	global.Metrics.LogEvent("job_finished", map[string]string{"job": job.Name, "status": status}, map[string]any{
+		"duration_ms": run.Duration.Milliseconds(),
+	})
+
+	// The run is stored even if the context is done, so the lock is released
+	if err := s.db.WithContext(context.WithoutCancel(ctx)).FinishJob(job.Name, s.instance, run); err != nil {
+		global.Logger.ErrorContext(ctx, "scheduler: storing job run error",
+			slog.String("job", job.Name), slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// run - run the job, the panic of the job is returned as the error.
+func (s *Scheduler) run(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", errorJobPanicked, r)
+		}
+	}()
+
+	return job.Run(ctx)
+}
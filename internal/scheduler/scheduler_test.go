@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	"github.com/plugfox/foxy-gram-server/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var errorTestJob = errors.New("test job failed")
+
+func TestScheduler(t *testing.T) {
+	global.Config = &config.Config{Database: config.DatabaseConfig{Driver: "sqlite", Connection: ":memory:", AutoMigrate: true}}
+	global.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	global.Metrics = metrics.NewMetricsFake()
+
+	sqlite, err := storage.New()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = sqlite.Close() })
+
+	testcases := []struct {
+		Name string
+		DB   storage.Repository
+	}{
+		{Name: "SQL", DB: sqlite},
+		{Name: "Memory", DB: memory.New()},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			runs := 0
+			job := Job{
+				Name:     "test",
+				Schedule: Every(time.Hour),
+				Run: func(context.Context) error {
+					runs++
+
+					return errorTestJob
+				},
+			}
+
+			first, second := New(tc.DB, "first", time.Minute), New(tc.DB, "second", time.Minute)
+			require.NoError(t, first.Register(job))
+			require.NoError(t, second.Register(job))
+			require.Error(t, first.Register(job), "Duplicate job")
+
+			// The job never run is due
+			require.Zero(t, first.delay(ctx, &job))
+
+			// The replica locking the job first runs it
+			now := time.Now()
+			acquired, err := tc.DB.AcquireJob(job.Name, "first", now, now.Add(time.Minute), false)
+			require.NoError(t, err)
+			require.True(t, acquired)
+
+			require.NoError(t, second.execute(ctx, &job, true))
+			require.Zero(t, runs, "Locked by another replica")
+
+			require.NoError(t, first.execute(ctx, &job, false))
+			require.Equal(t, 1, runs)
+
+			// The run is stored and the job is not due until the next run time
+			require.NoError(t, second.execute(ctx, &job, false))
+			require.Equal(t, 1, runs, "Not due")
+			require.InDelta(t, time.Hour, second.delay(ctx, &job), float64(time.Minute))
+
+			require.NoError(t, second.execute(ctx, &job, true))
+			require.Equal(t, 2, runs, "Forced")
+
+			statuses, err := second.Jobs(ctx)
+			require.NoError(t, err)
+			require.Len(t, statuses, 1)
+			require.False(t, statuses[0].Running)
+			require.EqualValues(t, 2, statuses[0].Runs)
+			require.EqualValues(t, 2, statuses[0].Failures)
+			require.Equal(t, errorTestJob.Error(), statuses[0].LastError)
+			require.NotNil(t, statuses[0].NextRunAt)
+
+			require.ErrorIs(t, second.Trigger("unknown"), ErrUnknownJob)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/scheduler"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+var (
+	errorInvalidSendAt         = errors.New("must be in the future")
+	errorScheduleOrSendAt      = errors.New("either the schedule or the send_at is required")
+	errorInvalidAnnouncementID = errors.New("must be a positive announcement ID")
+)
+
+func createAnnouncementSchema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"chat_id": openapi.Integer("Telegram chat ID"),
+		"text":    openapi.String("Text of the message, or the caption of the media"),
+		"media_type": openapi.String("Type of the media").WithEnum(
+			model.AnnouncementMediaPhoto, model.AnnouncementMediaVideo, model.AnnouncementMediaAnimation, model.AnnouncementMediaDocument,
+		),
+		"media":    openapi.String("Telegram file ID or URL of the media").WithMinLength(1),
+		"pin":      openapi.Boolean("Pin the message and unpin the previous one"),
+		"schedule": openapi.String("Cron spec of the recurring announcement, e.g. 0 10 * * 1 or @weekly").WithMinLength(1),
+		"send_at":  openapi.Integer("Unix timestamp of the one-off announcement").WithMinimum(1),
+	}, "chat_id").Strict()
+}
+
+// AddAnnouncements adds the endpoints listing, creating and deleting the announcements
+// posted to the chats once or by the schedule at /admin/announcements.
+func (srv *Server) AddAnnouncements(db storage.Repository) {
+	const path = "/admin/announcements"
+
+	responses := map[string]openapi.Response{
+		"400": openapi.JSONResponse("Invalid parameters", openapi.Ref("Response")),
+	}
+
+	srv.admin.Get(path, func(w http.ResponseWriter, r *http.Request) {
+		var chatID int64
+
+		if value := r.URL.Query().Get("chat_id"); value != "" {
+			var err error
+			if chatID, err = strconv.ParseInt(value, 10, 64); err != nil || chatID == 0 {
+				NewResponse().SetError("validation_error", "Invalid query parameters", map[string]any{
+					"fields": []openapi.FieldError{{Field: "chat_id", Message: errorInvalidChatID.Error()}},
+				}).BadRequest(w)
+
+				return
+			}
+		}
+
+		announcements, err := db.WithContext(r.Context()).Announcements(model.ChatID(chatID))
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		NewResponse().SetData(announcements).Ok(w)
+	})
+	srv.describe(http.MethodGet, path, true, &openapi.Operation{
+		Summary:     "List announcements",
+		Description: "The announcements of the chat, or of every chat without the chat_id, ordered by ID.",
+		OperationID: "listAnnouncements",
+		Tags:        []string{"announcements"},
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("chat_id", "Optional. Telegram chat ID", openapi.Integer("")),
+		},
+		Responses: responses,
+	})
+
+	createSchema := createAnnouncementSchema()
+
+	srv.admin.Post(path, func(w http.ResponseWriter, r *http.Request) {
+		var requestBody struct {
+			ChatID    int64  `json:"chat_id"`
+			Text      string `json:"text,omitempty"`
+			MediaType string `json:"media_type,omitempty"`
+			Media     string `json:"media,omitempty"`
+			Pin       bool   `json:"pin,omitempty"`
+			Schedule  string `json:"schedule,omitempty"`
+			SendAt    int64  `json:"send_at,omitempty"`
+		}
+
+		if !srv.decodeRequest(w, r, createSchema, &requestBody) {
+			return
+		}
+
+		invalid := func(field string, err error) {
+			NewResponse().SetError("validation_error", "Request body does not match the schema", map[string]any{
+				"fields": []openapi.FieldError{{Field: field, Message: err.Error()}},
+			}).BadRequest(w)
+		}
+
+		announcement := &model.Announcement{
+			ChatID:    model.ChatID(requestBody.ChatID),
+			Text:      requestBody.Text,
+			MediaType: requestBody.MediaType,
+			Media:     requestBody.Media,
+			Pin:       requestBody.Pin,
+		}
+
+		switch now := time.Now(); {
+		case (requestBody.Schedule == "") == (requestBody.SendAt == 0):
+			invalid("schedule", errorScheduleOrSendAt)
+
+			return
+		case requestBody.Schedule != "":
+			schedule, err := scheduler.Parse(requestBody.Schedule)
+			if err != nil {
+				invalid("schedule", err)
+
+				return
+			}
+
+			announcement.Schedule = schedule.String()
+			announcement.NextRunAt = sql.NullTime{Time: schedule.Next(now), Valid: true}
+		default:
+			sendAt := time.Unix(requestBody.SendAt, 0)
+			if !sendAt.After(now) {
+				invalid("send_at", errorInvalidSendAt)
+
+				return
+			}
+
+			announcement.NextRunAt = sql.NullTime{Time: sendAt, Valid: true}
+		}
+
+		if err := announcement.Validate(); err != nil {
+			invalid("text", err)
+
+			return
+		}
+
+		if err := db.WithContext(r.Context()).UpsertAnnouncement(announcement); err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		NewResponse().SetData(announcement).Ok(w)
+	})
+	srv.describe(http.MethodPost, path, true, &openapi.Operation{
+		Summary: "Create announcement",
+		Description: "Schedule the text or the media with the caption posted to the chat once at send_at " +
+			"or by the cron schedule. The bot must be a member of the chat, and an admin to pin the message.",
+		OperationID: "createAnnouncement",
+		Tags:        []string{"announcements"},
+		RequestBody: openapi.JSONBody(createSchema),
+		Responses:   responses,
+	})
+
+	srv.admin.Delete(path+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id < 1 {
+			NewResponse().SetError("validation_error", "Invalid path parameters", map[string]any{
+				"fields": []openapi.FieldError{{Field: "id", Message: errorInvalidAnnouncementID.Error()}},
+			}).BadRequest(w)
+
+			return
+		}
+
+		db := db.WithContext(r.Context())
+
+		if _, err := db.AnnouncementByID(id); errors.Is(err, storage.ErrNotFound) {
+			NewResponse().SetError("not_found", "Announcement not found").NotFound(w)
+
+			return
+		} else if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		if err := db.DeleteAnnouncement(id); err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		NewResponse().SetData(map[string]any{"id": id, "deleted": true}).Ok(w)
+	})
+	srv.describe(http.MethodDelete, path+"/{id}", true, &openapi.Operation{
+		Summary:     "Delete announcement",
+		Description: "Delete the announcement, it is no longer posted.",
+		OperationID: "deleteAnnouncement",
+		Tags:        []string{"announcements"},
+		Parameters:  []openapi.Parameter{openapi.PathParam("id", "ID of the announcement", openapi.Integer(""))},
+		Responses: map[string]openapi.Response{
+			"400": openapi.JSONResponse("Invalid parameters", openapi.Ref("Response")),
+			"404": openapi.JSONResponse("Announcement not found", openapi.Ref("Response")),
+		},
+	})
+}
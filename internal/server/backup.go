@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// Backuper - writes the backup of the database, e.g. the SQL storage.
+type Backuper interface {
+	Backup(ctx context.Context, writer io.Writer) (storage.BackupStats, error)
+}
+
+// AddBackup adds the endpoint streaming the backup of the database as gzip-compressed NDJSON
+// at [GET] /admin/backup. The backup is restored with the `restore` command.
+func (srv *Server) AddBackup(db Backuper) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// The backup of a large database takes longer than the timeouts of the API
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			global.Logger.WarnContext(r.Context(), "backup: write deadline is kept", slog.String("error", err.Error()))
+		}
+
+		ctx := context.WithoutCancel(r.Context())
+		filename := fmt.Sprintf("foxy-gram-%s.ndjson.gz", time.Now().UTC().Format("20060102-150405"))
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+
+		// The status is sent already, the failed backup is cut and rejected by the restore
+		stats, err := db.Backup(ctx, w)
+		if err != nil {
+			global.Logger.ErrorContext(ctx, "backup: streaming error", slog.String("error", err.Error()))
+
+			return
+		}
+
+		global.Logger.InfoContext(ctx, "backup streamed", slog.Any("rows", stats))
+
+		defer global.Metrics.LogEvent("backup_exported", nil, map[string]any{
+			"users":    stats["users"],
+			"messages": stats["messages"],
+		})
+	}
+
+	srv.admin.Get("/admin/backup", handler)
+	srv.describe(http.MethodGet, "/admin/backup", true, &openapi.Operation{
+		Summary: "Backup database",
+		Description: "Stream the users, chats, messages, verified and banned lists, captchas, key-value pairs " +
+			"and the other tables as gzip-compressed NDJSON. The first line is the header with the format version " +
+			"and the schema version, the last line has the number of the rows per table. " +
+			"The backup is portable between the database drivers and restored with the `restore` command.",
+		OperationID: "backup",
+		Tags:        []string{"maintenance"},
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "Backup file",
+				Content:     map[string]openapi.MediaType{"application/gzip": {}},
+			},
+		},
+	})
+}
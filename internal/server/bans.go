@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+var errorInvalidWithin = errors.New("must be a positive duration like 24h")
+
+// banExpiry - the ban expiring soon with the chats where the user is unbanned.
+type banExpiry struct {
+	model.BannedUser
+
+	Chats []model.ChatID `json:"chats"`
+}
+
+// AddBanExpiries adds the endpoint listing the bans expiring soon, the soonest first,
+// at [GET] /admin/bans/expiring.
+func (srv *Server) AddBanExpiries(db storage.Repository) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		const (
+			defaultWithin = 24 * time.Hour
+			defaultLimit  = 100
+		)
+
+		query := r.URL.Query()
+		within, limit := defaultWithin, defaultLimit
+
+		var errs []openapi.FieldError
+
+		if value := query.Get("within"); value != "" {
+			if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+				errs = append(errs, openapi.FieldError{Field: "within", Message: errorInvalidWithin.Error()})
+			} else {
+				within = duration
+			}
+		}
+
+		if value := query.Get("limit"); value != "" {
+			if n, err := strconv.Atoi(value); err != nil || n < 1 {
+				errs = append(errs, openapi.FieldError{Field: "limit", Message: errorInvalidLimit.Error()})
+			} else {
+				limit = n
+			}
+		}
+
+		if len(errs) > 0 {
+			NewResponse().SetError("validation_error", "Invalid query parameters", map[string]any{
+				"fields": errs,
+			}).BadRequest(w)
+
+			return
+		}
+
+		repo := db.WithContext(r.Context())
+		now := time.Now()
+
+		bans, err := repo.UpcomingBanExpiries(now, now.Add(within), limit)
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		expiries := make([]banExpiry, 0, len(bans))
+
+		for _, ban := range bans {
+			chats, err := repo.BanChats(ban.ID)
+			if err != nil {
+				NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+				return
+			}
+
+			expiry := banExpiry{BannedUser: ban, Chats: make([]model.ChatID, 0, len(chats))}
+			for _, chat := range chats {
+				expiry.Chats = append(expiry.Chats, chat.ChatID)
+			}
+
+			expiries = append(expiries, expiry)
+		}
+
+		NewResponse().SetData(expiries).Ok(w)
+	}
+
+	srv.admin.Get("/admin/bans/expiring", handler)
+	srv.describe(http.MethodGet, "/admin/bans/expiring", true, &openapi.Operation{
+		Summary: "List upcoming ban expiries",
+		Description: "The bans expiring soon, the soonest first, with the chats where the users are unbanned " +
+			"by the sweeper when the bans expire.",
+		OperationID: "listBanExpiries",
+		Tags:        []string{"users"},
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("within", "Duration from now, e.g. 1h or 72h, 24h by default", openapi.String("")),
+			openapi.QueryParam("limit", "Maximum number of the bans, 100 by default", openapi.Integer("").WithMinimum(1)),
+		},
+		Responses: map[string]openapi.Response{
+			"400": openapi.JSONResponse("Invalid query parameters", openapi.Ref("Response")),
+		},
+	})
+}
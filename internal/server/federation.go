@@ -0,0 +1,171 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/plugfox/foxy-gram-server/internal/federation"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// AddBanFeed adds the public endpoint publishing the signed feed of the local bans
+// at [GET] /federation/bans. The peers verify the feed with the public key of the key.
+func (srv *Server) AddBanFeed(db storage.Repository, name string, key ed25519.PrivateKey) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		bans, err := db.WithContext(r.Context()).BannedUsers()
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		signed, err := federation.Sign(federation.NewFeed(name, bans), key)
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(signed); err != nil {
+			global.Logger.WarnContext(r.Context(), "federation: writing ban feed error", slog.String("error", err.Error()))
+		}
+	}
+
+	srv.public.Get("/federation/bans", handler)
+	srv.describe(http.MethodGet, "/federation/bans", false, &openapi.Operation{
+		Summary: "Ban feed",
+		Description: "The local bans of this instance for the peers. The feed is the JSON object " +
+			"with the source, the generation time and the bans, signed with ed25519. " +
+			"The imported and the expired bans are not published.",
+		OperationID: "getBanFeed",
+		Tags:        []string{"federation"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Signed ban feed", openapi.Object(map[string]*openapi.Schema{
+				"feed": openapi.Object(map[string]*openapi.Schema{
+					"source":       openapi.String("Name of the publisher"),
+					"generated_at": openapi.String("RFC 3339 time of the feed"),
+					"bans": openapi.Array(openapi.Object(map[string]*openapi.Schema{
+						"user_id":    openapi.Integer("Telegram user ID"),
+						"reason":     openapi.String("Reason of the ban"),
+						"banned_at":  openapi.String("RFC 3339 time of the ban"),
+						"expires_at": openapi.String("Optional. RFC 3339 time when the ban expires"),
+					}, "user_id", "reason", "banned_at")),
+				}, "source", "generated_at", "bans"),
+				"signature": openapi.String("Base64 ed25519 signature of the exact bytes of the feed"),
+			}, "feed", "signature")),
+		},
+	})
+}
+
+// AddBanSources adds the endpoints listing the sources of the imported bans
+// and revoking or resuming a source at /admin/federation/sources.
+func (srv *Server) AddBanSources(db storage.Repository, peers []string) {
+	const path = "/admin/federation/sources"
+
+	list := func(w http.ResponseWriter, r *http.Request) {
+		bans, err := db.WithContext(r.Context()).BannedUsers()
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		counts := make(map[string]int, len(peers))
+		for _, peer := range peers {
+			counts[peer] = 0
+		}
+
+		for _, ban := range bans {
+			if !ban.IsLocal() {
+				counts[ban.Source]++
+			}
+		}
+
+		sources := make([]map[string]any, 0, len(counts))
+
+		for source, count := range counts {
+			paused, err := federation.IsPaused(db, source)
+			if err != nil {
+				NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+				return
+			}
+
+			sources = append(sources, map[string]any{"source": source, "bans": count, "paused": paused})
+		}
+
+		sort.Slice(sources, func(i, j int) bool { return sources[i]["source"].(string) < sources[j]["source"].(string) }) //nolint:forcetypeassert
+
+		NewResponse().SetData(sources).Ok(w)
+	}
+
+	revoke := func(w http.ResponseWriter, r *http.Request) {
+		source := chi.URLParam(r, "source")
+
+		removed, err := federation.Revoke(db.WithContext(r.Context()), source)
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		global.Logger.InfoContext(r.Context(), "federation: source revoked", slog.String("source", source), slog.Int64("removed", removed))
+
+		defer global.Metrics.LogEvent("ban_source_revoked", map[string]string{"peer": source}, map[string]any{
+			"removed": removed,
+		})
+
+		NewResponse().SetData(map[string]any{"source": source, "removed": removed, "paused": true}).Ok(w)
+	}
+
+	resume := func(w http.ResponseWriter, r *http.Request) {
+		source := chi.URLParam(r, "source")
+
+		if err := federation.Resume(db.WithContext(r.Context()), source); err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		global.Logger.InfoContext(r.Context(), "federation: source resumed", slog.String("source", source))
+
+		NewResponse().SetData(map[string]any{"source": source, "paused": false}).Ok(w)
+	}
+
+	sourceParam := openapi.PathParam("source", "Name of the peer", openapi.String(""))
+
+	srv.admin.Get(path, list)
+	srv.describe(http.MethodGet, path, true, &openapi.Operation{
+		Summary:     "List ban sources",
+		Description: "The configured peers and the other sources of the imported bans, with the number of the bans.",
+		OperationID: "listBanSources",
+		Tags:        []string{"federation"},
+	})
+
+	srv.admin.Delete(path+"/{source}", revoke)
+	srv.describe(http.MethodDelete, path+"/{source}", true, &openapi.Operation{
+		Summary:     "Revoke ban source",
+		Description: "Remove every ban imported from the source and stop pulling its feed until resumed.",
+		OperationID: "revokeBanSource",
+		Tags:        []string{"federation"},
+		Parameters:  []openapi.Parameter{sourceParam},
+	})
+
+	srv.admin.Post(path+"/{source}/resume", resume)
+	srv.describe(http.MethodPost, path+"/{source}/resume", true, &openapi.Operation{
+		Summary:     "Resume ban source",
+		Description: "Pull the feed of the revoked source again, the bans are merged on the next pull.",
+		OperationID: "resumeBanSource",
+		Tags:        []string{"federation"},
+		Parameters:  []openapi.Parameter{sourceParam},
+	})
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+var errorInvalidExpireAt = errors.New("must be in the future")
+
+// InviteLinkManager - creates and revokes the invite links of the chats with the Telegram Bot API.
+type InviteLinkManager interface {
+	CreateInviteLink(chatID int64, name string, expireAt time.Time, memberLimit int) (*model.InviteLink, error)
+	RevokeInviteLink(chatID int64, link string) (*model.InviteLink, error) // model.ErrInviteLinkOtherChat for the link of another chat
+}
+
+func createInviteLinkSchema() *openapi.Schema {
+	const (
+		maxNameLength  = 32
+		maxMemberLimit = 99999
+	)
+
+	return openapi.Object(map[string]*openapi.Schema{
+		"name":         openapi.String("Name of the link, e.g. the campaign").WithMinLength(1).WithMaxLength(maxNameLength),
+		"expire_at":    openapi.Integer("Unix timestamp when the link expires").WithMinimum(1),
+		"member_limit": openapi.Integer("Maximum number of users joining by the link").WithMinimum(1).WithMaximum(maxMemberLimit),
+	}, "name").Strict()
+}
+
+func revokeInviteLinkSchema() *openapi.Schema {
+	return openapi.Object(map[string]*openapi.Schema{
+		"link": openapi.String("The invite link").WithMinLength(1),
+	}, "link").Strict()
+}
+
+// parseChatID reads the chat ID from the path. On failure the error response is written and false is returned.
+func parseChatID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	chatID, err := strconv.ParseInt(chi.URLParam(r, "chat_id"), 10, 64)
+	if err != nil || chatID == 0 {
+		NewResponse().SetError("validation_error", "Invalid path parameters", map[string]any{
+			"fields": []openapi.FieldError{{Field: "chat_id", Message: errorInvalidChatID.Error()}},
+		}).BadRequest(w)
+
+		return 0, false
+	}
+
+	return chatID, true
+}
+
+// AddInviteLinks adds the endpoints listing, creating and revoking the invite links of the chat
+// at /admin/chats/{chat_id}/invite-links.
+func (srv *Server) AddInviteLinks(db storage.Repository, manager InviteLinkManager) {
+	const path = "/admin/chats/{chat_id}/invite-links"
+
+	chatIDParam := openapi.PathParam("chat_id", "Telegram chat ID", openapi.Integer(""))
+
+	// The responses are built for each operation, as describe adds the common ones to the map
+	responses := func() map[string]openapi.Response {
+		return map[string]openapi.Response{
+			"400": openapi.JSONResponse("Invalid parameters", openapi.Ref("Response")),
+		}
+	}
+
+	srv.admin.Get(path, func(w http.ResponseWriter, r *http.Request) {
+		chatID, ok := parseChatID(w, r)
+		if !ok {
+			return
+		}
+
+		links, err := db.WithContext(r.Context()).InviteLinks(model.ChatID(chatID))
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		NewResponse().SetData(links).Ok(w)
+	})
+	srv.describe(http.MethodGet, path, true, &openapi.Operation{
+		Summary:     "List invite links",
+		Description: "Invite links of the chat created by the bot, the latest first.",
+		OperationID: "listInviteLinks",
+		Tags:        []string{"invite links"},
+		Parameters:  []openapi.Parameter{chatIDParam},
+		Responses:   responses(),
+	})
+
+	createSchema := createInviteLinkSchema()
+
+	srv.admin.Post(path, func(w http.ResponseWriter, r *http.Request) {
+		chatID, ok := parseChatID(w, r)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Name        string `json:"name"`
+			ExpireAt    int64  `json:"expire_at,omitempty"`
+			MemberLimit int    `json:"member_limit,omitempty"`
+		}
+
+		if !srv.decodeRequest(w, r, createSchema, &requestBody) {
+			return
+		}
+
+		var expireAt time.Time
+		if requestBody.ExpireAt > 0 {
+			expireAt = time.Unix(requestBody.ExpireAt, 0)
+			if !expireAt.After(time.Now()) {
+				NewResponse().SetError("validation_error", "Request body does not match the schema", map[string]any{
+					"fields": []openapi.FieldError{{Field: "expire_at", Message: errorInvalidExpireAt.Error()}},
+				}).BadRequest(w)
+
+				return
+			}
+		}
+
+		link, err := manager.CreateInviteLink(chatID, requestBody.Name, expireAt, requestBody.MemberLimit)
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		NewResponse().SetData(link).Ok(w)
+	})
+	srv.describe(http.MethodPost, path, true, &openapi.Operation{
+		Summary:     "Create invite link",
+		Description: "Create the invite link of the chat with the name, expiry and member limit. The bot must be an admin of the chat.",
+		OperationID: "createInviteLink",
+		Tags:        []string{"invite links"},
+		Parameters:  []openapi.Parameter{chatIDParam},
+		RequestBody: openapi.JSONBody(createSchema),
+		Responses:   responses(),
+	})
+
+	revokeSchema := revokeInviteLinkSchema()
+
+	srv.admin.Post(path+"/revoke", func(w http.ResponseWriter, r *http.Request) {
+		chatID, ok := parseChatID(w, r)
+		if !ok {
+			return
+		}
+
+		var requestBody struct {
+			Link string `json:"link"`
+		}
+
+		if !srv.decodeRequest(w, r, revokeSchema, &requestBody) {
+			return
+		}
+
+		link, err := manager.RevokeInviteLink(chatID, requestBody.Link)
+		if errors.Is(err, model.ErrInviteLinkOtherChat) {
+			NewResponse().SetError("bad_request", err.Error()).BadRequest(w)
+
+			return
+		} else if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		NewResponse().SetData(link).Ok(w)
+	})
+	srv.describe(http.MethodPost, path+"/revoke", true, &openapi.Operation{
+		Summary:     "Revoke invite link",
+		Description: "Revoke the invite link of the chat, the users can no longer join by it.",
+		OperationID: "revokeInviteLink",
+		Tags:        []string{"invite links"},
+		Parameters:  []openapi.Parameter{chatIDParam},
+		RequestBody: openapi.JSONBody(revokeSchema),
+		Responses:   responses(),
+	})
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/scheduler"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+)
+
+// AddJobs adds the endpoints listing the background jobs and triggering a job at /admin/jobs.
+func (srv *Server) AddJobs(jobs *scheduler.Scheduler) {
+	const path = "/admin/jobs"
+
+	list := func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := jobs.Jobs(r.Context())
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		NewResponse().SetData(statuses).Ok(w)
+	}
+
+	trigger := func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+
+		if err := jobs.Trigger(name); errors.Is(err, scheduler.ErrUnknownJob) {
+			NewResponse().SetError("not_found", "Job not found").NotFound(w)
+
+			return
+		} else if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		global.Logger.InfoContext(r.Context(), "scheduler: job triggered", slog.String("job", name))
+
+		NewResponse().SetData(map[string]any{"job": name, "triggered": true}).Ok(w)
+	}
+
+	srv.admin.Get(path, list)
+	srv.describe(http.MethodGet, path, true, &openapi.Operation{
+		Summary: "List background jobs",
+		Description: "The registered jobs with their schedules, whether running, the last run with its error and duration " +
+			"and the next run time.",
+		OperationID: "listJobs",
+		Tags:        []string{"jobs"},
+	})
+
+	srv.admin.Post(path+"/{name}/run", trigger)
+	srv.describe(http.MethodPost, path+"/{name}/run", true, &openapi.Operation{
+		Summary:     "Trigger background job",
+		Description: "Run the job now, even if it is not due. The job is skipped if it is running on a replica.",
+		OperationID: "triggerJob",
+		Tags:        []string{"jobs"},
+		Parameters:  []openapi.Parameter{openapi.PathParam("name", "Name of the job", openapi.String(""))},
+		Responses: map[string]openapi.Response{
+			"404": openapi.JSONResponse("Job not found", openapi.Ref("Response")),
+		},
+	})
+}
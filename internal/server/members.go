@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// AddUserChats adds the endpoint listing the chats the user joined and left
+// at [GET] /admin/users/{id}/chats.
+func (srv *Server) AddUserChats(db storage.Repository) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || userID < 1 {
+			NewResponse().SetError("validation_error", "Invalid path parameters", map[string]any{
+				"fields": []openapi.FieldError{{Field: "id", Message: errorInvalidUserID.Error()}},
+			}).BadRequest(w)
+
+			return
+		}
+
+		members, err := db.WithContext(r.Context()).ChatMembersOfUser(model.UserID(userID))
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		NewResponse().SetData(members).Ok(w)
+	}
+
+	srv.admin.Get("/admin/users/{id}/chats", handler)
+	srv.describe(http.MethodGet, "/admin/users/{id}/chats", true, &openapi.Operation{
+		Summary:     "User chats",
+		Description: "List the memberships of the user in the known chats, the latest joins first. Use the ID of the bot to list the chats it was added to or removed from.",
+		OperationID: "listUserChats",
+		Tags:        []string{"users"},
+		Parameters: []openapi.Parameter{
+			openapi.PathParam("id", "Telegram user ID", openapi.Integer("").WithMinimum(1)),
+		},
+		Responses: map[string]openapi.Response{
+			"400": openapi.JSONResponse("Invalid user ID", openapi.Ref("Response")),
+		},
+	})
+}
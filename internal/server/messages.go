@@ -0,0 +1,69 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+var errorInvalidMessageID = errors.New("must be a positive integer")
+
+// AddMessageRevisions adds the endpoint listing every version of the message
+// at [GET] /admin/chats/{chat_id}/messages/{id}/revisions.
+func (srv *Server) AddMessageRevisions(db storage.Repository) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var errs []openapi.FieldError
+
+		chatID, err := strconv.ParseInt(chi.URLParam(r, "chat_id"), 10, 64)
+		if err != nil {
+			errs = append(errs, openapi.FieldError{Field: "chat_id", Message: errorInvalidChatID.Error()})
+		}
+
+		messageID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || messageID < 1 {
+			errs = append(errs, openapi.FieldError{Field: "id", Message: errorInvalidMessageID.Error()})
+		}
+
+		if len(errs) > 0 {
+			NewResponse().SetError("validation_error", "Invalid path parameters", map[string]any{"fields": errs}).BadRequest(w)
+
+			return
+		}
+
+		revisions, err := db.WithContext(r.Context()).MessageRevisions(model.ChatID(chatID), model.MessageID(messageID))
+		if errors.Is(err, storage.ErrNotFound) {
+			NewResponse().SetError("not_found", "Message not found").NotFound(w)
+
+			return
+		} else if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		NewResponse().SetData(revisions).Ok(w)
+	}
+
+	const path = "/admin/chats/{chat_id}/messages/{id}/revisions"
+
+	srv.admin.Get(path, handler)
+	srv.describe(http.MethodGet, path, true, &openapi.Operation{
+		Summary:     "Message revisions",
+		Description: "Every version of the message from the oldest to the current one, the current version has no ID.",
+		OperationID: "getMessageRevisions",
+		Tags:        []string{"messages"},
+		Parameters: []openapi.Parameter{
+			openapi.PathParam("chat_id", "Telegram chat ID", openapi.Integer("")),
+			openapi.PathParam("id", "Telegram message ID", openapi.Integer("").WithMinimum(1)),
+		},
+		Responses: map[string]openapi.Response{
+			"400": openapi.JSONResponse("Invalid chat or message ID", openapi.Ref("Response")),
+			"404": openapi.JSONResponse("Message not found", openapi.Ref("Response")),
+		},
+	})
+}
@@ -0,0 +1,244 @@
+// Description: The openapi package describes the HTTP API with an OpenAPI 3 document.
+// The document is assembled from the routes registered in the server package,
+// so the served specification always matches the actual router.
+//
+// https://spec.openapis.org/oas/v3.0.3
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Version of the OpenAPI specification used by the document.
+const Version = "3.0.3"
+
+// Document is the root object of the OpenAPI document.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	mu sync.RWMutex
+}
+
+// Info provides metadata about the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is an object representing a server.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem describes the operations available on a single path, keyed by lowercase method.
+type PathItem map[string]*Operation
+
+// Operation describes a single API operation on a path.
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter describes a single operation parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // "query", "path" or "header"
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes a single request body.
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// Response describes a single response from an API operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType provides schema for the media type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds a set of reusable objects.
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme defines a security scheme that can be used by the operations.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// New creates a new document with the given title and version.
+func New(title string, version string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:   title,
+			Version: version,
+		},
+		Paths: make(map[string]*PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]SecurityScheme),
+		},
+	}
+}
+
+// AddOperation adds the operation to the document.
+// Path parameters are expected in the same "{name}" form that chi uses.
+func (doc *Document) AddOperation(method string, path string, op *Operation) {
+	if op == nil {
+		return
+	}
+
+	if op.Responses == nil {
+		op.Responses = map[string]Response{}
+	}
+
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+
+	item, ok := doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		doc.Paths[path] = item
+	}
+
+	(*item)[strings.ToLower(method)] = op
+}
+
+// Operation returns the operation registered for the method and path, if any.
+func (doc *Document) Operation(method string, path string) *Operation {
+	doc.mu.RLock()
+	defer doc.mu.RUnlock()
+
+	item, ok := doc.Paths[path]
+	if !ok {
+		return nil
+	}
+
+	return (*item)[strings.ToLower(method)]
+}
+
+// AddSchema adds a reusable schema to the components.
+func (doc *Document) AddSchema(name string, schema *Schema) {
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+
+	doc.Components.Schemas[name] = schema
+}
+
+// AddSecurityScheme adds a reusable security scheme to the components.
+func (doc *Document) AddSecurityScheme(name string, scheme SecurityScheme) {
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+
+	doc.Components.SecuritySchemes[name] = scheme
+}
+
+// Validate validates the decoded JSON value against the schema,
+// resolving references with the reusable schemas of the document.
+func (doc *Document) Validate(schema *Schema, value any) []FieldError {
+	doc.mu.RLock()
+	defer doc.mu.RUnlock()
+
+	return schema.Validate(value, doc.Components.Schemas)
+}
+
+// MarshalJSON encodes the document while holding the read lock.
+func (doc *Document) MarshalJSON() ([]byte, error) {
+	doc.mu.RLock()
+	defer doc.mu.RUnlock()
+
+	return json.Marshal(&struct {
+		OpenAPI    string               `json:"openapi"`
+		Info       Info                 `json:"info"`
+		Servers    []Server             `json:"servers,omitempty"`
+		Paths      map[string]*PathItem `json:"paths"`
+		Components Components           `json:"components"`
+	}{
+		OpenAPI:    doc.OpenAPI,
+		Info:       doc.Info,
+		Servers:    doc.Servers,
+		Paths:      doc.Paths,
+		Components: doc.Components,
+	})
+}
+
+// Handler returns the HTTP handler serving the document as JSON.
+func (doc *Document) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		_ = json.NewEncoder(w).Encode(doc)
+	}
+}
+
+// JSONBody creates a required JSON request body with the given schema.
+func JSONBody(schema *Schema) *RequestBody {
+	return &RequestBody{
+		Required: true,
+		Content: map[string]MediaType{
+			"application/json": {Schema: schema},
+		},
+	}
+}
+
+// JSONResponse creates a JSON response with the given description and schema.
+func JSONResponse(description string, schema *Schema) Response {
+	return Response{
+		Description: description,
+		Content: map[string]MediaType{
+			"application/json": {Schema: schema},
+		},
+	}
+}
+
+// PathParam creates a required path parameter.
+func PathParam(name string, description string, schema *Schema) Parameter {
+	return Parameter{
+		Name:        name,
+		In:          "path",
+		Description: description,
+		Required:    true,
+		Schema:      schema,
+	}
+}
+
+// QueryParam creates an optional query parameter.
+func QueryParam(name string, description string, schema *Schema) Parameter {
+	return Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      schema,
+	}
+}
@@ -0,0 +1,303 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a subset of the OpenAPI schema object, enough to describe and validate JSON bodies.
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"` // "object", "array", "string", "integer", "number", "boolean"
+	Format      string             `json:"format,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	Nullable    bool               `json:"nullable,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+	MinItems    *int               `json:"minItems,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	Example     any                `json:"example,omitempty"`
+
+	// AdditionalProperties - whether unknown object properties are allowed, nil means allowed.
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+}
+
+// FieldError describes a single validation error of the request body.
+type FieldError struct {
+	Field   string `json:"field"`   // Path to the field, e.g. "ids[2]"; empty for the body itself.
+	Message string `json:"message"` // Human readable description of the problem.
+}
+
+// Ref creates a reference to the reusable schema from the components.
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// Object creates an object schema with the given properties and required fields.
+func Object(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{
+		Type:       "object",
+		Properties: properties,
+		Required:   required,
+	}
+}
+
+// Array creates an array schema with the given items schema.
+func Array(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// String creates a string schema.
+func String(description string) *Schema {
+	return &Schema{Type: "string", Description: description}
+}
+
+// Integer creates a 64-bit integer schema.
+func Integer(description string) *Schema {
+	return &Schema{Type: "integer", Format: "int64", Description: description}
+}
+
+// Boolean creates a boolean schema.
+func Boolean(description string) *Schema {
+	return &Schema{Type: "boolean", Description: description}
+}
+
+// WithMinItems sets the minimum number of array items.
+func (s *Schema) WithMinItems(n int) *Schema {
+	s.MinItems = &n
+
+	return s
+}
+
+// WithMaxItems sets the maximum number of array items.
+func (s *Schema) WithMaxItems(n int) *Schema {
+	s.MaxItems = &n
+
+	return s
+}
+
+// WithMinLength sets the minimum string length.
+func (s *Schema) WithMinLength(n int) *Schema {
+	s.MinLength = &n
+
+	return s
+}
+
+// WithMaxLength sets the maximum string length.
+func (s *Schema) WithMaxLength(n int) *Schema {
+	s.MaxLength = &n
+
+	return s
+}
+
+// WithMinimum sets the minimum numeric value.
+func (s *Schema) WithMinimum(n float64) *Schema {
+	s.Minimum = &n
+
+	return s
+}
+
+// WithMaximum sets the maximum numeric value.
+func (s *Schema) WithMaximum(n float64) *Schema {
+	s.Maximum = &n
+
+	return s
+}
+
+// WithEnum restricts the value to the given set.
+func (s *Schema) WithEnum(values ...any) *Schema {
+	s.Enum = values
+
+	return s
+}
+
+// Strict forbids unknown object properties.
+func (s *Schema) Strict() *Schema {
+	strict := false
+	s.AdditionalProperties = &strict
+
+	return s
+}
+
+// Validate validates the decoded JSON value against the schema.
+// The value is expected to be decoded with json.Decoder.UseNumber.
+// References are resolved with the given components, which may be nil.
+func (s *Schema) Validate(value any, components map[string]*Schema) []FieldError {
+	var errs []FieldError
+
+	s.validate("", value, components, &errs)
+
+	return errs
+}
+
+//nolint:gocognit,gocyclo,cyclop,funlen
+func (s *Schema) validate(path string, value any, components map[string]*Schema, errs *[]FieldError) {
+	if s == nil {
+		return
+	}
+
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		if ref, ok := components[name]; ok {
+			ref.validate(path, value, components, errs)
+		}
+
+		return
+	}
+
+	addError := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			addError("must not be null")
+		}
+
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		addError("must be one of %v", s.Enum)
+
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			addError("must be an object")
+
+			return
+		}
+
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				*errs = append(*errs, FieldError{Field: joinPath(path, name), Message: "is required"})
+			}
+		}
+
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys) // Stable error order
+
+		for _, key := range keys {
+			property, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					*errs = append(*errs, FieldError{Field: joinPath(path, key), Message: "is not allowed"})
+				}
+
+				continue
+			}
+
+			property.validate(joinPath(path, key), obj[key], components, errs)
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			addError("must be an array")
+
+			return
+		}
+
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			addError("must contain at least %d items", *s.MinItems)
+		}
+
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			addError("must contain at most %d items", *s.MaxItems)
+		}
+
+		for i, item := range arr {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, components, errs)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			addError("must be a string")
+
+			return
+		}
+
+		length := utf8.RuneCountInString(str)
+		if s.MinLength != nil && length < *s.MinLength {
+			addError("must be at least %d characters long", *s.MinLength)
+		}
+
+		if s.MaxLength != nil && length > *s.MaxLength {
+			addError("must be at most %d characters long", *s.MaxLength)
+		}
+	case "integer", "number":
+		article := "a"
+		if s.Type == "integer" {
+			article = "an"
+		}
+
+		num, ok := value.(json.Number)
+		if !ok {
+			addError("must be %s %s", article, s.Type)
+
+			return
+		}
+
+		f, err := num.Float64()
+		if err != nil {
+			addError("must be %s %s", article, s.Type)
+
+			return
+		}
+
+		if s.Type == "integer" && (f != math.Trunc(f) || strings.ContainsAny(num.String(), ".eE")) {
+			addError("must be an integer")
+
+			return
+		}
+
+		if s.Minimum != nil && f < *s.Minimum {
+			addError("must be greater than or equal to %v", *s.Minimum)
+		}
+
+		if s.Maximum != nil && f > *s.Maximum {
+			addError("must be less than or equal to %v", *s.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			addError("must be a boolean")
+		}
+	}
+}
+
+// inEnum checks whether the value is one of the enum values.
+func inEnum(value any, enum []any) bool {
+	for _, candidate := range enum {
+		if fmt.Sprint(candidate) == fmt.Sprint(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// joinPath joins the parent path with the property name.
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
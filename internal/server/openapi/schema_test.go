@@ -0,0 +1,103 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, raw string) any {
+	t.Helper()
+
+	var value any
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&value))
+
+	return value
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Object(map[string]*Schema{
+		"ids":    Array(Integer("").WithMinimum(1)).WithMinItems(1),
+		"reason": String("").WithMaxLength(5),
+		"mode":   String("").WithEnum("soft", "hard"),
+	}, "ids").Strict()
+
+	testcases := []struct {
+		Name     string
+		Body     string
+		Expected []FieldError
+	}{
+		{
+			Name: "Valid body",
+			Body: `{"ids":[1,2,3],"reason":"spam","mode":"hard"}`,
+		},
+		{
+			Name:     "Missing required field",
+			Body:     `{"reason":"spam"}`,
+			Expected: []FieldError{{Field: "ids", Message: "is required"}},
+		},
+		{
+			Name:     "Empty array",
+			Body:     `{"ids":[]}`,
+			Expected: []FieldError{{Field: "ids", Message: "must contain at least 1 items"}},
+		},
+		{
+			Name: "Invalid items",
+			Body: `{"ids":[1,"2",0,1.5]}`,
+			Expected: []FieldError{
+				{Field: "ids[1]", Message: "must be an integer"},
+				{Field: "ids[2]", Message: "must be greater than or equal to 1"},
+				{Field: "ids[3]", Message: "must be an integer"},
+			},
+		},
+		{
+			Name: "Too long string, enum and unknown field",
+			Body: `{"ids":[1],"reason":"too long","mode":"x","other":true}`,
+			Expected: []FieldError{
+				{Field: "mode", Message: "must be one of [soft hard]"},
+				{Field: "other", Message: "is not allowed"},
+				{Field: "reason", Message: "must be at most 5 characters long"},
+			},
+		},
+		{
+			Name:     "Not an object",
+			Body:     `[1,2,3]`,
+			Expected: []FieldError{{Field: "", Message: "must be an object"}},
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			errs := schema.Validate(decode(t, testcase.Body), nil)
+			require.Equal(t, testcase.Expected, errs)
+		})
+	}
+}
+
+func TestSchemaValidateRef(t *testing.T) {
+	doc := New("test", "0.0.0")
+	doc.AddSchema("User", Object(map[string]*Schema{"id": Integer("")}, "id"))
+
+	errs := doc.Validate(Array(Ref("User")), decode(t, `[{"id":1},{}]`))
+	require.Equal(t, []FieldError{{Field: "[1].id", Message: "is required"}}, errs)
+}
+
+func TestDocumentAddOperation(t *testing.T) {
+	doc := New("test", "0.0.0")
+	doc.AddOperation("POST", "/admin/verify", &Operation{Summary: "Verify"})
+
+	op := doc.Operation("post", "/admin/verify")
+	require.NotNil(t, op)
+	require.Equal(t, "Verify", op.Summary)
+	require.NotNil(t, op.Responses)
+
+	raw, err := json.Marshal(doc)
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `"openapi":"3.0.3"`)
+	require.Contains(t, string(raw), `"/admin/verify":{"post":`)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+)
+
+// maxRequestBodySize is the maximum size of the JSON request body.
+const maxRequestBodySize = 16 << 20 // 16 MiB
+
+var (
+	errorRequestBodyEmpty    = errors.New("request body is required")
+	errorRequestBodyTrailing = errors.New("request body must contain a single JSON value")
+)
+
+// decodeRequest reads the JSON request body, validates it against the schema
+// and decodes it into dst. On failure the error response is written and false is returned.
+func (srv *Server) decodeRequest(w http.ResponseWriter, r *http.Request, schema *openapi.Schema, dst any) bool {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "application/json") {
+		NewResponse().SetError("bad_request", "Content-Type must be application/json", contentType).BadRequest(w)
+
+		return false
+	}
+
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	if err != nil {
+		NewResponse().SetError("bad_request", err.Error()).BadRequest(w)
+
+		return false
+	} else if len(bytes.TrimSpace(raw)) == 0 {
+		NewResponse().SetError("bad_request", errorRequestBodyEmpty.Error()).BadRequest(w)
+
+		return false
+	}
+
+	// Decode into a generic value first to validate it against the schema
+	var value any
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	if err := decodeSingle(decoder, &value); err != nil {
+		NewResponse().SetError("bad_request", err.Error()).BadRequest(w)
+
+		return false
+	}
+
+	if schema != nil {
+		if errs := srv.spec.Validate(schema, value); len(errs) > 0 {
+			NewResponse().SetError(
+				"validation_error",
+				"Request body does not match the schema",
+				map[string]any{"fields": errs},
+			).BadRequest(w)
+
+			return false
+		}
+	}
+
+	if err := decodeSingle(json.NewDecoder(bytes.NewReader(raw)), dst); err != nil {
+		NewResponse().SetError("bad_request", err.Error()).BadRequest(w)
+
+		return false
+	}
+
+	return true
+}
+
+// decodeSingle decodes the only JSON value of the decoder into dst, the trailing data is rejected.
+func decodeSingle(decoder *json.Decoder, dst any) error {
+	if err := decoder.Decode(dst); err != nil {
+		return err
+	}
+
+	if decoder.More() {
+		return errorRequestBodyTrailing
+	}
+
+	if err := decoder.Decode(&json.RawMessage{}); !errors.Is(err, io.EOF) {
+		return errorRequestBodyTrailing
+	}
+
+	return nil
+}
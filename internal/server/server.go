@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -16,7 +15,10 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/plugfox/foxy-gram-server/internal/global"
 	"github.com/plugfox/foxy-gram-server/internal/log"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
 	"github.com/plugfox/foxy-gram-server/internal/storage"
+	"github.com/plugfox/foxy-gram-server/internal/tracing"
 )
 
 type Server struct {
@@ -24,12 +26,15 @@ type Server struct {
 	public chi.Router
 	admin  chi.Router
 	server *http.Server
+	spec   *openapi.Document
+	health http.HandlerFunc // Health check handler, also served at /metrics without the metrics handler
 }
 
 func New() *Server { // Router for HTTP API and Websocket centrifuge protocol.
 	middleware.DefaultLogger = middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.NewLogAdapter(global.Logger)})
 	router := chi.NewRouter()
 	/* router.Use(middleware.Recoverer) */
+	router.Use(tracing.Middleware)
 	router.Use(middlewareErrorRecoverer(global.Logger))
 	router.Use(middleware.Logger)
 	router.Use(middleware.RequestID)
@@ -87,12 +92,17 @@ func New() *Server { // Router for HTTP API and Websocket centrifuge protocol.
 		ErrorLog:     log.NewLogAdapter(global.Logger),
 	}
 
-	return &Server{
+	srv := &Server{
 		router: router,
 		public: public,
 		admin:  admin,
 		server: server,
+		spec:   newSpec(),
 	}
+
+	srv.addSpecRoute() // OpenAPI document [GET] /openapi.json
+
+	return srv
 }
 
 // AddHealthCheck adds a health check endpoint to the server.
@@ -142,49 +152,124 @@ func (srv *Server) AddHealthCheck(statusFunc func() (bool, map[string]string)) {
 		}
 	}
 
-	srv.public.Get("/health", handler)
-	srv.public.Get("/status", handler)
-	srv.public.Get("/healthz", handler)
-	srv.public.Get("/statusz", handler)
-	srv.public.Get("/metrics", handler)
-	srv.public.Get("/info", handler)
+	srv.health = handler
+
+	for _, path := range []string{"/health", "/status", "/healthz", "/statusz", "/info"} {
+		srv.addHealthAlias(path)
+	}
+}
+
+// addHealthAlias serves the health check at [GET] path.
+func (srv *Server) addHealthAlias(path string) {
+	srv.public.Get(path, srv.health)
+	srv.describe(http.MethodGet, path, false, &openapi.Operation{
+		Summary:     "Health check",
+		Description: "Status of the services, uptime and resource usage.",
+		Tags:        []string{"health"},
+	})
+}
+
+// AddMetrics exposes the metrics handler, e.g. Prometheus exporter, at [GET] /metrics.
+// Without the handler /metrics stays an alias of the health check, if it is added.
+func (srv *Server) AddMetrics(handler http.Handler) {
+	if handler == nil {
+		if srv.health != nil {
+			srv.addHealthAlias("/metrics")
+		}
+
+		return
+	}
+
+	srv.public.Method(http.MethodGet, "/metrics", handler)
+	srv.describe(http.MethodGet, "/metrics", false, &openapi.Operation{
+		Summary:     "Metrics",
+		Description: "Metrics in the Prometheus text exposition format.",
+		OperationID: "getMetrics",
+		Tags:        []string{"health"},
+		Responses: map[string]openapi.Response{
+			"200": {
+				Description: "Prometheus metrics",
+				Content: map[string]openapi.MediaType{
+					"text/plain": {Schema: openapi.String("")},
+				},
+			},
+		},
+	})
 }
 
-func (srv *Server) AddVerifyUsers(db *storage.Storage) {
+// verifyUsersSchema is the request body schema of the [POST] /admin/verify endpoint.
+func verifyUsersSchema() *openapi.Schema {
+	const maxReasonLength = 256
+
+	return openapi.Object(map[string]*openapi.Schema{
+		"ids":    openapi.Array(openapi.Integer("Telegram user ID").WithMinimum(1)).WithMinItems(1),
+		"reason": openapi.String("Reason of the verification").WithMaxLength(maxReasonLength),
+	}, "ids").Strict()
+}
+
+func (srv *Server) AddVerifyUsers(db storage.Repository) {
+	schema := verifyUsersSchema()
+
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		var requestBody struct {
 			IDs    []int  `json:"ids"`
 			Reason string `json:"reason,omitempty"`
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-			NewResponse().SetError("bad_request", err.Error()).BadRequest(w)
-		} else if (requestBody.IDs == nil) || (len(requestBody.IDs) == 0) {
-			NewResponse().SetError("bad_request", "IDs are required").BadRequest(w)
-		} else {
-			if requestBody.Reason == "" {
-				requestBody.Reason = "Verified from API"
-			}
+		if !srv.decodeRequest(w, r, schema, &requestBody) {
+			return
+		}
 
-			if err := db.VerifyUsers(requestBody.Reason, requestBody.IDs); err != nil {
-				NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
-			} else {
-				NewResponse().Ok(w)
-			}
+		if requestBody.Reason == "" {
+			requestBody.Reason = "Verified from API"
+		}
+
+		if err := db.VerifyUsers(requestBody.Reason, requestBody.IDs); err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		events := make([]*model.ModerationEvent, 0, len(requestBody.IDs))
+		for _, id := range requestBody.IDs {
+			events = append(events, model.NewModerationEvent(model.ModerationEventVerification, 0, int64(id), "api"))
 		}
+
+		if err := db.RecordModerationEvent(events...); err != nil {
+			global.Logger.ErrorContext(r.Context(), "record moderation events error", slog.String("error", err.Error()))
+		}
+
+		NewResponse().Ok(w)
 	}
 
 	srv.admin.Post("/admin/verify", handler)
+	srv.describe(http.MethodPost, "/admin/verify", true, &openapi.Operation{
+		Summary:     "Verify users",
+		Description: "Mark the users as verified, so they can skip the captcha.",
+		OperationID: "verifyUsers",
+		Tags:        []string{"users"},
+		RequestBody: openapi.JSONBody(schema),
+	})
 }
 
 // AddPublicRoute adds a public route to the server.
-func (srv *Server) AddPublicRoute(method string, path string, handler http.HandlerFunc) {
+// The optional operation describes the route in the OpenAPI document.
+func (srv *Server) AddPublicRoute(method string, path string, handler http.HandlerFunc, op ...*openapi.Operation) {
 	srv.public.Method(method, path, handler)
+
+	if len(op) > 0 {
+		srv.describe(method, path, false, op[0])
+	}
 }
 
 // AddAdminRoute adds an admin route to the server.
-func (srv *Server) AddAdminRoute(method string, path string, handler http.HandlerFunc) {
+// The optional operation describes the route in the OpenAPI document.
+func (srv *Server) AddAdminRoute(method string, path string, handler http.HandlerFunc, op ...*openapi.Operation) {
 	srv.admin.Method(method, path, handler)
+
+	if len(op) > 0 {
+		srv.describe(method, path, true, op[0])
+	}
 }
 
 // Status returns the server status.
@@ -260,7 +345,7 @@ func middlewareErrorRecoverer(logger *slog.Logger) func(next http.Handler) http.
 					}
 
 					// Log the error
-					logger.ErrorContext(context.Background(), "Recovered from panic", slog.String("error", fmt.Sprintf("%v", err)))
+					logger.ErrorContext(r.Context(), "Recovered from panic", slog.String("error", fmt.Sprintf("%v", err)))
 
 					NewResponse().SetError("internal_server_error",
 						"Internal Server Error",
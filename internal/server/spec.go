@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+)
+
+const (
+	specTitle   = "FoxyGram API"
+	specVersion = "1.0.0"
+
+	// bearerAuth is the name of the security scheme used by the admin API.
+	bearerAuth = "bearerAuth"
+)
+
+// newSpec creates the OpenAPI document with the reusable schemas of the API.
+func newSpec() *openapi.Document {
+	spec := openapi.New(specTitle, specVersion)
+	spec.Info.Description = "HTTP API of the FoxyGram Telegram administration bot."
+
+	spec.AddSecurityScheme(bearerAuth, openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "The secret from the configuration",
+	})
+
+	spec.AddSchema("Error", openapi.Object(map[string]*openapi.Schema{
+		"code":    openapi.String("Machine readable error code"),
+		"message": openapi.String("Human readable error message"),
+		"extra":   {Description: "Additional error details, e.g. field-level validation errors"},
+	}, "code", "message"))
+
+	spec.AddSchema("Response", openapi.Object(map[string]*openapi.Schema{
+		"status": openapi.String("Response status").WithEnum(okStatus, errStatus),
+		"data":   {Description: "Response payload"},
+		"error":  openapi.Ref("Error"),
+	}, "status"))
+
+	return spec
+}
+
+// describe adds the operation to the OpenAPI document.
+// Admin operations are marked as protected with the bearer token,
+// and the common error responses are added to every operation, 400 to the operations with the body or the parameters.
+func (srv *Server) describe(method string, path string, admin bool, op *openapi.Operation) {
+	if op == nil {
+		return
+	}
+
+	if op.Responses == nil {
+		op.Responses = map[string]openapi.Response{}
+	}
+
+	if _, ok := op.Responses["200"]; !ok {
+		op.Responses["200"] = openapi.JSONResponse("Successful response", openapi.Ref("Response"))
+	}
+
+	// The body and the query or path parameters are validated, the specific description of the operation is kept
+	if _, ok := op.Responses["400"]; !ok && (op.RequestBody != nil || len(op.Parameters) > 0) {
+		op.Responses["400"] = openapi.JSONResponse("Invalid request", openapi.Ref("Response"))
+	}
+
+	if admin {
+		op.Security = []map[string][]string{{bearerAuth: {}}}
+		op.Responses["401"] = openapi.JSONResponse("Unauthorized", openapi.Ref("Response"))
+	}
+
+	op.Responses["500"] = openapi.JSONResponse("Internal server error", openapi.Ref("Response"))
+
+	srv.spec.AddOperation(method, path, op)
+}
+
+// Spec returns the OpenAPI document of the server.
+func (srv *Server) Spec() *openapi.Document {
+	return srv.spec
+}
+
+// addSpecRoute serves the OpenAPI document at the public endpoint.
+func (srv *Server) addSpecRoute() {
+	srv.public.Get("/openapi.json", srv.spec.Handler())
+	srv.describe(http.MethodGet, "/openapi.json", false, &openapi.Operation{
+		Summary:     "OpenAPI document",
+		Description: "The OpenAPI 3 document describing this API.",
+		OperationID: "getOpenAPI",
+		Tags:        []string{"meta"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("OpenAPI document", &openapi.Schema{Type: "object"}),
+		},
+	})
+}
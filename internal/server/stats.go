@@ -0,0 +1,271 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+var (
+	errorInvalidTime   = errors.New("must be RFC 3339 time, date YYYY-MM-DD or unix timestamp")
+	errorInvalidBucket = errors.New("must be hour, day, week or duration like 15m, at least 1m")
+	errorInvalidRange  = errors.New("from must be before to")
+	errorInvalidChatID = errors.New("must be an integer")
+	errorInvalidLimit  = errors.New("must be a positive integer")
+)
+
+// statsResponses are the responses of the statistics endpoints, with the invalid query parameters.
+func statsResponses() map[string]openapi.Response {
+	return map[string]openapi.Response{
+		"400": openapi.JSONResponse("Invalid query parameters", openapi.Ref("Response")),
+	}
+}
+
+// statsParameters are the query parameters shared by the statistics endpoints.
+func statsParameters() []openapi.Parameter {
+	return []openapi.Parameter{
+		openapi.QueryParam("from", "Start of the range: RFC 3339 time, YYYY-MM-DD or unix timestamp, 30 days ago by default", openapi.String("")),
+		openapi.QueryParam("to", "End of the range, exclusive, now by default", openapi.String("")),
+		openapi.QueryParam("bucket", "Size of the time bucket: hour, day, week or duration like 15m, day by default", openapi.String("")),
+		openapi.QueryParam("chat_id", "Limit the statistics to the chat", openapi.Integer("")),
+		openapi.QueryParam("limit", "Maximum number of the most active users, 10 by default", openapi.Integer("").WithMinimum(1)),
+	}
+}
+
+// parseStatsTime parses RFC 3339 time, date or unix timestamp.
+func parseStatsTime(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, errorInvalidTime
+}
+
+// parseStatsBucket parses the named bucket or the duration.
+func parseStatsBucket(value string) (time.Duration, error) {
+	const (
+		day  = 24 * time.Hour
+		week = 7 * day
+	)
+
+	switch strings.ToLower(value) {
+	case "hour":
+		return time.Hour, nil
+	case "day":
+		return day, nil
+	case "week":
+		return week, nil
+	}
+
+	bucket, err := time.ParseDuration(value)
+	if err != nil || bucket < time.Minute {
+		return 0, errorInvalidBucket
+	}
+
+	return bucket, nil
+}
+
+// parseStatsFilter reads the statistics filter from the query parameters.
+// Returns the field errors in the format of the request validation.
+func parseStatsFilter(r *http.Request, now time.Time) (storage.StatsFilter, []openapi.FieldError) {
+	const defaultRange = 30 * 24 * time.Hour
+
+	query := r.URL.Query()
+	filter := storage.StatsFilter{
+		From:   now.Add(-defaultRange),
+		To:     now,
+		Bucket: 24 * time.Hour, //nolint:mnd
+	}
+
+	var errs []openapi.FieldError
+
+	fail := func(field string, err error) {
+		errs = append(errs, openapi.FieldError{Field: field, Message: err.Error()})
+	}
+
+	if value := query.Get("from"); value != "" {
+		if t, err := parseStatsTime(value); err != nil {
+			fail("from", err)
+		} else {
+			filter.From = t
+		}
+	}
+
+	if value := query.Get("to"); value != "" {
+		if t, err := parseStatsTime(value); err != nil {
+			fail("to", err)
+		} else {
+			filter.To = t
+		}
+	}
+
+	if value := query.Get("bucket"); value != "" {
+		if bucket, err := parseStatsBucket(value); err != nil {
+			fail("bucket", err)
+		} else {
+			filter.Bucket = bucket
+		}
+	}
+
+	if value := query.Get("chat_id"); value != "" {
+		if chatID, err := strconv.ParseInt(value, 10, 64); err != nil {
+			fail("chat_id", errorInvalidChatID)
+		} else {
+			filter.ChatID = chatID
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		if limit, err := strconv.Atoi(value); err != nil || limit < 1 {
+			fail("limit", errorInvalidLimit)
+		} else {
+			filter.Limit = limit
+		}
+	}
+
+	if len(errs) == 0 && !filter.From.Before(filter.To) {
+		fail("from", errorInvalidRange)
+	}
+
+	return filter, errs
+}
+
+// AddStats adds the statistics endpoints computed from the database at [GET] /admin/stats/*.
+func (srv *Server) AddStats(db storage.Repository) {
+	// stats wraps the query into the handler, parsing the filter from the query parameters
+	stats := func(query func(db storage.Repository, filter storage.StatsFilter) (any, error)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			filter, errs := parseStatsFilter(r, time.Now())
+			if len(errs) > 0 {
+				NewResponse().SetError("validation_error", "Invalid query parameters", map[string]any{"fields": errs}).BadRequest(w)
+
+				return
+			}
+
+			data, err := query(db.WithContext(r.Context()), filter)
+			if err != nil {
+				NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+				return
+			}
+
+			NewResponse().SetData(map[string]any{
+				"from":   filter.From.Unix(),
+				"to":     filter.To.Unix(),
+				"bucket": int64(filter.Bucket / time.Second),
+				"stats":  data,
+			}).Ok(w)
+		}
+	}
+
+	routes := []struct {
+		path        string
+		operationID string
+		summary     string
+		description string
+		query       func(db storage.Repository, filter storage.StatsFilter) (any, error)
+	}{
+		{
+			path:        "/admin/stats/messages",
+			operationID: "getStatsMessages",
+			summary:     "Messages per chat",
+			description: "Number of messages per chat per time bucket.",
+			query: func(db storage.Repository, filter storage.StatsFilter) (any, error) {
+				return db.MessagesPerChat(filter)
+			},
+		},
+		{
+			path:        "/admin/stats/users",
+			operationID: "getStatsUsers",
+			summary:     "Most active users",
+			description: "Users with the most messages in the range.",
+			query: func(db storage.Repository, filter storage.StatsFilter) (any, error) {
+				return db.TopUsers(filter)
+			},
+		},
+		{
+			path:        "/admin/stats/moderation",
+			operationID: "getStatsModeration",
+			summary:     "Joins, verifications and bans",
+			description: "Number of joins, verifications and bans per time bucket.",
+			query: func(db storage.Repository, filter storage.StatsFilter) (any, error) {
+				return db.ModerationTimeline(filter)
+			},
+		},
+		{
+			path:        "/admin/stats/captcha",
+			operationID: "getStatsCaptcha",
+			summary:     "Captcha statistics",
+			description: "Sent, solved, failed and expired captchas, solve rate and median solve time.",
+			query: func(db storage.Repository, filter storage.StatsFilter) (any, error) {
+				return db.CaptchaStats(filter)
+			},
+		},
+		{
+			path:        "/admin/stats/spam",
+			operationID: "getStatsSpam",
+			summary:     "Spam deletions per rule",
+			description: "Number of deleted messages per moderation rule.",
+			query: func(db storage.Repository, filter storage.StatsFilter) (any, error) {
+				return db.SpamDeletions(filter)
+			},
+		},
+		{
+			path:        "/admin/stats/invite-links",
+			operationID: "getStatsInviteLinks",
+			summary:     "Invite link statistics",
+			description: "Joins by the invite link, captcha outcomes and bans of the joined users, with the failure and ban rates. The user is attributed to the link of the last join.",
+			query: func(db storage.Repository, filter storage.StatsFilter) (any, error) {
+				return db.InviteLinkStats(filter)
+			},
+		},
+	}
+
+	for _, route := range routes {
+		srv.admin.Get(route.path, stats(route.query))
+		srv.describe(http.MethodGet, route.path, true, &openapi.Operation{
+			Summary:     route.summary,
+			Description: route.description,
+			OperationID: route.operationID,
+			Tags:        []string{"stats"},
+			Parameters:  statsParameters(),
+			Responses:   statsResponses(),
+		})
+	}
+
+	// Overview with every statistic at once
+	srv.admin.Get("/admin/stats", stats(func(db storage.Repository, filter storage.StatsFilter) (any, error) {
+		overview := make(map[string]any, len(routes))
+
+		for _, route := range routes {
+			data, err := route.query(db, filter)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", route.path, err)
+			}
+
+			overview[strings.TrimPrefix(route.path, "/admin/stats/")] = data
+		}
+
+		return overview, nil
+	}))
+	srv.describe(http.MethodGet, "/admin/stats", true, &openapi.Operation{
+		Summary:     "Statistics overview",
+		Description: "Every statistic of the /admin/stats/* endpoints in one response.",
+		OperationID: "getStats",
+		Tags:        []string{"stats"},
+		Parameters:  statsParameters(),
+		Responses:   statsResponses(),
+	})
+}
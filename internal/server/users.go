@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/server/openapi"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+var errorInvalidUserID = errors.New("must be a positive integer")
+
+// AddForgetUser adds the endpoint removing the messages and the profile data of the user
+// at [DELETE] /admin/users/{id}.
+func (srv *Server) AddForgetUser(db storage.Repository) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || userID < 1 {
+			NewResponse().SetError("validation_error", "Invalid path parameters", map[string]any{
+				"fields": []openapi.FieldError{{Field: "id", Message: errorInvalidUserID.Error()}},
+			}).BadRequest(w)
+
+			return
+		}
+
+		removed, err := db.WithContext(r.Context()).ForgetUser(model.UserID(userID))
+		if err != nil {
+			NewResponse().SetError("internal_server_error", err.Error()).InternalServerError(w)
+
+			return
+		}
+
+		global.Logger.InfoContext(r.Context(), "user data removed", slog.Int64("user_id", userID))
+
+		defer global.Metrics.LogEvent("user_forgotten", nil, map[string]any{
+			"user_id": userID,
+		})
+
+		NewResponse().SetData(map[string]any{
+			"id":      userID,
+			"removed": removed,
+		}).Ok(w)
+	}
+
+	srv.admin.Delete("/admin/users/{id}", handler)
+	srv.describe(http.MethodDelete, "/admin/users/{id}", true, &openapi.Operation{
+		Summary:     "Forget user",
+		Description: "Remove the messages and the profile data of the user from every table. The ban of the user, if any, is kept.",
+		OperationID: "forgetUser",
+		Tags:        []string{"users"},
+		Parameters: []openapi.Parameter{
+			openapi.PathParam("id", "Telegram user ID", openapi.Integer("").WithMinimum(1)),
+		},
+		Responses: map[string]openapi.Response{
+			"400": openapi.JSONResponse("Invalid user ID", openapi.Ref("Response")),
+		},
+	})
+}
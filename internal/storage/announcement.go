@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+)
+
+// AnnouncementByID - get the announcement by ID.
+func (s *Storage) AnnouncementByID(id int64) (*model.Announcement, error) {
+	var announcement model.Announcement
+	if err := s.db.Where("id = ?", id).First(&announcement).Error; err != nil {
+		return nil, err
+	}
+
+	return &announcement, nil
+}
+
+// Announcements - get the announcements of the chat, or of every chat if the chat ID is 0, ordered by ID.
+func (s *Storage) Announcements(chatID model.ChatID) ([]model.Announcement, error) {
+	query := s.db.Order("id")
+	if chatID != 0 {
+		query = query.Where("chat_id = ?", chatID)
+	}
+
+	var announcements []model.Announcement
+	if err := query.Find(&announcements).Error; err != nil {
+		return nil, err
+	}
+
+	return announcements, nil
+}
+
+// DueAnnouncements - get the announcements to post at the time, the most overdue first.
+func (s *Storage) DueAnnouncements(now time.Time, limit int) ([]model.Announcement, error) {
+	var announcements []model.Announcement
+	if err := s.db.Where("next_run_at IS NOT NULL AND next_run_at <= ?", now).
+		Order("next_run_at").Limit(limit).Find(&announcements).Error; err != nil {
+		return nil, err
+	}
+
+	return announcements, nil
+}
+
+// UpsertAnnouncement - insert or update the announcement, the ID of the new one is set.
+func (s *Storage) UpsertAnnouncement(announcement *model.Announcement) error {
+	return s.db.Save(announcement).Error
+}
+
+// DeleteAnnouncement - delete the announcement by ID.
+func (s *Storage) DeleteAnnouncement(id int64) error {
+	return s.db.Delete(&model.Announcement{}, "id = ?", id).Error
+}
@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	backupFormat    = "foxy-gram-backup"
+	backupVersion   = 1   // Version of the file format, not of the database schema
+	backupBatchSize = 500 // Rows read or written at once
+	backupLineSize  = 1 << 26
+)
+
+var (
+	errorBackupFormat    = errors.New("not a backup file")
+	errorBackupVersion   = errors.New("unsupported backup version")
+	errorBackupSchema    = errors.New("backup is made by a newer database schema, apply the migrations first")
+	errorBackupTable     = errors.New("unknown table in the backup")
+	errorBackupTruncated = errors.New("backup is truncated")
+)
+
+// BackupHeader - the first line of the backup.
+type BackupHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Schema    int64     `json:"schema"`  // Last applied migration of the source database
+	Dialect   string    `json:"dialect"` // Source database, e.g. "sqlite" or "postgres"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupStats - number of the rows per table.
+type BackupStats map[string]int64
+
+// backupLine - a row of the table, or the last line with the number of the rows.
+type backupLine struct {
+	Table string          `json:"table,omitempty"`
+	Row   json.RawMessage `json:"row,omitempty"`
+	End   BackupStats     `json:"end,omitempty"`
+}
+
+// backupTable - a table of the backup, the rows are encoded with the JSON tags of the model.
+type backupTable struct {
+	name    string
+	serial  bool // The ID is generated by the database
+	export  func(db *gorm.DB, write func(table string, row any) error) error
+	restore func(tx *gorm.DB, rows []json.RawMessage) error
+}
+
+// tableOf - the backup table of the model, the rows are exported in the order of the primary key,
+// so the replies follow the messages they reply to.
+func tableOf[T any](name string, order string, serial bool) backupTable {
+	return backupTable{
+		name:   name,
+		serial: serial,
+		export: func(db *gorm.DB, write func(table string, row any) error) error {
+			rows, err := db.Model(new(T)).Unscoped().Order(order).Rows()
+			if err != nil {
+				return err
+			}
+
+			defer rows.Close()
+
+			for rows.Next() {
+				var row T
+				if err := db.ScanRows(rows, &row); err != nil {
+					return err
+				}
+
+				if err := write(name, &row); err != nil {
+					return err
+				}
+			}
+
+			return rows.Err()
+		},
+		restore: func(tx *gorm.DB, raw []json.RawMessage) error {
+			rows := make([]T, len(raw))
+			for i, row := range raw {
+				if err := json.Unmarshal(row, &rows[i]); err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+
+			return tx.Omit(clause.Associations).Clauses(clause.OnConflict{UpdateAll: true}).Create(&rows).Error
+		},
+	}
+}
+
+// backupTables - the tables in the order of the restore, the referenced rows go first.
+func backupTables() []backupTable {
+	return []backupTable{
+		tableOf[model.User]("users", "id", false),
+		tableOf[model.Chat]("chats", "id", false),
+		tableOf[model.VerifiedUser]("verified", "id", false),
+		tableOf[model.BannedUser]("banned", "id", false),
+		tableOf[model.BanChat]("ban_chats", "user_id, chat_id", false),
+		tableOf[model.Message]("messages", "id", false),
+		tableOf[model.MessageOrigin]("message_origins", "id", true),
+		tableOf[model.ReplyMarkup]("reply_markups", "id", true),
+		tableOf[model.MessageRevision]("message_revisions", "id", true),
+		tableOf[model.Captcha]("captchas", "id", true),
+		tableOf[model.KeyValue]("kv", "key", false),
+		tableOf[model.ModerationEvent]("moderation_events", "id", true),
+		tableOf[model.ChatMember]("chat_members", "chat_id, user_id", false),
+		tableOf[model.InviteLink]("invite_links", "link", false),
+		tableOf[model.ChatRules]("chat_rules", "chat_id", false),
+		tableOf[model.Announcement]("announcements", "id", true),
+		tableOf[model.Lockdown]("lockdowns", "chat_id", false),
+	}
+}
+
+// schemaVersion - the last applied migration.
+func (s *Storage) schemaVersion(ctx context.Context) (int64, error) {
+	migrator, err := s.Migrator()
+	if err != nil {
+		return 0, err
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+
+	for _, status := range statuses {
+		if status.AppliedAt != nil && status.Version > version {
+			version = status.Version
+		}
+	}
+
+	return version, nil
+}
+
+// Backup - write every table as gzip-compressed NDJSON: the header, the rows and the number of the rows.
+// The backup is portable between the database drivers and restored with Restore.
+func (s *Storage) Backup(ctx context.Context, writer io.Writer) (BackupStats, error) {
+	schema, err := s.schemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := gzip.NewWriter(writer)
+	buffered := bufio.NewWriter(archive)
+	encoder := json.NewEncoder(buffered)
+	stats := make(BackupStats)
+
+	err = encoder.Encode(BackupHeader{
+		Format:    backupFormat,
+		Version:   backupVersion,
+		Schema:    schema,
+		Dialect:   s.db.Dialector.Name(),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	write := func(table string, row any) error {
+		raw, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+
+		stats[table]++
+
+		return encoder.Encode(backupLine{Table: table, Row: raw})
+	}
+
+	db := s.db.WithContext(ctx)
+	for _, table := range backupTables() {
+		stats[table.name] = 0
+		if err := table.export(db, write); err != nil {
+			return stats, fmt.Errorf("%s: %w", table.name, err)
+		}
+	}
+
+	if err := encoder.Encode(backupLine{End: stats}); err != nil {
+		return stats, err
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return stats, err
+	}
+
+	return stats, archive.Close()
+}
+
+// Restore - insert or update the rows of the backup, the existing rows not in the backup are kept.
+// The backup of an older schema is accepted, the new columns get the default values.
+// Every batch is committed separately, so the interrupted restore can be repeated.
+func (s *Storage) Restore(ctx context.Context, reader io.Reader) (BackupStats, error) {
+	archive, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	defer archive.Close()
+
+	scanner := bufio.NewScanner(archive)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), backupLineSize)
+
+	// Header
+	var header BackupHeader
+	if !scanner.Scan() {
+		return nil, errors.Join(errorBackupFormat, scanner.Err())
+	}
+
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Format != backupFormat {
+		return nil, errorBackupFormat
+	}
+
+	if header.Version != backupVersion {
+		return nil, fmt.Errorf("%w: %d", errorBackupVersion, header.Version)
+	}
+
+	schema, err := s.schemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Schema > schema {
+		return nil, fmt.Errorf("%w: backup %d, database %d", errorBackupSchema, header.Schema, schema)
+	}
+
+	// Rows
+	var (
+		tables = make(map[string]backupTable)
+		stats  = make(BackupStats)
+		batch  []json.RawMessage
+		table  backupTable
+		end    BackupStats
+		db     = s.db.WithContext(ctx)
+	)
+
+	for _, table := range backupTables() {
+		tables[table.name], stats[table.name] = table, 0
+	}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error { return table.restore(tx, batch) }); err != nil {
+			return err
+		}
+
+		stats[table.name] += int64(len(batch))
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for scanner.Scan() {
+		var line backupLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return stats, err
+		}
+
+		if line.End != nil {
+			end = line.End
+
+			break
+		}
+
+		if line.Table != table.name || len(batch) >= backupBatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+
+		if line.Table != table.name {
+			next, ok := tables[line.Table]
+			if !ok {
+				return stats, fmt.Errorf("%w: %s", errorBackupTable, line.Table)
+			}
+
+			table = next
+		}
+
+		batch = append(batch, line.Row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return stats, err
+	}
+
+	if err := flush(); err != nil {
+		return stats, err
+	}
+
+	s.ClearCache()
+
+	if err := s.resetSequences(ctx); err != nil {
+		return stats, err
+	}
+
+	// The rows are counted when written, the missing rows mean the backup is cut
+	for name, count := range end {
+		if stats[name] != count {
+			return stats, fmt.Errorf("%w: %s has %d of %d rows", errorBackupTruncated, name, stats[name], count)
+		}
+	}
+
+	if end == nil {
+		return stats, errorBackupTruncated
+	}
+
+	return stats, nil
+}
+
+// resetSequences - move the PostgreSQL sequences after the restored IDs,
+// the other databases continue after the largest ID themselves.
+func (s *Storage) resetSequences(ctx context.Context) error {
+	if s.db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	for _, table := range backupTables() {
+		if !table.serial {
+			continue
+		}
+
+		query := fmt.Sprintf( //nolint:gosec
+			"SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s",
+			table.name,
+		)
+		if err := s.db.WithContext(ctx).Exec(query).Error; err != nil {
+			return fmt.Errorf("%s: %w", table.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackup(t *testing.T) {
+	source := newTestStorage(t)
+	ctx := context.Background()
+
+	require.NoError(t, source.UpsertMessage(UpsertMessageInput{
+		Message: &model.Message{ID: 1, ChatID: -100, SenderID: 1, Text: "Hello", Unixtime: time.Now().Unix()},
+		Origin:  &model.MessageOrigin{Type: "hidden_user", SenderName: "Fox"},
+		Chats:   []*model.Chat{{ID: -100, Title: "Foxes"}},
+		Users:   []*model.User{{ID: 1, FirstName: "Fox"}, {ID: 2, FirstName: "Cat"}},
+	}))
+	require.NoError(t, source.VerifyUsers("test", []int{1}))
+	require.NoError(t, source.BanUser(&model.BannedUser{ID: 2, BannedAt: time.Now(), Reason: "spam"}))
+	require.NoError(t, source.KVSet("import#-100", int64(42)))
+	require.NoError(t, source.RecordModerationEvent(model.NewModerationEvent(model.ModerationEventCaptchaSolved, -100, 1, "")))
+
+	var backup bytes.Buffer
+
+	stats, err := source.Backup(ctx, &backup)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, stats["users"])
+	require.EqualValues(t, 1, stats["messages"])
+	require.EqualValues(t, 1, stats["message_origins"])
+	require.EqualValues(t, 1, stats["moderation_events"])
+	require.Zero(t, stats["captchas"])
+
+	// Restore into another database
+	global.Config.Database.Connection = filepath.Join(t.TempDir(), "restore.sqlite3")
+
+	target, err := New()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = target.Close() })
+
+	t.Run("Restore", func(t *testing.T) {
+		restored, err := target.Restore(ctx, bytes.NewReader(backup.Bytes()))
+		require.NoError(t, err)
+		require.Equal(t, stats, restored)
+
+		message, err := target.MessageByID(-100, 1)
+		require.NoError(t, err)
+		require.Equal(t, "Hello", message.Text)
+
+		verified, err := target.IsVerifiedUser(1)
+		require.NoError(t, err)
+		require.True(t, verified)
+
+		var checkpoint int64
+
+		kv, err := target.KVGet("import#-100")
+		require.NoError(t, err)
+		require.NoError(t, kv.GetValue(&checkpoint))
+		require.EqualValues(t, 42, checkpoint)
+
+		// The restore is repeatable
+		_, err = target.Restore(ctx, bytes.NewReader(backup.Bytes()))
+		require.NoError(t, err)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		archive, err := gzip.NewReader(bytes.NewReader(backup.Bytes()))
+		require.NoError(t, err)
+
+		raw, err := io.ReadAll(archive)
+		require.NoError(t, err)
+
+		// Drop the last line with the number of the rows
+		raw = raw[:bytes.LastIndexByte(raw[:len(raw)-1], '\n')+1]
+
+		var truncated bytes.Buffer
+
+		writer := gzip.NewWriter(&truncated)
+		_, err = writer.Write(raw)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		_, err = target.Restore(ctx, &truncated)
+		require.ErrorIs(t, err, errorBackupTruncated)
+	})
+}
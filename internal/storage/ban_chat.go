@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm/clause"
+)
+
+// ExpiredBans - get the bans expired before the time, the oldest first.
+func (s *Storage) ExpiredBans(now time.Time, limit int) ([]model.BannedUser, error) {
+	var bans []model.BannedUser
+	if err := s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Order("expires_at").Limit(limit).Find(&bans).Error; err != nil {
+		return nil, err
+	}
+
+	return bans, nil
+}
+
+// UpcomingBanExpiries - get the bans expiring between the times, the soonest first.
+func (s *Storage) UpcomingBanExpiries(now time.Time, until time.Time, limit int) ([]model.BannedUser, error) {
+	var bans []model.BannedUser
+	if err := s.db.Where("expires_at > ? AND expires_at <= ?", now, until).Order("expires_at").Limit(limit).Find(&bans).Error; err != nil {
+		return nil, err
+	}
+
+	return bans, nil
+}
+
+// RecordBanChat - remember the chat where the user is banned in Telegram.
+func (s *Storage) RecordBanChat(userID model.UserID, chatID model.ChatID) error {
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.BanChat{UserID: userID, ChatID: chatID, BannedAt: time.Now().UTC()}).Error
+}
+
+// BanChats - get the chats where the user is banned in Telegram.
+func (s *Storage) BanChats(userID model.UserID) ([]model.BanChat, error) {
+	var chats []model.BanChat
+	if err := s.db.Where("user_id = ?", userID).Order("chat_id").Find(&chats).Error; err != nil {
+		return nil, err
+	}
+
+	return chats, nil
+}
+
+// LiftedBanChats - get the chats where the user is still banned in Telegram,
+// but the ban is removed, e.g. unbanned by an admin, verified or revoked with its source.
+func (s *Storage) LiftedBanChats(limit int) ([]model.BanChat, error) {
+	var chats []model.BanChat
+	if err := s.db.Where("NOT EXISTS (SELECT 1 FROM banned WHERE banned.id = ban_chats.user_id)").
+		Order("banned_at").Limit(limit).Find(&chats).Error; err != nil {
+		return nil, err
+	}
+
+	return chats, nil
+}
+
+// DeleteBanChat - forget the chat, after the user is unbanned there.
+func (s *Storage) DeleteBanChat(userID model.UserID, chatID model.ChatID) error {
+	return s.db.Delete(&model.BanChat{}, "user_id = ? AND chat_id = ?", userID, chatID).Error
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBanExpiries(t *testing.T) {
+	db := newTestStorage(t)
+	now := time.Now()
+	expiresAt := func(d time.Duration) sql.NullTime {
+		return sql.NullTime{Time: now.Add(d), Valid: true}
+	}
+
+	require.NoError(t, db.BanUser(&model.BannedUser{ID: 1, BannedAt: now, ExpiresAt: expiresAt(-time.Hour)}))
+	require.NoError(t, db.BanUser(&model.BannedUser{ID: 2, BannedAt: now, ExpiresAt: expiresAt(time.Hour)}))
+	require.NoError(t, db.BanUser(&model.BannedUser{ID: 3, BannedAt: now}))
+	require.NoError(t, db.RecordBanChat(1, -100))
+	require.NoError(t, db.RecordBanChat(1, -100))
+	require.NoError(t, db.RecordBanChat(3, -100))
+
+	banned, err := db.IsBannedUser(1)
+	require.NoError(t, err)
+	require.False(t, banned, "Expired ban is not enforced")
+
+	expired, err := db.ExpiredBans(now, 10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	require.EqualValues(t, 1, expired[0].ID)
+
+	upcoming, err := db.UpcomingBanExpiries(now, now.Add(24*time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, upcoming, 1)
+	require.EqualValues(t, 2, upcoming[0].ID)
+
+	chats, err := db.BanChats(1)
+	require.NoError(t, err)
+	require.Len(t, chats, 1)
+
+	// The chats of the removed bans are lifted
+	require.NoError(t, db.UnbanUser(3))
+
+	lifted, err := db.LiftedBanChats(10)
+	require.NoError(t, err)
+	require.Len(t, lifted, 1)
+	require.EqualValues(t, 3, lifted[0].UserID)
+
+	require.NoError(t, db.DeleteBanChat(3, -100))
+
+	lifted, err = db.LiftedBanChats(10)
+	require.NoError(t, err)
+	require.Empty(t, lifted)
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChatMemberByID - get the membership of the user in the chat.
+func (s *Storage) ChatMemberByID(chatID model.ChatID, userID model.UserID) (*model.ChatMember, error) {
+	var member model.ChatMember
+	if err := s.db.Where("chat_id = ? AND user_id = ?", chatID, userID).First(&member).Error; err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// UpsertChatMember - insert or update the membership.
+func (s *Storage) UpsertChatMember(member *model.ChatMember) error {
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(member).Error
+}
+
+// UpdateChatMember - update the membership of the user in the chat atomically, the new membership is created if missing.
+// The row is locked by the no-op update first, so the concurrent updates of the member are applied one by one.
+func (s *Storage) UpdateChatMember(
+	chatID model.ChatID,
+	userID model.UserID,
+	update func(member *model.ChatMember) error,
+) (*model.ChatMember, error) {
+	member := model.NewChatMember(int64(chatID), int64(userID))
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(member).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.ChatMember{}).
+			Where("chat_id = ? AND user_id = ?", chatID, userID).
+			UpdateColumn("updated_at", gorm.Expr("updated_at")).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("chat_id = ? AND user_id = ?", chatID, userID).First(member).Error; err != nil {
+			return err
+		}
+
+		if err := update(member); err != nil {
+			return err
+		}
+
+		return tx.Save(member).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+// ChatMembersOfUser - get the memberships of the user in every known chat, the latest joins first.
+func (s *Storage) ChatMembersOfUser(userID model.UserID) ([]model.ChatMember, error) {
+	var members []model.ChatMember
+	if err := s.db.Where("user_id = ?", userID).Order("joined_at DESC, chat_id").Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
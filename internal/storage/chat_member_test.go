@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateChatMember(t *testing.T) {
+	db := newTestStorage(t)
+
+	member, err := db.UpdateChatMember(-100, 1, func(member *model.ChatMember) error {
+		member.Status = "member"
+		member.IsMember = true
+
+		return nil
+	})
+	require.NoError(t, err)
+	require.True(t, member.IsMember)
+
+	member, err = db.UpdateChatMember(-100, 1, func(member *model.ChatMember) error {
+		require.True(t, member.IsMember, "The stored membership is updated")
+		member.InviteLink = "https://t.me/+foxy"
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	stored, err := db.ChatMemberByID(-100, 1)
+	require.NoError(t, err)
+	require.Equal(t, member.InviteLink, stored.InviteLink)
+	require.Equal(t, "member", stored.Status)
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm/clause"
+)
+
+// ChatRulesByID - get the rules of the chat.
+func (s *Storage) ChatRulesByID(chatID model.ChatID) (*model.ChatRules, error) {
+	var rules model.ChatRules
+	if err := s.db.Where("chat_id = ?", chatID).First(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	return &rules, nil
+}
+
+// UpsertChatRules - insert or update the rules of the chat.
+func (s *Storage) UpsertChatRules(rules *model.ChatRules) error {
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(rules).Error
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errorEmptySource = errors.New("source of the bans is required")
+
+// BanMergeResult - changes of the banned list after merging the feed of a peer.
+type BanMergeResult struct {
+	Added   int64 `json:"added"`
+	Updated int64 `json:"updated"`
+	Removed int64 `json:"removed"` // Bans of the source missing in the feed
+	Skipped int64 `json:"skipped"` // Local bans, bans of more trusted sources and expired entries
+}
+
+// CanMergeBan - check if the entry of the source may replace the existing ban.
+// The local bans are never replaced, the bans of the other sources only by a more trusted source.
+func CanMergeBan(existing *model.BannedUser, source string, trust int) bool {
+	switch {
+	case existing == nil:
+		return true
+	case existing.IsLocal():
+		return false
+	case existing.Source == source:
+		return true
+	default:
+		return trust > existing.Trust
+	}
+}
+
+// MergeBans - replace the bans of the source with the entries of its feed.
+// The local bans and the bans of the more trusted sources are kept.
+func (s *Storage) MergeBans(source string, trust int, bans []model.BannedUser) (BanMergeResult, error) {
+	var result BanMergeResult
+
+	if source == "" {
+		return result, errorEmptySource
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Bans of the users in the feed, and every ban of the source
+		ids := make([]model.UserID, 0, len(bans))
+		for _, ban := range bans {
+			ids = append(ids, ban.ID)
+		}
+
+		existing := make(map[model.UserID]*model.BannedUser, len(bans))
+
+		const batchSize = 1000
+
+		for start := 0; start < len(ids); start += batchSize {
+			var rows []model.BannedUser
+			if err := tx.Where("id IN ?", ids[start:min(start+batchSize, len(ids))]).Find(&rows).Error; err != nil {
+				return err
+			}
+
+			for i := range rows {
+				existing[rows[i].ID] = &rows[i]
+			}
+		}
+
+		var stale []model.UserID
+		if err := tx.Model(&model.BannedUser{}).Where("source = ?", source).Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+
+		// Insert or update the entries of the feed
+		now := time.Now()
+		seen := make(map[model.UserID]struct{}, len(bans))
+
+		for _, ban := range bans {
+			seen[ban.ID] = struct{}{}
+			previous := existing[ban.ID]
+
+			if (ban.ExpiresAt.Valid && ban.ExpiresAt.Time.Before(now)) || !CanMergeBan(previous, source, trust) {
+				result.Skipped++
+
+				continue
+			}
+
+			ban.Source, ban.Trust = source, trust
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&ban).Error; err != nil {
+				return err
+			}
+
+			if previous == nil {
+				result.Added++
+			} else {
+				result.Updated++
+			}
+		}
+
+		// Remove the bans lifted by the source
+		removed := make([]model.UserID, 0)
+
+		for _, id := range stale {
+			if _, ok := seen[id]; !ok {
+				removed = append(removed, id)
+			}
+		}
+
+		for start := 0; start < len(removed); start += batchSize {
+			query := tx.Where("source = ? AND id IN ?", source, removed[start:min(start+batchSize, len(removed))]).Delete(&model.BannedUser{})
+			if query.Error != nil {
+				return query.Error
+			}
+
+			result.Removed += query.RowsAffected
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// RevokeBans - remove every ban imported from the source.
+func (s *Storage) RevokeBans(source string) (int64, error) {
+	if source == "" {
+		return 0, errorEmptySource
+	}
+
+	query := s.db.Where("source = ?", source).Delete(&model.BannedUser{})
+
+	return query.RowsAffected, query.Error
+}
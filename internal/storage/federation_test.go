@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeBans(t *testing.T) {
+	db := newTestStorage(t)
+	now := time.Now()
+
+	require.NoError(t, db.BanUser(&model.BannedUser{ID: 1, BannedAt: now, Reason: "local"}))
+
+	feed := []model.BannedUser{
+		{ID: 1, BannedAt: now, Reason: "spam"},
+		{ID: 2, BannedAt: now, Reason: "spam"},
+		{ID: 3, BannedAt: now, Reason: "scam"},
+	}
+
+	result, err := db.MergeBans("partner", 50, feed)
+	require.NoError(t, err)
+	require.Equal(t, BanMergeResult{Added: 2, Skipped: 1}, result)
+
+	// A more trusted peer replaces the ban, a less trusted one does not
+	result, err = db.MergeBans("trusted", 90, feed[1:2])
+	require.NoError(t, err)
+	require.Equal(t, BanMergeResult{Updated: 1}, result)
+
+	result, err = db.MergeBans("partner", 50, feed[1:2])
+	require.NoError(t, err)
+	require.Equal(t, BanMergeResult{Removed: 1, Skipped: 1}, result)
+
+	bans, err := db.BannedUsers()
+	require.NoError(t, err)
+	require.Len(t, bans, 2)
+	require.True(t, bans[0].IsLocal())
+	require.Equal(t, "local", bans[0].Reason)
+	require.Equal(t, "trusted", bans[1].Source)
+
+	removed, err := db.RevokeBans("trusted")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), removed)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm/clause"
+)
+
+// InviteLinkByLink - get the invite link.
+func (s *Storage) InviteLinkByLink(link string) (*model.InviteLink, error) {
+	var inviteLink model.InviteLink
+	if err := s.db.Where("link = ?", link).First(&inviteLink).Error; err != nil {
+		return nil, err
+	}
+
+	return &inviteLink, nil
+}
+
+// UpsertInviteLink - insert or update the invite link.
+func (s *Storage) UpsertInviteLink(link *model.InviteLink) error {
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "link"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "expire_at", "member_limit", "is_revoked", "updated_at"}),
+	}).Create(link).Error
+}
+
+// InviteLinks - get the invite links of the chat, the latest first.
+func (s *Storage) InviteLinks(chatID model.ChatID) ([]model.InviteLink, error) {
+	var links []model.InviteLink
+	if err := s.db.Where("chat_id = ?", chatID).Order("created_at DESC, link").Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobRun - the result of the run of the scheduled job.
+type JobRun struct {
+	StartedAt time.Time     // Start time of the run
+	Duration  time.Duration // Duration of the run
+	Error     string        // Error of the run, empty if succeeded
+	NextRunAt time.Time     // Time of the next run
+}
+
+// JobStates - get the persisted states of the scheduled jobs, ordered by the name.
+func (s *Storage) JobStates() ([]model.JobState, error) {
+	var states []model.JobState
+	if err := s.db.Order("name").Find(&states).Error; err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
+
+// AcquireJob - lock the job for the owner until the time, if the job is due and not locked by another replica.
+// The forced job is locked even if not due, e.g. when triggered manually.
+func (s *Storage) AcquireJob(name string, owner string, now time.Time, until time.Time, force bool) (bool, error) {
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.JobState{Name: name}).Error; err != nil {
+		return false, err
+	}
+
+	query := s.db.Model(&model.JobState{}).
+		Where("name = ?", name).
+		Where("locked_by = '' OR locked_by = ? OR locked_until IS NULL OR locked_until <= ?", owner, now)
+
+	if !force {
+		query = query.Where("next_run_at IS NULL OR next_run_at <= ?", now)
+	}
+
+	result := query.Updates(map[string]any{"locked_by": owner, "locked_until": until})
+
+	return result.RowsAffected == 1, result.Error
+}
+
+// FinishJob - store the run of the job and release the lock of the owner.
+func (s *Storage) FinishJob(name string, owner string, run JobRun) error {
+	failures := gorm.Expr("failures")
+	if run.Error != "" {
+		failures = gorm.Expr("failures + 1")
+	}
+
+	return s.db.Model(&model.JobState{}).Where("name = ? AND locked_by = ?", name, owner).Updates(map[string]any{
+		"last_run_at":   run.StartedAt,
+		"last_duration": run.Duration,
+		"last_error":    run.Error,
+		"next_run_at":   run.NextRunAt,
+		"runs":          gorm.Expr("runs + 1"),
+		"failures":      failures,
+		"locked_by":     "",
+		"locked_until":  nil,
+	}).Error
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockdownByChatID - get the lockdown of the chat.
+func (s *Storage) LockdownByChatID(chatID model.ChatID) (*model.Lockdown, error) {
+	var lockdown model.Lockdown
+	if err := s.db.Where("chat_id = ?", chatID).First(&lockdown).Error; err != nil {
+		return nil, err
+	}
+
+	return &lockdown, nil
+}
+
+// Lockdowns - get the lockdowns of every chat, the earliest ending first.
+func (s *Storage) Lockdowns() ([]model.Lockdown, error) {
+	var lockdowns []model.Lockdown
+	if err := s.db.Order("ends_at").Find(&lockdowns).Error; err != nil {
+		return nil, err
+	}
+
+	return lockdowns, nil
+}
+
+// UpsertLockdown - insert or update the lockdown of the chat.
+func (s *Storage) UpsertLockdown(lockdown *model.Lockdown) error {
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(lockdown).Error
+}
+
+// CreateLockdown - insert the lockdown of the chat, unless it exists, and return whether it was inserted.
+// The concurrent starts of the lockdown of the same chat are claimed by the first one.
+func (s *Storage) CreateLockdown(lockdown *model.Lockdown) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(lockdown)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// ExtendLockdown - add the joins to the lockdown of the chat and move its end to the later time,
+// the permissions of the lockdown are kept as they are.
+func (s *Storage) ExtendLockdown(chatID model.ChatID, endsAt time.Time, joins int) error {
+	return s.db.Model(&model.Lockdown{}).Where("chat_id = ?", chatID).Updates(map[string]any{
+		"joins":   gorm.Expr("joins + ?", joins),
+		"ends_at": gorm.Expr("CASE WHEN ends_at < ? THEN ? ELSE ends_at END", endsAt, endsAt),
+	}).Error
+}
+
+// RestrictLockdown - mark the lockdown of the chat restricted with the permissions before it,
+// unless it is restricted already, so the permissions to restore are never overwritten.
+func (s *Storage) RestrictLockdown(chatID model.ChatID, permissions string) error {
+	return s.db.Model(&model.Lockdown{}).Where("chat_id = ? AND restricted = ?", chatID, false).Updates(map[string]any{
+		"restricted":  true,
+		"permissions": permissions,
+	}).Error
+}
+
+// DeleteLockdown - delete the lockdown of the chat, when it ends.
+func (s *Storage) DeleteLockdown(chatID model.ChatID) error {
+	return s.db.Delete(&model.Lockdown{}, "chat_id = ?", chatID).Error
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateLockdownKeepsPermissions(t *testing.T) {
+	db := newTestStorage(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	created, err := db.CreateLockdown(&model.Lockdown{ChatID: -100, Joins: 10, StartedAt: now, EndsAt: now.Add(time.Minute)})
+	require.NoError(t, err)
+	require.True(t, created)
+
+	require.NoError(t, db.RestrictLockdown(-100, `{"can_send_messages":true}`))
+
+	// The second start extends the lockdown, the restricted permissions never replace the stored ones
+	created, err = db.CreateLockdown(&model.Lockdown{ChatID: -100, Joins: 5, StartedAt: now, EndsAt: now.Add(time.Hour)})
+	require.NoError(t, err)
+	require.False(t, created)
+	require.NoError(t, db.ExtendLockdown(-100, now.Add(time.Hour), 5))
+	require.NoError(t, db.ExtendLockdown(-100, now.Add(time.Second), 0))
+	require.NoError(t, db.RestrictLockdown(-100, `{}`))
+
+	lockdown, err := db.LockdownByChatID(-100)
+	require.NoError(t, err)
+	require.True(t, lockdown.Restricted)
+	require.Equal(t, `{"can_send_messages":true}`, lockdown.Permissions)
+	require.Equal(t, 15, lockdown.Joins)
+	require.True(t, lockdown.EndsAt.Equal(now.Add(time.Hour)))
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// AnnouncementByID - get the announcement by ID.
+func (s *Storage) AnnouncementByID(id int64) (*model.Announcement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	announcement, ok := s.announcements[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &announcement, nil
+}
+
+// Announcements - get the announcements of the chat, or of every chat if the chat ID is 0, ordered by ID.
+func (s *Storage) Announcements(chatID model.ChatID) ([]model.Announcement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	announcements := make([]model.Announcement, 0)
+
+	for _, announcement := range s.announcements {
+		if chatID == 0 || announcement.ChatID == chatID {
+			announcements = append(announcements, announcement)
+		}
+	}
+
+	sort.Slice(announcements, func(i, j int) bool { return announcements[i].ID < announcements[j].ID })
+
+	return announcements, nil
+}
+
+// DueAnnouncements - get the announcements to post at the time, the most overdue first.
+func (s *Storage) DueAnnouncements(now time.Time, limit int) ([]model.Announcement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	announcements := make([]model.Announcement, 0)
+
+	for _, announcement := range s.announcements {
+		if announcement.NextRunAt.Valid && !announcement.NextRunAt.Time.After(now) {
+			announcements = append(announcements, announcement)
+		}
+	}
+
+	sort.Slice(announcements, func(i, j int) bool {
+		return announcements[i].NextRunAt.Time.Before(announcements[j].NextRunAt.Time)
+	})
+
+	if limit > 0 && len(announcements) > limit {
+		announcements = announcements[:limit]
+	}
+
+	return announcements, nil
+}
+
+// UpsertAnnouncement - insert or update the announcement, the ID of the new one is set.
+func (s *Storage) UpsertAnnouncement(announcement *model.Announcement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	if announcement.ID == 0 {
+		s.lastAnnouncementID++
+		announcement.ID = s.lastAnnouncementID
+		announcement.CreatedAt = now
+	}
+
+	announcement.UpdatedAt = now
+	s.announcements[announcement.ID] = *announcement
+
+	return nil
+}
+
+// DeleteAnnouncement - delete the announcement by ID.
+func (s *Storage) DeleteAnnouncement(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.announcements, id)
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+)
+
+// ExpiredBans - get the bans expired before the time, the oldest first.
+func (s *Storage) ExpiredBans(now time.Time, limit int) ([]model.BannedUser, error) {
+	return s.bansWhere(limit, func(ban *model.BannedUser) bool {
+		return ban.IsExpired(now)
+	}), nil
+}
+
+// UpcomingBanExpiries - get the bans expiring between the times, the soonest first.
+func (s *Storage) UpcomingBanExpiries(now time.Time, until time.Time, limit int) ([]model.BannedUser, error) {
+	return s.bansWhere(limit, func(ban *model.BannedUser) bool {
+		return ban.ExpiresAt.Valid && ban.ExpiresAt.Time.After(now) && !ban.ExpiresAt.Time.After(until)
+	}), nil
+}
+
+// bansWhere - the matching bans ordered by the expiry time.
+func (s *Storage) bansWhere(limit int, match func(ban *model.BannedUser) bool) []model.BannedUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bans := make([]model.BannedUser, 0)
+
+	for _, ban := range s.banned {
+		if match(&ban) {
+			bans = append(bans, ban)
+		}
+	}
+
+	sort.Slice(bans, func(i, j int) bool { return bans[i].ExpiresAt.Time.Before(bans[j].ExpiresAt.Time) })
+
+	if limit > 0 && len(bans) > limit {
+		bans = bans[:limit]
+	}
+
+	return bans
+}
+
+// RecordBanChat - remember the chat where the user is banned in Telegram.
+func (s *Storage) RecordBanChat(userID model.UserID, chatID model.ChatID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memberKey{chatID, userID}
+	if _, ok := s.banChats[key]; !ok {
+		s.banChats[key] = model.BanChat{UserID: userID, ChatID: chatID, BannedAt: time.Now().UTC()}
+	}
+
+	return nil
+}
+
+// BanChats - get the chats where the user is banned in Telegram.
+func (s *Storage) BanChats(userID model.UserID) ([]model.BanChat, error) {
+	return s.banChatsWhere(0, func(chat *model.BanChat) bool { return chat.UserID == userID }), nil
+}
+
+// LiftedBanChats - get the chats where the user is still banned in Telegram, but the ban is removed.
+func (s *Storage) LiftedBanChats(limit int) ([]model.BanChat, error) {
+	return s.banChatsWhere(limit, func(chat *model.BanChat) bool {
+		_, banned := s.banned[chat.UserID]
+
+		return !banned
+	}), nil
+}
+
+// banChatsWhere - the matching ban chats ordered by the time of the ban.
+func (s *Storage) banChatsWhere(limit int, match func(chat *model.BanChat) bool) []model.BanChat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chats := make([]model.BanChat, 0)
+
+	for _, chat := range s.banChats {
+		if match(&chat) {
+			chats = append(chats, chat)
+		}
+	}
+
+	sort.Slice(chats, func(i, j int) bool {
+		if !chats[i].BannedAt.Equal(chats[j].BannedAt) {
+			return chats[i].BannedAt.Before(chats[j].BannedAt)
+		}
+
+		return chats[i].ChatID < chats[j].ChatID
+	})
+
+	if limit > 0 && len(chats) > limit {
+		chats = chats[:limit]
+	}
+
+	return chats
+}
+
+// DeleteBanChat - forget the chat, after the user is unbanned there.
+func (s *Storage) DeleteBanChat(userID model.UserID, chatID model.ChatID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.banChats, memberKey{chatID, userID})
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// memberKey - key of the membership of the user in the chat.
+type memberKey struct {
+	chatID model.ChatID
+	userID model.UserID
+}
+
+// ChatMemberByID - get the membership of the user in the chat.
+func (s *Storage) ChatMemberByID(chatID model.ChatID, userID model.UserID) (*model.ChatMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	member, ok := s.members[memberKey{chatID, userID}]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &member, nil
+}
+
+// UpsertChatMember - insert or update the membership.
+func (s *Storage) UpsertChatMember(member *model.ChatMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member.UpdatedAt = time.Now().UTC()
+	s.members[memberKey{member.ChatID, member.UserID}] = *member
+
+	return nil
+}
+
+// UpdateChatMember - update the membership of the user in the chat atomically, the new membership is created if missing.
+func (s *Storage) UpdateChatMember(
+	chatID model.ChatID,
+	userID model.UserID,
+	update func(member *model.ChatMember) error,
+) (*model.ChatMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	member, ok := s.members[memberKey{chatID, userID}]
+	if !ok {
+		member = *model.NewChatMember(int64(chatID), int64(userID))
+	}
+
+	if err := update(&member); err != nil {
+		return nil, err
+	}
+
+	member.UpdatedAt = time.Now().UTC()
+	s.members[memberKey{chatID, userID}] = member
+
+	return &member, nil
+}
+
+// ChatMembersOfUser - get the memberships of the user in every known chat, the latest joins first.
+func (s *Storage) ChatMembersOfUser(userID model.UserID) ([]model.ChatMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := make([]model.ChatMember, 0)
+
+	for key, member := range s.members {
+		if key.userID == userID {
+			members = append(members, member)
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].JoinedAt.Time.Equal(members[j].JoinedAt.Time) {
+			return members[i].JoinedAt.Time.After(members[j].JoinedAt.Time)
+		}
+
+		return members[i].ChatID < members[j].ChatID
+	})
+
+	return members, nil
+}
@@ -0,0 +1,32 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// ChatRulesByID - get the rules of the chat.
+func (s *Storage) ChatRulesByID(chatID model.ChatID) (*model.ChatRules, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules, ok := s.rules[chatID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &rules, nil
+}
+
+// UpsertChatRules - insert or update the rules of the chat.
+func (s *Storage) UpsertChatRules(rules *model.ChatRules) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rules.UpdatedAt = time.Now().UTC()
+	s.rules[rules.ChatID] = *rules
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+var errorEmptySource = errors.New("source of the bans is required")
+
+// MergeBans - replace the bans of the source with the entries of its feed.
+// The local bans and the bans of the more trusted sources are kept.
+func (s *Storage) MergeBans(source string, trust int, bans []model.BannedUser) (storage.BanMergeResult, error) {
+	var result storage.BanMergeResult
+
+	if source == "" {
+		return result, errorEmptySource
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	seen := make(map[model.UserID]struct{}, len(bans))
+
+	for _, ban := range bans {
+		seen[ban.ID] = struct{}{}
+
+		var previous *model.BannedUser
+		if existing, ok := s.banned[ban.ID]; ok {
+			previous = &existing
+		}
+
+		if (ban.ExpiresAt.Valid && ban.ExpiresAt.Time.Before(now)) || !storage.CanMergeBan(previous, source, trust) {
+			result.Skipped++
+
+			continue
+		}
+
+		ban.Source, ban.Trust, ban.UpdatedAt = source, trust, now
+		s.banned[ban.ID] = ban
+
+		if previous == nil {
+			result.Added++
+		} else {
+			result.Updated++
+		}
+	}
+
+	for id, ban := range s.banned {
+		if _, ok := seen[id]; !ok && ban.Source == source {
+			delete(s.banned, id)
+			result.Removed++
+		}
+	}
+
+	return result, nil
+}
+
+// RevokeBans - remove every ban imported from the source.
+func (s *Storage) RevokeBans(source string) (int64, error) {
+	if source == "" {
+		return 0, errorEmptySource
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int64
+
+	for id, ban := range s.banned {
+		if ban.Source == source {
+			delete(s.banned, id)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
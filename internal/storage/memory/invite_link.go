@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// InviteLinkByLink - get the invite link.
+func (s *Storage) InviteLinkByLink(link string) (*model.InviteLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inviteLink, ok := s.links[link]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &inviteLink, nil
+}
+
+// UpsertInviteLink - insert or update the invite link, the chat, the creator and the creation time are kept.
+func (s *Storage) UpsertInviteLink(link *model.InviteLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	if existing, ok := s.links[link.Link]; ok {
+		link.ChatID = existing.ChatID
+		link.CreatorID = existing.CreatorID
+		link.CreatedAt = existing.CreatedAt
+	} else if link.CreatedAt.IsZero() {
+		link.CreatedAt = now
+	}
+
+	link.UpdatedAt = now
+	s.links[link.Link] = *link
+
+	return nil
+}
+
+// InviteLinks - get the invite links of the chat, the latest first.
+func (s *Storage) InviteLinks(chatID model.ChatID) ([]model.InviteLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := make([]model.InviteLink, 0)
+
+	for _, link := range s.links {
+		if link.ChatID == chatID {
+			links = append(links, link)
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.After(links[j].CreatedAt)
+		}
+
+		return links[i].Link < links[j].Link
+	})
+
+	return links, nil
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// JobStates - get the persisted states of the scheduled jobs, ordered by the name.
+func (s *Storage) JobStates() ([]model.JobState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	states := make([]model.JobState, 0, len(s.jobs))
+	for _, state := range s.jobs {
+		states = append(states, state)
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+
+	return states, nil
+}
+
+// AcquireJob - lock the job for the owner until the time, if the job is due and not locked by another replica.
+// The forced job is locked even if not due, e.g. when triggered manually.
+func (s *Storage) AcquireJob(name string, owner string, now time.Time, until time.Time, force bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.jobs[name]
+	if !ok {
+		state = model.JobState{Name: name}
+	}
+
+	if (state.IsLocked(now) && state.LockedBy != owner) || (!force && !state.IsDue(now)) {
+		return false, nil
+	}
+
+	state.LockedBy = owner
+	state.LockedUntil = sql.NullTime{Time: until, Valid: true}
+	state.UpdatedAt = now
+	s.jobs[name] = state
+
+	return true, nil
+}
+
+// FinishJob - store the run of the job and release the lock of the owner.
+func (s *Storage) FinishJob(name string, owner string, run storage.JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.jobs[name]
+	if !ok || state.LockedBy != owner {
+		return nil
+	}
+
+	state.LastRunAt = sql.NullTime{Time: run.StartedAt, Valid: true}
+	state.LastDuration = run.Duration
+	state.LastError = run.Error
+	state.NextRunAt = sql.NullTime{Time: run.NextRunAt, Valid: true}
+	state.Runs++
+
+	if run.Error != "" {
+		state.Failures++
+	}
+
+	state.LockedBy = ""
+	state.LockedUntil = sql.NullTime{}
+	state.UpdatedAt = time.Now()
+	s.jobs[name] = state
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// LockdownByChatID - get the lockdown of the chat.
+func (s *Storage) LockdownByChatID(chatID model.ChatID) (*model.Lockdown, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lockdown, ok := s.lockdowns[chatID]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &lockdown, nil
+}
+
+// Lockdowns - get the lockdowns of every chat, the earliest ending first.
+func (s *Storage) Lockdowns() ([]model.Lockdown, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lockdowns := make([]model.Lockdown, 0, len(s.lockdowns))
+	for _, lockdown := range s.lockdowns {
+		lockdowns = append(lockdowns, lockdown)
+	}
+
+	sort.Slice(lockdowns, func(i, j int) bool { return lockdowns[i].EndsAt.Before(lockdowns[j].EndsAt) })
+
+	return lockdowns, nil
+}
+
+// UpsertLockdown - insert or update the lockdown of the chat.
+func (s *Storage) UpsertLockdown(lockdown *model.Lockdown) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lockdown.UpdatedAt = time.Now().UTC()
+	s.lockdowns[lockdown.ChatID] = *lockdown
+
+	return nil
+}
+
+// CreateLockdown - insert the lockdown of the chat, unless it exists, and return whether it was inserted.
+func (s *Storage) CreateLockdown(lockdown *model.Lockdown) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lockdowns[lockdown.ChatID]; ok {
+		return false, nil
+	}
+
+	lockdown.UpdatedAt = time.Now().UTC()
+	s.lockdowns[lockdown.ChatID] = *lockdown
+
+	return true, nil
+}
+
+// ExtendLockdown - add the joins to the lockdown of the chat and move its end to the later time.
+func (s *Storage) ExtendLockdown(chatID model.ChatID, endsAt time.Time, joins int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lockdown, ok := s.lockdowns[chatID]
+	if !ok {
+		return nil
+	}
+
+	if endsAt.After(lockdown.EndsAt) {
+		lockdown.EndsAt = endsAt
+	}
+
+	lockdown.Joins += joins
+	lockdown.UpdatedAt = time.Now().UTC()
+	s.lockdowns[chatID] = lockdown
+
+	return nil
+}
+
+// RestrictLockdown - mark the lockdown of the chat restricted with the permissions before it, unless it is restricted already.
+func (s *Storage) RestrictLockdown(chatID model.ChatID, permissions string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lockdown, ok := s.lockdowns[chatID]
+	if !ok || lockdown.Restricted {
+		return nil
+	}
+
+	lockdown.Restricted = true
+	lockdown.Permissions = permissions
+	lockdown.UpdatedAt = time.Now().UTC()
+	s.lockdowns[chatID] = lockdown
+
+	return nil
+}
+
+// DeleteLockdown - delete the lockdown of the chat, when it ends.
+func (s *Storage) DeleteLockdown(chatID model.ChatID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.lockdowns, chatID)
+
+	return nil
+}
@@ -0,0 +1,526 @@
+// Description: The memory package provides a thread-safe in-memory implementation of the repositories,
+// for the tests and for the ephemeral deployments, where nothing should outlive the process.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// Storage - the repositories kept in the maps guarded by a single mutex.
+type Storage struct {
+	mu sync.RWMutex
+
+	users    map[model.UserID]model.User
+	verified map[model.UserID]model.VerifiedUser
+	banned   map[model.UserID]model.BannedUser
+	chats    map[model.ChatID]model.Chat
+	messages map[model.MessageID]model.Message
+	origins  map[model.MessageID]model.MessageOrigin
+	markups  map[model.MessageID]model.ReplyMarkup
+	captchas map[int64]model.Captcha
+	kv       map[string]model.KeyValue
+	events   []model.ModerationEvent
+
+	revisions []model.MessageRevision
+	members   map[memberKey]model.ChatMember
+	links     map[string]model.InviteLink
+	rules     map[model.ChatID]model.ChatRules
+	banChats  map[memberKey]model.BanChat
+	jobs      map[string]model.JobState
+
+	announcements map[int64]model.Announcement
+	lockdowns     map[model.ChatID]model.Lockdown
+
+	lastCaptchaID int64
+	lastEventID   int64
+	lastOriginID  int64
+	lastMarkupID  int64
+	lastRevision  int64
+
+	lastAnnouncementID int64
+}
+
+// Ensure Storage implements Repository
+var _ storage.Repository = (*Storage)(nil)
+
+// New - create an empty in-memory storage.
+func New() *Storage {
+	return &Storage{
+		users:    make(map[model.UserID]model.User),
+		verified: make(map[model.UserID]model.VerifiedUser),
+		banned:   make(map[model.UserID]model.BannedUser),
+		chats:    make(map[model.ChatID]model.Chat),
+		messages: make(map[model.MessageID]model.Message),
+		origins:  make(map[model.MessageID]model.MessageOrigin),
+		markups:  make(map[model.MessageID]model.ReplyMarkup),
+		captchas: make(map[int64]model.Captcha),
+		kv:       make(map[string]model.KeyValue),
+		members:  make(map[memberKey]model.ChatMember),
+		links:    make(map[string]model.InviteLink),
+		rules:    make(map[model.ChatID]model.ChatRules),
+		banChats: make(map[memberKey]model.BanChat),
+		jobs:     make(map[string]model.JobState),
+
+		announcements: make(map[int64]model.Announcement),
+		lockdowns:     make(map[model.ChatID]model.Lockdown),
+	}
+}
+
+// WithContext - the in-memory storage is not traced, so the same storage is returned.
+func (s *Storage) WithContext(_ context.Context) storage.Repository {
+	return s
+}
+
+// Status - the in-memory storage is always available.
+func (s *Storage) Status() (string, error) {
+	return "ok", nil
+}
+
+// Close - nothing to release.
+func (s *Storage) Close() error {
+	return nil
+}
+
+// UserByID - get the user by ID.
+func (s *Storage) UserByID(id model.UserID) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &user, nil
+}
+
+// UserByUsername - get the user by username.
+func (s *Storage) UserByUsername(username string) (*model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+// UpsertUser - insert or update the user.
+func (s *Storage) UpsertUser(user *model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.upsertUsers(user)
+
+	return nil
+}
+
+// DeleteUser - delete the user.
+func (s *Storage) DeleteUser(user *model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, user.ID)
+
+	return nil
+}
+
+// Users - get all users ordered by ID.
+func (s *Storage) Users() ([]model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]model.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+// IsVerifiedUser - check if the user is verified.
+func (s *Storage) IsVerifiedUser(userID model.UserID) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.verified[userID]
+
+	return ok, nil
+}
+
+// VerifyUser - set the user as verified and remove the ban.
+func (s *Storage) VerifyUser(verifiedUser *model.VerifiedUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.banned, verifiedUser.ID)
+
+	user := *verifiedUser
+	user.UpdatedAt = time.Now().UTC()
+	s.verified[user.ID] = user
+
+	return nil
+}
+
+// VerifyUsers - verify the multiple users.
+func (s *Storage) VerifyUsers(reason string, userIDs []int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	for _, id := range userIDs {
+		userID := model.UserID(id)
+		delete(s.banned, userID)
+
+		user := s.verified[userID]
+		user.ID = userID
+		user.VerifiedAt = now
+		user.Reason = reason
+		user.UpdatedAt = now
+		s.verified[userID] = user
+	}
+
+	return nil
+}
+
+// UnverifyUser - remove the verification of the user.
+func (s *Storage) UnverifyUser(userID model.UserID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.verified, userID)
+
+	return nil
+}
+
+// VerifiedUsers - get the verified users ordered by ID.
+func (s *Storage) VerifiedUsers() ([]model.VerifiedUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]model.VerifiedUser, 0, len(s.verified))
+	for _, user := range s.verified {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+// IsBannedUser - check if the user is banned, the expired bans are removed by the sweeper.
+func (s *Storage) IsBannedUser(userID model.UserID) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ban, ok := s.banned[userID]
+
+	return ok && !ban.IsExpired(time.Now()), nil
+}
+
+// BanUser - ban the user and remove the verification.
+func (s *Storage) BanUser(bannedUser *model.BannedUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.verified, bannedUser.ID)
+
+	user := *bannedUser
+	user.UpdatedAt = time.Now().UTC()
+	s.banned[user.ID] = user
+
+	return nil
+}
+
+// UnbanUser - remove the user from the banned list.
+func (s *Storage) UnbanUser(userID model.UserID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.banned, userID)
+
+	return nil
+}
+
+// BannedUsers - get the banned users ordered by ID, including the expired bans not removed yet.
+func (s *Storage) BannedUsers() ([]model.BannedUser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]model.BannedUser, 0, len(s.banned))
+	for _, user := range s.banned {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+// GetOutdatedCaptchas - get the expired captchas.
+func (s *Storage) GetOutdatedCaptchas() []model.Captcha {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	captchas := make([]model.Captcha, 0)
+
+	for _, captcha := range s.captchas {
+		if captcha.ExpiresAt.Before(now) {
+			captchas = append(captchas, captcha)
+		}
+	}
+
+	sort.Slice(captchas, func(i, j int) bool { return captchas[i].ID < captchas[j].ID })
+
+	return captchas
+}
+
+// UpsertCaptcha - insert or update the captcha, a new captcha gets the next ID.
+func (s *Storage) UpsertCaptcha(captcha *model.Captcha) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	if captcha.ID == 0 {
+		s.lastCaptchaID++
+		captcha.ID = s.lastCaptchaID
+	} else if captcha.ID > s.lastCaptchaID {
+		s.lastCaptchaID = captcha.ID
+	}
+
+	if captcha.CreatedAt.IsZero() {
+		captcha.CreatedAt = now
+	}
+
+	captcha.UpdatedAt = now
+	s.captchas[captcha.ID] = *captcha
+
+	return nil
+}
+
+// DeleteCaptchaByID - delete the captcha.
+func (s *Storage) DeleteCaptchaByID(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.captchas, id)
+
+	return nil
+}
+
+// GetCaptchaForUserID - get the active captcha of the user, nil if there is none.
+func (s *Storage) GetCaptchaForUserID(userID int64) (*model.Captcha, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+
+	var found *model.Captcha
+
+	for _, captcha := range s.captchas {
+		if captcha.UserID != userID || captcha.ExpiresAt.Before(now) {
+			continue
+		}
+
+		if found == nil || captcha.ID < found.ID {
+			captcha := captcha
+			found = &captcha
+		}
+	}
+
+	return found, nil
+}
+
+// UpsertMessage - insert or update the message with its origin and reply markup, and the chats and users if any.
+func (s *Storage) UpsertMessage(input storage.UpsertMessageInput) error {
+	if (input.Message == nil) || (input.Message.ID == 0) {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, chat := range input.Chats {
+		if chat != nil {
+			s.chats[chat.ID] = *chat
+		}
+	}
+
+	s.upsertUsers(input.Users...)
+
+	now := time.Now().UTC()
+	message := *input.Message
+
+	if existing, ok := s.messages[message.ID]; ok {
+		message.CreatedAt = existing.CreatedAt
+
+		// Keep the previous version, if the content of the message is edited
+		if existing.ContentChanged(&message) {
+			s.lastRevision++
+			revision := model.NewMessageRevision(&existing)
+			revision.ID = s.lastRevision
+			revision.CreatedAt = now
+			s.revisions = append(s.revisions, *revision)
+		}
+	} else {
+		message.CreatedAt = now
+	}
+
+	message.UpdatedAt = now
+	message.Sender, message.Chat, message.ReplyTo = nil, nil, nil
+	s.messages[message.ID] = message
+
+	// Replace the origin and the reply markup
+	delete(s.origins, message.ID)
+
+	if input.Origin != nil {
+		s.lastOriginID++
+		input.Origin.ID = s.lastOriginID
+		input.Origin.ChatID = message.ChatID
+		input.Origin.MessageID = message.ID
+		s.origins[message.ID] = *input.Origin
+	}
+
+	delete(s.markups, message.ID)
+
+	if input.ReplyMarkup != nil {
+		s.lastMarkupID++
+		input.ReplyMarkup.ID = s.lastMarkupID
+		input.ReplyMarkup.ChatID = message.ChatID
+		input.ReplyMarkup.MessageID = message.ID
+		s.markups[message.ID] = *input.ReplyMarkup
+	}
+
+	return nil
+}
+
+// deleteMessage - delete the message with its origin, reply markup and revisions, the caller must hold the lock.
+func (s *Storage) deleteMessage(id model.MessageID) {
+	delete(s.messages, id)
+	delete(s.origins, id)
+	delete(s.markups, id)
+
+	s.revisions = filterRevisions(s.revisions, func(revision model.MessageRevision) bool {
+		return revision.MessageID != id
+	})
+}
+
+// filterRevisions - keep the revisions matching the predicate, in place.
+func filterRevisions(revisions []model.MessageRevision, keep func(model.MessageRevision) bool) []model.MessageRevision {
+	result := revisions[:0]
+
+	for _, revision := range revisions {
+		if keep(revision) {
+			result = append(result, revision)
+		}
+	}
+
+	return result
+}
+
+// MessageByID - get the message of the chat by ID.
+func (s *Storage) MessageByID(chatID model.ChatID, id model.MessageID) (*model.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	message, ok := s.messages[id]
+	if !ok || message.ChatID != chatID {
+		return nil, storage.ErrNotFound
+	}
+
+	return &message, nil
+}
+
+// MessageRevisions - get every version of the message from the oldest to the current one.
+func (s *Storage) MessageRevisions(chatID model.ChatID, id model.MessageID) ([]model.MessageRevision, error) {
+	message, err := s.MessageByID(chatID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := make([]model.MessageRevision, 0)
+
+	for _, revision := range s.revisions {
+		if revision.MessageID == id && revision.ChatID == chatID {
+			revisions = append(revisions, revision)
+		}
+	}
+
+	return append(revisions, *model.NewMessageRevision(message)), nil
+}
+
+// upsertUsers - save the users, the caller must hold the lock.
+func (s *Storage) upsertUsers(users ...*model.User) {
+	now := time.Now().UTC()
+
+	for _, user := range users {
+		if user == nil {
+			continue
+		}
+
+		saved := *user
+		saved.UpdatedAt = now
+		s.users[saved.ID] = saved
+	}
+}
+
+// KVSet - set the key-value pair, the value is serialized with gob.
+func (s *Storage) KVSet(key string, value interface{}) error {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.kv[key] = model.KeyValue{
+		Key:       key,
+		Value:     buffer.Bytes(),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	return nil
+}
+
+// KVGet - find the key-value pair by key.
+func (s *Storage) KVGet(key string) (*model.KeyValue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	kv, ok := s.kv[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &kv, nil
+}
+
+// KVDelete - delete the key-value pair.
+func (s *Storage) KVDelete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.kv, key)
+
+	return nil
+}
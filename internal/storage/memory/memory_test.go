@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyAndBan(t *testing.T) {
+	db := New()
+
+	require.NoError(t, db.BanUser(&model.BannedUser{ID: 1, BannedAt: time.Now(), Reason: "spam"}))
+	banned, err := db.IsBannedUser(1)
+	require.NoError(t, err)
+	require.True(t, banned)
+
+	// Verification removes the ban
+	require.NoError(t, db.VerifyUser(&model.VerifiedUser{ID: 1, VerifiedAt: time.Now(), Reason: "captcha"}))
+	banned, err = db.IsBannedUser(1)
+	require.NoError(t, err)
+	require.False(t, banned)
+
+	verified, err := db.IsVerifiedUser(1)
+	require.NoError(t, err)
+	require.True(t, verified)
+
+	// Expired ban is not enforced
+	require.NoError(t, db.BanUser(&model.BannedUser{
+		ID:        2,
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	}))
+	banned, err = db.IsBannedUser(2)
+	require.NoError(t, err)
+	require.False(t, banned)
+}
+
+func TestCaptchas(t *testing.T) {
+	db := New()
+
+	active := &model.Captcha{UserID: 1, ExpiresAt: time.Now().Add(time.Minute)}
+	outdated := &model.Captcha{UserID: 2, ExpiresAt: time.Now().Add(-time.Minute)}
+	require.NoError(t, db.UpsertCaptcha(active))
+	require.NoError(t, db.UpsertCaptcha(outdated))
+	require.NotEqual(t, active.ID, outdated.ID)
+
+	captcha, err := db.GetCaptchaForUserID(1)
+	require.NoError(t, err)
+	require.Equal(t, active.ID, captcha.ID)
+
+	captcha, err = db.GetCaptchaForUserID(2)
+	require.NoError(t, err)
+	require.Nil(t, captcha)
+
+	outdatedCaptchas := db.GetOutdatedCaptchas()
+	require.Len(t, outdatedCaptchas, 1)
+	require.NoError(t, db.DeleteCaptchaByID(outdatedCaptchas[0].ID))
+	require.Empty(t, db.GetOutdatedCaptchas())
+}
+
+func TestKVAndMessages(t *testing.T) {
+	db := New()
+
+	_, err := db.KVGet("missing")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	require.NoError(t, db.KVSet("answer", 42))
+	kv, err := db.KVGet("answer")
+	require.NoError(t, err)
+
+	var value int
+	require.NoError(t, kv.GetValue(&value))
+	require.Equal(t, 42, value)
+
+	require.NoError(t, db.UpsertMessage(storage.UpsertMessageInput{
+		Message: &model.Message{ID: 1, SenderID: 10, ChatID: -100, Unixtime: time.Now().Unix()},
+		Chats:   []*model.Chat{{ID: -100}, nil},
+		Users:   []*model.User{{ID: 10, Username: "fox"}, nil},
+	}))
+
+	user, err := db.UserByUsername("fox")
+	require.NoError(t, err)
+	require.Equal(t, model.UserID(10), user.ID)
+
+	users, err := db.TopUsers(storage.StatsFilter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.Equal(t, []storage.UserActivity{{UserID: 10, Username: "fox", Messages: 1}}, users)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	db := New()
+
+	var wg sync.WaitGroup
+
+	for i := range 50 {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			_ = db.VerifyUsers("bulk", []int{id})
+			_, _ = db.IsVerifiedUser(model.UserID(id))
+			_ = db.RecordModerationEvent(model.NewModerationEvent(model.ModerationEventVerification, 0, int64(id), "api"))
+		}(i)
+	}
+
+	wg.Wait()
+
+	timeline, err := db.ModerationTimeline(storage.StatsFilter{
+		From:   time.Now().Add(-time.Hour),
+		To:     time.Now().Add(time.Hour),
+		Bucket: 24 * time.Hour,
+	})
+	require.NoError(t, err)
+
+	var total int64
+	for _, bucket := range timeline {
+		total += bucket.Count
+	}
+
+	require.Equal(t, int64(50), total)
+}
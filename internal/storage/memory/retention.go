@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+)
+
+// MessageChats - get the IDs of the chats with the stored messages.
+func (s *Storage) MessageChats() ([]model.ChatID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[model.ChatID]struct{})
+	chats := make([]model.ChatID, 0)
+
+	for _, message := range s.messages {
+		if _, ok := seen[message.ChatID]; !ok {
+			seen[message.ChatID] = struct{}{}
+			chats = append(chats, message.ChatID)
+		}
+	}
+
+	sort.Slice(chats, func(i, j int) bool { return chats[i] < chats[j] })
+
+	return chats, nil
+}
+
+// PurgeMessages - apply one batch of the first step of the retention policy with anything left to do.
+func (s *Storage) PurgeMessages(chatID model.ChatID, policy config.RetentionPolicy, now time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Messages of the chat from the newest to the oldest
+	messages := make([]model.Message, 0)
+
+	for _, message := range s.messages {
+		if message.ChatID == chatID {
+			messages = append(messages, message)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if messages[i].Unixtime != messages[j].Unixtime {
+			return messages[i].Unixtime > messages[j].Unixtime
+		}
+
+		return messages[i].ID > messages[j].ID
+	})
+
+	// Beyond the maximum number of rows
+	if policy.MaxRows > 0 && len(messages) > policy.MaxRows {
+		beyond := messages[policy.MaxRows:min(len(messages), policy.MaxRows+limit)]
+		for _, message := range beyond {
+			s.deleteMessage(message.ID)
+		}
+
+		return int64(len(beyond)), nil
+	}
+
+	// Older than the maximum age
+	if policy.MaxAge > 0 {
+		before := now.Add(-policy.MaxAge).Unix()
+
+		var count int64
+
+		for i := len(messages) - 1; i >= 0 && messages[i].Unixtime < before && count < int64(limit); i-- {
+			s.deleteMessage(messages[i].ID)
+			count++
+		}
+
+		if count > 0 {
+			return count, nil
+		}
+	}
+
+	// Only the metadata is kept
+	if policy.MetadataOnly {
+		var count int64
+
+		for _, message := range messages {
+			if (message.Text == "" && message.Caption == "") || count >= int64(limit) {
+				continue
+			}
+
+			message.Text, message.Caption = "", ""
+			message.UpdatedAt = time.Now().UTC()
+			s.messages[message.ID] = message
+
+			if origin, ok := s.origins[message.ID]; ok {
+				origin.OriginalText = ""
+				s.origins[message.ID] = origin
+			}
+
+			for i := range s.revisions {
+				if s.revisions[i].MessageID == message.ID {
+					s.revisions[i].Text, s.revisions[i].Caption = "", ""
+				}
+			}
+			count++
+		}
+
+		return count, nil
+	}
+
+	return 0, nil
+}
+
+// PurgeDeleted - nothing is soft-deleted in memory, the deleted rows are removed at once.
+func (s *Storage) PurgeDeleted(_ time.Time, _ int) (int64, error) {
+	return 0, nil
+}
+
+// ForgetUser - remove the messages and the profile data of the user, the ban is kept.
+func (s *Storage) ForgetUser(userID model.UserID) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := map[string]int64{
+		"message_origins": 0, "reply_markups": 0, "message_revisions": 0, "messages": 0, "captchas": 0,
+		"moderation_events": 0, "chat_members": 0, "verified_users": 0, "users": 0,
+	}
+
+	for id, origin := range s.origins {
+		if origin.OriginalSenderID == userID || s.messages[id].SenderID == userID {
+			delete(s.origins, id)
+			removed["message_origins"]++
+		}
+	}
+
+	revisions := len(s.revisions)
+	s.revisions = filterRevisions(s.revisions, func(revision model.MessageRevision) bool {
+		return revision.SenderID != userID
+	})
+	removed["message_revisions"] = int64(revisions - len(s.revisions))
+
+	for id, message := range s.messages {
+		if message.SenderID != userID {
+			continue
+		}
+
+		if _, ok := s.markups[id]; ok {
+			delete(s.markups, id)
+			removed["reply_markups"]++
+		}
+
+		delete(s.messages, id)
+		removed["messages"]++
+	}
+
+	for id, captcha := range s.captchas {
+		if captcha.UserID == int64(userID) {
+			delete(s.captchas, id)
+			removed["captchas"]++
+		}
+	}
+
+	events := s.events[:0]
+
+	for _, event := range s.events {
+		if event.UserID == userID {
+			removed["moderation_events"]++
+
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	s.events = events
+
+	for key := range s.members {
+		if key.userID == userID {
+			delete(s.members, key)
+			removed["chat_members"]++
+		}
+	}
+
+	if _, ok := s.verified[userID]; ok {
+		delete(s.verified, userID)
+		removed["verified_users"]++
+	}
+
+	if _, ok := s.users[userID]; ok {
+		delete(s.users, userID)
+		removed["users"]++
+	}
+
+	return removed, nil
+}
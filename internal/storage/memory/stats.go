@@ -0,0 +1,254 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+)
+
+// inRange - whether the unix time and the chat match the filter.
+func inRange(filter storage.StatsFilter, unixtime int64, chatID model.ChatID) bool {
+	if unixtime < filter.From.Unix() || unixtime >= filter.To.Unix() {
+		return false
+	}
+
+	return filter.ChatID == 0 || int64(chatID) == filter.ChatID
+}
+
+// bucketOf - the unix time rounded down to the bucket, like the SQL implementation.
+func bucketOf(unixtime int64, bucket time.Duration) int64 {
+	seconds := int64(bucket / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return (unixtime / seconds) * seconds
+}
+
+// RecordModerationEvent - store the moderation events, a new event gets the next ID.
+func (s *Storage) RecordModerationEvent(events ...*model.ModerationEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		if event == nil {
+			continue
+		}
+
+		s.lastEventID++
+		event.ID = s.lastEventID
+		s.events = append(s.events, *event)
+	}
+
+	return nil
+}
+
+// MessagesPerChat - number of messages per chat per bucket.
+func (s *Storage) MessagesPerChat(filter storage.StatsFilter) ([]storage.ChatActivity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type key struct {
+		chatID int64
+		bucket int64
+	}
+
+	counts := make(map[key]int64)
+
+	for _, message := range s.messages {
+		if inRange(filter, message.Unixtime, message.ChatID) {
+			counts[key{int64(message.ChatID), bucketOf(message.Unixtime, filter.Bucket)}]++
+		}
+	}
+
+	result := make([]storage.ChatActivity, 0, len(counts))
+	for k, count := range counts {
+		result = append(result, storage.ChatActivity{ChatID: k.chatID, Bucket: k.bucket, Messages: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bucket != result[j].Bucket {
+			return result[i].Bucket < result[j].Bucket
+		}
+
+		return result[i].ChatID < result[j].ChatID
+	})
+
+	return result, nil
+}
+
+// TopUsers - the most active users by the number of messages.
+func (s *Storage) TopUsers(filter storage.StatsFilter) ([]storage.UserActivity, error) {
+	const defaultLimit = 10
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[model.UserID]int64)
+
+	for _, message := range s.messages {
+		if inRange(filter, message.Unixtime, message.ChatID) {
+			counts[message.SenderID]++
+		}
+	}
+
+	result := make([]storage.UserActivity, 0, len(counts))
+	for userID, count := range counts {
+		user := s.users[userID]
+		result = append(result, storage.UserActivity{
+			UserID:    int64(userID),
+			Username:  user.Username,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Messages:  count,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Messages != result[j].Messages {
+			return result[i].Messages > result[j].Messages
+		}
+
+		return result[i].UserID < result[j].UserID
+	})
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+// ModerationTimeline - number of joins, verifications and bans per bucket.
+func (s *Storage) ModerationTimeline(filter storage.StatsFilter) ([]storage.ModerationActivity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type key struct {
+		bucket    int64
+		eventType model.ModerationEventType
+	}
+
+	counts := make(map[key]int64)
+
+	for _, event := range s.events {
+		switch event.Type { //nolint:exhaustive
+		case model.ModerationEventJoin, model.ModerationEventVerification, model.ModerationEventBan:
+		default:
+			continue
+		}
+
+		if inRange(filter, event.Unixtime, event.ChatID) {
+			counts[key{bucketOf(event.Unixtime, filter.Bucket), event.Type}]++
+		}
+	}
+
+	result := make([]storage.ModerationActivity, 0, len(counts))
+	for k, count := range counts {
+		result = append(result, storage.ModerationActivity{Bucket: k.bucket, Type: k.eventType, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bucket != result[j].Bucket {
+			return result[i].Bucket < result[j].Bucket
+		}
+
+		return result[i].Type < result[j].Type
+	})
+
+	return result, nil
+}
+
+// CaptchaStats - captcha solve rate and median solve time.
+func (s *Storage) CaptchaStats(filter storage.StatsFilter) (*storage.CaptchaStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[model.ModerationEventType]int64)
+	durations := make([]int64, 0)
+
+	for _, event := range s.events {
+		if !inRange(filter, event.Unixtime, event.ChatID) {
+			continue
+		}
+
+		counts[event.Type]++
+
+		if event.Type == model.ModerationEventCaptchaSolved && event.Duration > 0 {
+			durations = append(durations, event.Duration)
+		}
+	}
+
+	return storage.NewCaptchaStats(counts, durations), nil
+}
+
+// SpamDeletions - number of deleted messages per rule.
+func (s *Storage) SpamDeletions(filter storage.StatsFilter) ([]storage.RuleCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int64)
+
+	for _, event := range s.events {
+		if event.Type == model.ModerationEventMessageDeleted && inRange(filter, event.Unixtime, event.ChatID) {
+			counts[event.Rule]++
+		}
+	}
+
+	result := make([]storage.RuleCount, 0, len(counts))
+	for rule, count := range counts {
+		result = append(result, storage.RuleCount{Rule: rule, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+
+		return result[i].Rule < result[j].Rule
+	})
+
+	return result, nil
+}
+
+// InviteLinkStats - joins, captcha outcomes and bans per invite link.
+func (s *Storage) InviteLinkStats(filter storage.StatsFilter) ([]storage.InviteLinkActivity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	builder := storage.NewInviteLinkStatsBuilder()
+
+	for _, member := range s.members {
+		if member.InviteLink != "" && member.JoinedAt.Valid &&
+			inRange(filter, member.JoinedAt.Time.Unix(), member.ChatID) {
+			builder.AddJoins(member.InviteLink, int64(member.ChatID), 1)
+		}
+	}
+
+	for _, event := range s.events {
+		if !inRange(filter, event.Unixtime, event.ChatID) {
+			continue
+		}
+
+		member, ok := s.members[memberKey{event.ChatID, event.UserID}]
+		if !ok || member.InviteLink == "" {
+			continue
+		}
+
+		builder.AddEvents(member.InviteLink, int64(event.ChatID), event.Type, 1)
+	}
+
+	links := make([]model.InviteLink, 0, len(s.links))
+	for _, link := range s.links {
+		links = append(links, link)
+	}
+
+	return builder.Build(links), nil
+}
@@ -0,0 +1,185 @@
+package migrations
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frozen snapshots of the models at the baseline, they must never change.
+// The later changes of the models are new migrations.
+
+type baselineKeyValue struct {
+	Key       string `gorm:"primaryKey"`
+	Value     []byte
+	UpdatedAt time.Time
+	Extra     string
+}
+
+func (baselineKeyValue) TableName() string { return "kv" }
+
+type baselineUser struct {
+	ID           int64 `gorm:"PrimaryKey"`
+	FirstName    string
+	LastName     string
+	Username     string
+	LanguageCode string
+	IsPremium    bool
+	IsBot        bool
+	LastSeen     sql.NullTime
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	Extra        string
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineVerifiedUser struct {
+	ID         int64     `gorm:"primaryKey"`
+	VerifiedAt time.Time `gorm:"not null"`
+	Reason     string    `gorm:"not null"`
+	UpdatedAt  time.Time
+	Extra      string
+}
+
+func (baselineVerifiedUser) TableName() string { return "verified" }
+
+type baselineBannedUser struct {
+	ID        int64        `gorm:"primaryKey"`
+	BannedAt  time.Time    `gorm:"not null"`
+	Reason    string       `gorm:"not null"`
+	ExpiresAt sql.NullTime `gorm:"null"`
+	UpdatedAt time.Time
+	Extra     string
+}
+
+func (baselineBannedUser) TableName() string { return "banned" }
+
+type baselineChat struct {
+	ID        int64 `gorm:"PrimaryKey"`
+	Type      string
+	Title     string
+	Username  string
+	IsPrivate bool
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Extra     string
+}
+
+func (baselineChat) TableName() string { return "chats" }
+
+type baselineMessage struct {
+	ID          int64 `gorm:"PrimaryKey"`
+	SenderID    int64 `gorm:"index"`
+	ChatID      int64 `gorm:"index"`
+	Text        string
+	Unixtime    int64
+	LastEdit    sql.NullTime
+	AlbumID     string
+	Caption     string
+	IsForwarded bool
+	ReplyToID   int64 `gorm:"index"`
+
+	Sender  *baselineUser    `gorm:"foreignKey:SenderID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Chat    *baselineChat    `gorm:"foreignKey:ChatID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	ReplyTo *baselineMessage `gorm:"foreignKey:ReplyToID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (baselineMessage) TableName() string { return "messages" }
+
+type baselineMessageOrigin struct {
+	ID               int64 `gorm:"PrimaryKey"`
+	OriginalChatID   int64 `gorm:"index"`
+	MessageID        int64 `gorm:"index"`
+	OriginalSenderID int64 `gorm:"index"`
+	OriginalText     string
+
+	OriginalChat   *baselineChat    `gorm:"foreignKey:OriginalChatID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	OriginalSender *baselineUser    `gorm:"foreignKey:OriginalSenderID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Message        *baselineMessage `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+}
+
+func (baselineMessageOrigin) TableName() string { return "message_origins" }
+
+type baselineReplyMarkup struct {
+	ID        int64 `gorm:"PrimaryKey"`
+	MessageID int64 `gorm:"index"`
+	Data      string
+
+	Message *baselineMessage `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+}
+
+func (baselineReplyMarkup) TableName() string { return "reply_markups" }
+
+type baselineCaptcha struct {
+	ID         int64 `gorm:"PrimaryKey"`
+	UserID     int64 `gorm:"index"`
+	ChatID     int64 `gorm:"index"`
+	MessageID  int64 `gorm:"index"`
+	Digits     string
+	Input      string
+	Length     int
+	Width      int
+	Height     int
+	Expiration time.Duration
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (baselineCaptcha) TableName() string { return "captchas" }
+
+type baselineModerationEvent struct {
+	ID       int64  `gorm:"primaryKey;autoIncrement"`
+	Type     string `gorm:"index:idx_moderation_type_time"`
+	ChatID   int64  `gorm:"index"`
+	UserID   int64  `gorm:"index"`
+	Rule     string
+	Unixtime int64 `gorm:"index:idx_moderation_type_time"`
+	Duration int64
+}
+
+func (baselineModerationEvent) TableName() string { return "moderation_events" }
+
+// baselineTables - the tables of the baseline in the order of creation.
+func baselineTables() []interface{} {
+	return []interface{}{
+		&baselineKeyValue{},
+		&baselineUser{},
+		&baselineVerifiedUser{},
+		&baselineBannedUser{},
+		&baselineChat{},
+		&baselineMessageOrigin{},
+		&baselineMessage{},
+		&baselineReplyMarkup{},
+		&baselineCaptcha{},
+		&baselineModerationEvent{},
+	}
+}
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "baseline",
+		// AutoMigrate adopts the databases created before the versioned migrations
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(baselineTables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			tables := baselineTables()
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Frozen snapshots of the fields added to the messages and the message origins.
+
+type messageContentV2 struct {
+	Entities        string
+	CaptionEntities string
+	MediaType       string `gorm:"index"`
+	FileID          string
+	FileUniqueID    string `gorm:"index"`
+	FileSize        int64
+	ViaBotID        int64 `gorm:"index"`
+}
+
+func (messageContentV2) TableName() string { return "messages" }
+
+type messageOriginV2 struct {
+	Type              string
+	SenderName        string
+	OriginalMessageID int64
+	Signature         string
+	OriginalUnixtime  int64
+}
+
+func (messageOriginV2) TableName() string { return "message_origins" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "message_content",
+		Up: func(tx *gorm.DB) error {
+			if err := AddColumns(&messageContentV2{})(tx); err != nil {
+				return err
+			}
+
+			return AddColumns(&messageOriginV2{})(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := DropColumns(&messageOriginV2{},
+				"Type", "SenderName", "OriginalMessageID", "Signature", "OriginalUnixtime")(tx); err != nil {
+				return err
+			}
+
+			return DropColumns(&messageContentV2{},
+				"Entities", "CaptionEntities", "MediaType", "FileID", "FileUniqueID", "FileSize", "ViaBotID")(tx)
+		},
+	})
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frozen snapshot of the message revisions.
+
+type messageRevisionV3 struct {
+	ID              int64 `gorm:"primaryKey;autoIncrement"`
+	MessageID       int64 `gorm:"index:idx_revision_message"`
+	ChatID          int64 `gorm:"index:idx_revision_message"`
+	SenderID        int64 `gorm:"index"`
+	Text            string
+	Caption         string
+	Entities        string
+	CaptionEntities string
+	Unixtime        int64
+	CreatedAt       time.Time
+}
+
+func (messageRevisionV3) TableName() string { return "message_revisions" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "message_revisions",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&messageRevisionV3{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&messageRevisionV3{})
+		},
+	})
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frozen snapshot of the chat members.
+
+type chatMemberV4 struct {
+	ChatID      int64 `gorm:"primaryKey;autoIncrement:false"`
+	UserID      int64 `gorm:"primaryKey;autoIncrement:false;index"`
+	Status      string
+	IsMember    bool
+	JoinedAt    sql.NullTime
+	LeftAt      sql.NullTime
+	InvitedByID int64
+	InviteLink  string
+	UpdatedAt   time.Time
+}
+
+func (chatMemberV4) TableName() string { return "chat_members" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "chat_members",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&chatMemberV4{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&chatMemberV4{})
+		},
+	})
+}
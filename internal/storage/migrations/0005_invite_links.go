@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frozen snapshot of the invite links.
+
+type inviteLinkV5 struct {
+	Link        string `gorm:"primaryKey"`
+	ChatID      int64  `gorm:"index"`
+	Name        string
+	CreatorID   int64
+	ExpireAt    sql.NullTime
+	MemberLimit int
+	IsRevoked   bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (inviteLinkV5) TableName() string { return "invite_links" }
+
+// The joins are attributed to the invite link of the member.
+type chatMemberV5 struct {
+	InviteLink string `gorm:"index"`
+}
+
+func (chatMemberV5) TableName() string { return "chat_members" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "invite_links",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&inviteLinkV5{}); err != nil {
+				return err
+			}
+
+			return tx.Migrator().CreateIndex(&chatMemberV5{}, "InviteLink")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&chatMemberV5{}, "InviteLink"); err != nil {
+				return err
+			}
+
+			return tx.Migrator().DropTable(&inviteLinkV5{})
+		},
+	})
+}
@@ -0,0 +1,20 @@
+package migrations
+
+// Frozen snapshot of the captcha columns for the join requests.
+
+type captchaV6 struct {
+	JoinChatID int64 `gorm:"index"`
+	Attempts   int
+}
+
+func (captchaV6) TableName() string { return "captchas" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "captcha_join_requests",
+		Up:      AddColumns(&captchaV6{}),
+		Down:    DropColumns(&captchaV6{}, "JoinChatID", "Attempts"),
+	})
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frozen snapshot of the chat rules and the acceptance of the rules.
+
+type chatRulesV7 struct {
+	ChatID            int64 `gorm:"primaryKey;autoIncrement:false"`
+	Text              string
+	RequireAcceptance bool
+	UpdatedByID       int64
+	UpdatedAt         time.Time
+}
+
+func (chatRulesV7) TableName() string { return "chat_rules" }
+
+type verifiedUserV7 struct {
+	RulesAcceptedAt sql.NullTime `gorm:"null"`
+}
+
+func (verifiedUserV7) TableName() string { return "verified" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "chat_rules",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&chatRulesV7{}); err != nil {
+				return err
+			}
+
+			return AddColumns(&verifiedUserV7{})(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := DropColumns(&verifiedUserV7{}, "RulesAcceptedAt")(tx); err != nil {
+				return err
+			}
+
+			return tx.Migrator().DropTable(&chatRulesV7{})
+		},
+	})
+}
@@ -0,0 +1,20 @@
+package migrations
+
+// Frozen snapshot of the banned columns for the shared ban lists.
+
+type bannedV8 struct {
+	Source string `gorm:"index;not null;default:''"`
+	Trust  int    `gorm:"not null;default:0"`
+}
+
+func (bannedV8) TableName() string { return "banned" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "banned_source",
+		Up:      AddColumns(&bannedV8{}),
+		Down:    DropColumns(&bannedV8{}, "Source", "Trust"),
+	})
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frozen snapshot of the chats where the users are banned in Telegram.
+
+type banChatV9 struct {
+	UserID   int64     `gorm:"primaryKey;autoIncrement:false"`
+	ChatID   int64     `gorm:"primaryKey;autoIncrement:false"`
+	BannedAt time.Time `gorm:"not null"`
+}
+
+func (banChatV9) TableName() string { return "ban_chats" }
+
+type bannedV9 struct {
+	ExpiresAt *time.Time `gorm:"index"`
+}
+
+func (bannedV9) TableName() string { return "banned" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "ban_chats",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&banChatV9{}); err != nil {
+				return err
+			}
+
+			// The sweeper looks up the expired bans
+			return tx.Migrator().CreateIndex(&bannedV9{}, "ExpiresAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&bannedV9{}, "ExpiresAt"); err != nil {
+				return err
+			}
+
+			return tx.Migrator().DropTable(&banChatV9{})
+		},
+	})
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frozen snapshot of the persisted states of the scheduled jobs.
+
+type jobStateV10 struct {
+	Name         string `gorm:"primaryKey"`
+	LastRunAt    *time.Time
+	LastDuration int64  `gorm:"not null;default:0"`
+	LastError    string `gorm:"not null;default:''"`
+	NextRunAt    *time.Time
+	Runs         int64  `gorm:"not null;default:0"`
+	Failures     int64  `gorm:"not null;default:0"`
+	LockedBy     string `gorm:"not null;default:''"`
+	LockedUntil  *time.Time
+	UpdatedAt    time.Time
+}
+
+func (jobStateV10) TableName() string { return "job_states" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "job_states",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&jobStateV10{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&jobStateV10{})
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frozen snapshot of the scheduled announcements.
+
+type announcementV11 struct {
+	ID            int64      `gorm:"primaryKey;autoIncrement"`
+	ChatID        int64      `gorm:"not null;index"`
+	Text          string     `gorm:"not null;default:''"`
+	MediaType     string     `gorm:"not null;default:''"`
+	Media         string     `gorm:"not null;default:''"`
+	Pin           bool       `gorm:"not null;default:false"`
+	Schedule      string     `gorm:"not null;default:''"`
+	NextRunAt     *time.Time `gorm:"index"`
+	LastSentAt    *time.Time
+	LastMessageID int64  `gorm:"not null;default:0"`
+	LastError     string `gorm:"not null;default:''"`
+	Sent          int64  `gorm:"not null;default:0"`
+	CreatedByID   int64
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (announcementV11) TableName() string { return "announcements" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "announcements",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&announcementV11{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&announcementV11{})
+		},
+	})
+}
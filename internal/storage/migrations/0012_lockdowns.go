@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frozen snapshot of the lockdowns of the chats.
+
+type lockdownV12 struct {
+	ChatID      int64  `gorm:"primaryKey;autoIncrement:false"`
+	Reason      string `gorm:"not null;default:''"`
+	Joins       int    `gorm:"not null;default:0"`
+	Restricted  bool   `gorm:"not null;default:false"`
+	Permissions string `gorm:"not null;default:''"`
+	StartedByID int64
+	StartedAt   time.Time
+	EndsAt      time.Time `gorm:"index"`
+	UpdatedAt   time.Time
+}
+
+func (lockdownV12) TableName() string { return "lockdowns" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "lockdowns",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&lockdownV12{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&lockdownV12{})
+		},
+	})
+}
@@ -0,0 +1,19 @@
+package migrations
+
+// Frozen snapshot of the captcha column for the join requests queued onto the active captcha.
+
+type captchaV13 struct {
+	QueuedJoinChats string `gorm:"not null;default:''"`
+}
+
+func (captchaV13) TableName() string { return "captchas" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "captcha_queued_join_chats",
+		Up:      AddColumns(&captchaV13{}),
+		Down:    DropColumns(&captchaV13{}, "QueuedJoinChats"),
+	})
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Frozen snapshots of the chat columns of the message origins and the reply markups,
+// as the message IDs are unique only within the chat.
+
+type messageOriginV14 struct {
+	ChatID int64 `gorm:"index"`
+}
+
+func (messageOriginV14) TableName() string { return "message_origins" }
+
+type replyMarkupV14 struct {
+	ChatID int64 `gorm:"index"`
+}
+
+func (replyMarkupV14) TableName() string { return "reply_markups" }
+
+//nolint:gochecknoinits
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "message_extras_chat",
+		Up: func(tx *gorm.DB) error {
+			if err := AddColumns(&messageOriginV14{})(tx); err != nil {
+				return err
+			}
+
+			if err := AddColumns(&replyMarkupV14{})(tx); err != nil {
+				return err
+			}
+
+			// The stored rows belong to the chat of their message
+			return SQL(map[string][]string{"": {
+				"UPDATE message_origins SET chat_id = (SELECT messages.chat_id FROM messages WHERE messages.id = message_origins.message_id)",
+				"UPDATE reply_markups SET chat_id = (SELECT messages.chat_id FROM messages WHERE messages.id = reply_markups.message_id)",
+			}})(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := DropColumns(&replyMarkupV14{}, "ChatID")(tx); err != nil {
+				return err
+			}
+
+			return DropColumns(&messageOriginV14{}, "ChatID")(tx)
+		},
+	})
+}
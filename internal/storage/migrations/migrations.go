@@ -0,0 +1,386 @@
+// Description: The migrations package applies the versioned schema migrations of the database.
+// Every migration has an up and a down step, written with GORM on frozen snapshots of the models
+// or as raw SQL per dialect. The applied versions are stored in the schema_migrations table,
+// and on Postgres and MySQL the migrations are serialized across the replicas with an advisory lock.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// lockKey is the key of the advisory lock, the same for every replica.
+const lockKey = "foxy-gram-server:migrations"
+
+var (
+	errorDuplicateVersion = errors.New("duplicate migration version")
+	errorUnknownVersion   = errors.New("applied migration is unknown to this build")
+	errorNoDialectSQL     = errors.New("migration has no SQL for the dialect")
+	errorLockTimeout      = errors.New("timed out waiting for the migration lock")
+)
+
+// Step - a single direction of the migration, executed in a transaction.
+type Step func(tx *gorm.DB) error
+
+// Migration - a versioned change of the database schema.
+type Migration struct {
+	Version int64  // Unique increasing version, e.g. 1, 2, 3
+	Name    string // Short description
+	Up      Step   // Apply the migration
+	Down    Step   // Revert the migration
+}
+
+// Status - state of the migration in the database.
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"` // Nil if the migration is pending
+}
+
+// schemaMigration - row of the schema_migrations table.
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName - set the table name.
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+var (
+	registryMutex sync.Mutex  //nolint:gochecknoglobals
+	registry      []Migration //nolint:gochecknoglobals
+)
+
+// register adds the migration to the registry, called from the init of every migration file.
+func register(migration Migration) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry = append(registry, migration)
+}
+
+// All - every known migration ordered by version.
+func All() ([]Migration, error) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	result := make([]Migration, len(registry))
+	copy(result, registry)
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+
+	for i := 1; i < len(result); i++ {
+		if result[i].Version == result[i-1].Version {
+			return nil, fmt.Errorf("%w: %d", errorDuplicateVersion, result[i].Version)
+		}
+	}
+
+	return result, nil
+}
+
+// SQL - step executing the raw statements for the dialect of the database,
+// e.g. "sqlite", "postgres" or "mysql". The statements of the empty dialect are used as a fallback.
+func SQL(statements map[string][]string) Step {
+	return func(tx *gorm.DB) error {
+		queries, ok := statements[tx.Dialector.Name()]
+		if !ok {
+			if queries, ok = statements[""]; !ok {
+				return fmt.Errorf("%w: %s", errorNoDialectSQL, tx.Dialector.Name())
+			}
+		}
+
+		for _, query := range queries {
+			if err := tx.Exec(query).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// AddColumns - step adding the columns and the indexes of the frozen snapshot to the existing table.
+// The snapshot holds only the new fields, with the table name of the existing table.
+func AddColumns(snapshot any) Step {
+	return func(tx *gorm.DB) error {
+		return tx.AutoMigrate(snapshot)
+	}
+}
+
+// DropColumns - step dropping the fields of the frozen snapshot from the table, with their indexes.
+func DropColumns(snapshot any, fields ...string) Step {
+	return func(tx *gorm.DB) error {
+		migrator := tx.Migrator()
+
+		for _, field := range fields {
+			if migrator.HasIndex(snapshot, field) {
+				if err := migrator.DropIndex(snapshot, field); err != nil {
+					return err
+				}
+			}
+
+			if migrator.HasColumn(snapshot, field) {
+				if err := migrator.DropColumn(snapshot, field); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+// Migrator - applies and reverts the migrations of the database.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New - create the migrator with every registered migration.
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Status - state of every known migration.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	db := m.db.WithContext(ctx)
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Status, 0, len(m.migrations))
+
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+
+		result = append(result, status)
+	}
+
+	return result, nil
+}
+
+// Pending - number of the migrations not applied yet.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+
+	return pending, nil
+}
+
+// Up - apply every pending migration in order, returns the applied migrations.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var result []Migration
+
+	err := m.withLock(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			if err := db.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+
+				return tx.Create(&schemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now().UTC(),
+				}).Error
+			}); err != nil {
+				return fmt.Errorf("migration %d %s up: %w", migration.Version, migration.Name, err)
+			}
+
+			result = append(result, migration)
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// Down - revert the last applied migrations, returns the reverted migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var result []Migration
+
+	err := m.withLock(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+
+		known := make(map[int64]Migration, len(m.migrations))
+		for _, migration := range m.migrations {
+			known[migration.Version] = migration
+		}
+
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, version := range versions {
+			if len(result) >= steps {
+				break
+			}
+
+			migration, ok := known[version]
+			if !ok {
+				return fmt.Errorf("%w: %d", errorUnknownVersion, version)
+			}
+
+			if err := db.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+
+				return tx.Delete(&schemaMigration{}, "version = ?", version).Error
+			}); err != nil {
+				return fmt.Errorf("migration %d %s down: %w", migration.Version, migration.Name, err)
+			}
+
+			result = append(result, migration)
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// applied - rows of the applied migrations by version.
+func (m *Migrator) applied(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		result[row.Version] = row
+	}
+
+	return result, nil
+}
+
+// withLock - run the function holding the advisory lock of the database, if supported,
+// so only one replica migrates the database at a time.
+func (m *Migrator) withLock(ctx context.Context, fn func(db *gorm.DB) error) error {
+	db := m.db.WithContext(ctx)
+
+	unlock, err := lock(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+
+	return fn(db)
+}
+
+// lock - acquire the advisory lock on a dedicated connection, the lock is bound to the session.
+// SQLite has no advisory locks, and a single process owns the database file anyway.
+func lock(ctx context.Context, db *gorm.DB) (func(), error) {
+	const timeoutSeconds = 15 * 60
+
+	var acquire, release string
+
+	switch db.Dialector.Name() {
+	case "postgres":
+		acquire = "SELECT pg_advisory_lock(hashtext($1))"
+		release = "SELECT pg_advisory_unlock(hashtext($1))"
+	case "mysql":
+		acquire = fmt.Sprintf("SELECT GET_LOCK(?, %d)", timeoutSeconds)
+		release = "SELECT RELEASE_LOCK(?)"
+	default:
+		return func() {}, nil
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired any
+	if err := conn.QueryRowContext(ctx, acquire, lockKey).Scan(&acquired); err != nil {
+		_ = conn.Close()
+
+		return nil, fmt.Errorf("acquire migration lock: %w", err)
+	}
+
+	// GET_LOCK returns 0 on timeout, pg_advisory_lock waits until the lock is acquired
+	if isZero(acquired) {
+		_ = conn.Close()
+
+		return nil, errorLockTimeout
+	}
+
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), release, lockKey)
+		_ = conn.Close()
+	}, nil
+}
+
+// isZero - whether the scanned value is zero, the drivers return the integers as int64 or text.
+func isZero(value any) bool {
+	switch v := value.(type) {
+	case int64:
+		return v == 0
+	case []byte:
+		return string(v) == "0"
+	case string:
+		return v == "0"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMigratorUpDown(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.sqlite3")), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	require.NoError(t, err)
+
+	migrator, err := New(db)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	all, err := All()
+	require.NoError(t, err)
+
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, len(all), pending)
+
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, len(all))
+	require.True(t, db.Migrator().HasTable("users"))
+	require.True(t, db.Migrator().HasColumn("messages", "file_unique_id"))
+	require.True(t, db.Migrator().HasIndex("messages", "idx_messages_file_unique_id"))
+	require.True(t, db.Migrator().HasColumn("message_origins", "original_unixtime"))
+
+	// Up is idempotent
+	applied, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+
+	for _, status := range statuses {
+		require.NotNil(t, status.AppliedAt, "migration %d", status.Version)
+	}
+
+	reverted, err := migrator.Down(ctx, len(all))
+	require.NoError(t, err)
+	require.Len(t, reverted, len(all))
+	require.False(t, db.Migrator().HasTable("users"))
+
+	pending, err = migrator.Pending(ctx)
+	require.NoError(t, err)
+	require.Equal(t, len(all), pending)
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound - the record is not found, returned by every implementation of the repositories.
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// UserRepository - users and their verification.
+type UserRepository interface {
+	UserByID(id model.UserID) (*model.User, error)
+	UserByUsername(username string) (*model.User, error)
+	UpsertUser(user *model.User) error
+	DeleteUser(user *model.User) error
+	Users() ([]model.User, error)
+	IsVerifiedUser(userID model.UserID) (bool, error)
+	VerifyUser(verifiedUser *model.VerifiedUser) error
+	VerifyUsers(reason string, userIDs []int) error
+	UnverifyUser(userID model.UserID) error
+	VerifiedUsers() ([]model.VerifiedUser, error)
+}
+
+// BanRepository - banned users.
+type BanRepository interface {
+	IsBannedUser(userID model.UserID) (bool, error)
+	BanUser(bannedUser *model.BannedUser) error
+	UnbanUser(userID model.UserID) error
+	BannedUsers() ([]model.BannedUser, error)
+	MergeBans(source string, trust int, bans []model.BannedUser) (BanMergeResult, error)
+	RevokeBans(source string) (int64, error)
+	ExpiredBans(now time.Time, limit int) ([]model.BannedUser, error)
+	UpcomingBanExpiries(now time.Time, until time.Time, limit int) ([]model.BannedUser, error)
+	RecordBanChat(userID model.UserID, chatID model.ChatID) error
+	BanChats(userID model.UserID) ([]model.BanChat, error)
+	LiftedBanChats(limit int) ([]model.BanChat, error)
+	DeleteBanChat(userID model.UserID, chatID model.ChatID) error
+}
+
+// CaptchaRepository - captchas waiting to be solved.
+type CaptchaRepository interface {
+	GetOutdatedCaptchas() []model.Captcha
+	UpsertCaptcha(captcha *model.Captcha) error
+	DeleteCaptchaByID(id int64) error
+	GetCaptchaForUserID(userID int64) (*model.Captcha, error)
+}
+
+// MessageRepository - messages with their chats, users and revisions.
+type MessageRepository interface {
+	UpsertMessage(input UpsertMessageInput) error
+	MessageByID(chatID model.ChatID, id model.MessageID) (*model.Message, error)
+	MessageRevisions(chatID model.ChatID, id model.MessageID) ([]model.MessageRevision, error)
+}
+
+// ChatMemberRepository - membership of the users in the chats.
+type ChatMemberRepository interface {
+	ChatMemberByID(chatID model.ChatID, userID model.UserID) (*model.ChatMember, error)
+	UpsertChatMember(member *model.ChatMember) error
+	UpdateChatMember(chatID model.ChatID, userID model.UserID, update func(member *model.ChatMember) error) (*model.ChatMember, error)
+	ChatMembersOfUser(userID model.UserID) ([]model.ChatMember, error)
+}
+
+// InviteLinkRepository - invite links of the chats.
+type InviteLinkRepository interface {
+	InviteLinkByLink(link string) (*model.InviteLink, error)
+	UpsertInviteLink(link *model.InviteLink) error
+	InviteLinks(chatID model.ChatID) ([]model.InviteLink, error)
+}
+
+// RulesRepository - rules of the chats.
+type RulesRepository interface {
+	ChatRulesByID(chatID model.ChatID) (*model.ChatRules, error)
+	UpsertChatRules(rules *model.ChatRules) error
+}
+
+// KVStore - key-value pairs.
+type KVStore interface {
+	KVSet(key string, value interface{}) error
+	KVGet(key string) (*model.KeyValue, error)
+	KVDelete(key string) error
+}
+
+// StatsRepository - moderation events and the statistics.
+type StatsRepository interface {
+	RecordModerationEvent(events ...*model.ModerationEvent) error
+	MessagesPerChat(filter StatsFilter) ([]ChatActivity, error)
+	TopUsers(filter StatsFilter) ([]UserActivity, error)
+	ModerationTimeline(filter StatsFilter) ([]ModerationActivity, error)
+	CaptchaStats(filter StatsFilter) (*CaptchaStats, error)
+	SpamDeletions(filter StatsFilter) ([]RuleCount, error)
+	InviteLinkStats(filter StatsFilter) ([]InviteLinkActivity, error)
+}
+
+// RetentionRepository - retention of the messages and removal of the user data.
+type RetentionRepository interface {
+	MessageChats() ([]model.ChatID, error)
+	PurgeMessages(chatID model.ChatID, policy config.RetentionPolicy, now time.Time, limit int) (int64, error)
+	PurgeDeleted(before time.Time, limit int) (int64, error)
+	ForgetUser(userID model.UserID) (map[string]int64, error)
+}
+
+// JobRepository - persisted states and locks of the scheduled jobs.
+type JobRepository interface {
+	JobStates() ([]model.JobState, error)
+	AcquireJob(name string, owner string, now time.Time, until time.Time, force bool) (bool, error)
+	FinishJob(name string, owner string, run JobRun) error
+}
+
+// AnnouncementRepository - announcements posted to the chats once or by the schedule.
+type AnnouncementRepository interface {
+	AnnouncementByID(id int64) (*model.Announcement, error)
+	Announcements(chatID model.ChatID) ([]model.Announcement, error)
+	DueAnnouncements(now time.Time, limit int) ([]model.Announcement, error)
+	UpsertAnnouncement(announcement *model.Announcement) error
+	DeleteAnnouncement(id int64) error
+}
+
+// LockdownRepository - lockdowns of the chats, e.g. after the raids.
+type LockdownRepository interface {
+	LockdownByChatID(chatID model.ChatID) (*model.Lockdown, error)
+	Lockdowns() ([]model.Lockdown, error)
+	UpsertLockdown(lockdown *model.Lockdown) error
+	CreateLockdown(lockdown *model.Lockdown) (bool, error)
+	ExtendLockdown(chatID model.ChatID, endsAt time.Time, joins int) error
+	RestrictLockdown(chatID model.ChatID, permissions string) error
+	DeleteLockdown(chatID model.ChatID) error
+}
+
+// Repository - every repository of the application in one storage.
+type Repository interface {
+	UserRepository
+	BanRepository
+	CaptchaRepository
+	MessageRepository
+	ChatMemberRepository
+	InviteLinkRepository
+	RulesRepository
+	KVStore
+	StatsRepository
+	RetentionRepository
+	JobRepository
+	AnnouncementRepository
+	LockdownRepository
+
+	// WithContext - get the repository bound to the context, e.g. for tracing.
+	WithContext(ctx context.Context) Repository
+	// Status - get the status of the storage.
+	Status() (string, error)
+	// Close - release the resources of the storage.
+	Close() error
+}
+
+// Ensure Storage implements Repository
+var _ Repository = (*Storage)(nil)
@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm"
+)
+
+// PurgeResult - number of rows removed or erased by the purge.
+type PurgeResult struct {
+	Messages int64 `json:"messages"` // Messages deleted or erased by the retention policies.
+	Deleted  int64 `json:"deleted"`  // Soft-deleted users, chats and messages removed.
+}
+
+// Purge - apply the retention policies to every chat and remove the outdated soft-deleted rows.
+// The rows are processed in small batches with a pause between them,
+// so the purge never holds the database for long. Stops when the context is done.
+func Purge(ctx context.Context, db RetentionRepository, cfg *config.RetentionConfig) (PurgeResult, error) {
+	var result PurgeResult
+
+	// batches calls the purge until there is nothing left to purge
+	batches := func(purge func() (int64, error)) (int64, error) {
+		var total int64
+
+		for {
+			count, err := purge()
+			total += count
+
+			if err != nil || count == 0 {
+				return total, err
+			}
+
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(cfg.BatchPause):
+			}
+		}
+	}
+
+	chats, err := db.MessageChats()
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now()
+
+	for _, chatID := range chats {
+		policy := cfg.PolicyFor(chatID.ToInt64())
+		if !policy.IsEnabled() {
+			continue
+		}
+
+		count, err := batches(func() (int64, error) {
+			return db.PurgeMessages(chatID, policy, now, cfg.BatchSize)
+		})
+		result.Messages += count
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if cfg.DeletedMaxAge > 0 {
+		count, err := batches(func() (int64, error) {
+			return db.PurgeDeleted(now.Add(-cfg.DeletedMaxAge), cfg.BatchSize)
+		})
+		result.Deleted += count
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// MessageChats - get the IDs of the chats with the stored messages.
+func (s *Storage) MessageChats() ([]model.ChatID, error) {
+	var chats []model.ChatID
+	if err := s.db.Unscoped().Model(&model.Message{}).Distinct("chat_id").Order("chat_id").Pluck("chat_id", &chats).Error; err != nil {
+		return nil, err
+	}
+
+	return chats, nil
+}
+
+// PurgeMessages - apply one batch of the retention policy to the messages of the chat.
+// The steps go in order, the batch is taken from the first step with anything left to do:
+// delete the messages beyond the maximum number of rows, delete the messages older than the maximum age,
+// and erase the text if only the metadata is kept. Returns the number of affected messages,
+// zero when the chat already complies with the policy.
+func (s *Storage) PurgeMessages(chatID model.ChatID, policy config.RetentionPolicy, now time.Time, limit int) (int64, error) {
+	messages := func() *gorm.DB {
+		return s.db.Unscoped().Model(&model.Message{}).Where("chat_id = ?", chatID).Limit(limit)
+	}
+
+	// Beyond the maximum number of rows, the newest messages are kept
+	if policy.MaxRows > 0 {
+		var ids []model.MessageID
+		if err := messages().Order("unixtime DESC, id DESC").Offset(policy.MaxRows).Pluck("id", &ids).Error; err != nil {
+			return 0, err
+		}
+
+		if count, err := s.deleteMessages(chatID, ids); err != nil || count > 0 {
+			return count, err
+		}
+	}
+
+	// Older than the maximum age
+	if policy.MaxAge > 0 {
+		var ids []model.MessageID
+		if err := messages().Where("unixtime < ?", now.Add(-policy.MaxAge).Unix()).Order("id").Pluck("id", &ids).Error; err != nil {
+			return 0, err
+		}
+
+		if count, err := s.deleteMessages(chatID, ids); err != nil || count > 0 {
+			return count, err
+		}
+	}
+
+	// Only the metadata is kept
+	if policy.MetadataOnly {
+		var ids []model.MessageID
+		if err := messages().Where("(text <> '' OR caption <> '')").Order("id").Pluck("id", &ids).Error; err != nil {
+			return 0, err
+		}
+
+		if len(ids) == 0 {
+			return 0, nil
+		}
+
+		var affected int64
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&model.MessageOrigin{}).Where("chat_id = ? AND message_id IN ?", chatID, ids).Update("original_text", "").Error; err != nil {
+				return err
+			}
+
+			if err := tx.Model(&model.MessageRevision{}).
+				Where("chat_id = ? AND message_id IN ?", chatID, ids).
+				Updates(map[string]any{"text": "", "caption": ""}).Error; err != nil {
+				return err
+			}
+
+			result := tx.Unscoped().Model(&model.Message{}).
+				Where("chat_id = ? AND id IN ?", chatID, ids).
+				Updates(map[string]any{"text": "", "caption": ""})
+			affected = result.RowsAffected
+
+			return result.Error
+		})
+
+		return affected, err
+	}
+
+	return 0, nil
+}
+
+// deleteMessages - delete the messages of the chat with the rows referencing them.
+func (s *Storage) deleteMessages(chatID model.ChatID, ids []model.MessageID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var affected int64
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.MessageOrigin{}, "chat_id = ? AND message_id IN ?", chatID, ids).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&model.ReplyMarkup{}, "chat_id = ? AND message_id IN ?", chatID, ids).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&model.MessageRevision{}, "chat_id = ? AND message_id IN ?", chatID, ids).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Delete(&model.Message{}, "chat_id = ? AND id IN ?", chatID, ids)
+		affected = result.RowsAffected
+
+		return result.Error
+	})
+
+	return affected, err
+}
+
+// PurgeDeleted - remove one batch of the messages, users and chats soft-deleted before the time.
+// Returns the number of removed rows, zero when there is nothing left to remove.
+func (s *Storage) PurgeDeleted(before time.Time, limit int) (int64, error) {
+	var affected int64
+
+	// Messages
+	var messages []model.Message
+	if err := s.db.Unscoped().Select("id", "chat_id").Where("deleted_at < ?", before).Order("id").Limit(limit).Find(&messages).Error; err != nil {
+		return affected, err
+	}
+
+	for _, message := range messages {
+		count, err := s.deleteMessages(message.ChatID, []model.MessageID{message.ID})
+		affected += count
+
+		if err != nil {
+			return affected, err
+		}
+	}
+
+	// Users and chats
+	for _, table := range []any{&model.User{}, &model.Chat{}} {
+		var ids []int64
+		if err := s.db.Unscoped().Model(table).Where("deleted_at < ?", before).Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+			return affected, err
+		}
+
+		if len(ids) == 0 {
+			continue
+		}
+
+		result := s.db.Unscoped().Delete(table, "id IN ?", ids)
+		affected += result.RowsAffected
+
+		if result.Error != nil {
+			return affected, result.Error
+		}
+	}
+
+	return affected, nil
+}
+
+// ForgetUser - remove the messages and the profile data of the user from every table.
+// The ban is kept, it holds no personal data and protects the chats from the same account.
+// Returns the number of removed rows per table.
+func (s *Storage) ForgetUser(userID model.UserID) (map[string]int64, error) {
+	removed := make(map[string]int64)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		messages := tx.Unscoped().Model(&model.Message{}).Select("chat_id, id").Where("sender_id = ?", userID)
+
+		// The rows referencing the messages are removed before the messages
+		deletes := []struct {
+			table  string
+			delete func() *gorm.DB
+		}{
+			{"message_origins", func() *gorm.DB {
+				return tx.Where("(chat_id, message_id) IN (?) OR original_sender_id = ?", messages, userID).Delete(&model.MessageOrigin{})
+			}},
+			{"reply_markups", func() *gorm.DB {
+				return tx.Where("(chat_id, message_id) IN (?)", messages).Delete(&model.ReplyMarkup{})
+			}},
+			{"message_revisions", func() *gorm.DB {
+				return tx.Where("sender_id = ?", userID).Delete(&model.MessageRevision{})
+			}},
+			{"messages", func() *gorm.DB {
+				return tx.Unscoped().Where("sender_id = ?", userID).Delete(&model.Message{})
+			}},
+			{"captchas", func() *gorm.DB {
+				return tx.Where("user_id = ?", userID).Delete(&model.Captcha{})
+			}},
+			{"moderation_events", func() *gorm.DB {
+				return tx.Where("user_id = ?", userID).Delete(&model.ModerationEvent{})
+			}},
+			{"chat_members", func() *gorm.DB {
+				return tx.Where("user_id = ?", userID).Delete(&model.ChatMember{})
+			}},
+			{"verified_users", func() *gorm.DB {
+				return tx.Where("id = ?", userID).Delete(&model.VerifiedUser{})
+			}},
+			{"users", func() *gorm.DB {
+				return tx.Unscoped().Where("id = ?", userID).Delete(&model.User{})
+			}},
+		}
+
+		for _, d := range deletes {
+			result := d.delete()
+			if result.Error != nil {
+				return result.Error
+			}
+
+			removed[d.table] = result.RowsAffected
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.cacheDel("_user#" + userID.ToString())
+	s.cacheDel("_verified#" + userID.ToString())
+
+	return removed, nil
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurge(t *testing.T) {
+	db := newTestStorage(t)
+	now := time.Now()
+
+	// Chat -100 keeps 3 messages, chat -200 keeps a day of metadata, chat -300 keeps everything
+	cfg := &config.RetentionConfig{
+		BatchSize: 2,
+		Chats: map[int64]config.RetentionPolicy{
+			-100: {MaxRows: 3},
+			-200: {MaxAge: 24 * time.Hour, MetadataOnly: true},
+		},
+	}
+
+	for i := range 15 {
+		chatID := model.ChatID(-100 * (i%3 + 1))
+		require.NoError(t, db.db.Create(&model.Message{
+			ID:       model.MessageID(i + 1),
+			SenderID: 1,
+			ChatID:   chatID,
+			Text:     "text",
+			Unixtime: now.Add(-time.Duration(i) * 12 * time.Hour).Unix(),
+		}).Error)
+	}
+
+	result, err := Purge(context.Background(), db, cfg)
+	require.NoError(t, err)
+
+	count := func(chatID model.ChatID, query string) int64 {
+		var count int64
+		require.NoError(t, db.db.Model(&model.Message{}).Where("chat_id = ? AND "+query, chatID).Count(&count).Error)
+
+		return count
+	}
+
+	require.Equal(t, int64(3), count(-100, "1 = 1"))
+	require.Equal(t, int64(0), count(-100, "id > 9"), "the newest messages are kept")
+	require.Equal(t, int64(1), count(-200, "1 = 1"), "only the message 2 is within a day")
+	require.Equal(t, int64(0), count(-200, "text <> ''"))
+	require.Equal(t, int64(5), count(-300, "text <> ''"))
+	require.Equal(t, int64(2+4+1), result.Messages)
+}
+
+func TestForgetUser(t *testing.T) {
+	db := newTestStorage(t)
+
+	require.NoError(t, db.UpsertMessage(UpsertMessageInput{
+		Message: &model.Message{ID: 1, SenderID: 1, ChatID: -100, Text: "hello"},
+		Chats:   []*model.Chat{{ID: -100}},
+		Users:   []*model.User{{ID: 1, Username: "fox"}},
+	}))
+	require.NoError(t, db.UpsertMessage(UpsertMessageInput{
+		Message: &model.Message{ID: 1, SenderID: 1, ChatID: -100, Text: "hello t.me/spam"},
+	}))
+
+	revisions, err := db.MessageRevisions(-100, 1)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	require.Equal(t, "hello", revisions[0].Text)
+	require.Equal(t, "hello t.me/spam", revisions[1].Text)
+
+	require.NoError(t, db.UpsertMessage(UpsertMessageInput{
+		Message: &model.Message{ID: 2, SenderID: 2, ChatID: -100, Text: "hi"},
+		Users:   []*model.User{{ID: 2, Username: "cat"}},
+	}))
+	require.NoError(t, db.db.Create(&model.MessageOrigin{MessageID: 2, OriginalSenderID: 1, OriginalText: "hello"}).Error)
+	require.NoError(t, db.VerifyUser(&model.VerifiedUser{ID: 1, VerifiedAt: time.Now()}))
+	require.NoError(t, db.RecordModerationEvent(model.NewModerationEvent(model.ModerationEventJoin, -100, 1, "")))
+
+	removed, err := db.ForgetUser(1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{
+		"message_origins":   1,
+		"reply_markups":     0,
+		"message_revisions": 1,
+		"messages":          1,
+		"captchas":          0,
+		"moderation_events": 1,
+		"chat_members":      0,
+		"verified_users":    1,
+		"users":             1,
+	}, removed)
+
+	_, err = db.UserByID(1)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	verified, err := db.IsVerifiedUser(1)
+	require.NoError(t, err)
+	require.False(t, verified)
+
+	// The other users are untouched
+	user, err := db.UserByID(2)
+	require.NoError(t, err)
+	require.Equal(t, "cat", user.Username)
+}
@@ -0,0 +1,432 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"gorm.io/gorm"
+)
+
+// StatsFilter - time range, bucketing and chat of the statistics queries.
+type StatsFilter struct {
+	From   time.Time     // Start of the range, inclusive
+	To     time.Time     // End of the range, exclusive
+	Bucket time.Duration // Size of the time bucket, at least one second
+	ChatID int64         // Optional. Limit the statistics to the chat
+	Limit  int           // Optional. Maximum number of rows for the top lists
+}
+
+// ChatActivity - number of messages in the chat during the bucket.
+type ChatActivity struct {
+	ChatID   int64 `json:"chat_id"`
+	Bucket   int64 `json:"bucket"` // Unix timestamp of the bucket start
+	Messages int64 `json:"messages"`
+}
+
+// UserActivity - number of messages sent by the user.
+type UserActivity struct {
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Messages  int64  `json:"messages"`
+}
+
+// ModerationActivity - number of the moderation events of the type during the bucket.
+type ModerationActivity struct {
+	Bucket int64                     `json:"bucket"` // Unix timestamp of the bucket start
+	Type   model.ModerationEventType `json:"type"`
+	Count  int64                     `json:"count"`
+}
+
+// CaptchaStats - captcha outcomes and solve times.
+type CaptchaStats struct {
+	Sent               int64   `json:"sent"`
+	Solved             int64   `json:"solved"`
+	Failed             int64   `json:"failed"`  // Wrong inputs, the user may try again
+	Expired            int64   `json:"expired"` // Not solved in time
+	SolveRate          float64 `json:"solve_rate"`
+	MedianSolveSeconds float64 `json:"median_solve_seconds"`
+}
+
+// RuleCount - number of the events triggered by the rule.
+type RuleCount struct {
+	Rule  string `json:"rule"`
+	Count int64  `json:"count"`
+}
+
+// InviteLinkActivity - joins by the invite link and the moderation outcomes of the joined users.
+// The user is attributed to the link of the last join.
+type InviteLinkActivity struct {
+	InviteLink     string  `json:"invite_link"`
+	Name           string  `json:"name"`
+	ChatID         int64   `json:"chat_id"`
+	Joins          int64   `json:"joins"`
+	CaptchaSent    int64   `json:"captcha_sent"`
+	CaptchaSolved  int64   `json:"captcha_solved"`
+	CaptchaFailed  int64   `json:"captcha_failed"`  // Wrong inputs, the user may try again
+	CaptchaExpired int64   `json:"captcha_expired"` // Not solved in time
+	Bans           int64   `json:"bans"`
+	FailureRate    float64 `json:"failure_rate"` // Share of the sent captchas, which were not solved
+	BanRate        float64 `json:"ban_rate"`     // Bans per join
+}
+
+// bucketExpression - SQL expression rounding the unix timestamp column down to the bucket.
+// The bucket size is an integer, so it is safe to format it into the query.
+func (s *Storage) bucketExpression(column string, bucket time.Duration) string {
+	seconds := int64(bucket / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	if s.db.Dialector.Name() == "mysql" {
+		return fmt.Sprintf("(%s DIV %d) * %d", column, seconds, seconds)
+	}
+
+	return fmt.Sprintf("(%s / %d) * %d", column, seconds, seconds)
+}
+
+// messagesInRange - query of the messages in the range of the filter.
+func (s *Storage) messagesInRange(filter StatsFilter) *gorm.DB {
+	query := s.db.Model(&model.Message{}).
+		Where("messages.unixtime >= ? AND messages.unixtime < ?", filter.From.Unix(), filter.To.Unix())
+	if filter.ChatID != 0 {
+		query = query.Where("messages.chat_id = ?", filter.ChatID)
+	}
+
+	return query
+}
+
+// moderationEventsInRange - query of the moderation events in the range of the filter.
+func (s *Storage) moderationEventsInRange(filter StatsFilter) *gorm.DB {
+	query := s.db.Model(&model.ModerationEvent{}).
+		Where("unixtime >= ? AND unixtime < ?", filter.From.Unix(), filter.To.Unix())
+	if filter.ChatID != 0 {
+		query = query.Where("chat_id = ?", filter.ChatID)
+	}
+
+	return query
+}
+
+// RecordModerationEvent - store the moderation event for the statistics.
+func (s *Storage) RecordModerationEvent(events ...*model.ModerationEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	const batchSize = 1000
+
+	return s.db.CreateInBatches(events, batchSize).Error
+}
+
+// MessagesPerChat - number of messages per chat per bucket.
+func (s *Storage) MessagesPerChat(filter StatsFilter) ([]ChatActivity, error) {
+	bucket := s.bucketExpression("messages.unixtime", filter.Bucket)
+	result := make([]ChatActivity, 0)
+
+	err := s.messagesInRange(filter).
+		Select(fmt.Sprintf("messages.chat_id AS chat_id, %s AS bucket, COUNT(*) AS messages", bucket)).
+		Group("messages.chat_id").
+		Group(bucket).
+		Order("bucket, chat_id").
+		Scan(&result).Error
+
+	return result, err
+}
+
+// TopUsers - the most active users by the number of messages.
+func (s *Storage) TopUsers(filter StatsFilter) ([]UserActivity, error) {
+	const defaultLimit = 10
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	result := make([]UserActivity, 0, limit)
+
+	err := s.messagesInRange(filter).
+		Select("messages.sender_id AS user_id, users.username, users.first_name, users.last_name, COUNT(*) AS messages").
+		Joins("LEFT JOIN users ON users.id = messages.sender_id").
+		Group("messages.sender_id, users.username, users.first_name, users.last_name").
+		Order("messages DESC, user_id").
+		Limit(limit).
+		Scan(&result).Error
+
+	return result, err
+}
+
+// ModerationTimeline - number of joins, verifications and bans per bucket.
+func (s *Storage) ModerationTimeline(filter StatsFilter) ([]ModerationActivity, error) {
+	bucket := s.bucketExpression("unixtime", filter.Bucket)
+	result := make([]ModerationActivity, 0)
+
+	err := s.moderationEventsInRange(filter).
+		Select(fmt.Sprintf("%s AS bucket, type, COUNT(*) AS count", bucket)).
+		Where("type IN ?", []model.ModerationEventType{
+			model.ModerationEventJoin,
+			model.ModerationEventVerification,
+			model.ModerationEventBan,
+		}).
+		Group(bucket).
+		Group("type").
+		Order("bucket, type").
+		Scan(&result).Error
+
+	return result, err
+}
+
+// CaptchaStats - captcha solve rate and median solve time.
+func (s *Storage) CaptchaStats(filter StatsFilter) (*CaptchaStats, error) {
+	var counts []struct {
+		Type  model.ModerationEventType
+		Count int64
+	}
+
+	if err := s.moderationEventsInRange(filter).
+		Select("type, COUNT(*) AS count").
+		Where("type IN ?", []model.ModerationEventType{
+			model.ModerationEventCaptchaSent,
+			model.ModerationEventCaptchaSolved,
+			model.ModerationEventCaptchaFailed,
+			model.ModerationEventCaptchaExpired,
+		}).
+		Group("type").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	byType := make(map[model.ModerationEventType]int64, len(counts))
+	for _, count := range counts {
+		byType[count.Type] = count.Count
+	}
+
+	// The median is not portable across the dialects, so it is computed here
+	var durations []int64
+	if err := s.moderationEventsInRange(filter).
+		Where("type = ? AND duration > 0", model.ModerationEventCaptchaSolved).
+		Pluck("duration", &durations).Error; err != nil {
+		return nil, err
+	}
+
+	return NewCaptchaStats(byType, durations), nil
+}
+
+// SpamDeletions - number of deleted messages per rule.
+func (s *Storage) SpamDeletions(filter StatsFilter) ([]RuleCount, error) {
+	result := make([]RuleCount, 0)
+
+	err := s.moderationEventsInRange(filter).
+		Select("rule, COUNT(*) AS count").
+		Where("type = ?", model.ModerationEventMessageDeleted).
+		Group("rule").
+		Order("count DESC, rule").
+		Scan(&result).Error
+
+	return result, err
+}
+
+// InviteLinkStats - joins, captcha outcomes and bans per invite link.
+func (s *Storage) InviteLinkStats(filter StatsFilter) ([]InviteLinkActivity, error) {
+	var joins []struct {
+		InviteLink string
+		ChatID     int64
+		Joins      int64
+	}
+
+	query := s.db.Model(&model.ChatMember{}).
+		Where("invite_link <> '' AND joined_at >= ? AND joined_at < ?", filter.From, filter.To)
+	if filter.ChatID != 0 {
+		query = query.Where("chat_id = ?", filter.ChatID)
+	}
+
+	if err := query.
+		Select("invite_link, chat_id, COUNT(*) AS joins").
+		Group("invite_link, chat_id").
+		Scan(&joins).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		InviteLink string
+		ChatID     int64
+		Type       model.ModerationEventType
+		Count      int64
+	}
+
+	query = s.db.Model(&model.ModerationEvent{}).
+		Joins("JOIN chat_members ON chat_members.chat_id = moderation_events.chat_id AND chat_members.user_id = moderation_events.user_id").
+		Where("chat_members.invite_link <> ''").
+		Where("moderation_events.unixtime >= ? AND moderation_events.unixtime < ?", filter.From.Unix(), filter.To.Unix()).
+		Where("moderation_events.type IN ?", inviteLinkEventTypes())
+	if filter.ChatID != 0 {
+		query = query.Where("moderation_events.chat_id = ?", filter.ChatID)
+	}
+
+	if err := query.
+		Select("chat_members.invite_link AS invite_link, moderation_events.chat_id AS chat_id, moderation_events.type AS type, COUNT(*) AS count").
+		Group("chat_members.invite_link, moderation_events.chat_id, moderation_events.type").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	builder := NewInviteLinkStatsBuilder()
+	for _, row := range joins {
+		builder.AddJoins(row.InviteLink, row.ChatID, row.Joins)
+	}
+
+	for _, row := range counts {
+		builder.AddEvents(row.InviteLink, row.ChatID, row.Type, row.Count)
+	}
+
+	var links []model.InviteLink
+	if err := s.db.Where("link IN ?", builder.Links()).Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	return builder.Build(links), nil
+}
+
+// inviteLinkEventTypes - types of the moderation events counted per invite link.
+func inviteLinkEventTypes() []model.ModerationEventType {
+	return []model.ModerationEventType{
+		model.ModerationEventCaptchaSent,
+		model.ModerationEventCaptchaSolved,
+		model.ModerationEventCaptchaFailed,
+		model.ModerationEventCaptchaExpired,
+		model.ModerationEventBan,
+	}
+}
+
+// InviteLinkStatsBuilder - collects the joins and the moderation events per invite link.
+type InviteLinkStatsBuilder struct {
+	activity map[string]*InviteLinkActivity
+}
+
+// NewInviteLinkStatsBuilder - create the empty builder of the invite link statistics.
+func NewInviteLinkStatsBuilder() *InviteLinkStatsBuilder {
+	return &InviteLinkStatsBuilder{activity: make(map[string]*InviteLinkActivity)}
+}
+
+// get - get or create the activity of the link.
+func (b *InviteLinkStatsBuilder) get(link string, chatID int64) *InviteLinkActivity {
+	activity, ok := b.activity[link]
+	if !ok {
+		activity = &InviteLinkActivity{InviteLink: link, ChatID: chatID}
+		b.activity[link] = activity
+	}
+
+	return activity
+}
+
+// AddJoins - add the joins by the link.
+func (b *InviteLinkStatsBuilder) AddJoins(link string, chatID int64, joins int64) {
+	b.get(link, chatID).Joins += joins
+}
+
+// AddEvents - add the moderation events of the users joined by the link.
+func (b *InviteLinkStatsBuilder) AddEvents(link string, chatID int64, eventType model.ModerationEventType, count int64) {
+	if !slices.Contains(inviteLinkEventTypes(), eventType) {
+		return
+	}
+
+	activity := b.get(link, chatID)
+
+	switch eventType { //nolint:exhaustive
+	case model.ModerationEventCaptchaSent:
+		activity.CaptchaSent += count
+	case model.ModerationEventCaptchaSolved:
+		activity.CaptchaSolved += count
+	case model.ModerationEventCaptchaFailed:
+		activity.CaptchaFailed += count
+	case model.ModerationEventCaptchaExpired:
+		activity.CaptchaExpired += count
+	case model.ModerationEventBan:
+		activity.Bans += count
+	}
+}
+
+// Links - the collected invite links.
+func (b *InviteLinkStatsBuilder) Links() []string {
+	links := make([]string, 0, len(b.activity))
+	for link := range b.activity {
+		links = append(links, link)
+	}
+
+	sort.Strings(links)
+
+	return links
+}
+
+// Build - the statistics with the names of the known links and the rates, the most joins first.
+func (b *InviteLinkStatsBuilder) Build(links []model.InviteLink) []InviteLinkActivity {
+	names := make(map[string]string, len(links))
+	for _, link := range links {
+		names[link.Link] = link.Name
+	}
+
+	result := make([]InviteLinkActivity, 0, len(b.activity))
+
+	for _, activity := range b.activity {
+		activity.Name = names[activity.InviteLink]
+
+		if activity.CaptchaSent > 0 {
+			unsolved := activity.CaptchaSent - activity.CaptchaSolved
+			activity.FailureRate = float64(max(unsolved, 0)) / float64(activity.CaptchaSent)
+		}
+
+		if activity.Joins > 0 {
+			activity.BanRate = float64(activity.Bans) / float64(activity.Joins)
+		}
+
+		result = append(result, *activity)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Joins != result[j].Joins {
+			return result[i].Joins > result[j].Joins
+		}
+
+		return result[i].InviteLink < result[j].InviteLink
+	})
+
+	return result
+}
+
+// NewCaptchaStats - captcha statistics from the number of events by type
+// and the solve durations in milliseconds.
+func NewCaptchaStats(counts map[model.ModerationEventType]int64, durations []int64) *CaptchaStats {
+	stats := &CaptchaStats{
+		Sent:    counts[model.ModerationEventCaptchaSent],
+		Solved:  counts[model.ModerationEventCaptchaSolved],
+		Failed:  counts[model.ModerationEventCaptchaFailed],
+		Expired: counts[model.ModerationEventCaptchaExpired],
+	}
+
+	if stats.Sent > 0 {
+		stats.SolveRate = float64(stats.Solved) / float64(stats.Sent)
+	}
+
+	stats.MedianSolveSeconds = median(durations) / float64(time.Second/time.Millisecond)
+
+	return stats
+}
+
+// median - median of the values, zero if there are no values.
+func median(values []int64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	middle := len(values) / 2 //nolint:mnd
+	if len(values)%2 == 0 {
+		return float64(values[middle-1]+values[middle]) / 2 //nolint:mnd
+	}
+
+	return float64(values[middle])
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+
+	global.Config = &config.Config{Database: config.DatabaseConfig{Driver: "sqlite", Connection: ":memory:", AutoMigrate: true}}
+	global.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	global.Metrics = metrics.NewMetricsFake()
+
+	db, err := New()
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestStats(t *testing.T) {
+	db := newTestStorage(t)
+
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	filter := StatsFilter{From: day, To: day.Add(48 * time.Hour), Bucket: 24 * time.Hour}
+
+	require.NoError(t, db.UpsertUsers(db.db, &model.User{ID: 1, Username: "fox"}, &model.User{ID: 2, Username: "cat"}))
+
+	for i, message := range []struct {
+		sender model.UserID
+		chat   model.ChatID
+		offset time.Duration
+	}{
+		{1, -100, time.Hour},
+		{1, -100, 2 * time.Hour},
+		{2, -100, 25 * time.Hour},
+		{1, -200, 26 * time.Hour},
+	} {
+		require.NoError(t, db.db.Create(&model.Message{
+			ID:       model.MessageID(i + 1),
+			SenderID: message.sender,
+			ChatID:   message.chat,
+			Unixtime: day.Add(message.offset).Unix(),
+		}).Error)
+	}
+
+	event := func(eventType model.ModerationEventType, rule string, offset time.Duration, duration time.Duration) *model.ModerationEvent {
+		event := model.NewModerationEvent(eventType, -100, 1, rule).WithDuration(duration)
+		event.Unixtime = day.Add(offset).Unix()
+
+		return event
+	}
+
+	require.NoError(t, db.RecordModerationEvent(
+		event(model.ModerationEventJoin, "", time.Hour, 0),
+		event(model.ModerationEventJoin, "", 25*time.Hour, 0),
+		event(model.ModerationEventBan, "local_db", 25*time.Hour, 0),
+		event(model.ModerationEventCaptchaSent, "", time.Hour, 0),
+		event(model.ModerationEventCaptchaSent, "", time.Hour, 0),
+		event(model.ModerationEventCaptchaSent, "", time.Hour, 0),
+		event(model.ModerationEventCaptchaSolved, "", time.Hour, 10*time.Second),
+		event(model.ModerationEventCaptchaSolved, "", time.Hour, 20*time.Second),
+		event(model.ModerationEventMessageDeleted, "unverified", time.Hour, 0),
+		event(model.ModerationEventMessageDeleted, "unverified", time.Hour, 0),
+		event(model.ModerationEventMessageDeleted, "local_db", time.Hour, 0),
+		event(model.ModerationEventJoin, "", 72*time.Hour, 0), // Out of the range
+	))
+
+	t.Run("Messages per chat", func(t *testing.T) {
+		activity, err := db.MessagesPerChat(filter)
+		require.NoError(t, err)
+		require.Equal(t, []ChatActivity{
+			{ChatID: -100, Bucket: day.Unix(), Messages: 2},
+			{ChatID: -200, Bucket: day.Add(24 * time.Hour).Unix(), Messages: 1},
+			{ChatID: -100, Bucket: day.Add(24 * time.Hour).Unix(), Messages: 1},
+		}, activity)
+	})
+
+	t.Run("Top users", func(t *testing.T) {
+		users, err := db.TopUsers(StatsFilter{From: filter.From, To: filter.To, Limit: 1})
+		require.NoError(t, err)
+		require.Equal(t, []UserActivity{{UserID: 1, Username: "fox", Messages: 3}}, users)
+	})
+
+	t.Run("Moderation timeline", func(t *testing.T) {
+		timeline, err := db.ModerationTimeline(filter)
+		require.NoError(t, err)
+		require.Equal(t, []ModerationActivity{
+			{Bucket: day.Unix(), Type: model.ModerationEventJoin, Count: 1},
+			{Bucket: day.Add(24 * time.Hour).Unix(), Type: model.ModerationEventBan, Count: 1},
+			{Bucket: day.Add(24 * time.Hour).Unix(), Type: model.ModerationEventJoin, Count: 1},
+		}, timeline)
+	})
+
+	t.Run("Captcha", func(t *testing.T) {
+		stats, err := db.CaptchaStats(filter)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), stats.Sent)
+		require.Equal(t, int64(2), stats.Solved)
+		require.InDelta(t, 2.0/3.0, stats.SolveRate, 0.001)
+		require.InDelta(t, 15.0, stats.MedianSolveSeconds, 0.001)
+	})
+
+	t.Run("Spam deletions", func(t *testing.T) {
+		rules, err := db.SpamDeletions(filter)
+		require.NoError(t, err)
+		require.Equal(t, []RuleCount{{Rule: "unverified", Count: 2}, {Rule: "local_db", Count: 1}}, rules)
+	})
+
+	t.Run("Invite links", func(t *testing.T) {
+		for _, member := range []struct {
+			user   model.UserID
+			link   string
+			offset time.Duration
+		}{
+			{1, "https://t.me/+a", time.Hour},
+			{2, "https://t.me/+b", 2 * time.Hour},
+			{3, "", 3 * time.Hour}, // Joined without the link
+		} {
+			chatMember := model.NewChatMember(-100, int64(member.user))
+			chatMember.Apply("member", true, day.Add(member.offset))
+			chatMember.InviteLink = member.link
+			require.NoError(t, db.UpsertChatMember(chatMember))
+		}
+
+		require.NoError(t, db.UpsertInviteLink(&model.InviteLink{Link: "https://t.me/+a", ChatID: -100, Name: "spring"}))
+
+		links, err := db.InviteLinkStats(filter)
+		require.NoError(t, err)
+		require.Len(t, links, 2)
+		require.Equal(t, "spring", links[0].Name)
+		require.Equal(t, int64(1), links[0].Joins)
+		require.Equal(t, int64(3), links[0].CaptchaSent)
+		require.Equal(t, int64(1), links[0].Bans)
+		require.InDelta(t, 1.0/3.0, links[0].FailureRate, 0.001)
+		require.InDelta(t, 1.0, links[0].BanRate, 0.001)
+		require.Equal(t, InviteLinkActivity{InviteLink: "https://t.me/+b", ChatID: -100, Joins: 1}, links[1])
+	})
+}
@@ -11,11 +11,13 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/dgraph-io/ristretto"
 	"github.com/plugfox/foxy-gram-server/internal/global"
 	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage/migrations"
 	storage_logger "github.com/plugfox/foxy-gram-server/internal/storage/storagelogger"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -30,7 +32,50 @@ type Storage struct {
 	db    *gorm.DB
 }
 
+// New - open the database connection and apply the pending migrations, if enabled.
 func New() (*Storage, error) {
+	s, err := Open()
+	if err != nil {
+		return nil, err
+	}
+
+	// Migrations
+	const timeoutSeconds = 15 * 60
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutSeconds*time.Second)
+
+	defer cancel() // releases resources if slowOperation completes before timeout elapses
+
+	migrator, err := s.Migrator()
+	if err != nil {
+		return nil, err
+	}
+
+	if global.Config.Database.AutoMigrate {
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, migration := range applied {
+			global.Logger.InfoContext(ctx, "database migration applied",
+				slog.Int64("version", migration.Version), slog.String("name", migration.Name))
+		}
+	} else if pending, err := migrator.Pending(ctx); err != nil {
+		return nil, err
+	} else if pending > 0 {
+		global.Logger.WarnContext(ctx, "database schema is outdated, run the migrate up command", slog.Int("pending", pending))
+	}
+
+	// var result int
+	// db.Raw("SELECT 1").Scan(&result)
+	// logger.Debug("Result of the SELECT 1 query", slog.Int("result", result))
+	// logger.Debug("Database connection established")
+
+	return s, nil
+}
+
+// Open - open the database connection without the migrations.
+func Open() (*Storage, error) {
 	// Cache
 	const (
 		numCounters = 1e7     // number of keys to track frequency of (10M).
@@ -68,7 +113,9 @@ func New() (*Storage, error) {
 	}
 
 	// Log SQL queries if enabled
-	dbLogger := storage_logger.NewGormSlogLogger(global.Logger)
+	dbLogger := storage_logger.NewGormSlogLogger(global.Logger).
+		WithMetrics(global.Metrics).
+		WithQueryValues(global.Config.Database.QueryValues)
 	if global.Config.Database.Logging {
 		dbLogger.LogMode(logger.Info)
 	} else {
@@ -86,37 +133,26 @@ func New() (*Storage, error) {
 		return nil, err
 	}
 
-	// Migrations
-	const timeoutSeconds = 15 * 60
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutSeconds*time.Second)
-
-	defer cancel() // releases resources if slowOperation completes before timeout elapses
-
-	if err := db.WithContext(ctx).AutoMigrate(
-		&model.KeyValue{},
-		&model.User{},
-		&model.VerifiedUser{},
-		&model.BannedUser{},
-		&model.Chat{},
-		&model.MessageOrigin{},
-		&model.Message{},
-		&model.ReplyMarkup{},
-		&model.Captcha{},
-	); err != nil {
-		return nil, err
-	}
-
-	// var result int
-	// db.Raw("SELECT 1").Scan(&result)
-	// logger.Debug("Result of the SELECT 1 query", slog.Int("result", result))
-	// logger.Debug("Database connection established")
-
 	return &Storage{
 		cache: cache,
 		db:    db,
 	}, nil
 }
 
+// Migrator - get the versioned migrations of the database.
+func (s *Storage) Migrator() (*migrations.Migrator, error) {
+	return migrations.New(s.db)
+}
+
+// WithContext - get the storage bound to the context,
+// so the queries are traced as children of the span from the context.
+func (s *Storage) WithContext(ctx context.Context) Repository {
+	return &Storage{
+		cache: s.cache,
+		db:    s.db.WithContext(ctx),
+	}
+}
+
 // Status - get the status of the database connection.
 func (s *Storage) Status() (string, error) {
 	var result int
@@ -201,14 +237,43 @@ func (s *Storage) Users() ([]model.User, error) {
 	return users, nil
 }
 
+// MessageByID - get the message of the chat by ID.
+func (s *Storage) MessageByID(chatID model.ChatID, id model.MessageID) (*model.Message, error) {
+	var message model.Message
+	if err := s.db.Where("id = ? AND chat_id = ?", id, chatID).First(&message).Error; err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// MessageRevisions - get every version of the message from the oldest to the current one.
+// The current version is the last one, without an ID.
+func (s *Storage) MessageRevisions(chatID model.ChatID, id model.MessageID) ([]model.MessageRevision, error) {
+	message, err := s.MessageByID(chatID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []model.MessageRevision
+	if err := s.db.Where("message_id = ? AND chat_id = ?", id, chatID).Order("id").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+
+	return append(revisions, *model.NewMessageRevision(message)), nil
+}
+
 // Struct for the UpsertMessage function.
 type UpsertMessageInput struct {
-	Message *model.Message
-	Chats   []*model.Chat
-	Users   []*model.User
+	Message     *model.Message
+	Origin      *model.MessageOrigin // Optional. Origin of the forwarded message.
+	ReplyMarkup *model.ReplyMarkup   // Optional. Inline keyboard of the message.
+	Chats       []*model.Chat
+	Users       []*model.User
 }
 
-// UpsertMessage - insert or update the message, and the users if any.
+// UpsertMessage - insert or update the message with its origin and reply markup, and the chats and users if any.
+// The previous version of the edited message is kept as a revision.
 func (s *Storage) UpsertMessage(input UpsertMessageInput) error {
 	if (input.Message == nil) || (input.Message.ID == 0) {
 		return nil
@@ -225,11 +290,51 @@ func (s *Storage) UpsertMessage(input UpsertMessageInput) error {
 			return err
 		}
 
+		// Keep the previous version, if the content of the message is edited
+		var previous model.Message
+
+		err := tx.Unscoped().Where("id = ? AND chat_id = ?", input.Message.ID, input.Message.ChatID).Limit(1).Find(&previous).Error
+		if err != nil {
+			return err
+		}
+
+		if previous.ID != 0 && previous.ContentChanged(input.Message) {
+			if err := tx.Create(model.NewMessageRevision(&previous)).Error; err != nil {
+				return err
+			}
+		}
+
 		// Save the message
 		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Save(input.Message).Error; err != nil {
 			return err
 		}
 
+		// Replace the origin and the reply markup, the edited message may have changed them.
+		// The message IDs are unique only within the chat.
+		if err := tx.Delete(&model.MessageOrigin{}, "chat_id = ? AND message_id = ?", input.Message.ChatID, input.Message.ID).Error; err != nil {
+			return err
+		}
+
+		if input.Origin != nil {
+			input.Origin.ChatID = input.Message.ChatID
+			input.Origin.MessageID = input.Message.ID
+			if err := tx.Create(input.Origin).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Delete(&model.ReplyMarkup{}, "chat_id = ? AND message_id = ?", input.Message.ChatID, input.Message.ID).Error; err != nil {
+			return err
+		}
+
+		if input.ReplyMarkup != nil {
+			input.ReplyMarkup.ChatID = input.Message.ChatID
+			input.ReplyMarkup.MessageID = input.Message.ID
+			if err := tx.Create(input.ReplyMarkup).Error; err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 }
@@ -352,23 +457,20 @@ func (s *Storage) KVSet(key string, value interface{}) error {
 		return err
 	}
 
-	bytes := buffer.Bytes()
-
-	// Save to cache
-	s.cache.Set(fmt.Sprintf("_kv#%s", key), bytes, int64(len(bytes)))
-
 	// Save to the database
 	kv := &model.KeyValue{
 		Key:   key,
-		Value: bytes,
+		Value: buffer.Bytes(),
 	}
 
 	if err := s.db.Clauses(clause.OnConflict{UpdateAll: true}).Save(kv).Error; err != nil {
-		s.cache.Del(fmt.Sprintf("_kv#%s", key))
-
 		return err
 	}
 
+	// Invalidate the cache, the sets of the cache are asynchronous and may be dropped,
+	// so the next read loads the value from the database instead of a stale one
+	s.cache.Del(fmt.Sprintf("_kv#%s", key))
+
 	return nil
 }
 
@@ -440,7 +542,7 @@ func (s *Storage) IsVerifiedUser(userID model.UserID) (bool, error) {
 	return exists, nil
 }
 
-// Check if the user is banned and delete expired bans.
+// Check if the user is banned, the expired bans are removed by the sweeper.
 func (s *Storage) IsBannedUser(userID model.UserID) (bool, error) {
 	var bannedUser model.BannedUser
 	err := s.db.Model(&model.BannedUser{}).
@@ -453,18 +555,8 @@ func (s *Storage) IsBannedUser(userID model.UserID) (bool, error) {
 		return false, err // Return error for other issues
 	}
 
-	// Check if the ban has expired
-	if bannedUser.ExpiresAt.Valid && bannedUser.ExpiresAt.Time.Before(time.Now()) {
-		// If the ban has expired, delete the record
-		if err := s.db.Delete(&bannedUser).Error; err != nil {
-			return false, err
-		}
-
-		return false, nil // User is not banned anymore
-	}
-
-	// User is banned and the ban is still valid
-	return true, nil
+	// The expired ban is kept until the user is unbanned in Telegram
+	return !bannedUser.IsExpired(time.Now()), nil
 }
 
 // Set the user as verified.
@@ -527,6 +619,23 @@ func (s *Storage) VerifyUsers(reason string, userIDs []int) error {
 	return nil
 }
 
+// UnverifyUser - remove the verification of the user, so the user is verified again.
+func (s *Storage) UnverifyUser(userID model.UserID) error {
+	s.cacheDel(fmt.Sprintf("_verified#%s", userID.ToString()))
+
+	return s.db.Delete(&model.VerifiedUser{}, "id = ?", userID).Error
+}
+
+// VerifiedUsers - get the verified users ordered by ID.
+func (s *Storage) VerifiedUsers() ([]model.VerifiedUser, error) {
+	var users []model.VerifiedUser
+	if err := s.db.Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 // Ban the user.
 func (s *Storage) BanUser(bannedUser *model.BannedUser) error {
 	if err := s.db.Transaction(func(tx *gorm.DB) error {
@@ -548,6 +657,21 @@ func (s *Storage) BanUser(bannedUser *model.BannedUser) error {
 	return nil
 }
 
+// UnbanUser - remove the user from the banned list.
+func (s *Storage) UnbanUser(userID model.UserID) error {
+	return s.db.Delete(&model.BannedUser{}, "id = ?", userID).Error
+}
+
+// BannedUsers - get the banned users ordered by ID, including the expired bans not removed yet.
+func (s *Storage) BannedUsers() ([]model.BannedUser, error) {
+	var users []model.BannedUser
+	if err := s.db.Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 // Get the outdated captchas.
 func (s *Storage) GetOutdatedCaptchas() []model.Captcha {
 	var captchas []model.Captcha
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertMessageKeepsOtherChats(t *testing.T) {
+	db := newTestStorage(t)
+	now := time.Now().Unix()
+
+	// The message IDs are unique only within the chat
+	require.NoError(t, db.UpsertMessage(UpsertMessageInput{
+		Message:     &model.Message{ID: 1, ChatID: -100, SenderID: 1, Text: "Forwarded", Unixtime: now},
+		Origin:      &model.MessageOrigin{Type: "hidden_user", SenderName: "Fox"},
+		ReplyMarkup: &model.ReplyMarkup{Data: `[[{"text":"Fox"}]]`},
+	}))
+	require.NoError(t, db.UpsertMessage(UpsertMessageInput{
+		Message:     &model.Message{ID: 1, ChatID: -200, SenderID: 2, Text: "Forwarded", Unixtime: now},
+		Origin:      &model.MessageOrigin{Type: "hidden_user", SenderName: "Cat"},
+		ReplyMarkup: &model.ReplyMarkup{Data: `[[{"text":"Cat"}]]`},
+	}))
+
+	// The edit without the origin and the keyboard removes them in its own chat only
+	require.NoError(t, db.UpsertMessage(UpsertMessageInput{
+		Message: &model.Message{ID: 1, ChatID: -200, SenderID: 2, Text: "Edited", Unixtime: now},
+	}))
+
+	var origins []model.MessageOrigin
+	require.NoError(t, db.db.Find(&origins).Error)
+	require.Len(t, origins, 1)
+	require.Equal(t, model.ChatID(-100), origins[0].ChatID)
+	require.Equal(t, "Fox", origins[0].SenderName)
+
+	var markups []model.ReplyMarkup
+	require.NoError(t, db.db.Find(&markups).Error)
+	require.Len(t, markups, 1)
+	require.Equal(t, model.ChatID(-100), markups[0].ChatID)
+}
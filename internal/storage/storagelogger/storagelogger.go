@@ -2,16 +2,25 @@ package storagelogger
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
+	"github.com/plugfox/foxy-gram-server/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 // GormSlogLogger is a custom GORM logger that uses slog.Logger for logging.
 type GormSlogLogger struct {
-	logger *slog.Logger
-	level  logger.LogLevel
+	logger  *slog.Logger
+	level   logger.LogLevel
+	metrics metrics.Metrics
+	values  bool // Queries are logged and traced with the bound values
 }
 
 // NewGormSlogLogger creates a new GormSlogLogger instance.
@@ -21,6 +30,30 @@ func NewGormSlogLogger(slog *slog.Logger) *GormSlogLogger {
 	}
 }
 
+// WithMetrics reports the execution time of every query to the metrics.
+func (l *GormSlogLogger) WithMetrics(m metrics.Metrics) *GormSlogLogger {
+	l.metrics = m
+
+	return l
+}
+
+// WithQueryValues logs and traces the queries with the bound values instead of the placeholders.
+// The values are the personal data, like the text of the messages and the usernames.
+func (l *GormSlogLogger) WithQueryValues(values bool) *GormSlogLogger {
+	l.values = values
+
+	return l
+}
+
+// ParamsFilter drops the bound values of the query, unless they are enabled, so only the placeholders are recorded.
+func (l *GormSlogLogger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.values {
+		return sql, params
+	}
+
+	return sql, nil
+}
+
 // LogMode sets the log level for GORM logger.
 func (l *GormSlogLogger) LogMode(level logger.LogLevel) logger.Interface {
 	l.level = level
@@ -50,19 +83,42 @@ func (l *GormSlogLogger) Error(ctx context.Context, msg string, data ...interfac
 }
 
 // Trace logs SQL queries with their execution time, affected rows, and errors.
+// Every query is also recorded as a child span of the span from the context, if any.
+// The bound values are replaced with the placeholders by ParamsFilter, unless they are enabled.
 func (l *GormSlogLogger) Trace(
 	ctx context.Context,
 	begin time.Time,
 	fc func() (sql string, rowsAffected int64),
 	err error,
 ) {
+	elapsed := time.Since(begin)
+	sql, rows := fc()
+
+	// The query is already executed, so the span starts at the query begin time
+	_, span := tracing.Tracer().Start(ctx, "SQL "+operation(sql),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(begin),
+		trace.WithAttributes(
+			attribute.String("db.query.text", sql),
+			attribute.Int64("db.rows_affected", rows),
+		),
+	)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		span.End() // Not found is an expected result, not an error
+	} else {
+		tracing.End(span, err)
+	}
+
+	if l.metrics != nil {
+		l.metrics.ObserveDuration(metrics.DurationDBQuery, elapsed, map[string]string{
+			"operation": operation(sql),
+		})
+	}
+
 	if l.level <= logger.Silent {
 		return
 	}
 
-	elapsed := time.Since(begin)
-	sql, rows := fc()
-
 	if err != nil {
 		l.logger.ErrorContext(ctx, "SQL execution error",
 			slog.String("sql", sql),
@@ -78,3 +134,13 @@ func (l *GormSlogLogger) Trace(
 		)
 	}
 }
+
+// operation returns the lowercase SQL statement type, e.g. "select" or "insert".
+func operation(sql string) string {
+	sql = strings.TrimSpace(sql)
+	if i := strings.IndexAny(sql, " \t\n("); i > 0 {
+		sql = sql[:i]
+	}
+
+	return strings.ToLower(sql)
+}
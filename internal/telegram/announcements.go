@@ -0,0 +1,342 @@
+package telegram
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/scheduler"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	announcementBatchSize   = 20 // Announcements posted per run
+	announcementTimeLayout  = "2006-01-02 15:04"
+	announcementPreviewSize = 40
+)
+
+var (
+	errorAnnounceUsage = errors.New("usage: /announce <when> [pin], the text on the next lines or reply /announce to the message\n" +
+		"when: a delay like 2h, a time like 2030-01-31 18:00, or a schedule like @weekly or 0 10 * * 1")
+	errorAnnounceCancelUsage  = errors.New("usage: /announce_cancel <id>")
+	errorAnnouncementNotFound = errors.New("announcement not found")
+	errorAnnouncementInPast   = errors.New("the time of the announcement is in the past")
+)
+
+// parseAnnouncementWhen - parse when the announcement is posted: a delay like 2h or a time like 2030-01-31 18:00
+// for the one-off announcement, or a schedule like @weekly or 0 10 * * 1 for the recurring one.
+// The schedule is empty for the one-off announcement.
+func parseAnnouncementWhen(when string, now time.Time) (string, time.Time, error) {
+	if delay, err := time.ParseDuration(when); err == nil {
+		if delay <= 0 {
+			return "", time.Time{}, errorAnnouncementInPast
+		}
+
+		return "", now.Add(delay), nil
+	}
+
+	for _, layout := range []string{announcementTimeLayout, time.RFC3339} {
+		if at, err := time.ParseInLocation(layout, when, time.Local); err == nil {
+			if !at.After(now) {
+				return "", time.Time{}, errorAnnouncementInPast
+			}
+
+			return "", at, nil
+		}
+	}
+
+	schedule, err := scheduler.Parse(when)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return schedule.String(), schedule.Next(now), nil
+}
+
+// SendAnnouncements - post the due announcements, pin them if requested and schedule the next posts.
+// The posts have the low priority in the queue keeping the rate limits of Telegram,
+// after the flood error the rest is posted on the next run.
+func (t *Telegram) SendAnnouncements(ctx context.Context) (int, error) {
+	db := t.db.WithContext(ctx)
+
+	due, err := db.DueAnnouncements(time.Now(), announcementBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+
+	for i := range due {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		announcement := &due[i]
+
+		err := t.postAnnouncement(ctx, announcement)
+
+		var flood tele.FloodError
+		if errors.As(err, &flood) {
+			return sent, fmt.Errorf("announcement %d: %w, retry after %ds", announcement.ID, err, flood.RetryAfter)
+		}
+
+		now := time.Now()
+
+		switch {
+		case err == nil:
+			sent++
+		case isPermanentError(err):
+			// The chat is not found or the bot has no rights, the post is skipped
+			announcement.LastError = err.Error()
+		default:
+			// The post is retried on the next run
+			announcement.LastError = err.Error()
+			if err := db.UpsertAnnouncement(announcement); err != nil {
+				return sent, err
+			}
+
+			continue
+		}
+
+		announcement.NextRunAt = sql.NullTime{}
+
+		if announcement.IsRecurring() {
+			if schedule, err := scheduler.Parse(announcement.Schedule); err != nil {
+				announcement.LastError = err.Error()
+			} else if next := schedule.Next(now); !next.IsZero() {
+				announcement.NextRunAt = sql.NullTime{Time: next, Valid: true}
+			}
+		}
+
+		if err := db.UpsertAnnouncement(announcement); err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+// postAnnouncement - post the announcement and pin it, unpinning the previous post.
+// The error of the pin is stored as the last error, but the announcement is posted.
+func (t *Telegram) postAnnouncement(ctx context.Context, announcement *model.Announcement) error {
+	chat := &tele.Chat{ID: int64(announcement.ChatID)}
+
+	msg, err := t.announcer.Send(chat, announcementContent(announcement), tele.NoPreview)
+	if err != nil {
+		global.Logger.WarnContext(ctx, "telegram: posting announcement error", slog.String("error", err.Error()),
+			slog.Int64("id", announcement.ID), slog.Int64("chat_id", chat.ID))
+
+		return err
+	}
+
+	previous := announcement.LastMessageID
+
+	announcement.LastError = ""
+	announcement.LastMessageID = int64(msg.ID)
+	announcement.LastSentAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	announcement.Sent++
+
+	global.Metrics.LogChatEvent("announcement", chat.ID, map[string]interface{}{
+		"id":        announcement.ID,
+		"chat_id":   chat.ID,
+		"recurring": announcement.IsRecurring(),
+	})
+
+	if !announcement.Pin {
+		return nil
+	}
+
+	if previous != 0 {
+		if err := t.announcer.Unpin(chat, int(previous)); err != nil {
+			global.Logger.WarnContext(ctx, "telegram: unpinning announcement error", slog.String("error", err.Error()),
+				slog.Int64("id", announcement.ID), slog.Int64("chat_id", chat.ID))
+		}
+	}
+
+	if err := t.announcer.Pin(msg, tele.Silent); err != nil {
+		announcement.LastError = "pin: " + err.Error()
+	}
+
+	return nil
+}
+
+// announcementContent - the text or the media with the caption to send.
+func announcementContent(announcement *model.Announcement) interface{} {
+	file := tele.File{FileID: announcement.Media}
+	if strings.HasPrefix(announcement.Media, "https://") || strings.HasPrefix(announcement.Media, "http://") {
+		file = tele.FromURL(announcement.Media)
+	}
+
+	switch announcement.MediaType {
+	case model.AnnouncementMediaPhoto:
+		return &tele.Photo{File: file, Caption: announcement.Text}
+	case model.AnnouncementMediaVideo:
+		return &tele.Video{File: file, Caption: announcement.Text}
+	case model.AnnouncementMediaAnimation:
+		return &tele.Animation{File: file, Caption: announcement.Text}
+	case model.AnnouncementMediaDocument:
+		return &tele.Document{File: file, Caption: announcement.Text}
+	default:
+		return announcement.Text
+	}
+}
+
+// announcementFromMessage - the text and the media of the message, e.g. replied with the /announce command.
+func announcementFromMessage(announcement *model.Announcement, msg *tele.Message) {
+	switch {
+	case msg.Photo != nil:
+		announcement.MediaType, announcement.Media = model.AnnouncementMediaPhoto, msg.Photo.FileID
+	case msg.Animation != nil:
+		announcement.MediaType, announcement.Media = model.AnnouncementMediaAnimation, msg.Animation.FileID
+	case msg.Video != nil:
+		announcement.MediaType, announcement.Media = model.AnnouncementMediaVideo, msg.Video.FileID
+	case msg.Document != nil:
+		announcement.MediaType, announcement.Media = model.AnnouncementMediaDocument, msg.Document.FileID
+	}
+
+	if announcement.Text == "" {
+		announcement.Text = strings.TrimSpace(msg.Text + msg.Caption)
+	}
+}
+
+// formatAnnouncement - the short description of the announcement for the admins.
+func formatAnnouncement(announcement *model.Announcement) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "#%d", announcement.ID)
+
+	if announcement.IsRecurring() {
+		fmt.Fprintf(&builder, " [%s]", announcement.Schedule)
+	}
+
+	if announcement.IsActive() {
+		fmt.Fprintf(&builder, " next %s", announcement.NextRunAt.Time.Local().Format(announcementTimeLayout))
+	} else {
+		builder.WriteString(" done")
+	}
+
+	if announcement.Pin {
+		builder.WriteString(", pinned")
+	}
+
+	if announcement.MediaType != "" {
+		fmt.Fprintf(&builder, ", %s", announcement.MediaType)
+	}
+
+	preview := []rune(announcement.Text)
+	if len(preview) > announcementPreviewSize {
+		preview = append(preview[:announcementPreviewSize], '…')
+	}
+
+	fmt.Fprintf(&builder, ": %s", string(preview))
+
+	if announcement.LastError != "" {
+		fmt.Fprintf(&builder, " (last error: %s)", announcement.LastError)
+	}
+
+	return builder.String()
+}
+
+// Handle the /announce command of the admins: the first line is when the announcement is posted
+// and whether it is pinned, the text is on the next lines or in the replied message with its media.
+func onAnnounce(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		msg := c.Message()
+		firstLine, text, _ := strings.Cut(msg.Text, "\n")
+
+		args := strings.Fields(firstLine)[1:]
+
+		pin := len(args) > 0 && strings.EqualFold(args[len(args)-1], "pin")
+		if pin {
+			args = args[:len(args)-1]
+		}
+
+		if len(args) == 0 {
+			return c.Reply(errorAnnounceUsage.Error())
+		}
+
+		schedule, next, err := parseAnnouncementWhen(strings.Join(args, " "), time.Now())
+		if err != nil {
+			return c.Reply(err.Error() + "\n\n" + errorAnnounceUsage.Error())
+		}
+
+		announcement := &model.Announcement{
+			ChatID:      model.ChatID(c.Chat().ID),
+			Text:        strings.TrimSpace(text),
+			Pin:         pin,
+			Schedule:    schedule,
+			NextRunAt:   sql.NullTime{Time: next, Valid: true},
+			CreatedByID: model.UserID(c.Sender().ID),
+		}
+
+		if msg.ReplyTo != nil {
+			announcementFromMessage(announcement, msg.ReplyTo)
+		}
+
+		if err := announcement.Validate(); err != nil {
+			return c.Reply(err.Error() + "\n\n" + errorAnnounceUsage.Error())
+		}
+
+		if err := db.WithContext(updateContext(c)).UpsertAnnouncement(announcement); err != nil {
+			return err
+		}
+
+		return c.Reply("Announcement scheduled " + formatAnnouncement(announcement))
+	}
+}
+
+// Handle the /announcements command of the admins.
+func onAnnouncements(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		announcements, err := db.WithContext(updateContext(c)).Announcements(model.ChatID(c.Chat().ID))
+		if err != nil {
+			return err
+		} else if len(announcements) == 0 {
+			return c.Reply("No announcements")
+		}
+
+		lines := make([]string, 0, len(announcements))
+		for i := range announcements {
+			lines = append(lines, formatAnnouncement(&announcements[i]))
+		}
+
+		return c.Reply(strings.Join(lines, "\n"), tele.NoPreview)
+	}
+}
+
+// Handle the /announce_cancel command of the admins.
+func onAnnounceCancel(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		if len(c.Args()) != 1 {
+			return c.Reply(errorAnnounceCancelUsage.Error())
+		}
+
+		id, err := strconv.ParseInt(strings.TrimPrefix(c.Args()[0], "#"), 10, 64)
+		if err != nil {
+			return c.Reply(errorAnnounceCancelUsage.Error())
+		}
+
+		db := db.WithContext(updateContext(c))
+
+		announcement, err := db.AnnouncementByID(id)
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && int64(announcement.ChatID) != c.Chat().ID) {
+			return c.Reply(errorAnnouncementNotFound.Error())
+		} else if err != nil {
+			return err
+		}
+
+		if err := db.DeleteAnnouncement(id); err != nil {
+			return err
+		}
+
+		return c.Reply(fmt.Sprintf("Announcement #%d cancelled", id))
+	}
+}
@@ -0,0 +1,43 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAnnouncementWhen(t *testing.T) {
+	now := time.Date(2030, time.January, 31, 10, 0, 0, 0, time.Local)
+
+	testcases := []struct {
+		Name     string
+		When     string
+		Schedule string
+		Next     time.Time
+		Invalid  bool
+	}{
+		{Name: "Delay", When: "90m", Next: now.Add(90 * time.Minute)},
+		{Name: "Time", When: "2030-01-31 18:00", Next: time.Date(2030, time.January, 31, 18, 0, 0, 0, time.Local)},
+		{Name: "Cron", When: "0 10 * * 1", Schedule: "0 10 * * 1", Next: time.Date(2030, time.February, 4, 10, 0, 0, 0, time.Local)},
+		{Name: "Descriptor", When: "@daily", Schedule: "@daily", Next: time.Date(2030, time.February, 1, 0, 0, 0, 0, time.Local)},
+		{Name: "Past time", When: "2030-01-31 09:00", Invalid: true},
+		{Name: "Negative delay", When: "-1h", Invalid: true},
+		{Name: "Garbage", When: "tomorrow", Invalid: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			schedule, next, err := parseAnnouncementWhen(tc.When, now)
+			if tc.Invalid {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.Schedule, schedule)
+			require.True(t, tc.Next.Equal(next), "expected %s, got %s", tc.Next, next)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+const banSweepBatchSize = 100 // Bans and chats processed per sweep
+
+// BanSweepResult - result of the sweep of the bans.
+type BanSweepResult struct {
+	Expired  int // Removed expired bans
+	Unbanned int // Chats where the users are unbanned
+	Failed   int // Chats to retry on the next sweep
+}
+
+// SweepBans unbans the users in the chats, where their bans expired or were lifted,
+// e.g. unbanned by an admin or revoked with the source, and removes the expired bans.
+func (t *Telegram) SweepBans(ctx context.Context) (BanSweepResult, error) {
+	var result BanSweepResult
+
+	db := t.db.WithContext(ctx)
+
+	// The lifted bans first, the chats failed below are retried on the next sweep
+	lifted, err := db.LiftedBanChats(banSweepBatchSize)
+	if err != nil {
+		return result, err
+	}
+
+	for _, chat := range lifted {
+		t.unbanChat(ctx, db, chat, "ban_lifted", &result)
+	}
+
+	expired, err := db.ExpiredBans(time.Now(), banSweepBatchSize)
+	if err != nil {
+		return result, err
+	}
+
+	for _, ban := range expired {
+		chats, err := db.BanChats(ban.ID)
+		if err != nil {
+			return result, err
+		}
+
+		for _, chat := range chats {
+			t.unbanChat(ctx, db, chat, "ban_expired", &result)
+		}
+
+		if err := db.UnbanUser(ban.ID); err != nil {
+			return result, err
+		}
+
+		result.Expired++
+	}
+
+	return result, nil
+}
+
+// unbanChat unbans the user in the chat and records the unban.
+// The chat is forgotten, unless the error may be temporary.
+func (t *Telegram) unbanChat(ctx context.Context, db storage.Repository, chat model.BanChat, rule string, result *BanSweepResult) {
+	err := t.bot.Unban(&tele.Chat{ID: int64(chat.ChatID)}, &tele.User{ID: int64(chat.UserID)}, true)
+	if err != nil {
+		global.Logger.WarnContext(ctx, "telegram: unban error", slog.String("error", err.Error()),
+			slog.Int64("chat_id", int64(chat.ChatID)), slog.Int64("user_id", int64(chat.UserID)))
+
+		// The bot is removed from the chat or has no rights, there is nothing to retry
+		if !isPermanentError(err) {
+			result.Failed++
+
+			return
+		}
+	} else {
+		result.Unbanned++
+
+		recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventUnban, int64(chat.ChatID), int64(chat.UserID), rule), func(err error) {
+			global.Logger.ErrorContext(ctx, "database: recording unban error", slog.String("error", err.Error()))
+		})
+
+		global.Metrics.LogChatEvent("unban", int64(chat.ChatID), map[string]interface{}{
+			"chat_id": chat.ChatID,
+			"user_id": chat.UserID,
+			"rule":    rule,
+		})
+	}
+
+	if err := db.DeleteBanChat(chat.UserID, chat.ChatID); err != nil {
+		global.Logger.ErrorContext(ctx, "database: deleting ban chat error", slog.String("error", err.Error()))
+	}
+}
+
+// isPermanentError - whether the error of the Bot API is not temporary and the request should not be retried,
+// e.g. the chat is not found or the bot has no rights.
+func isPermanentError(err error) bool {
+	var apiErr *tele.Error
+
+	return errors.As(err, &apiErr) && (apiErr.Code == http.StatusBadRequest || apiErr.Code == http.StatusForbidden)
+}
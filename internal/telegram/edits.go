@@ -0,0 +1,127 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+const contextKeyRecheck = "recheck" // Context key for the recheck flag, the edit added links and the sender is verified again
+
+// Recheck edits middleware - when an edit adds links to the message,
+// the verification of the sender is run again, as if the sender was never verified.
+func recheckEditsMiddleware(db storage.Repository, onError func(error)) tele.MiddlewareFunc {
+	// Centralized error handling
+	handleError := func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+	}
+
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			edited := c.Update().EditedMessage
+			if edited == nil || edited.Sender == nil || edited.Chat == nil {
+				return next(c) // Not an edit
+			}
+
+			if global.Config.Retention.PolicyFor(edited.Chat.ID).MetadataOnly {
+				return next(c) // The text is not stored, nothing to compare with
+			}
+
+			previous, err := db.WithContext(updateContext(c)).MessageByID(model.ChatID(edited.Chat.ID), model.MessageID(edited.ID))
+			if errors.Is(err, storage.ErrNotFound) {
+				return next(c) // Unknown message, nothing to compare with
+			} else if err != nil {
+				handleError(err)
+
+				return next(c)
+			}
+
+			if addsLinks(previous, edited) {
+				c.Set(contextKeyRecheck, true)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// addsLinks checks if the edited message has links, which the previous version has not.
+// The previous version stored with the metadata only, without the text but with the entities, is never compared.
+func addsLinks(previous *model.Message, edited *tele.Message) bool {
+	if stripped(previous.Text, previous.Entities) || stripped(previous.Caption, previous.CaptionEntities) {
+		return false
+	}
+
+	known := make(map[string]struct{})
+
+	for _, link := range append(
+		links(previous.Text, decodeEntities(previous.Entities)),
+		links(previous.Caption, decodeEntities(previous.CaptionEntities))...,
+	) {
+		known[link] = struct{}{}
+	}
+
+	for _, link := range append(links(edited.Text, edited.Entities), links(edited.Caption, edited.CaptionEntities)...) {
+		if _, ok := known[link]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stripped checks if the text of the stored message was removed, while its entities were kept.
+func stripped(text string, entities string) bool {
+	return text == "" && len(decodeEntities(entities)) > 0
+}
+
+// links returns the URLs and the mentions of the text, in lower case.
+func links(text string, entities tele.Entities) []string {
+	var (
+		result []string
+		units  []uint16
+	)
+
+	for _, entity := range entities {
+		switch entity.Type { //nolint:exhaustive
+		case tele.EntityTextLink:
+			result = append(result, strings.ToLower(entity.URL))
+		case tele.EntityURL, tele.EntityMention:
+			// The offsets are in UTF-16 code units
+			if units == nil {
+				units = utf16.Encode([]rune(text))
+			}
+
+			end := entity.Offset + entity.Length
+			if entity.Offset < 0 || end > len(units) {
+				continue
+			}
+
+			result = append(result, strings.ToLower(string(utf16.Decode(units[entity.Offset:end]))))
+		}
+	}
+
+	return result
+}
+
+// decodeEntities decodes the JSON-encoded entities of the stored message.
+func decodeEntities(data string) tele.Entities {
+	if data == "" {
+		return nil
+	}
+
+	var entities tele.Entities
+	if err := json.Unmarshal([]byte(data), &entities); err != nil {
+		return nil
+	}
+
+	return entities
+}
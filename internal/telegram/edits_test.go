@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestAddsLinks(t *testing.T) {
+	testcases := []struct {
+		Name     string
+		Previous *model.Message
+		Edited   *tele.Message
+		Expected bool
+	}{
+		{
+			Name:     "Typo fixed",
+			Previous: &model.Message{Text: "helo"},
+			Edited:   &tele.Message{Text: "hello"},
+			Expected: false,
+		},
+		{
+			Name:     "Link added",
+			Previous: &model.Message{Text: "hello"},
+			Edited: &tele.Message{Text: "hello t.me/spam", Entities: tele.Entities{
+				{Type: tele.EntityURL, Offset: 6, Length: 9},
+			}},
+			Expected: true,
+		},
+		{
+			Name: "Same link after emoji",
+			Previous: &model.Message{
+				Text:     "🦊 t.me/fox",
+				Entities: `[{"type":"url","offset":3,"length":8}]`,
+			},
+			Edited: &tele.Message{Text: "🦊 T.me/fox!", Entities: tele.Entities{
+				{Type: tele.EntityURL, Offset: 3, Length: 8},
+			}},
+			Expected: false,
+		},
+		{
+			Name:     "Hidden link in the caption",
+			Previous: &model.Message{Caption: "photo"},
+			Edited: &tele.Message{Caption: "photo", CaptionEntities: tele.Entities{
+				{Type: tele.EntityTextLink, Offset: 0, Length: 5, URL: "https://spam.example"},
+			}},
+			Expected: true,
+		},
+		{
+			Name:     "Mention added",
+			Previous: &model.Message{Text: "join"},
+			Edited: &tele.Message{Text: "join @spam", Entities: tele.Entities{
+				{Type: tele.EntityMention, Offset: 5, Length: 5},
+			}},
+			Expected: true,
+		},
+		{
+			Name: "Typo fixed with metadata only",
+			Previous: &model.Message{
+				Entities: `[{"type":"url","offset":6,"length":10}]`,
+			},
+			Edited: &tele.Message{Text: "Visit t.me/foxy, pls", Entities: tele.Entities{
+				{Type: tele.EntityURL, Offset: 6, Length: 10},
+			}},
+			Expected: false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			require.Equal(t, testcase.Expected, addsLinks(testcase.Previous, testcase.Edited))
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/converters"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+var (
+	errorInviteLinkUsage   = errors.New("usage: /invite_create <name> [expire, e.g. 72h] [member limit]")
+	errorInviteRevokeUsage = errors.New("usage: /invite_revoke <link>")
+)
+
+// InviteLinkOptions - options of the new invite link.
+type InviteLinkOptions struct {
+	Name        string    // Name of the link, e.g. the campaign
+	ExpireAt    time.Time // Optional. Time when the link expires
+	MemberLimit int       // Optional. Maximum number of users joining by the link, from 1 to 99999
+}
+
+// createInviteLink - create the invite link of the chat and store it.
+func createInviteLink(bot *tele.Bot, db storage.Repository, chatID int64, options InviteLinkOptions) (*model.InviteLink, error) {
+	request := &tele.ChatInviteLink{
+		Name:        options.Name,
+		MemberLimit: options.MemberLimit,
+	}
+
+	if !options.ExpireAt.IsZero() {
+		request.ExpireUnixtime = options.ExpireAt.Unix()
+	}
+
+	created, err := bot.CreateInviteLink(&tele.Chat{ID: chatID}, request)
+	if err != nil {
+		return nil, err
+	}
+
+	link := converters.InviteLinkFromTG(chatID, created)
+	if err := db.UpsertInviteLink(link); err != nil {
+		return nil, err
+	}
+
+	global.Metrics.LogChatEvent("invite_link_created", chatID, map[string]interface{}{
+		"chat_id": chatID,
+		"name":    link.Name,
+	})
+
+	return link, nil
+}
+
+// revokeInviteLink - revoke the invite link of the chat and store it.
+func revokeInviteLink(bot *tele.Bot, db storage.Repository, chatID int64, inviteLink string) (*model.InviteLink, error) {
+	existing, err := db.InviteLinkByLink(inviteLink)
+	if err == nil && int64(existing.ChatID) != chatID {
+		return nil, model.ErrInviteLinkOtherChat
+	} else if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	revoked, err := bot.RevokeInviteLink(&tele.Chat{ID: chatID}, inviteLink)
+	if err != nil {
+		return nil, err
+	}
+
+	link := converters.InviteLinkFromTG(chatID, revoked)
+	if err := db.UpsertInviteLink(link); err != nil {
+		return nil, err
+	}
+
+	global.Metrics.LogChatEvent("invite_link_revoked", chatID, map[string]interface{}{
+		"chat_id": chatID,
+		"name":    link.Name,
+	})
+
+	return link, nil
+}
+
+// parseInviteLinkOptions - parse the arguments of the /invite_create command.
+func parseInviteLinkOptions(args []string, now time.Time) (InviteLinkOptions, error) {
+	const maxArgs = 3
+
+	if len(args) == 0 || len(args) > maxArgs || strings.TrimSpace(args[0]) == "" {
+		return InviteLinkOptions{}, errorInviteLinkUsage
+	}
+
+	options := InviteLinkOptions{Name: args[0]}
+
+	if len(args) > 1 {
+		expire, err := time.ParseDuration(args[1])
+		if err != nil || expire <= 0 {
+			return InviteLinkOptions{}, errorInviteLinkUsage
+		}
+
+		options.ExpireAt = now.Add(expire)
+	}
+
+	if len(args) > 2 { //nolint:mnd
+		limit, err := strconv.Atoi(args[2])
+		if err != nil || limit < 1 {
+			return InviteLinkOptions{}, errorInviteLinkUsage
+		}
+
+		options.MemberLimit = limit
+	}
+
+	return options, nil
+}
+
+// formatInviteLink - describe the invite link for the admins.
+func formatInviteLink(link *model.InviteLink, now time.Time) string {
+	var builder strings.Builder
+
+	builder.WriteString(link.Link)
+
+	if link.Name != "" {
+		fmt.Fprintf(&builder, " %q", link.Name)
+	}
+
+	switch {
+	case link.IsRevoked:
+		builder.WriteString(" revoked")
+	case !link.Active(now):
+		builder.WriteString(" expired")
+	case link.ExpireAt.Valid:
+		fmt.Fprintf(&builder, " until %s", link.ExpireAt.Time.Format(time.RFC3339))
+	}
+
+	if link.MemberLimit > 0 {
+		fmt.Fprintf(&builder, ", limit %d", link.MemberLimit)
+	}
+
+	return builder.String()
+}
+
+// Handle the /invite_create command of the admins.
+func onInviteCreate(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		options, err := parseInviteLinkOptions(c.Args(), time.Now())
+		if err != nil {
+			return c.Reply(err.Error())
+		}
+
+		link, err := createInviteLink(c.Bot(), db.WithContext(updateContext(c)), c.Chat().ID, options)
+		if err != nil {
+			return err
+		}
+
+		return c.Reply(formatInviteLink(link, time.Now()))
+	}
+}
+
+// Handle the /invite_revoke command of the admins.
+func onInviteRevoke(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		if len(c.Args()) != 1 {
+			return c.Reply(errorInviteRevokeUsage.Error())
+		}
+
+		link, err := revokeInviteLink(c.Bot(), db.WithContext(updateContext(c)), c.Chat().ID, c.Args()[0])
+		if errors.Is(err, model.ErrInviteLinkOtherChat) {
+			return c.Reply(err.Error())
+		} else if err != nil {
+			return err
+		}
+
+		return c.Reply(formatInviteLink(link, time.Now()))
+	}
+}
+
+// Handle the /invite_links command of the admins.
+func onInviteLinks(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		links, err := db.WithContext(updateContext(c)).InviteLinks(model.ChatID(c.Chat().ID))
+		if err != nil {
+			return err
+		} else if len(links) == 0 {
+			return c.Reply("No invite links")
+		}
+
+		now := time.Now()
+		lines := make([]string, 0, len(links))
+
+		for i := range links {
+			lines = append(lines, formatInviteLink(&links[i], now))
+		}
+
+		return c.Reply(strings.Join(lines, "\n"), tele.NoPreview)
+	}
+}
+
+// CreateInviteLink creates the invite link of the chat.
+func (t *Telegram) CreateInviteLink(chatID int64, name string, expireAt time.Time, memberLimit int) (*model.InviteLink, error) {
+	return createInviteLink(t.bot, t.db, chatID, InviteLinkOptions{
+		Name:        name,
+		ExpireAt:    expireAt,
+		MemberLimit: memberLimit,
+	})
+}
+
+// RevokeInviteLink revokes the invite link of the chat.
+func (t *Telegram) RevokeInviteLink(chatID int64, link string) (*model.InviteLink, error) {
+	return revokeInviteLink(t.bot, t.db, chatID, link)
+}
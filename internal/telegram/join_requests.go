@@ -0,0 +1,207 @@
+package telegram
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+// approveJoinRequest - approve the join request of the user and record the event.
+func approveJoinRequest(bot *tele.Bot, db storage.Repository, chatID int64, userID int64, rule string, onError func(error)) error {
+	if err := bot.ApproveJoinRequest(&tele.Chat{ID: chatID}, &tele.User{ID: userID}); err != nil {
+		return err
+	}
+
+	recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventJoinApproved, chatID, userID, rule), onError)
+
+	global.Metrics.LogChatEvent("join_approved", chatID, map[string]interface{}{
+		"chat_id": chatID,
+		"user_id": userID,
+		"rule":    rule,
+	})
+
+	return nil
+}
+
+// declineJoinRequest - decline the join request of the user and record the event.
+func declineJoinRequest(bot *tele.Bot, db storage.Repository, chatID int64, userID int64, rule string, onError func(error)) error {
+	if err := bot.DeclineJoinRequest(&tele.Chat{ID: chatID}, &tele.User{ID: userID}); err != nil {
+		return err
+	}
+
+	recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventJoinDeclined, chatID, userID, rule), onError)
+
+	global.Metrics.LogChatEvent("join_declined", chatID, map[string]interface{}{
+		"chat_id": chatID,
+		"user_id": userID,
+		"rule":    rule,
+	})
+
+	return nil
+}
+
+// approveJoinChats - approve the join requests of the user to every chat of the solved captcha.
+func approveJoinChats(bot *tele.Bot, db storage.Repository, captcha *model.Captcha, rule string, onError func(error)) error {
+	var errs []error
+
+	for _, chatID := range captcha.JoinChats() {
+		if err := approveJoinRequest(bot, db, chatID, captcha.UserID, rule, onError); err != nil {
+			errs = append(errs, fmt.Errorf("join request to the chat %d: %w", chatID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// declineJoinChats - decline the join requests of the user to every chat of the expired or failed captcha.
+func declineJoinChats(bot *tele.Bot, db storage.Repository, captcha *model.Captcha, rule string, onError func(error)) error {
+	var errs []error
+
+	for _, chatID := range captcha.JoinChats() {
+		if err := declineJoinRequest(bot, db, chatID, captcha.UserID, rule, onError); err != nil {
+			errs = append(errs, fmt.Errorf("join request to the chat %d: %w", chatID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Handle the join requests: approve the verified users, decline the banned users
+// and send the captcha to the others in the private chat.
+//
+//nolint:funlen
+func onChatJoinRequest(db storage.Repository, detector *raidDetector, onError func(error)) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		request := c.ChatJoinRequest()
+		if request == nil || request.Chat == nil || request.Sender == nil || !allowedChats(request.Chat.ID) {
+			return nil
+		}
+
+		bot := c.Bot()
+		sender := request.Sender
+		db := db.WithContext(updateContext(c))
+
+		detectRaid(bot, db, detector, request.Chat.ID, 1, onError)
+
+		if !global.Config.Captcha.JoinRequests {
+			return nil // The requests are reviewed by the admins
+		}
+
+		banned, err := isUserLocalBanned(db, sender)
+		if err != nil {
+			return err
+		} else if banned {
+			return declineJoinRequest(bot, db, request.Chat.ID, sender.ID, "local_db", onError)
+		}
+
+		verified, err := db.IsVerifiedUser(model.UserID(sender.ID))
+		if err != nil {
+			return err
+		} else if verified {
+			return approveJoinRequest(bot, db, request.Chat.ID, sender.ID, "verified", onError)
+		}
+
+		captcha, err := db.GetCaptchaForUserID(sender.ID)
+		if err != nil {
+			return err
+		} else if captcha != nil && !captcha.Expired() {
+			// The user already has a captcha, the request is approved or declined together with it
+			if captcha.QueueJoinChat(request.Chat.ID) {
+				return db.UpsertCaptcha(captcha)
+			}
+
+			return nil
+		}
+
+		verdict := profileNormal
+
+		if global.Config.Profile.Enabled {
+			var score profileScore
+
+			score, verdict = assessProfile(bot, db, request.Chat.ID, sender)
+
+			switch verdict {
+			case profileTrusted:
+				if err := trustProfile(db, request.Chat.ID, sender, onError); err != nil {
+					return err
+				}
+
+				return approveJoinRequest(bot, db, request.Chat.ID, sender.ID, "profile", onError)
+			case profileBanned:
+				if err := banProfile(db, request.Chat.ID, sender, score, onError); err != nil {
+					return err
+				}
+
+				return declineJoinRequest(bot, db, request.Chat.ID, sender.ID, "profile", onError)
+			case profileNormal, profileStrict:
+			}
+		}
+
+		buffer := new(bytes.Buffer)
+		defer buffer.Reset()
+
+		captcha, err = model.GenerateCaptchaWithConfig(buffer, captchaConfig(db, request.Chat.ID, verdict == profileStrict))
+		if err != nil {
+			return err
+		}
+
+		// The bot can write to the user until the request is processed
+		userChat := &tele.Chat{ID: request.UserChatID}
+		if request.UserChatID == 0 {
+			userChat.ID = sender.ID
+		}
+
+		intro := fmt.Sprintf("You requested to join %q. Please solve the captcha below within %s, otherwise the request is declined.",
+			request.Chat.Title, captcha.Expiration)
+		if _, err := bot.Send(userChat, intro); err != nil {
+			return err
+		}
+
+		photo := tele.Photo{
+			File:    tele.FromReader(buffer),
+			Width:   captcha.Width,
+			Height:  captcha.Height,
+			Caption: captcha.Caption(sender.Username, sender.FirstName, sender.LastName),
+		}
+
+		reply, err := photo.Send(bot, userChat, &tele.SendOptions{
+			ReplyMarkup: &tele.ReplyMarkup{
+				InlineKeyboard: captchaKeyboardDefault().keyboard,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		captcha.UserID = sender.ID
+		captcha.ChatID = reply.Chat.ID
+		captcha.MessageID = int64(reply.ID)
+		captcha.JoinChatID = request.Chat.ID
+
+		if err := db.UpsertCaptcha(captcha); err != nil {
+			return err
+		}
+
+		recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventCaptchaSent, request.Chat.ID, sender.ID, "join_request"), onError)
+
+		global.Metrics.LogChatEvent("captcha_sent", request.Chat.ID, map[string]interface{}{
+			"message_id":   reply.ID,
+			"chat_id":      request.Chat.ID,
+			"user_id":      sender.ID,
+			"captcha_id":   captcha.ID,
+			"join_request": true,
+		})
+
+		return nil
+	}
+}
+
+// DeclineJoinRequests declines the join requests of the user to the chats of the captcha, e.g. when it was not solved in time.
+func (t *Telegram) DeclineJoinRequests(captcha *model.Captcha, rule string) error {
+	return declineJoinChats(t.bot, t.db, captcha, rule, nil)
+}
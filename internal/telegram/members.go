@@ -0,0 +1,218 @@
+package telegram
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+// isMember - check if the user with the status is in the chat.
+func isMember(member *tele.ChatMember) bool {
+	if member == nil {
+		return false
+	}
+
+	switch member.Role {
+	case tele.Creator, tele.Administrator, tele.Member:
+		return true
+	case tele.Restricted:
+		return member.Member
+	default:
+		return false
+	}
+}
+
+// joinedUsers - the users joined the chat with the service message, added by the sender or by themselves.
+func joinedUsers(msg *tele.Message) []tele.User {
+	switch {
+	case msg == nil:
+		return nil
+	case len(msg.UsersJoined) > 0:
+		return msg.UsersJoined
+	case msg.UserJoined != nil:
+		return []tele.User{*msg.UserJoined}
+	default:
+		return nil
+	}
+}
+
+// memberChange - a change of the membership of the user in the chat.
+type memberChange struct {
+	chat      *tele.Chat
+	user      *tele.User
+	status    string
+	isMember  bool
+	at        time.Time
+	invitedBy *tele.User
+	link      string
+}
+
+// applyMemberChange - store the change of the membership and detect the join-and-leave.
+// The inviter and the invite link are stored whenever they are known for the current membership,
+// as the service message and the chat member update of the same join may come in any order.
+func applyMemberChange(db storage.Repository, change memberChange) error {
+	var left bool
+
+	member, err := db.UpdateChatMember(model.ChatID(change.chat.ID), model.UserID(change.user.ID), func(member *model.ChatMember) error {
+		_, left = member.Apply(change.status, change.isMember, change.at)
+		if !member.IsMember {
+			return nil
+		}
+
+		if change.invitedBy != nil && change.invitedBy.ID != change.user.ID && member.InvitedByID == 0 {
+			member.InvitedByID = model.UserID(change.invitedBy.ID)
+		}
+
+		if change.link != "" {
+			member.InviteLink = change.link
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The user left shortly after the join, a common pattern of the spam bots
+	window := global.Config.Telegram.JoinLeaveWindow
+	if left && window > 0 && member.Stayed() <= window {
+		global.Logger.Warn("telegram: join and leave",
+			slog.Int64("chat_id", change.chat.ID),
+			slog.Int64("user_id", change.user.ID),
+			slog.Duration("stayed", member.Stayed()),
+		)
+
+		if err := db.RecordModerationEvent(
+			model.NewModerationEvent(model.ModerationEventJoinLeave, change.chat.ID, change.user.ID, ""),
+		); err != nil {
+			return err
+		}
+
+		global.Metrics.LogChatEvent("join_leave", change.chat.ID, map[string]interface{}{
+			"chat_id": change.chat.ID,
+			"user_id": change.user.ID,
+			"stayed":  member.Stayed().Milliseconds(),
+		})
+	}
+
+	return nil
+}
+
+// Handle the chat member updates of the users.
+func onChatMember(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		update := c.ChatMember()
+		if update == nil || update.Chat == nil || update.NewChatMember == nil || update.NewChatMember.User == nil {
+			return nil
+		}
+
+		if !allowedChats(update.Chat.ID) {
+			return nil
+		}
+
+		change := memberChange{
+			chat:      update.Chat,
+			user:      update.NewChatMember.User,
+			status:    string(update.NewChatMember.Role),
+			isMember:  isMember(update.NewChatMember),
+			at:        update.Time(),
+			invitedBy: update.Sender,
+		}
+
+		if update.InviteLink != nil {
+			change.link = update.InviteLink.InviteLink
+		}
+
+		return applyMemberChange(db.WithContext(updateContext(c)), change)
+	}
+}
+
+// Handle the chat member updates of the bot itself, when it is added to or removed from the chat.
+func onMyChatMember(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		update := c.ChatMember()
+		if update == nil || update.Chat == nil || update.NewChatMember == nil || update.NewChatMember.User == nil {
+			return nil
+		}
+
+		change := memberChange{
+			chat:      update.Chat,
+			user:      update.NewChatMember.User,
+			status:    string(update.NewChatMember.Role),
+			isMember:  isMember(update.NewChatMember),
+			at:        update.Time(),
+			invitedBy: update.Sender,
+		}
+
+		if err := applyMemberChange(db.WithContext(updateContext(c)), change); err != nil {
+			return err
+		}
+
+		event := "bot_removed"
+		if change.isMember {
+			event = "bot_added"
+		}
+
+		global.Logger.Info("telegram: "+event,
+			slog.Int64("chat_id", update.Chat.ID),
+			slog.String("chat_title", update.Chat.Title),
+			slog.String("status", change.status),
+		)
+
+		global.Metrics.LogChatEvent(event, update.Chat.ID, map[string]interface{}{
+			"chat_id": update.Chat.ID,
+			"status":  change.status,
+		})
+
+		return nil
+	}
+}
+
+// Track members middleware - store the joined and left users from the service messages,
+// before the verification, which can delete the message. The chat member updates
+// are sent to the bot only if it is an admin of the chat.
+func trackMembersMiddleware(db storage.Repository, onError func(error)) tele.MiddlewareFunc {
+	handleError := func(err error) {
+		if err != nil && onError != nil {
+			onError(err)
+		}
+	}
+
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			msg := c.Message()
+			if msg == nil || msg.Chat == nil || !allowedChats(msg.Chat.ID) {
+				return next(c)
+			}
+
+			db := db.WithContext(updateContext(c))
+
+			if msg.UserLeft != nil {
+				handleError(applyMemberChange(db, memberChange{
+					chat:   msg.Chat,
+					user:   msg.UserLeft,
+					status: string(tele.Left),
+					at:     msg.Time(),
+				}))
+			}
+
+			users := joinedUsers(msg)
+			for i := range users {
+				handleError(applyMemberChange(db, memberChange{
+					chat:      msg.Chat,
+					user:      &users[i],
+					status:    string(tele.Member),
+					isMember:  true,
+					at:        msg.Time(),
+					invitedBy: msg.Sender,
+				}))
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestApplyMemberChangeKeepsInviteLink(t *testing.T) {
+	global.Config = &config.Config{}
+
+	chat := &tele.Chat{ID: -100}
+	user := &tele.User{ID: 1}
+	inviter := &tele.User{ID: 2}
+	at := time.Now()
+
+	// The service message of the join has the inviter, the chat member update has the link
+	message := memberChange{chat: chat, user: user, status: string(tele.Member), isMember: true, at: at, invitedBy: inviter}
+	update := memberChange{chat: chat, user: user, status: string(tele.Member), isMember: true, at: at, invitedBy: user, link: "https://t.me/+foxy"}
+
+	testcases := []struct {
+		Name    string
+		Changes []memberChange
+	}{
+		{Name: "Service message first", Changes: []memberChange{message, update}},
+		{Name: "Chat member update first", Changes: []memberChange{update, message}},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			db := memory.New()
+
+			for _, change := range testcase.Changes {
+				require.NoError(t, applyMemberChange(db, change))
+			}
+
+			member, err := db.ChatMemberByID(model.ChatID(chat.ID), model.UserID(user.ID))
+			require.NoError(t, err)
+			require.True(t, member.IsMember)
+			require.Equal(t, "https://t.me/+foxy", member.InviteLink)
+			require.Equal(t, model.UserID(inviter.ID), member.InvitedByID)
+		})
+	}
+}
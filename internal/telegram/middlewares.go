@@ -2,18 +2,24 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/plugfox/foxy-gram-server/internal/converters"
 	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
 	"github.com/plugfox/foxy-gram-server/internal/model"
 	"github.com/plugfox/foxy-gram-server/internal/storage"
+	"github.com/plugfox/foxy-gram-server/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	tele "gopkg.in/telebot.v3"
 )
 
 const (
 	contextKeyShouldVerify = "should_verify" // Context key for the verification flag, we should verify the user
+	contextKeyContext      = "context"       // Context key for the context.Context of the update, with the current span
 )
 
 // var errorUnexpectedStatusCode = fmt.Errorf("unexpected status code")
@@ -51,7 +57,7 @@ func kickUser(bot *tele.Bot, chat *tele.Chat, user *tele.User) error {
 }
 
 // Verify the user with a local database
-func isUserLocalBanned(db *storage.Storage, user *tele.User) (bool, error) {
+func isUserLocalBanned(db storage.Repository, user *tele.User) (bool, error) {
 	// Check local ban
 	banned, err := db.IsBannedUser(model.UserID(user.ID))
 	if err != nil {
@@ -116,9 +122,150 @@ func isUserCASBanned(httpClient *http.Client, user *tele.User) (bool, error) {
 }
 */
 
+// updateType returns the type of the update for metrics and logs.
+func updateType(u tele.Update) string {
+	switch {
+	case u.Message != nil:
+		return "message"
+	case u.EditedMessage != nil:
+		return "edited_message"
+	case u.ChannelPost != nil:
+		return "channel_post"
+	case u.EditedChannelPost != nil:
+		return "edited_channel_post"
+	case u.Callback != nil:
+		return "callback_query"
+	case u.MyChatMember != nil:
+		return "my_chat_member"
+	case u.ChatMember != nil:
+		return "chat_member"
+	case u.ChatJoinRequest != nil:
+		return "chat_join_request"
+	default:
+		return "other"
+	}
+}
+
+// updateContext returns the context of the update with the current span,
+// or the background context if the update is not traced.
+func updateContext(c tele.Context) context.Context {
+	if ctx, ok := c.Get(contextKeyContext).(context.Context); ok && ctx != nil {
+		return ctx
+	}
+
+	return context.Background()
+}
+
+// Trace update middleware - start a span for every update.
+func traceUpdateMiddleware() tele.MiddlewareFunc {
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			update := c.Update()
+			attributes := []attribute.KeyValue{
+				attribute.Int("telegram.update_id", update.ID),
+				attribute.String("telegram.update_type", updateType(update)),
+			}
+
+			if chat := c.Chat(); chat != nil {
+				attributes = append(attributes, attribute.Int64("telegram.chat_id", chat.ID))
+			}
+
+			if sender := c.Sender(); sender != nil {
+				attributes = append(attributes, attribute.Int64("telegram.user_id", sender.ID))
+			}
+
+			ctx, span := tracing.Tracer().Start(context.Background(), "telegram.update "+updateType(update),
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(attributes...),
+			)
+
+			c.Set(contextKeyContext, ctx)
+
+			err := next(c)
+
+			tracing.End(span, err)
+
+			return err
+		}
+	}
+}
+
+// traced wraps the middleware with a child span of the update span.
+// The span covers the middleware and the rest of the chain after it.
+func traced(name string, middleware tele.MiddlewareFunc) tele.MiddlewareFunc {
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		handler := middleware(next)
+
+		return func(c tele.Context) error {
+			parent := updateContext(c)
+			ctx, span := tracing.Tracer().Start(parent, "telegram.middleware "+name)
+
+			c.Set(contextKeyContext, ctx)
+
+			err := handler(c)
+
+			c.Set(contextKeyContext, parent)
+			tracing.End(span, err)
+
+			return err
+		}
+	}
+}
+
+// recordModerationEvent stores the moderation event for the statistics.
+func recordModerationEvent(db storage.Repository, event *model.ModerationEvent, onError func(error)) {
+	if err := db.RecordModerationEvent(event); err != nil && onError != nil {
+		onError(err)
+	}
+}
+
+// Record joins middleware - store the joins of the users for the statistics,
+// before the verification, which can delete the join message.
+func recordJoinsMiddleware(db storage.Repository, onError func(error)) tele.MiddlewareFunc {
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			msg := c.Message()
+			if msg == nil || msg.Chat == nil || !allowedChats(msg.Chat.ID) {
+				return next(c)
+			}
+
+			users := joinedUsers(msg)
+			if len(users) > 0 {
+				events := make([]*model.ModerationEvent, 0, len(users))
+				for _, user := range users {
+					events = append(events, model.NewModerationEvent(model.ModerationEventJoin, msg.Chat.ID, user.ID, ""))
+				}
+
+				if err := db.WithContext(updateContext(c)).RecordModerationEvent(events...); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// Update duration middleware - observe the time spent handling the update.
+func updateDurationMiddleware() tele.MiddlewareFunc {
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			startedAt := time.Now()
+
+			defer func() {
+				global.Metrics.ObserveDuration(metrics.DurationUpdate, time.Since(startedAt), map[string]string{
+					"type": updateType(c.Update()),
+				})
+			}()
+
+			return next(c)
+		}
+	}
+}
+
 // Verify user middleware - verify the user with a captcha
 func verifyUserMiddleware(
-	db *storage.Storage,
+	db storage.Repository,
 	onError func(error),
 ) tele.MiddlewareFunc {
 	// Centralized error handling
@@ -138,6 +285,12 @@ func verifyUserMiddleware(
 				return next(c) // There is callback
 			}
 
+			if update := c.Update(); update.ChatMember != nil || update.MyChatMember != nil || update.ChatJoinRequest != nil {
+				c.Set(contextKeyShouldVerify, false) // Skip the verification for the member updates and the join requests
+
+				return next(c) // There is member update or join request
+			}
+
 			sender := c.Sender() // Sender
 			chat := c.Chat()     // Chat
 
@@ -152,12 +305,12 @@ func verifyUserMiddleware(
 			}
 
 			// Check if it already verified user
-			verified, err := db.IsVerifiedUser(model.UserID(sender.ID))
+			verified, err := db.WithContext(updateContext(c)).IsVerifiedUser(model.UserID(sender.ID))
 			if err != nil {
 				handleError(err)
 
 				return nil // Skip the current message
-			} else if verified {
+			} else if verified && c.Get(contextKeyRecheck) != true {
 				c.Set(contextKeyShouldVerify, false) // Skip the verification for callbacks
 
 				return next(c) // Verified user
@@ -171,12 +324,17 @@ func verifyUserMiddleware(
 				return nil // Skip the current message
 			} else if member.Role == tele.Creator || member.Role == tele.Administrator || chat.Private {
 				// Add user to the verification list, if it is an admin or private ch
-				if err := db.VerifyUser(&model.VerifiedUser{
-					ID:         model.UserID(sender.ID),
-					VerifiedAt: time.Now(),
-					Reason:     "Not banned",
-				}); err != nil {
-					handleError(err)
+				if !verified {
+					if err := db.WithContext(updateContext(c)).VerifyUser(&model.VerifiedUser{
+						ID:         model.UserID(sender.ID),
+						VerifiedAt: time.Now(),
+						Reason:     "Not banned",
+					}); err != nil {
+						handleError(err)
+					} else {
+						recordModerationEvent(db.WithContext(updateContext(c)),
+							model.NewModerationEvent(model.ModerationEventVerification, chat.ID, sender.ID, "admin"), handleError)
+					}
 				}
 
 				c.Set(contextKeyShouldVerify, false) // Skip the verification, because the user is an admin
@@ -186,6 +344,17 @@ func verifyUserMiddleware(
 
 			c.Set(contextKeyShouldVerify, true) // Should verify the user
 
+			// The edit added links, the user has to pass the verification again
+			rule := "unverified"
+
+			if verified {
+				rule = "edited_link"
+
+				if err := db.WithContext(updateContext(c)).UnverifyUser(model.UserID(sender.ID)); err != nil {
+					handleError(err)
+				}
+			}
+
 			// Delete the current message, because user is not verified
 			if err := c.Delete(); err != nil {
 				handleError(err)
@@ -193,6 +362,9 @@ func verifyUserMiddleware(
 				chatID := c.Chat().ID
 				userID := c.Sender().ID
 
+				recordModerationEvent(db.WithContext(updateContext(c)),
+					model.NewModerationEvent(model.ModerationEventMessageDeleted, chatID, userID, rule), handleError)
+
 				defer global.Metrics.LogChatEvent("message_deleted", chatID, map[string]interface{}{
 					"chat_id": chatID,
 					"user_id": userID,
@@ -206,7 +378,7 @@ func verifyUserMiddleware(
 
 // Verify the user with a local database
 func verifyUserWithLocalDB(
-	db *storage.Storage,
+	db storage.Repository,
 	onError func(error),
 ) tele.MiddlewareFunc {
 	// Centralized error handling
@@ -222,16 +394,18 @@ func verifyUserWithLocalDB(
 				return next(c) // Skip the verification for callbacks, if the user is already verified or an admin
 			}
 
-			banned, err := isUserLocalBanned(db, c.Sender())
+			banned, err := isUserLocalBanned(db.WithContext(updateContext(c)), c.Sender())
 			if err != nil {
 				handleError(err)
 
 				return nil // Skip the current message
 			} else if banned {
 				bot := c.Bot()
-				// Ban the user again if they are already banned
+				// Ban the user again if they are already banned, the chat is unbanned when the ban is over
 				if err := bot.Ban(c.Chat(), &tele.ChatMember{User: c.Sender()}, true); err != nil {
 					handleError(err)
+				} else if err := db.WithContext(updateContext(c)).RecordBanChat(model.UserID(c.Sender().ID), model.ChatID(c.Chat().ID)); err != nil {
+					handleError(err)
 				}
 
 				// Send the message to the chat
@@ -243,6 +417,9 @@ func verifyUserWithLocalDB(
 				chatID := c.Chat().ID
 				userID := c.Sender().ID
 
+				recordModerationEvent(db.WithContext(updateContext(c)),
+					model.NewModerationEvent(model.ModerationEventBan, chatID, userID, "local_db"), handleError)
+
 				defer global.Metrics.LogChatEvent("ban", chatID, map[string]interface{}{
 					"chat_id": chatID,
 					"user_id": userID,
@@ -260,7 +437,7 @@ func verifyUserWithLocalDB(
 /*
 // Verify the user with a CAS ban
 func verifyUserWithCAS(
-	db *storage.Storage,
+	db storage.Repository,
 	httpClient *http.Client,
 	onError func(error),
 ) tele.MiddlewareFunc {
@@ -324,7 +501,7 @@ func verifyUserWithCAS(
 
 // Verify the user with a captcha
 func verifyUserWithCaptcha(
-	db *storage.Storage,
+	db storage.Repository,
 	onError func(error),
 ) tele.MiddlewareFunc {
 	// Centralized error handling
@@ -340,6 +517,8 @@ func verifyUserWithCaptcha(
 				return next(c) // Skip the verification for callbacks, if the user is already verified or an admin
 			}
 
+			db := db.WithContext(updateContext(c))
+
 			captcha, err := db.GetCaptchaForUserID(c.Sender().ID)
 			if err != nil {
 				handleError(err)
@@ -351,7 +530,7 @@ func verifyUserWithCaptcha(
 			// Create a new captcha
 			buffer := new(bytes.Buffer)
 			defer buffer.Reset()
-			captcha, err = model.GenerateCaptcha(buffer)
+			captcha, err = model.GenerateCaptchaWithConfig(buffer, captchaConfig(db, c.Chat().ID, c.Get(contextKeyStrictCaptcha) == true))
 			if err != nil {
 				handleError(err)
 
@@ -389,6 +568,8 @@ func verifyUserWithCaptcha(
 				handleError(err)
 			}
 
+			recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventCaptchaSent, reply.Chat.ID, sender.ID, ""), handleError)
+
 			defer global.Metrics.LogChatEvent("captcha_sent", reply.Chat.ID, map[string]interface{}{
 				"message_id": reply.ID,
 				"chat_id":    reply.Chat.ID,
@@ -404,26 +585,64 @@ func verifyUserWithCaptcha(
 	}
 }
 
+// originChats returns the chats of the forward origin of the message, if any.
+func originChats(msg *tele.Message) []*model.Chat {
+	if msg.Origin == nil {
+		return nil
+	}
+
+	return []*model.Chat{converters.ChatFromTG(msg.Origin.Chat), converters.ChatFromTG(msg.Origin.SenderChat)}
+}
+
+// originUser returns the sender of the forward origin of the message, if any.
+func originUser(msg *tele.Message) *model.User {
+	if msg.Origin == nil {
+		return nil
+	}
+
+	return converters.UserFromTG(msg.Origin.Sender)
+}
+
 // storeMessages middleware - store messages in the database asynchronously.
-func storeMessagesMiddleware(db *storage.Storage, onError func(error)) tele.MiddlewareFunc {
+func storeMessagesMiddleware(db storage.Repository, onError func(error)) tele.MiddlewareFunc {
 	return func(next tele.HandlerFunc) tele.HandlerFunc {
 		return func(c tele.Context) error {
 			msg := c.Message()
 			if msg != nil {
+				// The message is stored after the update is handled, so the span is linked, not nested
+				link := trace.LinkFromContext(updateContext(c))
+
 				go func() {
-					err := db.UpsertMessage(
+					ctx, span := tracing.Tracer().Start(context.Background(), "telegram.store_message", trace.WithLinks(link))
+					defer span.End()
+
+					message := converters.MessageFromTG(msg)
+					origin := converters.MessageOriginFromTG(msg)
+
+					// The text is not stored at all, if the chat keeps only the metadata
+					if global.Config.Retention.PolicyFor(msg.Chat.ID).MetadataOnly {
+						message.Text, message.Caption = "", ""
+						if origin != nil {
+							origin.OriginalText = ""
+						}
+					}
+
+					err := db.WithContext(ctx).UpsertMessage(
 						storage.UpsertMessageInput{
-							Message: converters.MessageFromTG(msg),
-							Chats: []*model.Chat{
+							Message:     message,
+							Origin:      origin,
+							ReplyMarkup: converters.ReplyMarkupFromTG(msg),
+							Chats: append([]*model.Chat{
 								converters.ChatFromTG(msg.Chat),
 								converters.ChatFromTG(msg.SenderChat),
 								converters.ChatFromTG(msg.OriginalChat),
-							}, Users: []*model.User{
+							}, originChats(msg)...), Users: []*model.User{
 								converters.UserFromTG(msg.Sender).Seen(),
 								converters.UserFromTG(msg.OriginalSender),
 								converters.UserFromTG(msg.Via),
 								converters.UserFromTG(msg.UserJoined),
 								converters.UserFromTG(msg.UserLeft),
+								originUser(msg),
 							},
 						})
 					if err != nil {
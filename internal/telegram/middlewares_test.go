@@ -0,0 +1,33 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestIsUserLocalBanned(t *testing.T) {
+	db := memory.New()
+	require.NoError(t, db.BanUser(&model.BannedUser{ID: 1, BannedAt: time.Now(), Reason: "spam"}))
+
+	testcases := []struct {
+		Name     string
+		User     *tele.User
+		Expected bool
+	}{
+		{Name: "Banned user", User: &tele.User{ID: 1}, Expected: true},
+		{Name: "Unknown user", User: &tele.User{ID: 2}, Expected: false},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			banned, err := isUserLocalBanned(db, testcase.User)
+			require.NoError(t, err)
+			require.Equal(t, testcase.Expected, banned)
+		})
+	}
+}
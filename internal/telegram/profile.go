@@ -0,0 +1,357 @@
+package telegram
+
+import (
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	contextKeyStrictCaptcha = "strict_captcha" // Context key for the stricter captcha of the suspicious profile
+	strictProfileTTL        = 24 * time.Hour   // The user added by someone else gets the stricter captcha within this time
+)
+
+// Traits of the suspicious profiles.
+const (
+	traitNoUsername = "no_username"
+	traitNoPhoto    = "no_photo"
+	traitLinkInName = "link_in_name"
+	traitEmojiName  = "emoji_name"
+	traitLanguage   = "language"
+	traitRecentID   = "recent_id"
+)
+
+// profileVerdict - the verification decided by the score of the profile.
+type profileVerdict string
+
+const (
+	profileNormal  profileVerdict = "normal"  // The usual captcha
+	profileTrusted profileVerdict = "trusted" // Verified without the captcha
+	profileStrict  profileVerdict = "strict"  // The stricter captcha
+	profileBanned  profileVerdict = "banned"  // Banned without the captcha
+)
+
+// linkInName - links, domains and mentions in the names of the spam accounts, e.g. "Earn $500 at t.me/xyz".
+var linkInName = regexp.MustCompile(`(?i)(https?://|t\.me/|telegram\.me/|www\.|@[a-z0-9_]{4,}|` +
+	`[a-z0-9-]+\.(com|net|org|ru|io|me|xyz|top|site|online|link|bet|shop|live|club)\b)`)
+
+// profileScore - the score of the profile, the sum of the weights of its traits.
+type profileScore struct {
+	Score  int
+	Traits []string
+}
+
+// scoreProfile - score the profile of the user with the number of the profile photos, negative if unknown.
+func scoreProfile(user *tele.User, photos int, cfg *config.ProfileConfig) profileScore {
+	var score profileScore
+
+	add := func(trait string, weight int) {
+		score.Score += weight
+		score.Traits = append(score.Traits, trait)
+	}
+
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+
+	if user.Username == "" {
+		add(traitNoUsername, cfg.Weights.NoUsername)
+	}
+
+	if photos == 0 {
+		add(traitNoPhoto, cfg.Weights.NoPhoto)
+	}
+
+	if linkInName.MatchString(name) {
+		add(traitLinkInName, cfg.Weights.LinkInName)
+	}
+
+	if isEmojiName(name, cfg.EmojiCount) {
+		add(traitEmojiName, cfg.Weights.EmojiName)
+	}
+
+	if user.LanguageCode != "" && slices.ContainsFunc(cfg.Languages, func(code string) bool {
+		return strings.EqualFold(code, user.LanguageCode)
+	}) {
+		add(traitLanguage, cfg.Weights.Language)
+	}
+
+	if cfg.RecentID > 0 && user.ID >= cfg.RecentID {
+		add(traitRecentID, cfg.Weights.RecentID)
+	}
+
+	return score
+}
+
+// verdict - the verification by the thresholds of the score, the zero threshold is disabled.
+func (s profileScore) verdict(cfg *config.ProfileConfig) profileVerdict {
+	switch {
+	case cfg.BanFrom > 0 && s.Score >= cfg.BanFrom:
+		return profileBanned
+	case cfg.StrictFrom > 0 && s.Score >= cfg.StrictFrom:
+		return profileStrict
+	case cfg.TrustBelow > 0 && s.Score < cfg.TrustBelow:
+		return profileTrusted
+	default:
+		return profileNormal
+	}
+}
+
+// isEmojiName - the name has at least count emoji, or the emoji and no letters.
+func isEmojiName(name string, count int) bool {
+	emoji, letters := 0, 0
+
+	for _, r := range name {
+		switch {
+		case isEmoji(r):
+			emoji++
+		case unicode.IsLetter(r):
+			letters++
+		}
+	}
+
+	return emoji > 0 && ((count > 0 && emoji >= count) || letters == 0)
+}
+
+// isEmoji - the pictographs, symbols, dingbats and flags.
+func isEmoji(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) || (r >= 0x2B00 && r <= 0x2BFF)
+}
+
+// profilePhotos - the number of the profile photos of the user, -1 if the lookup fails.
+func profilePhotos(bot *tele.Bot, user *tele.User) int {
+	data, err := bot.Raw("getUserProfilePhotos", map[string]string{
+		"user_id": user.Recipient(),
+		"limit":   "1",
+	})
+	if err != nil {
+		global.Logger.Warn("telegram: reading profile photos error", slog.String("error", err.Error()), slog.Int64("user_id", user.ID))
+
+		return -1
+	}
+
+	var resp struct {
+		Result struct {
+			Count int `json:"total_count"`
+		} `json:"result"`
+	}
+
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return -1
+	}
+
+	return resp.Result.Count
+}
+
+// assessProfile - score the profile of the user joining the chat and decide the verification.
+// The user is not trusted in the lockdown or when the chat requires the acceptance of the rules after the captcha.
+func assessProfile(bot *tele.Bot, db storage.Repository, chatID int64, user *tele.User) (profileScore, profileVerdict) {
+	cfg := &global.Config.Profile
+
+	score := scoreProfile(user, profilePhotos(bot, user), cfg)
+	verdict := score.verdict(cfg)
+
+	if verdict == profileTrusted {
+		lockdown, err := db.LockdownByChatID(model.ChatID(chatID))
+		if err == nil && lockdown.IsActive(time.Now()) {
+			verdict = profileNormal
+		} else if rules, err := chatRules(db, chatID); err != nil || rules.AcceptanceRequired() {
+			verdict = profileNormal
+		}
+	}
+
+	global.Metrics.LogChatEvent("profile_scored", chatID, map[string]interface{}{
+		"chat_id": chatID,
+		"user_id": user.ID,
+		"score":   score.Score,
+		"traits":  strings.Join(score.Traits, ","),
+		"verdict": string(verdict),
+	})
+
+	return score, verdict
+}
+
+// trustProfile - verify the user with the low risk profile without the captcha.
+func trustProfile(db storage.Repository, chatID int64, user *tele.User, onError func(error)) error {
+	if err := db.VerifyUser(&model.VerifiedUser{
+		ID:         model.UserID(user.ID),
+		VerifiedAt: time.Now(),
+		Reason:     "Low risk profile",
+	}); err != nil {
+		return err
+	}
+
+	recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventVerification, chatID, user.ID, "profile"), onError)
+
+	return nil
+}
+
+// banProfile - ban the user with the suspicious profile in the local database.
+func banProfile(db storage.Repository, chatID int64, user *tele.User, score profileScore, onError func(error)) error {
+	if err := db.BanUser(&model.BannedUser{
+		ID:       model.UserID(user.ID),
+		BannedAt: time.Now(),
+		Reason:   "Suspicious profile: " + strings.Join(score.Traits, ", "),
+	}); err != nil {
+		return err
+	}
+
+	recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventBan, chatID, user.ID, "profile"), onError)
+
+	global.Metrics.LogChatEvent("ban", chatID, map[string]interface{}{
+		"chat_id": chatID,
+		"user_id": user.ID,
+		"reason":  "Profile",
+		"score":   score.Score,
+	})
+
+	return nil
+}
+
+// strictProfiles - the users added to the chat by someone else with the suspicious profile,
+// they get the stricter captcha with the first message sent within the TTL.
+type strictProfiles struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	users map[int64]time.Time
+}
+
+func newStrictProfiles(ttl time.Duration) *strictProfiles {
+	return &strictProfiles{
+		ttl:   ttl,
+		users: make(map[int64]time.Time),
+	}
+}
+
+// add - flag the user at the time, dropping the expired flags.
+func (p *strictProfiles) add(userID int64, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, expires := range p.users {
+		if !expires.After(now) {
+			delete(p.users, id)
+		}
+	}
+
+	p.users[userID] = now.Add(p.ttl)
+}
+
+// take - whether the user is flagged at the time, the flag is removed.
+func (p *strictProfiles) take(userID int64, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	expires, ok := p.users[userID]
+	if ok {
+		delete(p.users, userID)
+	}
+
+	return ok && expires.After(now)
+}
+
+// Verify the users joining the chat by the score of the profile: trust the low risk users,
+// give the stricter captcha to the suspicious ones and ban the spam accounts.
+// Each joined user is scored, the sender who added them is verified as usual.
+func verifyUserWithProfile(
+	db storage.Repository,
+	onError func(error),
+) tele.MiddlewareFunc {
+	// Centralized error handling
+	handleError := func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+	}
+
+	strict := newStrictProfiles(strictProfileTTL)
+
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			shouldVerify := c.Get(contextKeyShouldVerify) == true
+			sender := c.Sender()
+			chat := c.Chat()
+			now := time.Now()
+
+			users := joinedUsers(c.Message())
+			if len(users) == 0 || chat == nil || !allowedChats(chat.ID) {
+				// The profile is scored at the join time only, the user added by someone else was flagged then
+				if shouldVerify && sender != nil && strict.take(sender.ID, now) {
+					c.Set(contextKeyStrictCaptcha, true)
+				}
+
+				return next(c)
+			}
+
+			db := db.WithContext(updateContext(c))
+			bot := c.Bot()
+			senderBanned := false
+
+			for i := range users {
+				user := &users[i]
+				isSender := sender != nil && user.ID == sender.ID
+
+				if user.IsBot {
+					continue
+				}
+
+				if isSender {
+					if !shouldVerify {
+						continue // Skip the verification for callbacks, if the user is already verified or an admin
+					}
+				} else if verified, err := db.IsVerifiedUser(model.UserID(user.ID)); err != nil {
+					handleError(err)
+
+					continue
+				} else if verified {
+					continue
+				}
+
+				score, verdict := assessProfile(bot, db, chat.ID, user)
+
+				switch verdict {
+				case profileTrusted:
+					if err := trustProfile(db, chat.ID, user, handleError); err != nil {
+						handleError(err)
+					} else if isSender {
+						c.Set(contextKeyShouldVerify, false)
+					}
+				case profileStrict:
+					if isSender {
+						c.Set(contextKeyStrictCaptcha, true)
+					} else {
+						strict.add(user.ID, now)
+					}
+				case profileBanned:
+					if err := bot.Ban(chat, &tele.ChatMember{User: user}, true); err != nil {
+						handleError(err)
+					} else if err := db.RecordBanChat(model.UserID(user.ID), model.ChatID(chat.ID)); err != nil {
+						handleError(err)
+					}
+
+					if err := banProfile(db, chat.ID, user, score, handleError); err != nil {
+						handleError(err)
+					}
+
+					senderBanned = senderBanned || isSender
+				case profileNormal:
+				}
+			}
+
+			if senderBanned {
+				return nil // Skip the next pipeline
+			}
+
+			return next(c)
+		}
+	}
+}
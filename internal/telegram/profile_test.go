@@ -0,0 +1,243 @@
+package telegram
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestScoreProfile(t *testing.T) {
+	cfg := &config.ProfileConfig{
+		TrustBelow: 10,
+		StrictFrom: 40,
+		BanFrom:    90,
+		Languages:  []string{"zh"},
+		RecentID:   8000000000,
+		EmojiCount: 3,
+		Weights: config.ProfileWeights{
+			NoUsername: 10,
+			NoPhoto:    20,
+			LinkInName: 40,
+			EmojiName:  15,
+			Language:   15,
+			RecentID:   15,
+		},
+	}
+
+	testcases := []struct {
+		Name    string
+		User    tele.User
+		Photos  int
+		Score   int
+		Traits  []string
+		Verdict profileVerdict
+	}{
+		{
+			Name:    "Regular user",
+			User:    tele.User{ID: 123456, FirstName: "Alice", Username: "alice", LanguageCode: "en"},
+			Photos:  2,
+			Score:   0,
+			Verdict: profileTrusted,
+		},
+		{
+			Name:    "Unknown photos",
+			User:    tele.User{ID: 123456, FirstName: "Alice", Username: "alice"},
+			Photos:  -1,
+			Score:   0,
+			Verdict: profileTrusted,
+		},
+		{
+			Name:    "No username",
+			User:    tele.User{ID: 123456, FirstName: "Bob"},
+			Photos:  1,
+			Score:   10,
+			Traits:  []string{traitNoUsername},
+			Verdict: profileNormal,
+		},
+		{
+			Name:    "Link in the name",
+			User:    tele.User{ID: 123456, FirstName: "Crypto signals", LastName: "t.me/signals", Username: "signals"},
+			Photos:  1,
+			Score:   40,
+			Traits:  []string{traitLinkInName},
+			Verdict: profileStrict,
+		},
+		{
+			Name:    "Emoji only name",
+			User:    tele.User{ID: 123456, FirstName: "🔥", Username: "fire"},
+			Photos:  1,
+			Score:   15,
+			Traits:  []string{traitEmojiName},
+			Verdict: profileNormal,
+		},
+		{
+			Name:    "Few emoji",
+			User:    tele.User{ID: 123456, FirstName: "Anna 🌸", Username: "anna"},
+			Photos:  1,
+			Score:   0,
+			Verdict: profileTrusted,
+		},
+		{
+			Name:   "Spam account",
+			User:   tele.User{ID: 8123456789, FirstName: "💰💰💰 Earn", LastName: "www.example.xyz", LanguageCode: "zh"},
+			Photos: 0,
+			Score:  115,
+			Traits: []string{
+				traitNoUsername, traitNoPhoto, traitLinkInName, traitEmojiName, traitLanguage, traitRecentID,
+			},
+			Verdict: profileBanned,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			score := scoreProfile(&tc.User, tc.Photos, cfg)
+			require.Equal(t, tc.Score, score.Score)
+			require.Equal(t, tc.Traits, score.Traits)
+			require.Equal(t, tc.Verdict, score.verdict(cfg))
+		})
+	}
+}
+
+func TestVerifyJoinedUsersWithProfile(t *testing.T) {
+	global.Config = &config.Config{Profile: config.ProfileConfig{
+		TrustBelow: 10,
+		StrictFrom: 20,
+		BanFrom:    40,
+		Weights:    config.ProfileWeights{NoUsername: 20, LinkInName: 40},
+	}}
+	global.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	global.Metrics = metrics.NewMetricsFake()
+
+	var (
+		mu     sync.Mutex
+		banned []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/kickChatMember") {
+			body, _ := io.ReadAll(r.Body)
+
+			mu.Lock()
+			banned = append(banned, string(body))
+			mu.Unlock()
+
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"total_count":1,"photos":[]}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	bot, err := tele.NewBot(tele.Settings{URL: server.URL, Token: "123:test", Offline: true})
+	require.NoError(t, err)
+
+	chat := &tele.Chat{ID: -100, Type: tele.ChatSuperGroup}
+	trusted := tele.User{ID: 1, FirstName: "Alice", Username: "alice"}
+	suspicious := tele.User{ID: 2, FirstName: "Bob"}
+	spammer := tele.User{ID: 3, FirstName: "Earn $500 at t.me/xyz", Username: "earn"}
+	adder := &tele.User{ID: 4, FirstName: "Admin", Username: "admin"}
+
+	testcases := []struct {
+		Name         string
+		Sender       *tele.User
+		Joined       []tele.User
+		ShouldVerify bool
+		Verified     []int64
+		Banned       []int64
+		Strict       []int64
+		Next         bool
+	}{
+		{
+			Name:         "Member added by someone else",
+			Sender:       adder,
+			Joined:       []tele.User{spammer},
+			ShouldVerify: false,
+			Banned:       []int64{spammer.ID},
+			Next:         true,
+		},
+		{
+			Name:         "Several users joined",
+			Sender:       adder,
+			Joined:       []tele.User{trusted, suspicious, spammer},
+			ShouldVerify: true,
+			Verified:     []int64{trusted.ID},
+			Banned:       []int64{spammer.ID},
+			Strict:       []int64{suspicious.ID},
+			Next:         true,
+		},
+		{
+			Name:         "Spammer joined by themselves",
+			Sender:       &spammer,
+			Joined:       []tele.User{spammer},
+			ShouldVerify: true,
+			Banned:       []int64{spammer.ID},
+			Next:         false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			mu.Lock()
+			banned = nil
+			mu.Unlock()
+
+			db := memory.New()
+			called := false
+
+			middleware := verifyUserWithProfile(db, func(err error) { require.NoError(t, err) })
+			handler := middleware(func(tele.Context) error {
+				called = true
+
+				return nil
+			})
+
+			c := bot.NewContext(tele.Update{Message: &tele.Message{Sender: testcase.Sender, Chat: chat, UsersJoined: testcase.Joined}})
+			c.Set(contextKeyShouldVerify, testcase.ShouldVerify)
+
+			require.NoError(t, handler(c))
+			require.Equal(t, testcase.Next, called)
+
+			// The sender who added the users is never scored
+			require.Nil(t, c.Get(contextKeyStrictCaptcha))
+			require.Equal(t, testcase.ShouldVerify, c.Get(contextKeyShouldVerify))
+
+			for _, user := range testcase.Joined {
+				verified, err := db.IsVerifiedUser(model.UserID(user.ID))
+				require.NoError(t, err)
+				require.Equal(t, slices.Contains(testcase.Verified, user.ID), verified, "user %d", user.ID)
+
+				isBanned, err := db.IsBannedUser(model.UserID(user.ID))
+				require.NoError(t, err)
+				require.Equal(t, slices.Contains(testcase.Banned, user.ID), isBanned, "user %d", user.ID)
+
+				// The first message of the flagged user gets the stricter captcha
+				c := bot.NewContext(tele.Update{Message: &tele.Message{Sender: &user, Chat: chat, Text: "hello"}})
+				c.Set(contextKeyShouldVerify, true)
+
+				require.NoError(t, handler(c))
+				require.Equal(t, slices.Contains(testcase.Strict, user.ID), c.Get(contextKeyStrictCaptcha) == true, "user %d", user.ID)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			require.Len(t, banned, len(testcase.Banned))
+		})
+	}
+}
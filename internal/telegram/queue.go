@@ -0,0 +1,689 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
+)
+
+var (
+	errorQueueClosed  = errors.New("telegram queue is closed")
+	errorQueueTimeout = errors.New("telegram queue wait timeout")
+)
+
+// Priority - the order of the queued requests, the requests of the higher priority are sent first.
+type Priority int
+
+const (
+	PriorityAuto   Priority = iota - 1 // Priority by the method of the request
+	PriorityLow                        // Announcements
+	PriorityNormal                     // Messages, edits and captchas
+	PriorityHigh                       // Deletions, bans, restrictions and join requests
+
+	priorityCount = int(PriorityHigh) + 1
+)
+
+// String - the name of the priority, used as the tag of the metrics.
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "auto"
+	}
+}
+
+// QueueOptions - the rate limits of the outgoing queue.
+type QueueOptions struct {
+	GlobalRate float64       // Requests per second to the Bot API
+	ChatRate   float64       // Messages per minute to a chat
+	Workers    int           // Requests sent at the same time
+	Retries    int           // Attempts after 429 Too Many Requests, before the error is returned
+	MaxWait    time.Duration // Time a request may wait in the queue, zero is unlimited
+	Timeout    time.Duration // Timeout of an attempt, the time in the queue is limited by MaxWait
+}
+
+// Queue - the outgoing queue of the Telegram Bot API requests, which keeps the global and per-chat rate limits,
+// waits for retry_after of 429 Too Many Requests and sends the requests by their priority.
+// The queue is an HTTP transport, so every call of the bot passes through it.
+type Queue struct {
+	transport http.RoundTripper
+	options   QueueOptions
+
+	mu      sync.Mutex
+	pending [priorityCount][]*queuedRequest
+	global  *bucket
+	chats   map[int64]*bucket
+	blocked map[int64]time.Time // Chats blocked by retry_after
+	backoff time.Time           // Every request is blocked by retry_after until, see block
+	pruned  time.Time
+	closed  bool
+
+	slots chan struct{}
+	wake  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+type queuedRequest struct {
+	req      *http.Request
+	body     []byte
+	method   string
+	chatID   int64
+	limited  bool // The request is counted by the per-chat rate limit
+	priority Priority
+	queuedAt time.Time
+	readyAt  time.Time // Retry after 429 Too Many Requests of the request without the numeric chat
+	attempts int
+	running  bool // The request is being sent, not in the queue
+	result   chan queueResult
+}
+
+type queueResult struct {
+	resp *http.Response
+	err  error
+}
+
+// NewQueue - create the queue sending the requests with the transport and start its dispatcher.
+func NewQueue(transport http.RoundTripper, options QueueOptions) *Queue {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	options.Workers = max(options.Workers, 1)
+
+	q := &Queue{
+		transport: transport,
+		options:   options,
+		global:    newBucket(options.GlobalRate, options.GlobalRate),
+		chats:     make(map[int64]*bucket),
+		blocked:   make(map[int64]time.Time),
+		slots:     make(chan struct{}, options.Workers),
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	go q.dispatch()
+
+	return q
+}
+
+// Client - a copy of the client sending the requests through the queue with the priority,
+// PriorityAuto derives the priority from the method. The timeout of the client is applied to each attempt instead.
+func (q *Queue) Client(client *http.Client, priority Priority) *http.Client {
+	queued := *client
+	queued.Timeout = 0
+	queued.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return q.roundTrip(req, priority)
+	})
+
+	return &queued
+}
+
+// Close - stop the dispatcher and fail the queued requests, the requests being sent are completed.
+func (q *Queue) Close() {
+	q.once.Do(func() {
+		close(q.done)
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		q.closed = true
+
+		for priority := range q.pending {
+			for _, item := range q.pending[priority] {
+				item.result <- queueResult{err: errorQueueClosed}
+			}
+
+			q.pending[priority] = nil
+		}
+	})
+}
+
+// roundTrip - queue the request and wait for its response.
+// The reading methods, e.g. getUpdates, are not rate limited and sent at once.
+func (q *Queue) roundTrip(req *http.Request, priority Priority) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	if !isQueuedMethod(method) {
+		return q.send(req)
+	}
+
+	var body []byte
+
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+
+		req.Body.Close()
+	}
+
+	if priority == PriorityAuto {
+		priority = methodPriority(method)
+	}
+
+	item := &queuedRequest{
+		req:      req,
+		body:     body,
+		method:   method,
+		chatID:   requestChatID(req.Header.Get("Content-Type"), body),
+		limited:  isChatLimitedMethod(method),
+		priority: priority,
+		queuedAt: time.Now(),
+		result:   make(chan queueResult, 1),
+	}
+
+	q.push(item, false)
+
+	var deadline <-chan time.Time
+
+	if q.options.MaxWait > 0 {
+		timer := time.NewTimer(q.options.MaxWait)
+		defer timer.Stop()
+
+		deadline = timer.C
+	}
+
+	for {
+		select {
+		case result := <-item.result:
+			return result.resp, result.err
+		case <-req.Context().Done():
+			// The dispatcher drops the request, when it is picked
+			return nil, req.Context().Err()
+		case <-deadline:
+			if q.remove(item) {
+				return nil, errorQueueTimeout
+			}
+
+			deadline = nil // The request is being sent, the attempt has its own timeout
+		}
+	}
+}
+
+// remove - remove the request waiting in the queue, false if it is being sent.
+func (q *Queue) remove(item *queuedRequest) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if item.running {
+		return false
+	}
+
+	pending := q.pending[item.priority]
+	for i := range pending {
+		if pending[i] == item {
+			q.pending[item.priority] = append(pending[:i], pending[i+1:]...)
+
+			return true
+		}
+	}
+
+	return false // Already failed by Close
+}
+
+// push - add the request to the end of its priority, or to the front after 429 Too Many Requests.
+func (q *Queue) push(item *queuedRequest, front bool) {
+	q.mu.Lock()
+
+	item.running = false
+
+	if q.closed {
+		q.mu.Unlock()
+		item.result <- queueResult{err: errorQueueClosed}
+
+		return
+	}
+
+	if front {
+		q.pending[item.priority] = append([]*queuedRequest{item}, q.pending[item.priority]...)
+	} else {
+		q.pending[item.priority] = append(q.pending[item.priority], item)
+	}
+
+	depth := len(q.pending[item.priority])
+	q.mu.Unlock()
+
+	q.observeDepth(item.priority, depth)
+	q.signal()
+}
+
+// signal - wake the dispatcher up.
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch - send the next ready request, when a worker is free.
+func (q *Queue) dispatch() {
+	for {
+		select {
+		case q.slots <- struct{}{}:
+		case <-q.done:
+			return
+		}
+
+		item := q.wait()
+		if item == nil {
+			return
+		}
+
+		go q.execute(item)
+	}
+}
+
+// wait - wait for the next ready request, nil if the queue is closed.
+func (q *Queue) wait() *queuedRequest {
+	for {
+		item, delay := q.next(time.Now())
+		if item != nil {
+			return item
+		}
+
+		var timer <-chan time.Time
+		if delay > 0 {
+			timer = time.After(delay)
+		}
+
+		select {
+		case <-q.wake:
+		case <-timer:
+		case <-q.done:
+			return nil
+		}
+	}
+}
+
+// next - take the first request of the highest priority, which is allowed by the rate limits,
+// otherwise the delay until a request may be allowed, zero to wait for a new request.
+//
+//nolint:gocognit
+func (q *Queue) next(now time.Time) (*queuedRequest, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.prune(now)
+
+	if q.backoff.After(now) {
+		return nil, q.backoff.Sub(now)
+	}
+
+	if delay := q.global.delay(now); delay > 0 {
+		return nil, delay
+	}
+
+	var wait time.Duration
+
+	later := func(delay time.Duration) {
+		if wait == 0 || delay < wait {
+			wait = delay
+		}
+	}
+
+	for priority := priorityCount - 1; priority >= 0; priority-- {
+		pending := q.pending[priority]
+
+		for i := 0; i < len(pending); i++ {
+			item := pending[i]
+
+			if item.req.Context().Err() != nil {
+				// The caller is gone
+				pending = append(pending[:i], pending[i+1:]...)
+				i--
+
+				continue
+			}
+
+			if item.readyAt.After(now) {
+				later(item.readyAt.Sub(now))
+
+				continue
+			}
+
+			if until := q.blocked[item.chatID]; item.chatID != 0 && until.After(now) {
+				later(until.Sub(now))
+
+				continue
+			}
+
+			if item.limited && item.chatID != 0 {
+				chat := q.chats[item.chatID]
+				if chat == nil {
+					chat = newBucket(q.options.ChatRate/60, q.options.ChatRate) //nolint:mnd
+					q.chats[item.chatID] = chat
+				}
+
+				if delay := chat.delay(now); delay > 0 {
+					later(delay)
+
+					continue
+				}
+
+				chat.take(now)
+			}
+
+			q.global.take(now)
+			q.pending[priority] = append(pending[:i], pending[i+1:]...)
+			item.running = true
+
+			return item, 0
+		}
+
+		q.pending[priority] = pending
+	}
+
+	return nil, wait
+}
+
+// prune - forget the idle chats and the expired blocks, once a minute.
+func (q *Queue) prune(now time.Time) {
+	if now.Sub(q.pruned) < time.Minute {
+		return
+	}
+
+	q.pruned = now
+
+	for chatID, chat := range q.chats {
+		if chat.full(now) {
+			delete(q.chats, chatID)
+		}
+	}
+
+	for chatID, until := range q.blocked {
+		if !until.After(now) {
+			delete(q.blocked, chatID)
+		}
+	}
+}
+
+// execute - send the request, after 429 Too Many Requests block the chat for retry_after and queue it again.
+func (q *Queue) execute(item *queuedRequest) {
+	defer func() {
+		<-q.slots
+		q.signal()
+	}()
+
+	q.mu.Lock()
+	depth := len(q.pending[item.priority])
+	q.mu.Unlock()
+
+	q.observeDepth(item.priority, depth)
+
+	global.Metrics.ObserveDuration(metrics.DurationQueueWait, time.Since(item.queuedAt), map[string]string{
+		"priority": item.priority.String(),
+	})
+
+	req := item.req.Clone(item.req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(item.body))
+	req.ContentLength = int64(len(item.body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(item.body)), nil
+	}
+
+	resp, err := q.send(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		item.result <- queueResult{resp: resp, err: err}
+
+		return
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		item.result <- queueResult{err: err}
+
+		return
+	}
+
+	retryAfter := parseRetryAfter(data)
+
+	global.Metrics.LogEvent("telegram_rate_limited", map[string]string{"method": item.method}, map[string]any{
+		"chat_id":     item.chatID,
+		"retry_after": retryAfter.Seconds(),
+		"attempt":     item.attempts + 1,
+	})
+
+	now := time.Now()
+	q.block(item, now, now.Add(retryAfter))
+
+	if item.attempts < q.options.Retries {
+		item.attempts++
+		item.queuedAt = time.Now()
+		q.push(item, true)
+
+		return
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	item.result <- queueResult{resp: resp}
+}
+
+// block - block the chat of the rate limited request until the time.
+// The backoff is per chat for the numeric chat IDs only, the request without one,
+// e.g. to the @username, waits alone, so it does not stall the other chats.
+// When another chat is blocked too, the bot is rate limited as a whole and every request waits.
+func (q *Queue) block(item *queuedRequest, now time.Time, until time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if item.chatID == 0 {
+		item.readyAt = until
+
+		return
+	}
+
+	for chatID, blocked := range q.blocked {
+		if chatID != item.chatID && blocked.After(now) {
+			if until.After(q.backoff) {
+				q.backoff = until
+			}
+
+			break
+		}
+	}
+
+	if until.After(q.blocked[item.chatID]) {
+		q.blocked[item.chatID] = until
+	}
+}
+
+// send - send the request with the timeout of an attempt.
+func (q *Queue) send(req *http.Request) (*http.Response, error) {
+	if q.options.Timeout <= 0 {
+		return q.transport.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), q.options.Timeout)
+
+	resp, err := q.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	// The timeout covers reading the body too
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, nil
+}
+
+// observeDepth - report the number of the queued requests of the priority.
+func (q *Queue) observeDepth(priority Priority, depth int) {
+	global.Metrics.SetGauge(metrics.GaugeQueueDepth, float64(depth), map[string]string{
+		"priority": priority.String(),
+	})
+}
+
+// cancelBody - the body of the response, which cancels the context of the request when closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+
+	return b.ReadCloser.Close()
+}
+
+// roundTripperFunc - an adapter to use the function as the HTTP transport.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// isQueuedMethod - the methods changing something are queued, the reading ones are sent at once.
+// The callback queries are answered at once too, the user waits for the answer.
+func isQueuedMethod(method string) bool {
+	return !strings.HasPrefix(method, "get") && method != "answerCallbackQuery"
+}
+
+// isChatLimitedMethod - the methods posting to the chat, which are limited to about 20 per minute in a group.
+func isChatLimitedMethod(method string) bool {
+	for _, prefix := range []string{"send", "edit", "copy", "forward"} {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// methodPriority - deletions and moderation go first, the rest is normal.
+func methodPriority(method string) Priority {
+	for _, prefix := range []string{"delete", "ban", "unban", "restrict", "approve", "decline"} {
+		if strings.HasPrefix(method, prefix) {
+			return PriorityHigh
+		}
+	}
+
+	return PriorityNormal
+}
+
+// requestChatID - the chat_id of the JSON or the multipart body, zero for the username or without the chat.
+func requestChatID(contentType string, body []byte) int64 {
+	var value string
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/json":
+		var request struct {
+			ChatID json.RawMessage `json:"chat_id"`
+		}
+
+		if err := json.Unmarshal(body, &request); err != nil {
+			return 0
+		}
+
+		value = strings.Trim(string(request.ChatID), `"`)
+	case "multipart/form-data":
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return 0
+			}
+
+			if part.FormName() == "chat_id" {
+				data, _ := io.ReadAll(part)
+				value = string(data)
+
+				break
+			}
+		}
+	}
+
+	chatID, _ := strconv.ParseInt(value, 10, 64)
+
+	return chatID
+}
+
+// parseRetryAfter - retry_after of 429 Too Many Requests, a second if it is missing.
+func parseRetryAfter(body []byte) time.Duration {
+	var response struct {
+		Parameters struct {
+			RetryAfter *int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil || response.Parameters.RetryAfter == nil {
+		return time.Second
+	}
+
+	return time.Duration(*response.Parameters.RetryAfter) * time.Second
+}
+
+// bucket - the token bucket of the rate limit, refilled by rate tokens per second up to burst.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst float64) *bucket {
+	burst = max(burst, 1)
+
+	return &bucket{rate: rate, burst: burst, tokens: burst}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b.rate <= 0 {
+		b.tokens = b.burst
+
+		return
+	}
+
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+
+	b.last = now
+}
+
+// delay - the time until a token is available.
+func (b *bucket) delay(now time.Time) time.Duration {
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *bucket) take(now time.Time) {
+	b.refill(now)
+	b.tokens--
+}
+
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+
+	return b.tokens >= b.burst
+}
@@ -0,0 +1,300 @@
+package telegram
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueue(t *testing.T) {
+	global.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	global.Metrics = metrics.NewMetricsFake()
+
+	post := func(client *http.Client, url string, method string, chatID int64) *http.Response {
+		resp, err := client.Post(url+"/bot123/"+method, "application/json", strings.NewReader(fmt.Sprintf(`{"chat_id":"%d"}`, chatID)))
+		require.NoError(t, err)
+
+		return resp
+	}
+
+	t.Run("Priority", func(t *testing.T) {
+		var (
+			mu      sync.Mutex
+			order   []string
+			release = make(chan struct{})
+		)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+
+			mu.Lock()
+			order = append(order, r.URL.Path[len("/bot123/"):]+" "+string(body))
+			first := len(order) == 1
+			mu.Unlock()
+
+			if first {
+				<-release
+			}
+
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+		}))
+		t.Cleanup(server.Close)
+
+		queue := NewQueue(server.Client().Transport, QueueOptions{Workers: 1})
+		t.Cleanup(queue.Close)
+
+		client := queue.Client(server.Client(), PriorityAuto)
+		low := queue.Client(server.Client(), PriorityLow)
+
+		var wg sync.WaitGroup
+
+		send := func(client *http.Client, method string, chatID int64) {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				post(client, server.URL, method, chatID).Body.Close()
+			}()
+		}
+
+		// The first request occupies the only worker, the rest is queued
+		send(client, "sendMessage", 1)
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return len(order) == 1
+		}, time.Second, time.Millisecond)
+
+		send(low, "sendMessage", 2)
+		send(client, "sendMessage", 3)
+		send(client, "deleteMessage", 4)
+		require.Eventually(t, func() bool {
+			queue.mu.Lock()
+			defer queue.mu.Unlock()
+
+			return len(queue.pending[PriorityLow])+len(queue.pending[PriorityNormal])+len(queue.pending[PriorityHigh]) == 3
+		}, time.Second, time.Millisecond)
+
+		close(release)
+		wg.Wait()
+
+		require.Equal(t, []string{
+			`sendMessage {"chat_id":"1"}`,
+			`deleteMessage {"chat_id":"4"}`,
+			`sendMessage {"chat_id":"3"}`,
+			`sendMessage {"chat_id":"2"}`,
+		}, order)
+	})
+
+	t.Run("RetryAfter", func(t *testing.T) {
+		var (
+			mu       sync.Mutex
+			attempts int
+		)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			mu.Lock()
+			attempts++
+			attempt := attempts
+			mu.Unlock()
+
+			if attempt == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"ok":false,"error_code":429,"parameters":{"retry_after":0}}`))
+
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+		}))
+		t.Cleanup(server.Close)
+
+		queue := NewQueue(server.Client().Transport, QueueOptions{Workers: 1, Retries: 1})
+		t.Cleanup(queue.Close)
+
+		resp := post(queue.Client(server.Client(), PriorityAuto), server.URL, "sendMessage", 1)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, 2, attempts)
+	})
+
+	t.Run("RetriesExhausted", func(t *testing.T) {
+		const body = `{"ok":false,"error_code":429,"parameters":{"retry_after":0}}`
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(body))
+		}))
+		t.Cleanup(server.Close)
+
+		queue := NewQueue(server.Client().Transport, QueueOptions{Workers: 1, Retries: 2})
+		t.Cleanup(queue.Close)
+
+		resp := post(queue.Client(server.Client(), PriorityAuto), server.URL, "sendMessage", 1)
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		require.JSONEq(t, body, string(data))
+	})
+
+	t.Run("MaxWait", func(t *testing.T) {
+		release := make(chan struct{})
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			<-release
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+		}))
+		t.Cleanup(server.Close)
+		t.Cleanup(func() { close(release) })
+
+		queue := NewQueue(server.Client().Transport, QueueOptions{Workers: 1, MaxWait: 50 * time.Millisecond})
+		t.Cleanup(queue.Close)
+
+		client := queue.Client(server.Client(), PriorityAuto)
+
+		// The first request occupies the only worker longer than the wait of the second one
+		go func() {
+			if resp, err := client.Post(server.URL+"/bot123/sendMessage", "application/json", strings.NewReader(`{"chat_id":1}`)); err == nil {
+				resp.Body.Close()
+			}
+		}()
+
+		require.Eventually(t, func() bool {
+			return len(queue.slots) == 1
+		}, time.Second, time.Millisecond)
+
+		_, err := client.Post(server.URL+"/bot123/sendMessage", "application/json", strings.NewReader(`{"chat_id":2}`))
+		require.ErrorIs(t, err, errorQueueTimeout)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		queue := NewQueue(http.DefaultTransport, QueueOptions{Workers: 1, GlobalRate: 0.001})
+		client := queue.Client(http.DefaultClient, PriorityAuto)
+
+		// The global bucket allows the first request only, the second one waits in the queue
+		queue.mu.Lock()
+		queue.global.take(time.Now())
+		queue.mu.Unlock()
+
+		errs := make(chan error, 1)
+
+		go func() {
+			_, err := client.Post("http://localhost/bot123/sendMessage", "application/json", strings.NewReader(`{"chat_id":1}`))
+			errs <- err
+		}()
+
+		require.Eventually(t, func() bool {
+			queue.mu.Lock()
+			defer queue.mu.Unlock()
+
+			return len(queue.pending[PriorityNormal]) == 1
+		}, time.Second, time.Millisecond)
+
+		queue.Close()
+		require.ErrorIs(t, <-errs, errorQueueClosed)
+	})
+
+	t.Run("RetryAfterOfUsername", func(t *testing.T) {
+		var (
+			mu     sync.Mutex
+			chats  []string
+			failed bool
+		)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+
+			mu.Lock()
+			chats = append(chats, string(body))
+			first := !failed
+			failed = true
+			mu.Unlock()
+
+			if first {
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"ok":false,"error_code":429,"parameters":{"retry_after":60}}`))
+
+				return
+			}
+
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+		}))
+		t.Cleanup(server.Close)
+
+		queue := NewQueue(server.Client().Transport, QueueOptions{Workers: 1, Retries: 1})
+		t.Cleanup(queue.Close)
+
+		client := queue.Client(server.Client(), PriorityAuto)
+
+		// The request to the @username waits for its retry_after alone
+		go func() {
+			if resp, err := client.Post(server.URL+"/bot123/sendMessage", "application/json", strings.NewReader(`{"chat_id":"@channel"}`)); err == nil {
+				resp.Body.Close()
+			}
+		}()
+
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return failed
+		}, time.Second, time.Millisecond)
+
+		resp := post(client, server.URL, "sendMessage", 1)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestRequestChatID(t *testing.T) {
+	multipartBody := func(chatID string) (string, []byte) {
+		var buffer bytes.Buffer
+
+		writer := multipart.NewWriter(&buffer)
+		_ = writer.WriteField("caption", "captcha")
+		_ = writer.WriteField("chat_id", chatID)
+		_ = writer.Close()
+
+		return writer.FormDataContentType(), buffer.Bytes()
+	}
+
+	multipartType, multipartData := multipartBody("-100123")
+
+	testcases := []struct {
+		Name        string
+		ContentType string
+		Body        []byte
+		Expected    int64
+	}{
+		{Name: "JSON string", ContentType: "application/json", Body: []byte(`{"chat_id":"-100123","text":"hi"}`), Expected: -100123},
+		{Name: "JSON number", ContentType: "application/json", Body: []byte(`{"chat_id":42}`), Expected: 42},
+		{Name: "Username", ContentType: "application/json", Body: []byte(`{"chat_id":"@channel"}`), Expected: 0},
+		{Name: "Without chat", ContentType: "application/json", Body: []byte(`{"callback_query_id":"1"}`), Expected: 0},
+		{Name: "Multipart", ContentType: multipartType, Body: multipartData, Expected: -100123},
+		{Name: "Empty", ContentType: "", Body: nil, Expected: 0},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expected, requestChatID(tc.ContentType, tc.Body))
+		})
+	}
+}
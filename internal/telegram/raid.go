@@ -0,0 +1,381 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+var (
+	errorLockdownUsage       = errors.New("usage: /lockdown [on [duration] | off]")
+	errorLockdownPermissions = errors.New("permissions of the chat before the lockdown are unknown")
+)
+
+// raidDetector - counts the joins to each chat within the sliding window.
+type raidDetector struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	joins  map[int64][]time.Time
+}
+
+func newRaidDetector(limit int, window time.Duration) *raidDetector {
+	return &raidDetector{
+		limit:  limit,
+		window: window,
+		joins:  make(map[int64][]time.Time),
+	}
+}
+
+// record - add the joins to the chat at the time and return the joins within the window,
+// it is tripped when they reach the limit. The window is cleared after the trip,
+// so the raid going on trips it again after the next limit of joins.
+func (d *raidDetector) record(chatID int64, at time.Time, count int) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	joins := d.joins[chatID]
+
+	// Drop the joins out of the window
+	start := 0
+	for start < len(joins) && !joins[start].After(at.Add(-d.window)) {
+		start++
+	}
+
+	joins = joins[start:]
+	for range count {
+		joins = append(joins, at)
+	}
+
+	total := len(joins)
+
+	if total >= d.limit || total == 0 {
+		delete(d.joins, chatID)
+	} else {
+		d.joins[chatID] = joins
+	}
+
+	return total, total >= d.limit
+}
+
+// Raid detector middleware - count the users joining the chat and lock it down during the raid.
+func detectRaidMiddleware(db storage.Repository, detector *raidDetector, onError func(error)) tele.MiddlewareFunc {
+	return func(next tele.HandlerFunc) tele.HandlerFunc {
+		return func(c tele.Context) error {
+			msg := c.Message()
+			if msg == nil || msg.Chat == nil || !allowedChats(msg.Chat.ID) {
+				return next(c)
+			}
+
+			if joined := len(joinedUsers(msg)); joined > 0 {
+				detectRaid(c.Bot(), db.WithContext(updateContext(c)), detector, msg.Chat.ID, joined, onError)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// detectRaid - record the joins and start the lockdown, or extend the active one, when the detector is tripped.
+func detectRaid(bot *tele.Bot, db storage.Repository, detector *raidDetector, chatID int64, joined int, onError func(error)) {
+	if detector == nil {
+		return
+	}
+
+	joins, tripped := detector.record(chatID, time.Now(), joined)
+	if !tripped {
+		return
+	}
+
+	now := time.Now()
+
+	if _, err := startLockdown(bot, db, &model.Lockdown{
+		ChatID:    model.ChatID(chatID),
+		Reason:    model.LockdownReasonRaid,
+		Joins:     joins,
+		StartedAt: now,
+		EndsAt:    now.Add(global.Config.Raid.Cooldown),
+	}); err != nil && onError != nil {
+		onError(err)
+	}
+}
+
+// startLockdown - restrict the default permissions of the chat, storing the previous ones to restore them,
+// and notify the admins. The existing lockdown of the chat is extended instead, false is returned then.
+// The lockdown is started even if the bot can not restrict the permissions, the captchas are stricter anyway.
+// The permissions are not restricted, if the current ones can not be read to restore them at the end.
+// The lockdown is claimed before the permissions are read, so the concurrent start of the same chat
+// extends it and never reads the permissions already restricted by the first one.
+func startLockdown(bot *tele.Bot, db storage.Repository, lockdown *model.Lockdown) (bool, error) {
+	chatID := int64(lockdown.ChatID)
+
+	created, err := db.CreateLockdown(lockdown)
+	if err != nil {
+		return false, err
+	} else if !created {
+		if err := db.ExtendLockdown(lockdown.ChatID, lockdown.EndsAt, lockdown.Joins); err != nil {
+			return false, err
+		}
+
+		global.Metrics.LogChatEvent("lockdown_extended", chatID, map[string]interface{}{
+			"chat_id": chatID,
+			"reason":  lockdown.Reason,
+			"joins":   lockdown.Joins,
+		})
+
+		return false, nil
+	}
+
+	if chat, err := bot.ChatByID(chatID); err != nil {
+		global.Logger.Warn("telegram: reading chat permissions error", slog.String("error", err.Error()), slog.Int64("chat_id", chatID))
+	} else if chat.Permissions == nil {
+		global.Logger.Warn("telegram: reading chat permissions error", slog.String("error", errorLockdownPermissions.Error()), slog.Int64("chat_id", chatID))
+	} else {
+		permissions, err := json.Marshal(chat.Permissions)
+		if err != nil {
+			return false, err
+		}
+
+		// The members can only read the chat, the admins are not restricted
+		if err := bot.SetGroupPermissions(chat, tele.Rights{Independent: true}); err != nil {
+			global.Logger.Warn("telegram: restricting chat permissions error", slog.String("error", err.Error()), slog.Int64("chat_id", chatID))
+		} else if err := db.RestrictLockdown(lockdown.ChatID, string(permissions)); err != nil {
+			return false, err
+		} else {
+			lockdown.Restricted = true
+			lockdown.Permissions = string(permissions)
+		}
+	}
+
+	global.Logger.Warn("telegram: lockdown started",
+		slog.Int64("chat_id", chatID),
+		slog.String("reason", lockdown.Reason),
+		slog.Int("joins", lockdown.Joins),
+		slog.Time("ends_at", lockdown.EndsAt),
+	)
+
+	global.Metrics.LogChatEvent("lockdown_started", chatID, map[string]interface{}{
+		"chat_id":    chatID,
+		"reason":     lockdown.Reason,
+		"joins":      lockdown.Joins,
+		"restricted": lockdown.Restricted,
+	})
+
+	text := fmt.Sprintf("Lockdown of the chat %d started (%s) until %s.", chatID, lockdown.Reason,
+		lockdown.EndsAt.Local().Format(announcementTimeLayout))
+	if lockdown.Reason == model.LockdownReasonRaid {
+		text += fmt.Sprintf(" %d users joined within %s.", lockdown.Joins, global.Config.Raid.Window)
+	}
+
+	if !lockdown.Restricted {
+		text += " The permissions of the chat are not restricted, as the bot can not read or change them, it must be an admin allowed to ban users."
+	}
+
+	notifyAdmins(bot, text+" Send /lockdown off to the chat to end it.")
+
+	return true, nil
+}
+
+// endLockdown - restore the default permissions of the chat and delete the lockdown.
+// The lockdown stays, if the permissions can not be restored, unless the error is permanent.
+// The unknown permissions are never replaced with the full rights: the lockdown is extended
+// and the admins are notified, only the admin ending it leaves the chat restricted.
+func endLockdown(bot *tele.Bot, db storage.Repository, lockdown *model.Lockdown, reason string, byAdmin bool) error {
+	chatID := int64(lockdown.ChatID)
+
+	if lockdown.Restricted && lockdown.Permissions == "" {
+		if !byAdmin {
+			lockdown.EndsAt = time.Now().Add(global.Config.Raid.Cooldown)
+			if err := db.ExtendLockdown(lockdown.ChatID, lockdown.EndsAt, 0); err != nil {
+				return err
+			}
+
+			notifyAdmins(bot, fmt.Sprintf("Lockdown of the chat %d is kept until %s, its permissions before the lockdown are unknown."+
+				" Restore them in the chat settings and send /lockdown off to the chat to end it.",
+				chatID, lockdown.EndsAt.Local().Format(announcementTimeLayout)))
+
+			return errorLockdownPermissions
+		}
+
+		global.Logger.Warn("telegram: restoring chat permissions error", slog.String("error", errorLockdownPermissions.Error()), slog.Int64("chat_id", chatID))
+	} else if lockdown.Restricted {
+		rights := tele.Rights{}
+		if err := json.Unmarshal([]byte(lockdown.Permissions), &rights); err != nil {
+			return err
+		}
+
+		rights.Independent = true
+
+		if err := bot.SetGroupPermissions(&tele.Chat{ID: chatID}, rights); err != nil {
+			if !isPermanentError(err) {
+				return err
+			}
+
+			// The chat is gone or the bot is not an admin anymore, there is nothing to restore
+			global.Logger.Warn("telegram: restoring chat permissions error", slog.String("error", err.Error()), slog.Int64("chat_id", chatID))
+		}
+	}
+
+	if err := db.DeleteLockdown(lockdown.ChatID); err != nil {
+		return err
+	}
+
+	duration := time.Since(lockdown.StartedAt)
+
+	global.Logger.Info("telegram: lockdown ended",
+		slog.Int64("chat_id", chatID),
+		slog.String("reason", reason),
+		slog.Duration("duration", duration),
+	)
+
+	global.Metrics.LogChatEvent("lockdown_ended", chatID, map[string]interface{}{
+		"chat_id":  chatID,
+		"reason":   reason,
+		"joins":    lockdown.Joins,
+		"duration": duration.Milliseconds(),
+	})
+
+	text := fmt.Sprintf("Lockdown of the chat %d ended (%s).", chatID, reason)
+	if lockdown.Restricted && lockdown.Permissions == "" {
+		text += " Its permissions before the lockdown are unknown, restore them in the chat settings."
+	}
+
+	notifyAdmins(bot, text)
+
+	return nil
+}
+
+// EndLockdowns - end the lockdowns, whose cooldown is over, and return their number.
+func (t *Telegram) EndLockdowns(ctx context.Context) (int, error) {
+	db := t.db.WithContext(ctx)
+
+	lockdowns, err := db.Lockdowns()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		ended int
+		errs  []error
+		now   = time.Now()
+	)
+
+	for i := range lockdowns {
+		if lockdowns[i].IsActive(now) {
+			break // The earliest ending first
+		}
+
+		if err := endLockdown(t.bot, db, &lockdowns[i], "cooldown", false); err != nil {
+			errs = append(errs, fmt.Errorf("lockdown of the chat %d: %w", lockdowns[i].ChatID, err))
+
+			continue
+		}
+
+		ended++
+	}
+
+	return ended, errors.Join(errs...)
+}
+
+// captchaConfig - the captcha config of the chat, stricter in the lockdown or for the suspicious profile.
+func captchaConfig(db storage.Repository, chatID int64, strict bool) config.CaptchaConfig {
+	captcha := global.Config.Captcha
+
+	if !strict {
+		lockdown, err := db.LockdownByChatID(model.ChatID(chatID))
+		if err != nil || !lockdown.IsActive(time.Now()) {
+			return captcha
+		}
+	}
+
+	captcha.Length = max(captcha.Length, global.Config.Raid.CaptchaLength)
+	captcha.Expiration = min(captcha.Expiration, global.Config.Raid.CaptchaExpiration)
+
+	return captcha
+}
+
+// notifyAdmins - send the message to the admins of the bot, who started the private chat with it.
+func notifyAdmins(bot *tele.Bot, text string) {
+	for _, admin := range global.Config.Telegram.Admins {
+		if _, err := bot.Send(&tele.User{ID: admin}, text); err != nil {
+			global.Logger.Warn("telegram: notifying admin error", slog.String("error", err.Error()), slog.Int64("admin_id", admin))
+		}
+	}
+}
+
+// Handle the /lockdown command of the admins: show the lockdown of the chat, start it or end it.
+func onLockdown(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		chat := c.Chat()
+		if chat == nil || chat.Type == tele.ChatPrivate {
+			return c.Reply(errorLockdownUsage.Error())
+		}
+
+		db := db.WithContext(updateContext(c))
+		args := c.Args()
+
+		switch {
+		case len(args) == 0:
+			lockdown, err := db.LockdownByChatID(model.ChatID(chat.ID))
+			if errors.Is(err, storage.ErrNotFound) {
+				return c.Reply("No lockdown")
+			} else if err != nil {
+				return err
+			}
+
+			return c.Reply(fmt.Sprintf("Lockdown (%s) until %s", lockdown.Reason, lockdown.EndsAt.Local().Format(announcementTimeLayout)))
+		case strings.EqualFold(args[0], "on") && len(args) <= 2:
+			duration := global.Config.Raid.Cooldown
+
+			if len(args) == 2 {
+				var err error
+				if duration, err = time.ParseDuration(args[1]); err != nil || duration <= 0 {
+					return c.Reply(errorLockdownUsage.Error())
+				}
+			}
+
+			now := time.Now()
+
+			started, err := startLockdown(c.Bot(), db, &model.Lockdown{
+				ChatID:      model.ChatID(chat.ID),
+				Reason:      model.LockdownReasonManual,
+				StartedByID: model.UserID(c.Sender().ID),
+				StartedAt:   now,
+				EndsAt:      now.Add(duration),
+			})
+			if err != nil {
+				return err
+			} else if !started {
+				return c.Reply("Lockdown extended")
+			}
+
+			return c.Reply("Lockdown started")
+		case strings.EqualFold(args[0], "off") && len(args) == 1:
+			lockdown, err := db.LockdownByChatID(model.ChatID(chat.ID))
+			if errors.Is(err, storage.ErrNotFound) {
+				return c.Reply("No lockdown")
+			} else if err != nil {
+				return err
+			}
+
+			if err := endLockdown(c.Bot(), db, lockdown, "manual", true); err != nil {
+				return err
+			}
+
+			return c.Reply("Lockdown ended")
+		default:
+			return c.Reply(errorLockdownUsage.Error())
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package telegram
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	"github.com/plugfox/foxy-gram-server/internal/storage/memory"
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestRaidDetector(t *testing.T) {
+	type join struct {
+		ChatID  int64
+		After   time.Duration // Since the start
+		Count   int
+		Joins   int
+		Tripped bool
+	}
+
+	testcases := []struct {
+		Name  string
+		Joins []join
+	}{
+		{
+			Name: "Below the limit",
+			Joins: []join{
+				{ChatID: 1, After: 0, Count: 1, Joins: 1},
+				{ChatID: 1, After: time.Second, Count: 1, Joins: 2},
+			},
+		},
+		{
+			Name: "Tripped within the window",
+			Joins: []join{
+				{ChatID: 1, After: 0, Count: 1, Joins: 1},
+				{ChatID: 1, After: time.Second, Count: 1, Joins: 2},
+				{ChatID: 1, After: 2 * time.Second, Count: 1, Joins: 3, Tripped: true},
+			},
+		},
+		{
+			Name: "Several users in one message",
+			Joins: []join{
+				{ChatID: 1, After: 0, Count: 3, Joins: 3, Tripped: true},
+			},
+		},
+		{
+			Name: "Out of the window",
+			Joins: []join{
+				{ChatID: 1, After: 0, Count: 2, Joins: 2},
+				{ChatID: 1, After: 11 * time.Second, Count: 1, Joins: 1},
+				{ChatID: 1, After: 12 * time.Second, Count: 1, Joins: 2},
+			},
+		},
+		{
+			Name: "Counted per chat",
+			Joins: []join{
+				{ChatID: 1, After: 0, Count: 2, Joins: 2},
+				{ChatID: 2, After: time.Second, Count: 2, Joins: 2},
+				{ChatID: 1, After: 2 * time.Second, Count: 1, Joins: 3, Tripped: true},
+			},
+		},
+		{
+			Name: "Cleared after the trip",
+			Joins: []join{
+				{ChatID: 1, After: 0, Count: 3, Joins: 3, Tripped: true},
+				{ChatID: 1, After: time.Second, Count: 1, Joins: 1},
+			},
+		},
+	}
+
+	start := time.Now()
+
+	for _, tc := range testcases {
+		t.Run(tc.Name, func(t *testing.T) {
+			detector := newRaidDetector(3, 10*time.Second)
+
+			for i, j := range tc.Joins {
+				joins, tripped := detector.record(j.ChatID, start.Add(j.After), j.Count)
+				require.Equal(t, j.Joins, joins, "join %d", i)
+				require.Equal(t, j.Tripped, tripped, "join %d", i)
+			}
+		})
+	}
+}
+
+func TestEndLockdownWithUnknownPermissions(t *testing.T) {
+	global.Config = &config.Config{Raid: config.RaidConfig{Cooldown: time.Minute}}
+	global.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	global.Metrics = metrics.NewMetricsFake()
+
+	testcases := []struct {
+		Name    string
+		ByAdmin bool
+		Kept    bool
+	}{
+		{Name: "Cooldown", ByAdmin: false, Kept: true},
+		{Name: "Ended by the admin", ByAdmin: true, Kept: false},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			db := memory.New()
+
+			lockdown := &model.Lockdown{ChatID: -100, Restricted: true, StartedAt: time.Now().Add(-time.Hour), EndsAt: time.Now()}
+			require.NoError(t, db.UpsertLockdown(lockdown))
+
+			// The bot is not called, the chat permissions are left as they are
+			err := endLockdown(nil, db, lockdown, "test", testcase.ByAdmin)
+
+			stored, found := db.LockdownByChatID(lockdown.ChatID)
+			if testcase.Kept {
+				require.ErrorIs(t, err, errorLockdownPermissions)
+				require.NoError(t, found)
+				require.True(t, stored.IsActive(time.Now()))
+			} else {
+				require.NoError(t, err)
+				require.ErrorIs(t, found, storage.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestStartLockdownConcurrently(t *testing.T) {
+	global.Config = &config.Config{Raid: config.RaidConfig{Cooldown: time.Minute}}
+	global.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	global.Metrics = metrics.NewMetricsFake()
+
+	var (
+		mu          sync.Mutex
+		permissions = tele.Rights{CanSendMessages: true, CanInviteUsers: true}
+		restricted  int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getChat"):
+			chat, _ := json.Marshal(tele.Chat{ID: -100, Type: tele.ChatSuperGroup, Permissions: &permissions})
+			_, _ = w.Write([]byte(`{"ok":true,"result":` + string(chat) + `}`))
+		case strings.HasSuffix(r.URL.Path, "/setChatPermissions"):
+			permissions = tele.Rights{}
+			restricted++
+
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+		default:
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	bot, err := tele.NewBot(tele.Settings{URL: server.URL, Token: "123:test", Offline: true})
+	require.NoError(t, err)
+
+	db := memory.New()
+	now := time.Now()
+
+	var (
+		wg      sync.WaitGroup
+		started = make(chan bool, 2)
+	)
+
+	// Two trips of the same raid start the lockdown at once
+	for range 2 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ok, err := startLockdown(bot, db, &model.Lockdown{
+				ChatID:    -100,
+				Reason:    model.LockdownReasonRaid,
+				Joins:     10,
+				StartedAt: now,
+				EndsAt:    now.Add(time.Minute),
+			})
+			require.NoError(t, err)
+
+			started <- ok
+		}()
+	}
+
+	wg.Wait()
+	close(started)
+
+	count := 0
+	for ok := range started {
+		if ok {
+			count++
+		}
+	}
+
+	require.Equal(t, 1, count)
+	require.Equal(t, 1, restricted)
+
+	lockdown, err := db.LockdownByChatID(-100)
+	require.NoError(t, err)
+	require.True(t, lockdown.Restricted)
+	require.Equal(t, 20, lockdown.Joins)
+
+	var stored tele.Rights
+	require.NoError(t, json.Unmarshal([]byte(lockdown.Permissions), &stored))
+	require.True(t, stored.CanSendMessages)
+	require.True(t, stored.CanInviteUsers)
+}
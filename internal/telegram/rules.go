@@ -0,0 +1,174 @@
+package telegram
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/model"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+const (
+	rulesKeyboardUnique = "rules-keyboard"
+	maxRulesLength      = 3500 // The rules and the acceptance prompt fit into one message
+)
+
+var (
+	errorSetRulesUsage  = errors.New("usage: /setrules <text>, or reply /setrules to the message with the rules")
+	errorRulesGateUsage = errors.New("usage: /rules_gate on|off")
+	errorRulesTooLong   = errors.New("the rules are too long")
+	errorRulesNotSet    = errors.New("the rules are not set, use /setrules first")
+)
+
+// commandText - the full text after the command, including the next lines,
+// or the text of the replied message if the command has no text.
+func commandText(msg *tele.Message) string {
+	text := msg.Text
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		text = strings.TrimSpace(text[i:])
+	} else {
+		text = ""
+	}
+
+	if text == "" && msg.ReplyTo != nil {
+		text = strings.TrimSpace(msg.ReplyTo.Text)
+	}
+
+	return text
+}
+
+// chatRules - the rules of the chat, nil if the rules are not set.
+func chatRules(db storage.Repository, chatID int64) (*model.ChatRules, error) {
+	rules, err := db.ChatRulesByID(model.ChatID(chatID))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil //nolint:nilnil
+	}
+
+	return rules, err
+}
+
+// askRulesAcceptance - replace the solved captcha with the rules and the accept button.
+func askRulesAcceptance(c tele.Context, db storage.Repository, captcha *model.Captcha, rules *model.ChatRules) error {
+	if err := c.Bot().Delete(c.Message()); err != nil {
+		global.Logger.Warn("Failed to delete the message", slog.String("error", err.Error()))
+	}
+
+	reply, err := c.Bot().Send(&tele.Chat{ID: captcha.ChatID}, rules.Text+"\n\nPlease accept the rules to continue.", &tele.SendOptions{
+		ReplyMarkup: &tele.ReplyMarkup{
+			InlineKeyboard: [][]tele.InlineButton{{
+				{Text: "✅ I accept the rules", Unique: rulesKeyboardUnique, Data: "rules-accept"},
+			}},
+		},
+		DisableWebPagePreview: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The captcha is kept solved until the rules are accepted or it expires
+	captcha.MessageID = int64(reply.ID)
+	if err := db.UpsertCaptcha(captcha); err != nil {
+		return err
+	}
+
+	return c.RespondText("Captcha solved, please accept the rules.")
+}
+
+// Handle the accept button of the rules, shown after the captcha is solved.
+func onRulesAccept(db storage.Repository, onModerationError func(error)) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		user := c.Sender()
+
+		captcha, err := db.GetCaptchaForUserID(user.ID)
+		if err != nil {
+			return err
+		} else if captcha == nil || c.Message() == nil || captcha.MessageID != int64(c.Message().ID) || captcha.Input != captcha.Digits {
+			return nil // Not the rules of this user, or the captcha expired
+		}
+
+		return completeVerification(c, db, captcha, user, sql.NullTime{Time: time.Now().UTC(), Valid: true}, onModerationError)
+	}
+}
+
+// Handle the /rules command.
+func onRules(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		rules, err := chatRules(db.WithContext(updateContext(c)), c.Chat().ID)
+		if err != nil {
+			return err
+		} else if rules == nil || rules.Text == "" {
+			return c.Reply("The rules are not set.")
+		}
+
+		return c.Reply(rules.Text, tele.NoPreview)
+	}
+}
+
+// Handle the /setrules command of the admins.
+func onSetRules(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		text := commandText(c.Message())
+		if text == "" {
+			return c.Reply(errorSetRulesUsage.Error())
+		} else if utf8.RuneCountInString(text) > maxRulesLength {
+			return c.Reply(errorRulesTooLong.Error())
+		}
+
+		db := db.WithContext(updateContext(c))
+
+		rules, err := chatRules(db, c.Chat().ID)
+		if err != nil {
+			return err
+		} else if rules == nil {
+			rules = &model.ChatRules{ChatID: model.ChatID(c.Chat().ID)}
+		}
+
+		rules.Text = text
+		rules.UpdatedByID = model.UserID(c.Sender().ID)
+
+		if err := db.UpsertChatRules(rules); err != nil {
+			return err
+		}
+
+		return c.Reply("The rules are updated.")
+	}
+}
+
+// Handle the /rules_gate command of the admins, which turns the acceptance of the rules on or off.
+func onRulesGate(db storage.Repository) tele.HandlerFunc {
+	return func(c tele.Context) error {
+		args := c.Args()
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return c.Reply(errorRulesGateUsage.Error())
+		}
+
+		db := db.WithContext(updateContext(c))
+
+		rules, err := chatRules(db, c.Chat().ID)
+		if err != nil {
+			return err
+		} else if rules == nil || rules.Text == "" {
+			return c.Reply(errorRulesNotSet.Error())
+		}
+
+		rules.RequireAcceptance = args[0] == "on"
+		rules.UpdatedByID = model.UserID(c.Sender().ID)
+
+		if err := db.UpsertChatRules(rules); err != nil {
+			return err
+		}
+
+		if rules.RequireAcceptance {
+			return c.Reply("The new users accept the rules after the captcha.")
+		}
+
+		return c.Reply("The new users are verified right after the captcha.")
+	}
+}
@@ -4,13 +4,17 @@ package telegram
 
 import (
 	"bytes"
+	"database/sql"
 	"log/slog"
 	"net/http"
+	"path"
 	"time"
 
 	"github.com/plugfox/foxy-gram-server/internal/converters"
 	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/httpclient"
 	log "github.com/plugfox/foxy-gram-server/internal/log"
+	"github.com/plugfox/foxy-gram-server/internal/metrics"
 	"github.com/plugfox/foxy-gram-server/internal/model"
 	"github.com/plugfox/foxy-gram-server/internal/storage"
 
@@ -20,16 +24,40 @@ import (
 )
 
 type Telegram struct {
-	bot *tele.Bot
+	bot       *tele.Bot
+	announcer *tele.Bot // The same bot, whose requests have the low priority in the queue
+	queue     *Queue
+	db        storage.Repository
 }
 
 //nolint:funlen,gocognit,gocyclo,cyclop
-func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
+func New(db storage.Repository, httpClient *http.Client) (*Telegram, error) {
+	// Observe the Telegram Bot API calls, the method is the last segment of the URL path
+	httpClient = httpclient.WithObserver(httpClient, func(req *http.Request, duration time.Duration) {
+		global.Metrics.ObserveDuration(metrics.DurationTelegramAPI, duration, map[string]string{
+			"method": path.Base(req.URL.Path),
+		})
+	})
+
+	// Send the requests through the queue keeping the rate limits of Telegram
+	queue := NewQueue(httpClient.Transport, QueueOptions{
+		GlobalRate: global.Config.Telegram.QueueGlobalRate,
+		ChatRate:   global.Config.Telegram.QueueChatRate,
+		Workers:    global.Config.Telegram.QueueWorkers,
+		Retries:    global.Config.Telegram.QueueRetries,
+		MaxWait:    global.Config.Telegram.QueueMaxWait,
+		Timeout:    httpClient.Timeout,
+	})
+
 	pref := tele.Settings{
 		Token:  global.Config.Telegram.Token,
-		Client: httpClient,
+		Client: queue.Client(httpClient, PriorityAuto),
 		Poller: &tele.LongPoller{
 			Timeout: global.Config.Telegram.Timeout,
+			AllowedUpdates: []string{
+				"message", "edited_message", "channel_post", "edited_channel_post",
+				"callback_query", "my_chat_member", "chat_member", "chat_join_request",
+			},
 		},
 		OnError: func(err error, ctx tele.Context) {
 			global.Logger.Error("telegram error", slog.String("error", err.Error()), slog.String("context", ctx.Text()))
@@ -38,11 +66,26 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 
 	bot, err := tele.NewBot(pref)
 	if err != nil {
+		queue.Close()
+
+		return nil, err
+	}
+
+	announcer, err := tele.NewBot(tele.Settings{
+		Token:   global.Config.Telegram.Token,
+		Client:  queue.Client(httpClient, PriorityLow),
+		Offline: true,
+	})
+	if err != nil {
+		queue.Close()
+
 		return nil, err
 	}
 
 	// Global-scoped middleware:
 	bot.Use(mw.Recover())
+	bot.Use(traceUpdateMiddleware())
+	bot.Use(updateDurationMiddleware())
 	bot.Use(mw.AutoRespond())
 	bot.Use(mw.Logger(log.NewLogAdapter(global.Logger)))
 
@@ -50,21 +93,51 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 		bot.Use(mw.IgnoreVia())
 	}
 
-	bot.Use(verifyUserMiddleware(db, func(err error) {
+	bot.Use(traced("record_joins", recordJoinsMiddleware(db, func(err error) {
+		global.Logger.Error("record joins error", slog.String("error", err.Error()))
+	})))
+
+	// Lock the chat down, when many users join within the window
+	var detector *raidDetector
+	if global.Config.Raid.Joins > 0 {
+		detector = newRaidDetector(global.Config.Raid.Joins, global.Config.Raid.Window)
+
+		bot.Use(traced("detect_raid", detectRaidMiddleware(db, detector, func(err error) {
+			global.Logger.Error("detect raid error", slog.String("error", err.Error()))
+		})))
+	}
+
+	bot.Use(traced("track_members", trackMembersMiddleware(db, func(err error) {
+		global.Logger.Error("track members error", slog.String("error", err.Error()))
+	})))
+
+	if global.Config.Telegram.RecheckEdits {
+		bot.Use(traced("recheck_edits", recheckEditsMiddleware(db, func(err error) {
+			global.Logger.Error("recheck edits error", slog.String("error", err.Error()))
+		})))
+	}
+
+	bot.Use(traced("verify_user", verifyUserMiddleware(db, func(err error) {
 		global.Logger.Error("verify user error", slog.String("error", err.Error()))
-	}))
+	})))
 
-	bot.Use(verifyUserWithLocalDB(db, func(err error) {
+	bot.Use(traced("verify_user_with_local_db", verifyUserWithLocalDB(db, func(err error) {
 		global.Logger.Error("verify user with local db error", slog.String("error", err.Error()))
-	}))
+	})))
 
 	/* bot.Use(verifyUserWithCAS(db, httpClient, func(err error) {
 		global.Logger.Error("verify user with cas error", slog.String("error", err.Error()))
 	})) */
 
-	bot.Use(verifyUserWithCaptcha(db, func(err error) {
+	if global.Config.Profile.Enabled {
+		bot.Use(traced("verify_user_with_profile", verifyUserWithProfile(db, func(err error) {
+			global.Logger.Error("verify user with profile error", slog.String("error", err.Error()))
+		})))
+	}
+
+	bot.Use(traced("verify_user_with_captcha", verifyUserWithCaptcha(db, func(err error) {
 		global.Logger.Error("verify user with captcha error", slog.String("error", err.Error()))
-	}))
+	})))
 
 	if len(global.Config.Telegram.Whitelist) > 0 {
 		bot.Use(mw.Whitelist(global.Config.Telegram.Whitelist...))
@@ -75,9 +148,9 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 	}
 
 	// Store messages in the database
-	bot.Use(storeMessagesMiddleware(db, func(err error) {
+	bot.Use(traced("store_messages", storeMessagesMiddleware(db, func(err error) {
 		global.Logger.Error("store message error", slog.String("error", err.Error()))
-	}))
+	})))
 
 	// Group-scoped middleware:
 	if len(global.Config.Telegram.Admins) > 0 {
@@ -85,6 +158,15 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 		/* adminOnly.Handle("/ban", onBan)
 		adminOnly.Handle("/kick", onKick) */
 		adminOnly.Use(middleware.Whitelist(global.Config.Telegram.Admins...))
+		adminOnly.Handle("/invite_create", onInviteCreate(db))
+		adminOnly.Handle("/invite_revoke", onInviteRevoke(db))
+		adminOnly.Handle("/invite_links", onInviteLinks(db))
+		adminOnly.Handle("/setrules", onSetRules(db))
+		adminOnly.Handle("/rules_gate", onRulesGate(db))
+		adminOnly.Handle("/announce", onAnnounce(db))
+		adminOnly.Handle("/announcements", onAnnouncements(db))
+		adminOnly.Handle("/announce_cancel", onAnnounceCancel(db))
+		adminOnly.Handle("/lockdown", onLockdown(db))
 	}
 
 	const onStory = "\astory" // Custom event for story messages
@@ -108,8 +190,7 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 		tele.OnDice,
 		tele.OnChannelPost,
 		tele.OnMedia,
-		tele.OnMyChatMember,
-		tele.OnChatMember,
+		tele.OnUserLeft,
 		onStory,
 	}
 
@@ -119,6 +200,17 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 		})
 	}
 
+	bot.Handle("/rules", onRules(db))
+
+	// Verify the users requesting to join with the captcha in the private chat
+	bot.Handle(tele.OnChatJoinRequest, onChatJoinRequest(db, detector, func(err error) {
+		global.Logger.Error("join request error", slog.String("error", err.Error()))
+	}))
+
+	// Keep the membership of the users and the bot itself
+	bot.Handle(tele.OnChatMember, onChatMember(db))
+	bot.Handle(tele.OnMyChatMember, onMyChatMember(db))
+
 	go func(b *tele.Bot) {
 		// Recovery:
 		defer func() {
@@ -138,6 +230,10 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 		}
 	}(bot)
 
+	onModerationError := func(err error) {
+		global.Logger.Error("record moderation event error", slog.String("error", err.Error()))
+	}
+
 	// Handle the captcha keyboard
 	bot.Handle(&tele.Btn{Unique: captchaKeyboardUnique}, func(c tele.Context) error {
 		user := c.Sender() // Get the user who clicked the button
@@ -155,6 +251,12 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 				return err
 			}
 
+			recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventCaptchaExpired, captcha.ModeratedChatID(), captcha.UserID, ""), onModerationError)
+
+			if err := declineJoinChats(c.Bot(), db, captcha, "captcha_expired", onModerationError); err != nil {
+				global.Logger.Error("telegram: declining join request error", slog.String("error", err.Error()))
+			}
+
 			if err := c.Delete(); err != nil {
 				global.Logger.Error("telegram: deleting captcha message error", slog.String("error", err.Error()))
 			}
@@ -164,7 +266,6 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 			return nil
 		}
 
-		captcha.Expiration = global.Config.Captcha.Expiration
 		editCaption := false
 
 		switch data {
@@ -252,47 +353,57 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 
 		// Check if the captcha code is correct
 		if captcha.Validate() {
-			if err := db.VerifyUser(&model.VerifiedUser{
-				ID:         model.UserID(captcha.UserID),
-				VerifiedAt: time.Now(),
-				Reason:     "Captcha was solved",
-			}); err != nil {
-				global.Logger.Warn("Failed to verify user at database", slog.String("error", err.Error()))
-			}
-
-			if err := c.RespondText("You have been verified!"); err != nil {
-				global.Logger.Warn("Failed to respond to the user", slog.String("error", err.Error()))
-			}
+			recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventCaptchaSolved, captcha.ModeratedChatID(), captcha.UserID, "").
+				WithDuration(captcha.SolveDuration()), onModerationError)
 
-			if err := c.Bot().Delete(c.Message()); err != nil {
-				global.Logger.Warn("Failed to delete the message", slog.String("error", err.Error()))
-			}
-
-			if err := db.DeleteCaptchaByID(captcha.ID); err != nil {
-				global.Logger.Warn("Failed to delete the captcha", slog.String("error", err.Error()))
-			}
-
-			defer global.Metrics.LogChatEvent("captcha_solved", captcha.ChatID, map[string]interface{}{
-				"chat_id": captcha.ChatID,
+			defer global.Metrics.LogChatEvent("captcha_solved", captcha.ModeratedChatID(), map[string]interface{}{
+				"chat_id": captcha.ModeratedChatID(),
 				"user_id": captcha.UserID,
 			})
 
-			return nil
+			// The user accepts the rules of the chat before the verification
+			rules, err := chatRules(db, captcha.ModeratedChatID())
+			if err != nil {
+				return err
+			} else if rules.AcceptanceRequired() {
+				return askRulesAcceptance(c, db, captcha, rules)
+			}
+
+			return completeVerification(c, db, captcha, user, sql.NullTime{}, onModerationError)
 		} else if len(captcha.Input) >= len(captcha.Digits) {
 			if err := c.RespondText("Invalid captcha code. Please try again."); err != nil {
 				global.Logger.Warn("Failed to respond to the user", slog.String("error", err.Error()))
 			}
 
 			captcha.Input = ""
+			captcha.Attempts++
 			editCaption = true
 
-			defer global.Metrics.LogChatEvent("captcha_failed", captcha.ChatID, map[string]interface{}{
-				"chat_id": captcha.ChatID,
+			recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventCaptchaFailed, captcha.ModeratedChatID(), captcha.UserID, ""), onModerationError)
+
+			defer global.Metrics.LogChatEvent("captcha_failed", captcha.ModeratedChatID(), map[string]interface{}{
+				"chat_id": captcha.ModeratedChatID(),
 				"user_id": captcha.UserID,
 			})
+
+			// Too many wrong inputs, the join request is declined
+			if captcha.IsJoinRequest() && captcha.Attempts >= global.Config.Captcha.MaxAttempts {
+				if err := db.DeleteCaptchaByID(captcha.ID); err != nil {
+					return err
+				}
+
+				if err := c.Bot().Delete(c.Message()); err != nil {
+					global.Logger.Warn("Failed to delete the message", slog.String("error", err.Error()))
+				}
+
+				if err := c.Send("Too many wrong attempts, the join request is declined."); err != nil {
+					global.Logger.Warn("Failed to send the message to the user", slog.String("error", err.Error()))
+				}
+
+				return declineJoinChats(c.Bot(), db, captcha, "captcha_failed", onModerationError)
+			}
 		}
 
-		captcha.Expiration = global.Config.Captcha.Expiration // Reset the expiration time
 		if err := db.UpsertCaptcha(captcha); err != nil {
 			return err
 		}
@@ -319,11 +430,67 @@ func New(db *storage.Storage, httpClient *http.Client) (*Telegram, error) {
 		return nil
 	})
 
+	// Handle the accept button of the rules
+	bot.Handle(&tele.Btn{Unique: rulesKeyboardUnique}, onRulesAccept(db, onModerationError))
+
 	return &Telegram{
-		bot: bot,
+		bot:       bot,
+		announcer: announcer,
+		queue:     queue,
+		db:        db,
 	}, nil
 }
 
+// completeVerification - verify the user, who solved the captcha and accepted the rules if required,
+// delete the captcha, approve the join request and post the welcome message.
+func completeVerification(
+	c tele.Context,
+	db storage.Repository,
+	captcha *model.Captcha,
+	user *tele.User,
+	rulesAcceptedAt sql.NullTime,
+	onModerationError func(error),
+) error {
+	if err := db.VerifyUser(&model.VerifiedUser{
+		ID:              model.UserID(captcha.UserID),
+		VerifiedAt:      time.Now(),
+		Reason:          "Captcha was solved",
+		RulesAcceptedAt: rulesAcceptedAt,
+	}); err != nil {
+		global.Logger.Warn("Failed to verify user at database", slog.String("error", err.Error()))
+	}
+
+	if err := c.RespondText("You have been verified!"); err != nil {
+		global.Logger.Warn("Failed to respond to the user", slog.String("error", err.Error()))
+	}
+
+	if err := c.Bot().Delete(c.Message()); err != nil {
+		global.Logger.Warn("Failed to delete the message", slog.String("error", err.Error()))
+	}
+
+	if err := db.DeleteCaptchaByID(captcha.ID); err != nil {
+		global.Logger.Warn("Failed to delete the captcha", slog.String("error", err.Error()))
+	}
+
+	recordModerationEvent(db, model.NewModerationEvent(model.ModerationEventVerification, captcha.ModeratedChatID(), captcha.UserID, "captcha"), onModerationError)
+
+	welcomeChat := c.Chat()
+
+	if err := approveJoinChats(c.Bot(), db, captcha, "captcha", onModerationError); err != nil {
+		return err
+	}
+
+	if captcha.IsJoinRequest() {
+		welcomeChat = &tele.Chat{ID: captcha.JoinChatID}
+	}
+
+	if err := sendWelcome(c.Bot(), db, welcomeChat, user); err != nil {
+		global.Logger.Warn("Failed to send the welcome message", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
 // Status returns the telegram bot status.
 func (t *Telegram) Status() (string, error) {
 	return "ok", nil
@@ -350,4 +517,5 @@ func (t *Telegram) DeleteMessage(chatID int64, messageID int64) error {
 // Stop the bot.
 func (t *Telegram) Stop() {
 	t.bot.Stop()
+	t.queue.Close()
 }
@@ -0,0 +1,160 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/plugfox/foxy-gram-server/internal/global"
+	"github.com/plugfox/foxy-gram-server/internal/storage"
+	tele "gopkg.in/telebot.v3"
+)
+
+// kvWelcomeKey - key of the last welcome message of the chat in the key-value store.
+const kvWelcomeKey = "welcome#%d"
+
+// welcomeData - variables of the welcome message template.
+type welcomeData struct {
+	Name      string        // First and last name of the user
+	Username  string        // Username of the user without @, empty if the user has none
+	Mention   template.HTML // Link to the user with the name
+	UserID    int64         // ID of the user
+	ChatTitle string        // Title of the chat
+	RulesLink string        // Link to the rules of the chat
+}
+
+// newWelcomeData - variables of the welcome message for the user in the chat.
+func newWelcomeData(chat *tele.Chat, user *tele.User, rulesLink string) welcomeData {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.Username
+	}
+
+	return welcomeData{
+		Name:      name,
+		Username:  user.Username,
+		Mention:   template.HTML(fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, user.ID, template.HTMLEscapeString(name))), //nolint:gosec
+		UserID:    user.ID,
+		ChatTitle: chat.Title,
+		RulesLink: rulesLink,
+	}
+}
+
+// renderWelcome - render the welcome message template in the Telegram HTML, the variables are escaped.
+func renderWelcome(text string, data welcomeData) (string, error) {
+	tmpl, err := template.New("welcome").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", err
+	}
+
+	return builder.String(), nil
+}
+
+// welcomeMarkup - inline keyboard with the links of the welcome message, one button per row.
+func welcomeMarkup(buttons []config.WelcomeButton) *tele.ReplyMarkup {
+	if len(buttons) == 0 {
+		return nil
+	}
+
+	keyboard := make([][]tele.InlineButton, 0, len(buttons))
+	for _, button := range buttons {
+		keyboard = append(keyboard, []tele.InlineButton{{Text: button.Text, URL: button.URL}})
+	}
+
+	return &tele.ReplyMarkup{InlineKeyboard: keyboard}
+}
+
+// sendWelcome - post the welcome message of the chat for the verified user,
+// delete the previous welcome message and schedule the deletion of the new one.
+func sendWelcome(bot *tele.Bot, db storage.Repository, chat *tele.Chat, user *tele.User) error {
+	welcome := global.Config.Welcome.MessageFor(chat.ID)
+	if !welcome.IsEnabled() {
+		return nil
+	}
+
+	// The chat of the join request is known only by ID
+	if chat.Title == "" {
+		if full, err := bot.ChatByID(chat.ID); err == nil {
+			chat = full
+		}
+	}
+
+	text, err := renderWelcome(welcome.Text, newWelcomeData(chat, user, welcome.RulesLink))
+	if err != nil {
+		return err
+	}
+
+	deletePreviousWelcome(bot, db, chat.ID)
+
+	options := &tele.SendOptions{
+		ParseMode:             tele.ModeHTML,
+		ReplyMarkup:           welcomeMarkup(welcome.Buttons),
+		DisableWebPagePreview: true,
+	}
+
+	var what interface{} = text
+
+	if welcome.Photo != "" {
+		file := tele.File{FileID: welcome.Photo}
+		if strings.HasPrefix(welcome.Photo, "http://") || strings.HasPrefix(welcome.Photo, "https://") {
+			file = tele.FromURL(welcome.Photo)
+		}
+
+		what = &tele.Photo{File: file, Caption: text}
+	}
+
+	reply, err := bot.Send(chat, what, options)
+	if err != nil {
+		return err
+	}
+
+	if err := db.KVSet(fmt.Sprintf(kvWelcomeKey, chat.ID), reply.ID); err != nil {
+		global.Logger.Warn("telegram: storing welcome message error", slog.String("error", err.Error()))
+	}
+
+	if welcome.DeleteAfter > 0 {
+		time.AfterFunc(welcome.DeleteAfter, func() {
+			if err := bot.Delete(reply); err != nil {
+				global.Logger.Debug("telegram: deleting welcome message error", slog.String("error", err.Error()))
+			}
+		})
+	}
+
+	global.Metrics.LogChatEvent("welcome_sent", chat.ID, map[string]interface{}{
+		"chat_id": chat.ID,
+		"user_id": user.ID,
+	})
+
+	return nil
+}
+
+// deletePreviousWelcome - delete the last welcome message of the chat, if it is not deleted yet.
+func deletePreviousWelcome(bot *tele.Bot, db storage.Repository, chatID int64) {
+	kv, err := db.KVGet(fmt.Sprintf(kvWelcomeKey, chatID))
+	if errors.Is(err, storage.ErrNotFound) {
+		return
+	} else if err != nil {
+		global.Logger.Warn("telegram: loading welcome message error", slog.String("error", err.Error()))
+
+		return
+	}
+
+	var messageID int
+	if err := kv.GetValue(&messageID); err != nil {
+		return
+	}
+
+	// The message may be already deleted by the timer or by the admins
+	if err := bot.Delete(&tele.Message{ID: messageID, Chat: &tele.Chat{ID: chatID}}); err != nil {
+		global.Logger.Debug("telegram: deleting previous welcome message error", slog.String("error", err.Error()))
+	}
+}
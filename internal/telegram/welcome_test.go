@@ -0,0 +1,49 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tele "gopkg.in/telebot.v3"
+)
+
+func TestRenderWelcome(t *testing.T) {
+	chat := &tele.Chat{ID: -100, Title: "Foxes & Cats"}
+
+	testcases := []struct {
+		Name     string
+		Text     string
+		User     *tele.User
+		Expected string
+	}{
+		{
+			Name:     "Mention and chat title",
+			Text:     "Welcome, {{.Mention}}, to {{.ChatTitle}}!",
+			User:     &tele.User{ID: 1, FirstName: "Fox"},
+			Expected: `Welcome, <a href="tg://user?id=1">Fox</a>, to Foxes &amp; Cats!`,
+		},
+		{
+			Name:     "Name is escaped",
+			Text:     "Hi {{.Name}} {{.Mention}}",
+			User:     &tele.User{ID: 2, FirstName: "<b>Spam</b>"},
+			Expected: `Hi &lt;b&gt;Spam&lt;/b&gt; <a href="tg://user?id=2">&lt;b&gt;Spam&lt;/b&gt;</a>`,
+		},
+		{
+			Name:     "Username and rules link",
+			Text:     `{{if .Username}}@{{.Username}}, {{end}}read <a href="{{.RulesLink}}">the rules</a>`,
+			User:     &tele.User{ID: 3, Username: "fox"},
+			Expected: `@fox, read <a href="https://t.me/foxes/1">the rules</a>`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.Name, func(t *testing.T) {
+			text, err := renderWelcome(testcase.Text, newWelcomeData(chat, testcase.User, "https://t.me/foxes/1"))
+			require.NoError(t, err)
+			require.Equal(t, testcase.Expected, text)
+		})
+	}
+
+	_, err := renderWelcome("{{.Unknown", newWelcomeData(chat, &tele.User{ID: 1}, ""))
+	require.Error(t, err)
+}
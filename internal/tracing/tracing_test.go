@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/plugfox/foxy-gram-server/internal/config"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewDisabled(t *testing.T) {
+	shutdown, err := New(&config.TracingConfig{Exporter: "none"})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	_, err = New(&config.TracingConfig{Exporter: "unknown"})
+	require.ErrorIs(t, err, errorUnsupportedExporter)
+}
+
+func TestMiddlewareAndTransport(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	_, err := New(&config.TracingConfig{}) // Set up the propagator only
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Use(Middleware)
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		require.NotEmpty(t, r.Header.Get("Traceparent")) // Propagated by the transport
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := &http.Client{Transport: Transport(nil)}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+"/users/42", nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "HTTP GET /users/{id}", spans[0].Name())
+	require.Equal(t, "HTTP GET", spans[1].Name())
+	require.Equal(t, spans[1].SpanContext().TraceID(), spans[0].SpanContext().TraceID())
+	require.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}